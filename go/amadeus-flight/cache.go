@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DEFAULT_SEARCH_CACHE_TTL keeps cached searches briefly, since offer prices
+// and availability change quickly; SEARCH_CACHE_TTL_SECONDS overrides it, up
+// to MAX_SEARCH_CACHE_TTL
+const (
+	DEFAULT_SEARCH_CACHE_TTL = 2 * time.Minute
+	MAX_SEARCH_CACHE_TTL     = 15 * time.Minute
+)
+
+// SEARCH_CACHE_SIZE bounds how many searches are remembered
+const SEARCH_CACHE_SIZE = 32
+
+// searchCache holds raw flight-offers responses by request. It only lives as
+// long as the plugin instance, and is off unless SEARCH_CACHE is "true".
+type searchCache struct {
+	entries map[string]searchCacheEntry
+}
+
+type searchCacheEntry struct {
+	body    []byte
+	trip    string
+	expires time.Time
+}
+
+func newSearchCache() *searchCache {
+	return &searchCache{entries: make(map[string]searchCacheEntry, SEARCH_CACHE_SIZE)}
+}
+
+// Get returns a cached response that has not expired yet
+func (c *searchCache) Get(key string, now time.Time) ([]byte, string, bool) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, "", false
+	}
+	if !now.Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, "", false
+	}
+	return entry.body, entry.trip, true
+}
+
+// Put stores a response until now+ttl. Expired entries are dropped first;
+// if the cache is still full, the entry closest to expiring goes.
+func (c *searchCache) Put(key string, body []byte, trip string, now time.Time, ttl time.Duration) {
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= SEARCH_CACHE_SIZE {
+		var oldest string
+		for k, entry := range c.entries {
+			if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = searchCacheEntry{body: body, trip: trip, expires: now.Add(ttl)}
+}
+
+// Clear removes every entry
+func (c *searchCache) Clear() {
+	clear(c.entries)
+}
+
+var searches = newSearchCache()
+
+// isSearchCacheEnabled reports whether SEARCH_CACHE turns on search caching
+func isSearchCacheEnabled() bool {
+	return strings.EqualFold(getEnvVar("SEARCH_CACHE"), "true")
+}
+
+// searchCacheTTL reads SEARCH_CACHE_TTL_SECONDS, falling back to the default
+// when unset or invalid
+func searchCacheTTL() time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(getEnvVar("SEARCH_CACHE_TTL_SECONDS")))
+	if err != nil || seconds < 1 {
+		return DEFAULT_SEARCH_CACHE_TTL
+	}
+	return min(time.Duration(seconds)*time.Second, MAX_SEARCH_CACHE_TTL)
+}
+
+// searchCacheKey identifies a search by the request it sends. The request is
+// built from validated, normalized parameters, so searches that differ only
+// in how a value was written (e.g. "business" and "BUSINESS") or in the
+// filters applied after the response share an entry. The host and the
+// credentials are included so test and production results, or results
+// fetched with another account's credentials, are never mixed, and the
+// locale so a response in one language isn't served for another.
+func searchCacheKey(req Request) string {
+	return AMADEUS_HOST + " " + credentialsHash() + " " + req.Headers["Accept-Language"] + " " + req.Method + " " + req.PathWithQuery + " " + string(req.Body)
+}
+
+// credentialsHash identifies the credentials in use by a SHA-256 of the key
+// and secret, so a rotated secret gets fresh results without the cache
+// holding either in the clear
+func credentialsHash() string {
+	credentials := Credentials{APIKey: config.APIKey, APISecret: config.APISecret}
+	if callCredentials != nil {
+		credentials = *callCredentials
+	}
+	sum := sha256.Sum256([]byte(credentials.APIKey + "\x00" + credentials.APISecret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.bytecodealliance.org/cm"
+)
+
+func TestSearchCacheExpiry(t *testing.T) {
+	cache := newSearchCache()
+	now := time.Unix(1_700_000_000, 0)
+	cache.Put("search", []byte(`{"data":[]}`), TRIP_ONE_WAY, now, time.Minute)
+
+	body, trip, ok := cache.Get("search", now.Add(59*time.Second))
+	if !ok || string(body) != `{"data":[]}` || trip != TRIP_ONE_WAY {
+		t.Errorf("Get() before expiry = %s, %q, %v, want the stored response", body, trip, ok)
+	}
+	if _, _, ok := cache.Get("search", now.Add(time.Minute)); ok {
+		t.Error("Get() at expiry hit, want a miss")
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("%d entries left, want the expired one dropped", len(cache.entries))
+	}
+}
+
+func TestSearchCacheEviction(t *testing.T) {
+	cache := newSearchCache()
+	now := time.Unix(1_700_000_000, 0)
+	for i := range SEARCH_CACHE_SIZE {
+		cache.Put(fmt.Sprint(i), nil, TRIP_ONE_WAY, now.Add(time.Duration(i)*time.Second), time.Minute)
+	}
+
+	// Full: the entry closest to expiring makes room
+	cache.Put("new", nil, TRIP_ONE_WAY, now.Add(SEARCH_CACHE_SIZE*time.Second), 2*time.Hour)
+	if len(cache.entries) != SEARCH_CACHE_SIZE {
+		t.Errorf("%d entries, want %d", len(cache.entries), SEARCH_CACHE_SIZE)
+	}
+	if _, ok := cache.entries["0"]; ok {
+		t.Error("entry 0 kept, want it evicted as the soonest to expire")
+	}
+
+	// Expired entries go before anything live is evicted
+	later := now.Add(time.Hour)
+	cache.Put("newer", nil, TRIP_ONE_WAY, later, time.Minute)
+	if len(cache.entries) != 2 {
+		t.Errorf("%d entries, want only the two live ones", len(cache.entries))
+	}
+}
+
+func TestSearchCacheTTL(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", DEFAULT_SEARCH_CACHE_TTL},
+		{" 30 ", 30 * time.Second},
+		{"0", DEFAULT_SEARCH_CACHE_TTL},
+		{"soon", DEFAULT_SEARCH_CACHE_TTL},
+		{"3600", MAX_SEARCH_CACHE_TTL},
+	}
+	for _, tt := range tests {
+		setEnv(t, "SEARCH_CACHE_TTL_SECONDS", tt.value)
+		if got := searchCacheTTL(); got != tt.want {
+			t.Errorf("searchCacheTTL(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSearchCacheKeyCredentials(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret"})
+	req := Request{Method: "GET", PathWithQuery: FLIGHT_OFFERS_PATH + "?originLocationCode=MAD"}
+	configured := searchCacheKey(req)
+
+	release, err := useCredentials(cm.Some("other-key"), cm.Some("other-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if searchCacheKey(req) == configured {
+		t.Error("searchCacheKey() is the same for another account's credentials")
+	}
+}
+
+func TestSearchCacheKeySecret(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret"})
+	req := Request{Method: "GET", PathWithQuery: FLIGHT_OFFERS_PATH + "?originLocationCode=MAD"}
+	configured := searchCacheKey(req)
+	if strings.Contains(configured, "key") || strings.Contains(configured, "secret") {
+		t.Errorf("searchCacheKey() = %q, want the credentials hashed", configured)
+	}
+
+	config.APISecret = "rotated"
+	if searchCacheKey(req) == configured {
+		t.Error("searchCacheKey() is the same after the secret changed")
+	}
+}
+
+func TestSearchFlightsCacheMissesNewSecret(t *testing.T) {
+	setEnv(t, "SEARCH_CACHE", "true")
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	t.Cleanup(searches.Clear)
+	fake := &fakeTransport{}
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 200, body: CAPTURED_OUTBOUND_OFFERS}, fakeResponse{status: 200, body: CAPTURED_OUTBOUND_OFFERS})
+	useTransport(t, fake)
+
+	params, _ := splitLegs(roundTripParams())
+	if _, err := searchFlights(params); err != nil {
+		t.Fatal(err)
+	}
+	config.APISecret = "rotated"
+	if _, err := searchFlights(params); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.sent) != 2 {
+		t.Errorf("sent %d requests, want the search after the secret changed sent again", len(fake.sent))
+	}
+}
+
+func TestSearchFlightsCached(t *testing.T) {
+	setEnv(t, "SEARCH_CACHE", "true")
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	t.Cleanup(searches.Clear)
+	fake := &fakeTransport{}
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 200, body: CAPTURED_OUTBOUND_OFFERS})
+	useTransport(t, fake)
+
+	params, _ := splitLegs(roundTripParams())
+	for i, wantCached := range []bool{false, true} {
+		data, err := searchFlights(params)
+		if err != nil {
+			t.Fatalf("search %d: error = %v", i+1, err)
+		}
+		var result FlightSearchResult
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Cached != wantCached || len(result.Offers) == 0 {
+			t.Errorf("search %d: cached = %v with %d offers, want %v", i+1, result.Cached, len(result.Offers), wantCached)
+		}
+	}
+	if len(fake.sent) != 1 {
+		t.Errorf("sent %d requests, want the second search answered from the cache", len(fake.sent))
+	}
+}
+
+func TestSearchFlightsCacheOff(t *testing.T) {
+	setEnv(t)
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	t.Cleanup(searches.Clear)
+	fake := &fakeTransport{}
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 200, body: CAPTURED_OUTBOUND_OFFERS})
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 200, body: CAPTURED_OUTBOUND_OFFERS})
+	useTransport(t, fake)
+
+	params, _ := splitLegs(roundTripParams())
+	for range 2 {
+		if _, err := searchFlights(params); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(fake.sent) != 2 || len(searches.entries) != 0 {
+		t.Errorf("sent %d requests and cached %d, want every search sent and none kept", len(fake.sent), len(searches.entries))
+	}
+}
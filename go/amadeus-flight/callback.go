@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// CallbackDelivery is returned in place of the results when they were
+// POSTed to a callback URL instead
+type CallbackDelivery struct {
+	Delivered bool `json:"delivered"`
+	// CallbackURL has secret query parameters redacted, like request errors
+	CallbackURL    string `json:"callback_url"`
+	CallbackStatus int    `json:"callback_status"`
+	Count          int    `json:"count"`
+}
+
+// callbackHosts reads CALLBACK_HOSTS, the comma-separated hosts a callback
+// URL may point at. Each must also be allowed in noorle.yaml.
+func callbackHosts() []string {
+	var hosts []string
+	for _, host := range strings.Split(getEnvVar("CALLBACK_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// validateCallbackURL checks a callback URL is an https URL, without
+// credentials or a fragment, on one of the CALLBACK_HOSTS
+func validateCallbackURL(callbackURL string) (*url.URL, error) {
+	// The URL itself is left out of the message, since it may hold credentials
+	invalid := func(reason string) error {
+		return &PluginError{Code: ERR_INVALID_CALLBACK_URL, Message: "callback-url " + reason}
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(callbackURL))
+	if err != nil {
+		return nil, invalid("is not a valid URL")
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, invalid("must be an absolute https URL")
+	}
+	if parsed.User != nil || parsed.Fragment != "" {
+		return nil, invalid("must not contain credentials or a fragment")
+	}
+
+	allowed := callbackHosts()
+	if len(allowed) == 0 {
+		return nil, invalid("is disabled; set CALLBACK_HOSTS to the hosts callbacks may go to")
+	}
+	if !slices.Contains(allowed, strings.ToLower(parsed.Hostname())) {
+		return nil, invalid(fmt.Sprintf("host %s is not in CALLBACK_HOSTS", parsed.Hostname()))
+	}
+	return parsed, nil
+}
+
+// CALLBACK_MIDDLEWARE wraps callback deliveries. Unlike REQUEST_MIDDLEWARE
+// it has no retries: a POST that timed out or failed with a 5xx may still
+// have been processed, and a retry would deliver the results twice.
+var CALLBACK_MIDDLEWARE = []Middleware{withRequestURLs}
+
+// deliverCallback POSTs a JSON payload to a validated callback URL, in a
+// single attempt. The Amadeus token is never sent along, and the body is not
+// compressed since the receiver may not expect it.
+func deliverCallback(callback *url.URL, payload []byte, count int) (string, error) {
+	req := Request{
+		Authority:     callback.Host,
+		Method:        "POST",
+		PathWithQuery: callback.RequestURI(),
+		Headers:       map[string]string{"Content-Type": "application/json"},
+		Body:          payload,
+	}
+	response, err := chain(roundTrip, CALLBACK_MIDDLEWARE...)(req)
+	if err != nil {
+		return "", fmt.Errorf("callback delivery failed: %w", err)
+	}
+
+	data, err := marshalJSON(CallbackDelivery{
+		Delivered:      true,
+		CallbackURL:    requestURL(req),
+		CallbackStatus: response.Status,
+		Count:          count,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %v", err)
+	}
+	return string(data), nil
+}
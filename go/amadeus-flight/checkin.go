@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.bytecodealliance.org/cm"
+)
+
+const CHECKIN_LINKS_PATH = "/v2/reference-data/urls/checkin-links"
+
+// normalizeLanguage upper-cases a language code, written as a two-letter
+// language ("EN") optionally followed by a country ("EN-GB"). Empty falls
+// back to the configured locale (see defaultPresentation).
+func normalizeLanguage(language string) (string, error) {
+	language = strings.ToUpper(strings.TrimSpace(language))
+	if language == "" {
+		return strings.ToUpper(defaultPresentation().Locale), nil
+	}
+
+	lang, country, hasCountry := strings.Cut(language, "-")
+	valid := isLetters(lang, 2) && (!hasCountry || isLetters(country, 2))
+	if !valid {
+		return "", &PluginError{
+			Code:    ERR_INVALID_LANGUAGE,
+			Message: fmt.Sprintf("language %q: expected a language code like \"EN\" or \"EN-GB\"", language),
+		}
+	}
+	return language, nil
+}
+
+// isLetters reports whether s is exactly n letters A-Z
+func isLetters(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func checkinLinksPath(airlineCode string, language string) string {
+	var query QueryBuilder
+	query.Set("airlineCode", airlineCode)
+	query.Set("language", language)
+	return query.Path(CHECKIN_LINKS_PATH)
+}
+
+// normalizeCheckinLinks converts a raw Amadeus check-in links response into
+// the plugin's output format, skipping entries without a URL
+func normalizeCheckinLinks(respBody []byte, result *CheckinLinksResult) error {
+	var raw AmadeusCheckinLinksResponse
+	if err := json.Unmarshal(respBody, &raw); err != nil {
+		return fmt.Errorf("failed to parse check-in links: %v", err)
+	}
+
+	result.Links = make([]CheckinLink, 0, len(raw.Data))
+	for _, link := range raw.Data {
+		if link.Href == "" {
+			continue
+		}
+		result.Links = append(result.Links, CheckinLink{Channel: link.Channel, Href: link.Href})
+	}
+	return nil
+}
+
+// getCheckinLink looks up an airline's online check-in pages
+func getCheckinLink(airlineCode string, language string, apiKey cm.Option[string], apiSecret cm.Option[string]) (string, error) {
+	release, err := useCredentials(apiKey, apiSecret)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	// Load configuration
+	if err := loadConfig(); err != nil {
+		return "", err
+	}
+
+	airlineCode = strings.ToUpper(strings.TrimSpace(airlineCode))
+	if airlineCode == "" {
+		return "", &PluginError{Code: ERR_MISSING_REQUIRED_PARAM, Message: "airline-code is required"}
+	}
+	if err := validateAirlineCode("airline-code", airlineCode); err != nil {
+		return "", err
+	}
+	language, err = normalizeLanguage(language)
+	if err != nil {
+		return "", err
+	}
+
+	headers := map[string]string{
+		"Accept-Language": defaultPresentation().Locale,
+	}
+
+	respBody, err := authorizedRequest("GET", checkinLinksPath(airlineCode, language), headers, nil)
+	if err != nil {
+		return "", fmt.Errorf("API request failed: %w", err)
+	}
+
+	result := &CheckinLinksResult{
+		AirlineCode: airlineCode,
+		Language:    language,
+	}
+	if err := normalizeCheckinLinks(respBody, result); err != nil {
+		return "", err
+	}
+
+	data, err := marshalJSON(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %v", err)
+	}
+
+	return string(data), nil
+}
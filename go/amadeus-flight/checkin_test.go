@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go.bytecodealliance.org/cm"
+)
+
+// British Airways' check-in pages, with an entry missing its URL
+const CAPTURED_CHECKIN_LINKS = `{"meta":{"count":3},"data":[
+  {"type":"checkin-link","id":"BAEN-GBWeb","href":"https://www.britishairways.com/travel/olcilandingpageauthreq/public/en_gb","channel":"Web"},
+  {"type":"checkin-link","id":"BAEN-GBMobile","href":"https://www.britishairways.com/travel/olcilandingpageauthreq/public/en_gb/device-mobile","channel":"Mobile"},
+  {"type":"checkin-link","id":"BAEN-GBAll","channel":"All"}]}`
+
+func TestNormalizeLanguage(t *testing.T) {
+	useConfig(t, &Config{})
+	tests := map[string]string{
+		" en ":  "EN",
+		"en-gb": "EN-GB",
+		"":      "EN-US", // the configured locale, by default en-US
+	}
+	for language, want := range tests {
+		if got, err := normalizeLanguage(language); err != nil || got != want {
+			t.Errorf("normalizeLanguage(%q) = %q, %v, want %q", language, got, err, want)
+		}
+	}
+
+	for _, language := range []string{"english", "E", "EN-", "EN-GBR", "E1", "EN_GB"} {
+		var pluginErr *PluginError
+		if _, err := normalizeLanguage(language); !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_LANGUAGE {
+			t.Errorf("normalizeLanguage(%q) error = %v, want %s", language, err, ERR_INVALID_LANGUAGE)
+		}
+	}
+}
+
+func TestNormalizeCheckinLinks(t *testing.T) {
+	result := &CheckinLinksResult{AirlineCode: "BA", Language: "EN-GB"}
+	if err := normalizeCheckinLinks([]byte(CAPTURED_CHECKIN_LINKS), result); err != nil {
+		t.Fatalf("normalizeCheckinLinks() error = %v", err)
+	}
+	if len(result.Links) != 2 || result.Links[0].Channel != "Web" || result.Links[1].Channel != "Mobile" {
+		t.Errorf("links = %+v, want the web and mobile pages", result.Links)
+	}
+
+	// An airline without check-in pages gets an empty list, not null
+	result = &CheckinLinksResult{}
+	if err := normalizeCheckinLinks([]byte(`{"data":[]}`), result); err != nil || result.Links == nil {
+		t.Errorf("links = %v, %v, want an empty list", result.Links, err)
+	}
+}
+
+func TestGetCheckinLink(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	fake := &fakeTransport{}
+	fake.respond(CHECKIN_LINKS_PATH, fakeResponse{status: 200, body: CAPTURED_CHECKIN_LINKS})
+	useTransport(t, fake)
+
+	data, err := getCheckinLink(" ba ", "en-gb", cm.None[string](), cm.None[string]())
+	if err != nil {
+		t.Fatalf("getCheckinLink() error = %v", err)
+	}
+	var result CheckinLinksResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.AirlineCode != "BA" || result.Language != "EN-GB" || len(result.Links) != 2 {
+		t.Errorf("result = %+v, want BA's two pages in EN-GB", result)
+	}
+	if want := CHECKIN_LINKS_PATH + "?airlineCode=BA&language=EN-GB"; fake.sent[0].PathWithQuery != want {
+		t.Errorf("sent %q, want %q", fake.sent[0].PathWithQuery, want)
+	}
+}
+
+func TestGetCheckinLinkInvalid(t *testing.T) {
+	tests := []struct {
+		airline  string
+		language string
+		want     string
+	}{
+		{"", "EN", ERR_MISSING_REQUIRED_PARAM},
+		{"BAW", "EN", ERR_INVALID_AIRLINE_CODE},
+		{"BA", "english", ERR_INVALID_LANGUAGE},
+	}
+	for _, tt := range tests {
+		useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+		fake := &fakeTransport{}
+		useTransport(t, fake)
+
+		_, err := getCheckinLink(tt.airline, tt.language, cm.None[string](), cm.None[string]())
+		var pluginErr *PluginError
+		if !errors.As(err, &pluginErr) || pluginErr.Code != tt.want {
+			t.Errorf("getCheckinLink(%q, %q) error = %v, want %s", tt.airline, tt.language, err, tt.want)
+		}
+		if len(fake.sent) != 0 {
+			t.Errorf("getCheckinLink(%q, %q) sent %d requests, want none", tt.airline, tt.language, len(fake.sent))
+		}
+	}
+}
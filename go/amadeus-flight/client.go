@@ -0,0 +1,44 @@
+package main
+
+import "strings"
+
+// host is the authority a request is sent to
+func (req Request) host() string {
+	if req.Authority != "" {
+		return req.Authority
+	}
+	return AMADEUS_HOST
+}
+
+// makeHTTPRequest sends an API request and returns its body. POST bodies are
+// gzipped when HTTP_COMPRESS_REQUESTS is "true"; the token request bypasses
+// it, since the OAuth2 endpoint expects a plain form. HEAD requests return a
+// nil body once the status is known to be 2xx, which makes them a cheap
+// reachability probe; any other success without a body, such as a 204,
+// returns NO_CONTENT_BODY. Errors carry the redacted URL that was attempted
+// (see RequestError).
+func makeHTTPRequest(method string, pathWithQuery string, headers map[string]string, body []byte) ([]byte, error) {
+	compress := strings.EqualFold(method, "POST") && isRequestCompressionEnabled()
+	response, err := makeRequest(Request{Method: method, PathWithQuery: pathWithQuery, Headers: headers, Body: body, CompressBody: compress})
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// REQUEST_MIDDLEWARE wraps every Amadeus request, single or batched:
+// errors carry the redacted URL, a success without a body returns
+// NO_CONTENT_BODY, and transient failures are retried
+var REQUEST_MIDDLEWARE = []Middleware{withRequestURLs, withNoContent, withRetries}
+
+// makeRequest is makeHTTPRequest for a request built by the caller, such as
+// one to another host, returning the whole response
+func makeRequest(req Request) (*Response, error) {
+	return chain(roundTrip, REQUEST_MIDDLEWARE...)(req)
+}
+
+// isRequestCompressionEnabled reports whether HTTP_COMPRESS_REQUESTS asks
+// for POST bodies sent through makeHTTPRequest to be gzipped
+func isRequestCompressionEnabled() bool {
+	return strings.EqualFold(getEnvVar("HTTP_COMPRESS_REQUESTS"), "true")
+}
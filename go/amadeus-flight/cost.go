@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TripSelections are the paid extras chosen for an offer. Prices come from
+// the caller (e.g. from a seat map or a baggage quote) and must be in the
+// offer's currency; a selection may leave currency empty to mean that.
+type TripSelections struct {
+	Seats []SeatSelection `json:"seats"`
+	Bags  []BagSelection  `json:"bags"`
+}
+
+// SeatSelection is one seat for one traveler on one segment
+type SeatSelection struct {
+	SegmentID  string `json:"segment_id"`
+	TravelerID string `json:"traveler_id"`
+	SeatNumber string `json:"seat_number"`
+	Price      string `json:"price"`
+	Currency   string `json:"currency"`
+}
+
+// BagSelection is a number of extra checked bags at a price per bag
+type BagSelection struct {
+	Quantity int    `json:"quantity"`
+	Price    string `json:"price"`
+	Currency string `json:"currency"`
+}
+
+// TripCostEstimate is the response returned by estimate-trip-cost
+type TripCostEstimate struct {
+	OfferID   string `json:"offer_id"`
+	Currency  string `json:"currency"`
+	BaseFare  string `json:"base_fare"`
+	SeatCount int    `json:"seat_count"`
+	SeatsCost string `json:"seats_cost"`
+	BagCount  int    `json:"bag_count"`
+	BagsCost  string `json:"bags_cost"`
+	Total     string `json:"total"`
+}
+
+// parsePrice reads a non-negative decimal price such as "25.50"
+func parsePrice(field string, price string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(price), 64)
+	if err != nil || value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, &PluginError{
+			Code:    ERR_INVALID_SELECTION,
+			Message: fmt.Sprintf("%s must be a non-negative decimal price, got %q", field, price),
+		}
+	}
+	return value, nil
+}
+
+// checkSelectionCurrency rejects a selection priced in another currency than
+// the offer; the plugin has no exchange rates to convert it
+func checkSelectionCurrency(field string, currency string, offerCurrency string) error {
+	currency = strings.TrimSpace(currency)
+	if currency != "" && !strings.EqualFold(currency, offerCurrency) {
+		return &PluginError{
+			Code:    ERR_INVALID_SELECTION,
+			Message: fmt.Sprintf("%s is priced in %s but the offer is priced in %s", field, strings.ToUpper(currency), offerCurrency),
+		}
+	}
+	return nil
+}
+
+// estimateTripCost adds selected seats and extra bags to an offer's fare.
+// It works on an offer returned by search-flights and sends no requests.
+func estimateTripCost(offerJSON string, selectionsJSON string) (string, error) {
+	var offer FlightOffer
+	if err := json.Unmarshal([]byte(offerJSON), &offer); err != nil {
+		return "", &PluginError{Code: ERR_INVALID_OFFER, Message: fmt.Sprintf("offer is not valid JSON: %v", err)}
+	}
+	if offer.TotalPrice == "" || offer.Currency == "" {
+		return "", &PluginError{Code: ERR_INVALID_OFFER, Message: "offer must include total_price and currency, as returned by search-flights"}
+	}
+	baseFare, err := strconv.ParseFloat(offer.TotalPrice, 64)
+	if err != nil {
+		return "", &PluginError{Code: ERR_INVALID_OFFER, Message: fmt.Sprintf("offer total_price %q is not a decimal price", offer.TotalPrice)}
+	}
+
+	// No selections is a valid estimate: the fare on its own
+	var selections TripSelections
+	if strings.TrimSpace(selectionsJSON) != "" {
+		if err := json.Unmarshal([]byte(selectionsJSON), &selections); err != nil {
+			return "", &PluginError{Code: ERR_INVALID_SELECTION, Message: fmt.Sprintf("selections are not valid JSON: %v", err)}
+		}
+	}
+
+	var seatsCost float64
+	for i, seat := range selections.Seats {
+		field := fmt.Sprintf("seats[%d]", i)
+		price, err := parsePrice(field+".price", seat.Price)
+		if err != nil {
+			return "", err
+		}
+		if err := checkSelectionCurrency(field, seat.Currency, offer.Currency); err != nil {
+			return "", err
+		}
+		seatsCost += price
+	}
+
+	var bagsCost float64
+	var bagCount int
+	for i, bag := range selections.Bags {
+		field := fmt.Sprintf("bags[%d]", i)
+		if bag.Quantity < 0 {
+			return "", &PluginError{Code: ERR_INVALID_SELECTION, Message: fmt.Sprintf("%s.quantity must not be negative", field)}
+		}
+		price, err := parsePrice(field+".price", bag.Price)
+		if err != nil {
+			return "", err
+		}
+		if err := checkSelectionCurrency(field, bag.Currency, offer.Currency); err != nil {
+			return "", err
+		}
+		bagsCost += price * float64(bag.Quantity)
+		bagCount += bag.Quantity
+	}
+
+	estimate := TripCostEstimate{
+		OfferID:   offer.ID,
+		Currency:  offer.Currency,
+		BaseFare:  strconv.FormatFloat(baseFare, 'f', 2, 64),
+		SeatCount: len(selections.Seats),
+		SeatsCost: strconv.FormatFloat(seatsCost, 'f', 2, 64),
+		BagCount:  bagCount,
+		BagsCost:  strconv.FormatFloat(bagsCost, 'f', 2, 64),
+		Total:     strconv.FormatFloat(baseFare+seatsCost+bagsCost, 'f', 2, 64),
+	}
+
+	data, err := marshalJSON(estimate)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %v", err)
+	}
+	return string(data), nil
+}
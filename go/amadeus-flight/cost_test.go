@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// An offer as search-flights returns it, trimmed to the fields the estimate reads
+const TRIP_OFFER = `{"id":"1","total_price":"412.30","currency":"EUR"}`
+
+func TestEstimateTripCost(t *testing.T) {
+	setEnv(t)
+	selections := `{
+  "seats": [
+    {"segment_id":"1","traveler_id":"1","seat_number":"12A","price":"25.50","currency":"eur"},
+    {"segment_id":"2","traveler_id":"1","seat_number":"3C","price":" 18 "}
+  ],
+  "bags": [{"quantity":2,"price":"40.00","currency":"EUR"}, {"quantity":0,"price":"55"}]
+}`
+
+	data, err := estimateTripCost(TRIP_OFFER, selections)
+	if err != nil {
+		t.Fatalf("estimateTripCost() error = %v", err)
+	}
+	var estimate TripCostEstimate
+	if err := json.Unmarshal([]byte(data), &estimate); err != nil {
+		t.Fatal(err)
+	}
+	want := TripCostEstimate{
+		OfferID:   "1",
+		Currency:  "EUR",
+		BaseFare:  "412.30",
+		SeatCount: 2,
+		SeatsCost: "43.50",
+		BagCount:  2,
+		BagsCost:  "80.00",
+		Total:     "535.80",
+	}
+	if estimate != want {
+		t.Errorf("estimate = %+v, want %+v", estimate, want)
+	}
+}
+
+func TestEstimateTripCostNoSelections(t *testing.T) {
+	setEnv(t)
+	data, err := estimateTripCost(TRIP_OFFER, " ")
+	if err != nil {
+		t.Fatalf("estimateTripCost() error = %v", err)
+	}
+	var estimate TripCostEstimate
+	if err := json.Unmarshal([]byte(data), &estimate); err != nil {
+		t.Fatal(err)
+	}
+	if estimate.Total != "412.30" || estimate.SeatsCost != "0.00" || estimate.BagsCost != "0.00" {
+		t.Errorf("estimate = %+v, want the fare on its own", estimate)
+	}
+}
+
+func TestEstimateTripCostInvalid(t *testing.T) {
+	setEnv(t)
+	tests := []struct {
+		name       string
+		offer      string
+		selections string
+		code       string
+	}{
+		{"offer not json", `total 412.30`, "", ERR_INVALID_OFFER},
+		{"offer without currency", `{"id":"1","total_price":"412.30"}`, "", ERR_INVALID_OFFER},
+		{"offer price not decimal", `{"id":"1","total_price":"cheap","currency":"EUR"}`, "", ERR_INVALID_OFFER},
+		{"selections not json", TRIP_OFFER, `seats: 12A`, ERR_INVALID_SELECTION},
+		{"negative seat price", TRIP_OFFER, `{"seats":[{"price":"-5"}]}`, ERR_INVALID_SELECTION},
+		{"non-finite seat price", TRIP_OFFER, `{"seats":[{"price":"Inf"}]}`, ERR_INVALID_SELECTION},
+		{"other currency", TRIP_OFFER, `{"seats":[{"price":"20","currency":"USD"}]}`, ERR_INVALID_SELECTION},
+		{"negative bag quantity", TRIP_OFFER, `{"bags":[{"quantity":-1,"price":"40"}]}`, ERR_INVALID_SELECTION},
+		{"missing bag price", TRIP_OFFER, `{"bags":[{"quantity":1}]}`, ERR_INVALID_SELECTION},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := estimateTripCost(tt.offer, tt.selections)
+			var pluginErr *PluginError
+			if !errors.As(err, &pluginErr) || pluginErr.Code != tt.code {
+				t.Errorf("error = %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
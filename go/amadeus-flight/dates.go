@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+)
+
+// SUPPORTED_VIEW_BY are the ways Amadeus can aggregate cheapest-date results;
+// the first entry is the default
+var SUPPORTED_VIEW_BY = []string{"DATE", "DURATION", "WEEK"}
+
+// normalizeViewBy upper-cases viewBy, defaulting to DATE when it is blank
+func normalizeViewBy(viewBy string) (string, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(viewBy))
+	if normalized == "" {
+		return SUPPORTED_VIEW_BY[0], nil
+	}
+	if !slices.Contains(SUPPORTED_VIEW_BY, normalized) {
+		return "", &PluginError{
+			Code:    ERR_INVALID_VIEW_BY,
+			Message: fmt.Sprintf("unsupported view-by %q: use %s", viewBy, strings.Join(SUPPORTED_VIEW_BY, ", ")),
+		}
+	}
+	return normalized, nil
+}
+
+// flightDatesPath builds the cheapest-date search request path
+func flightDatesPath(params amadeusflightcomponent.FlightDatesParams, viewBy string) string {
+	var query QueryBuilder
+	query.Set("origin", params.Origin)
+	query.Set("destination", params.Destination)
+	query.Set("viewBy", viewBy)
+
+	if departureDate := params.DepartureDate.Some(); departureDate != nil {
+		query.Set("departureDate", strings.TrimSpace(*departureDate))
+	}
+	if oneWay := params.OneWay.Some(); oneWay != nil {
+		query.Set("oneWay", strconv.FormatBool(*oneWay))
+	}
+	if duration := params.Duration.Some(); duration != nil {
+		query.Set("duration", strings.TrimSpace(*duration))
+	}
+	if nonStop := params.NonStop.Some(); nonStop != nil {
+		query.Set("nonStop", strconv.FormatBool(*nonStop))
+	}
+	if maxPrice := params.MaxPrice.Some(); maxPrice != nil {
+		query.Set("maxPrice", strconv.Itoa(int(*maxPrice)))
+	}
+
+	return query.Path("/v1/shopping/flight-dates")
+}
+
+// normalizeFlightDates converts a raw Amadeus flight-dates response into the
+// plugin's flattened output format
+func normalizeFlightDates(respBody []byte, viewBy string) (*FlightDatesResult, error) {
+	var raw AmadeusFlightDatesResponse
+	if err := json.Unmarshal(respBody, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse flight dates: %v", err)
+	}
+
+	result := &FlightDatesResult{
+		ViewBy:   viewBy,
+		Currency: raw.Meta.Currency,
+		Dates:    make([]FlightDate, 0, len(raw.Data)),
+	}
+	for _, date := range raw.Data {
+		result.Dates = append(result.Dates, FlightDate{
+			Origin:        date.Origin,
+			Destination:   date.Destination,
+			DepartureDate: date.DepartureDate,
+			ReturnDate:    date.ReturnDate,
+			TotalPrice:    date.Price.Total,
+		})
+	}
+
+	result.Count = len(result.Dates)
+	return result, nil
+}
+
+// searchFlightDates finds the cheapest travel dates for a route
+func searchFlightDates(params amadeusflightcomponent.FlightDatesParams) (string, error) {
+	release, err := useCredentials(params.APIKey, params.APISecret)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	// Load configuration
+	if err := loadConfig(); err != nil {
+		return "", err
+	}
+
+	if err := validateIATACode("origin", params.Origin); err != nil {
+		return "", err
+	}
+	if err := validateIATACode("destination", params.Destination); err != nil {
+		return "", err
+	}
+
+	var viewBy string
+	if requested := params.ViewBy.Some(); requested != nil {
+		viewBy = *requested
+	}
+	viewBy, err = normalizeViewBy(viewBy)
+	if err != nil {
+		return "", err
+	}
+
+	// Check the callback before searching, so a bad URL costs no request
+	var callback *url.URL
+	if callbackURL := params.CallbackURL.Some(); callbackURL != nil {
+		callback, err = validateCallbackURL(*callbackURL)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	headers := map[string]string{
+		"Accept-Language": defaultPresentation().Locale,
+	}
+
+	respBody, err := authorizedRequest("GET", flightDatesPath(params, viewBy), headers, nil)
+	if err != nil {
+		return "", fmt.Errorf("API request failed: %w", err)
+	}
+
+	result, err := normalizeFlightDates(respBody, viewBy)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := marshalJSON(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %v", err)
+	}
+
+	if callback != nil {
+		return deliverCallback(callback, data, result.Count)
+	}
+	return string(data), nil
+}
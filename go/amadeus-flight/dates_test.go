@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+)
+
+func TestNormalizeViewBy(t *testing.T) {
+	tests := map[string]string{
+		"":         "DATE",
+		"  ":       "DATE",
+		"DATE":     "DATE",
+		"duration": "DURATION",
+		" Week ":   "WEEK",
+	}
+	for in, want := range tests {
+		got, err := normalizeViewBy(in)
+		if err != nil || got != want {
+			t.Errorf("normalizeViewBy(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+}
+
+func TestNormalizeViewByInvalid(t *testing.T) {
+	_, err := normalizeViewBy("MONTH")
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_VIEW_BY {
+		t.Fatalf("normalizeViewBy(MONTH) error = %v, want %s", err, ERR_INVALID_VIEW_BY)
+	}
+	if !strings.Contains(pluginErr.Message, "DATE, DURATION, WEEK") {
+		t.Errorf("message %q does not list the valid values", pluginErr.Message)
+	}
+}
+
+func TestFlightDatesPathViewBy(t *testing.T) {
+	path := flightDatesPath(amadeusflightcomponent.FlightDatesParams{Origin: "MAD", Destination: "MUC"}, "WEEK")
+	if want := "/v1/shopping/flight-dates?origin=MAD&destination=MUC&viewBy=WEEK"; path != want {
+		t.Errorf("flightDatesPath() = %q, want %q", path, want)
+	}
+}
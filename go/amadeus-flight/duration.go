@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseISODuration parses the ISO 8601 durations Amadeus uses for itinerary
+// and segment lengths, such as "PT12H30M" or "P1DT2H". Day, hour, and minute
+// components are supported, in that order and each at most once.
+func ParseISODuration(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid ISO 8601 duration %q: expected a form like PT2H30M", s)
+
+	rest, ok := strings.CutPrefix(s, "P")
+	if !ok || rest == "" {
+		return 0, invalid
+	}
+
+	var total time.Duration
+	inTime := false
+	lastUnit := -1
+	for rest != "" {
+		if rest[0] == 'T' {
+			// The time designator appears once and must be followed by a component
+			if inTime || len(rest) == 1 {
+				return 0, invalid
+			}
+			inTime = true
+			rest = rest[1:]
+			continue
+		}
+
+		digits := 0
+		for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+			digits++
+		}
+		if digits == 0 || digits == len(rest) {
+			return 0, invalid
+		}
+		n, err := strconv.ParseInt(rest[:digits], 10, 32)
+		if err != nil {
+			return 0, invalid
+		}
+
+		var unit int
+		var size time.Duration
+		switch {
+		case rest[digits] == 'D' && !inTime:
+			unit, size = 0, 24*time.Hour
+		case rest[digits] == 'H' && inTime:
+			unit, size = 1, time.Hour
+		case rest[digits] == 'M' && inTime:
+			unit, size = 2, time.Minute
+		default:
+			return 0, invalid
+		}
+		if unit <= lastUnit {
+			return 0, invalid
+		}
+		lastUnit = unit
+
+		total += time.Duration(n) * size
+		rest = rest[digits+1:]
+	}
+
+	return total, nil
+}
+
+// FormatISODuration formats d as an ISO 8601 duration in the style Amadeus
+// uses, such as "PT1H45M", dropping seconds and zero components
+func FormatISODuration(d time.Duration) string {
+	minutes := int(d / time.Minute)
+	hours, minutes := minutes/60, minutes%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("PT%dM", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("PT%dH", hours)
+	default:
+		return fmt.Sprintf("PT%dH%dM", hours, minutes)
+	}
+}
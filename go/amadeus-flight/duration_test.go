@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"PT2H":      2 * time.Hour,
+		"PT45M":     45 * time.Minute,
+		"PT1H5M":    time.Hour + 5*time.Minute,
+		"PT12H30M":  12*time.Hour + 30*time.Minute,
+		"P1DT2H":    26 * time.Hour,
+		"P2D":       48 * time.Hour,
+		"PT0M":      0,
+		"PT100H":    100 * time.Hour,
+		"P1DT1H15M": 25*time.Hour + 15*time.Minute,
+	}
+	for in, want := range tests {
+		got, err := ParseISODuration(in)
+		if err != nil {
+			t.Errorf("ParseISODuration(%q) error = %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseISODuration(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestParseISODurationMalformed(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"P",
+		"PT",
+		"2H",
+		"PT2",
+		"PTH",
+		"PT2H2H",
+		"PT30M2H",
+		"P2H",
+		"PT1D",
+		"P1DT",
+		"PTT2H",
+		"PT-2H",
+		"PT2S",
+		"pt2h",
+		"PT99999999999H",
+	} {
+		if got, err := ParseISODuration(in); err == nil {
+			t.Errorf("ParseISODuration(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestFormatISODuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                               "PT0M",
+		45 * time.Minute:                "PT45M",
+		2 * time.Hour:                   "PT2H",
+		time.Hour + 45*time.Minute:      "PT1H45M",
+		26 * time.Hour:                  "PT26H",
+		90*time.Minute + 30*time.Second: "PT1H30M",
+	}
+	for in, want := range tests {
+		if got := FormatISODuration(in); got != want {
+			t.Errorf("FormatISODuration(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestISODurationRoundTrip(t *testing.T) {
+	for _, in := range []string{"PT2H", "PT45M", "PT1H5M", "PT12H30M"} {
+		d, err := ParseISODuration(in)
+		if err != nil {
+			t.Fatalf("ParseISODuration(%q) error = %v", in, err)
+		}
+		if got := FormatISODuration(d); got != in {
+			t.Errorf("FormatISODuration(ParseISODuration(%q)) = %q", in, got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+//go:build tinygo
+
+package main
+
+import (
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// The exports are only registered in the TinyGo build. They reach every WASI
+// import the plugin uses, so leaving them out lets go test build the package
+// on the host and exercise the helpers against stand-ins (see wasi_other.go).
+func init() {
+	amadeusflightcomponent.Exports.SearchFlights = func(params amadeusflightcomponent.FlightSearchParams) string {
+		startRequest()
+		result, err := searchFlights(params)
+		if err != nil {
+			return errorJSON("Failed to search flights", err)
+		}
+		return result
+	}
+	amadeusflightcomponent.Exports.SearchFlightsJsonl = func(params amadeusflightcomponent.FlightSearchParams) string {
+		startRequest()
+		result, err := searchFlightsJSONL(params)
+		if err != nil {
+			return errorJSON("Failed to search flights", err)
+		}
+		return result
+	}
+	amadeusflightcomponent.Exports.SearchMultiCity = func(params amadeusflightcomponent.MultiCityParams) string {
+		startRequest()
+		result, err := searchMultiCity(params)
+		if err != nil {
+			return errorJSON("Failed to search multi-city flights", err)
+		}
+		return result
+	}
+	amadeusflightcomponent.Exports.SearchFlightDates = func(params amadeusflightcomponent.FlightDatesParams) string {
+		startRequest()
+		result, err := searchFlightDates(params)
+		if err != nil {
+			return errorJSON("Failed to search flight dates", err)
+		}
+		return result
+	}
+	amadeusflightcomponent.Exports.GetPriceMetrics = func(origin string, destination string, departureDate string, apiKey cm.Option[string], apiSecret cm.Option[string]) string {
+		startRequest()
+		result, err := getPriceMetrics(origin, destination, departureDate, apiKey, apiSecret)
+		if err != nil {
+			return errorJSON("Failed to get price metrics", err)
+		}
+		return result
+	}
+	amadeusflightcomponent.Exports.GetCheckinLink = func(airlineCode string, language string, apiKey cm.Option[string], apiSecret cm.Option[string]) string {
+		startRequest()
+		result, err := getCheckinLink(airlineCode, language, apiKey, apiSecret)
+		if err != nil {
+			return errorJSON("Failed to get check-in links", err)
+		}
+		return result
+	}
+	amadeusflightcomponent.Exports.PriceFlightOffer = func(params amadeusflightcomponent.FlightSearchParams, offerID string, includeFareRules bool) string {
+		startRequest()
+		result, err := priceFlightOffer(params, offerID, includeFareRules)
+		if err != nil {
+			return errorJSON("Failed to price flight offer", err)
+		}
+		return result
+	}
+	amadeusflightcomponent.Exports.EstimateTripCost = func(offerJSON string, selectionsJSON string) string {
+		startRequest()
+		result, err := estimateTripCost(offerJSON, selectionsJSON)
+		if err != nil {
+			return errorJSON("Failed to estimate trip cost", err)
+		}
+		return result
+	}
+	amadeusflightcomponent.Exports.SummarizeSearch = func(searchJSON string) string {
+		startRequest()
+		result, err := summarizeSearch(searchJSON)
+		if err != nil {
+			return errorJSON("Failed to summarize search", err)
+		}
+		return result
+	}
+	amadeusflightcomponent.Exports.ClearCaches = clearCaches
+	amadeusflightcomponent.Exports.ValidateKey = func() string {
+		startRequest()
+		result, err := validateKey()
+		if err != nil {
+			return errorJSON("Failed to validate credentials", err)
+		}
+		return result
+	}
+	amadeusflightcomponent.Exports.SupportedTravelClasses = supportedTravelClasses
+	amadeusflightcomponent.Exports.RequiredEnv = func() string {
+		data, _ := marshalJSON(REQUIRED_ENV)
+		return string(data)
+	}
+	amadeusflightcomponent.Exports.SearchSplitFlights = func(params amadeusflightcomponent.FlightSearchParams) string {
+		startRequest()
+		result, err := searchSplitFlights(params)
+		if err != nil {
+			return errorJSON("Failed to search split flights", err)
+		}
+		return result
+	}
+}
@@ -2,6 +2,9 @@ module github.com/my_org/amadeus-flight
 
 go 1.23.0
 
-require go.bytecodealliance.org/cm v0.3.0
+require (
+	github.com/andybalholm/brotli v1.1.1
+	go.bytecodealliance.org/cm v0.3.0
+)
 
 replace github.com/my_org/amadeus-flight => ./
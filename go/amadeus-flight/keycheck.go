@@ -0,0 +1,37 @@
+package main
+
+import "errors"
+
+// KeyValidation is returned by validate-key. Reason explains rejected
+// credentials.
+type KeyValidation struct {
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// validateKey fetches an access token for the configured credentials, the
+// cheapest call that proves them, and reports whether Amadeus accepted
+// them. The cached token is neither used nor replaced. Failures other than
+// rejected credentials are returned as errors, since they say nothing about
+// the credentials.
+func validateKey() (string, error) {
+	if err := loadConfig(); err != nil {
+		return "", err
+	}
+
+	validation := KeyValidation{Valid: true}
+	_, err := fetchToken(Credentials{APIKey: config.APIKey, APISecret: config.APISecret})
+	if err != nil {
+		var pluginErr *PluginError
+		if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_API_KEY {
+			return "", err
+		}
+		validation = KeyValidation{Valid: false, Reason: pluginErr.Message}
+	}
+
+	data, err := marshalJSON(validation)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
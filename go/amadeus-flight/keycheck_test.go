@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateKey(t *testing.T) {
+	expiration := time.Now().Unix() + 600
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "cached", Expiration: expiration})
+	fake := &fakeTransport{}
+	fake.respond(TOKEN_PATH, tokenResponse("fresh"))
+	useTransport(t, fake)
+
+	result, err := validateKey()
+	if err != nil {
+		t.Fatalf("validateKey() error = %v", err)
+	}
+	if result != `{"valid":true}` {
+		t.Errorf("validateKey() = %s, want valid", result)
+	}
+	// A token is fetched even though one is cached, and the cached one is kept
+	if len(fake.sent) != 1 || !strings.Contains(string(fake.sent[0].Body), "client_id=key") {
+		t.Errorf("sent %d requests, want one token request for the configured key", len(fake.sent))
+	}
+	if config.Token != "cached" || config.Expiration != expiration {
+		t.Errorf("config token = %q expiring %d, want the cached token untouched", config.Token, config.Expiration)
+	}
+}
+
+func TestValidateKeyRejected(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "wrong"})
+	fake := &fakeTransport{}
+	fake.respond(TOKEN_PATH, fakeResponse{
+		status: 401,
+		body:   `{"error":"invalid_client","error_description":"Client credentials are invalid","code":38187,"title":"Invalid parameters"}`,
+	})
+	useTransport(t, fake)
+
+	result, err := validateKey()
+	if err != nil {
+		t.Fatalf("validateKey() error = %v, want rejected credentials reported", err)
+	}
+	var validation KeyValidation
+	if err := json.Unmarshal([]byte(result), &validation); err != nil {
+		t.Fatal(err)
+	}
+	if validation.Valid || !strings.Contains(validation.Reason, "Client credentials are invalid") {
+		t.Errorf("validation = %+v, want invalid with Amadeus's description", validation)
+	}
+}
+
+func TestValidateKeyUpstreamFailure(t *testing.T) {
+	tests := map[string]fakeResponse{
+		"server error": {status: 503},
+		// A request that never got an answer says no more about the credentials
+		"transport error": {err: errors.New("connection reset")},
+	}
+	for name, response := range tests {
+		t.Run(name, func(t *testing.T) {
+			setEnv(t, "HTTP_MAX_ATTEMPTS", "1")
+			useConfig(t, &Config{APIKey: "key", APISecret: "secret"})
+			fake := &fakeTransport{}
+			fake.respond(TOKEN_PATH, response)
+			useTransport(t, fake)
+
+			// An outage says nothing about the credentials, so it is an error
+			result, err := validateKey()
+			var pluginErr *PluginError
+			if err == nil || errors.As(err, &pluginErr) && pluginErr.Code == ERR_INVALID_API_KEY {
+				t.Errorf("validateKey() = %s, %v, want an error other than %s", result, err, ERR_INVALID_API_KEY)
+			}
+			if result == `{"valid":true}` {
+				t.Errorf("validateKey() = %s, want no verdict", result)
+			}
+		})
+	}
+}
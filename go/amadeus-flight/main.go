@@ -1,26 +1,37 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
-	"github.com/my_org/amadeus-flight/gen/wasi/cli/environment"
-	outgoinghandler "github.com/my_org/amadeus-flight/gen/wasi/http/outgoing-handler"
-	"github.com/my_org/amadeus-flight/gen/wasi/http/types"
-	"github.com/my_org/amadeus-flight/gen/wasi/io/poll"
 	"go.bytecodealliance.org/cm"
 )
 
 var AMADEUS_HOST string
 
+// AMADEUS_ENV_HOSTS maps AMADEUS_ENV values to their API hosts, used when
+// AMADEUS_HOST is not set explicitly
+var AMADEUS_ENV_HOSTS = map[string]string{
+	"test":       "test.api.amadeus.com",
+	"production": "api.amadeus.com",
+}
+
 type Config struct {
-	APIKey     string
-	APISecret  string
-	Token      string
-	Expiration int64
+	APIKey          string
+	APISecret       string
+	Token           string
+	Expiration      int64
+	DefaultCurrency string
+	DefaultLocale   string
 }
 
 type TokenResponse struct {
@@ -31,153 +42,323 @@ type TokenResponse struct {
 
 var config = &Config{}
 
-func makeHTTPRequest(method string, pathWithQuery string, headers map[string]string, body []byte) ([]byte, error) {
-	// Create headers
-	headersFields := types.NewFields()
-	userAgent := cm.ToList([]uint8("Mozilla/5.0 (compatible; noorle/1.0)"))
-	headersFields.Append(types.FieldKey("User-Agent"), types.FieldValue(userAgent))
+// Credentials are an Amadeus API key and secret
+type Credentials struct {
+	APIKey    string
+	APISecret string
+}
 
-	for key, value := range headers {
-		valueBytes := cm.ToList([]uint8(value))
-		headersFields.Append(types.FieldKey(key), types.FieldValue(valueBytes))
-	}
+// callCredentials override the configured credentials for the export call
+// in progress, or are nil to use config. Their token lives in callToken and
+// is dropped when the call ends, so one tenant's token never leaks into
+// another's call.
+var callCredentials *Credentials
+var callToken string
+
+// useCredentials applies a per-call credential override from an export's
+// parameters. Key and secret must be given together. The returned function
+// restores the configured credentials and must be deferred by the caller.
+func useCredentials(apiKey cm.Option[string], apiSecret cm.Option[string]) (func(), error) {
+	var key, secret string
+	if value := apiKey.Some(); value != nil {
+		key = strings.TrimSpace(*value)
+	}
+	if value := apiSecret.Some(); value != nil {
+		secret = strings.TrimSpace(*value)
+	}
+	if key == "" && secret == "" {
+		return func() {}, nil
+	}
+	if key == "" || secret == "" {
+		return nil, &PluginError{Code: ERR_MISSING_REQUIRED_PARAM, Message: "api-key and api-secret must be given together"}
+	}
+
+	callCredentials = &Credentials{APIKey: key, APISecret: secret}
+	callToken = ""
+	return func() {
+		callCredentials = nil
+		callToken = ""
+	}, nil
+}
 
-	// Create the request
-	request := types.NewOutgoingRequest(headersFields)
+// ClearCachesResponse confirms which caches clear-caches emptied
+type ClearCachesResponse struct {
+	Cleared []string `json:"cleared"`
+}
 
-	// Set request properties
-	var httpMethod types.Method
-	switch strings.ToUpper(method) {
-	case "GET":
-		httpMethod = types.MethodGet()
-	case "POST":
-		httpMethod = types.MethodPost()
-	default:
-		httpMethod = types.MethodGet()
-	}
+// clearCaches drops the cached access token, configuration, and search
+// results, so the next call re-reads the environment and fetches a fresh
+// token. Useful after rotating credentials; safe to call at any time.
+func clearCaches() string {
+	startRequest()
 
-	request.SetMethod(httpMethod)
-	request.SetScheme(cm.Some(types.SchemeHTTPS()))
-	request.SetAuthority(cm.Some(AMADEUS_HOST))
-	request.SetPathWithQuery(cm.Some(pathWithQuery))
+	config = &Config{}
+	AMADEUS_HOST = ""
+	searches.Clear()
 
-	// Write body for POST requests
-	if method == "POST" && body != nil && len(body) > 0 {
-		bodyResult := request.Body()
-		if bodyResult.IsErr() {
-			return nil, fmt.Errorf("failed to get request body: %v", bodyResult.Err())
-		}
-		outgoingBody := bodyResult.OK()
+	result, _ := marshalJSON(ClearCachesResponse{Cleared: []string{"token", "config", "search"}})
+	return string(result)
+}
 
-		streamResult := outgoingBody.Write()
-		if streamResult.IsErr() {
-			outgoingBody.ResourceDrop()
-			return nil, fmt.Errorf("failed to get body stream: %v", streamResult.Err())
-		}
-		bodyStream := streamResult.OK()
+// Machine-readable codes returned in the "code" field of error responses
+const (
+	ERR_INVALID_API_KEY         = "INVALID_API_KEY"
+	ERR_INVALID_CURRENCY        = "INVALID_CURRENCY"
+	ERR_INVALID_TRAVEL_CLASS    = "INVALID_TRAVEL_CLASS"
+	ERR_INVALID_VIEW_BY         = "INVALID_VIEW_BY"
+	ERR_MISSING_REQUIRED_PARAM  = "MISSING_REQUIRED_PARAM"
+	ERR_INVALID_IATA_CODE       = "INVALID_IATA_CODE"
+	ERR_INVALID_SOURCE          = "INVALID_SOURCE"
+	ERR_INVALID_TIME_WINDOW     = "INVALID_TIME_WINDOW"
+	ERR_INVALID_AIRLINE_CODE    = "INVALID_AIRLINE_CODE"
+	ERR_INVALID_OFFER           = "INVALID_OFFER"
+	ERR_INVALID_SELECTION       = "INVALID_SELECTION"
+	ERR_INVALID_SEARCH_RESULT   = "INVALID_SEARCH_RESULT"
+	ERR_OFFER_NOT_FOUND         = "OFFER_NOT_FOUND"
+	ERR_INVALID_LEGS            = "INVALID_LEGS"
+	ERR_INVALID_TRAVELERS       = "INVALID_TRAVELERS"
+	ERR_ENVIRONMENT_UNAVAILABLE = "ENVIRONMENT_UNAVAILABLE"
+	ERR_INVALID_WEIGHTS         = "INVALID_WEIGHTS"
+	ERR_INVALID_LANGUAGE        = "INVALID_LANGUAGE"
+	ERR_INVALID_LOCALE          = "INVALID_LOCALE"
+	ERR_INVALID_CALLBACK_URL    = "INVALID_CALLBACK_URL"
+)
 
-		// Write the body data
-		writeResult := bodyStream.BlockingWriteAndFlush(cm.ToList(body))
-		if writeResult.IsErr() {
-			bodyStream.ResourceDrop()
-			outgoingBody.ResourceDrop()
-			return nil, fmt.Errorf("failed to write body: %v", writeResult.Err())
-		}
+// SUPPORTED_TRAVEL_CLASSES are the cabin classes Amadeus accepts for travelClass
+var SUPPORTED_TRAVEL_CLASSES = []string{"ECONOMY", "PREMIUM_ECONOMY", "BUSINESS", "FIRST"}
+
+// SUPPORTED_SOURCES are the inventory sources Amadeus accepts for sources
+var SUPPORTED_SOURCES = []string{"GDS"}
 
-		// Drop the stream first
-		bodyStream.ResourceDrop()
+// ErrorResponse is the JSON shape returned by exports when a call fails
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	Code      string `json:"code,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
 
-		// Finish the body (this consumes the outgoing body)
-		finishResult := types.OutgoingBodyFinish(*outgoingBody, cm.None[types.Trailers]())
-		if finishResult.IsErr() {
-			// Don't drop outgoingBody here since Finish consumes it
-			return nil, fmt.Errorf("failed to finish body: %v", finishResult.Err())
+// PluginError is an error carrying a machine-readable code so hosts can
+// tell failure modes apart without parsing messages
+type PluginError struct {
+	Code    string
+	Message string
+}
+
+func (e *PluginError) Error() string {
+	return e.Message
+}
+
+// TokenErrorResponse is the OAuth2 error payload returned by the token endpoint
+type TokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func getEnvVar(name string) string {
+	envVars := environ()
+	for _, env := range envVars {
+		if env[0] == name {
+			return env[1]
 		}
-		// Don't drop outgoingBody here either since Finish consumed it
 	}
+	return ""
+}
 
-	// Send the request
-	futureResponseResult := outgoinghandler.Handle(request, cm.None[types.RequestOptions]())
-	if futureResponseResult.IsErr() {
-		return nil, fmt.Errorf("failed to handle request: %v", futureResponseResult.Err())
+// getSecretEnvVar reads a secret from name, or when that is unset from
+// name_B64, base64-decoded, for secret stores that inject encoded values.
+// Whitespace around the decoded value, such as the newline `echo key |
+// base64` encodes, is trimmed.
+func getSecretEnvVar(name string) (string, error) {
+	if value := getEnvVar(name); value != "" {
+		return value, nil
+	}
+	encoded := strings.TrimSpace(getEnvVar(name + "_B64"))
+	if encoded == "" {
+		return "", nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", &PluginError{
+			Code:    ERR_INVALID_API_KEY,
+			Message: fmt.Sprintf("%s_B64 is not valid base64: %v", name, err),
+		}
 	}
-	futureResponse := futureResponseResult.OK()
-	defer futureResponse.ResourceDrop()
+	return strings.TrimSpace(string(decoded)), nil
+}
 
-	// Subscribe to the response
-	pollable := futureResponse.Subscribe()
-	defer pollable.ResourceDrop()
+// REQUIRED_ENV lists the variables loadConfig can't do without; keep it in
+// step with loadConfig and resolveHost. AMADEUS_ENV can stand in for
+// AMADEUS_HOST, and per-call credentials for the key and secret.
+var REQUIRED_ENV = []string{"AMADEUS_HOST", "AMADEUS_API_KEY", "AMADEUS_API_SECRET"}
 
-	// Wait for the response
-	poll.Poll(cm.ToList([]types.Pollable{pollable}))
+// environmentAvailable reports whether the host passed the plugin any
+// environment at all. A host that denies environment access hands over an
+// empty list, which would otherwise look like every variable being unset.
+func environmentAvailable() bool {
+	return len(environ()) > 0
+}
 
-	// Get the response
-	optionResult := futureResponse.Get()
-	result := optionResult.Some()
-	if result == nil {
-		return nil, fmt.Errorf("request timed out")
+// normalizeCurrency upper-cases a currency code and checks it has the
+// three-letter ISO 4217 shape
+func normalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	valid := len(code) == 3
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			valid = false
+		}
 	}
-
-	// Handle the response
-	if result.IsErr() {
-		return nil, fmt.Errorf("request failed: %v", result.Err())
+	if !valid {
+		return "", &PluginError{
+			Code:    ERR_INVALID_CURRENCY,
+			Message: fmt.Sprintf("invalid currency code %q: expected a 3-letter ISO 4217 code", code),
+		}
 	}
+	return code, nil
+}
 
-	responseResult := result.OK()
-	if responseResult.IsErr() {
-		return nil, fmt.Errorf("HTTP error: %v", responseResult.Err())
+// normalizeTravelClass maps a travel class such as "premium-economy" to the
+// Amadeus spelling and checks it is supported
+func normalizeTravelClass(class string) (string, error) {
+	normalized := strings.ReplaceAll(strings.ToUpper(strings.TrimSpace(class)), "-", "_")
+	if !slices.Contains(SUPPORTED_TRAVEL_CLASSES, normalized) {
+		return "", &PluginError{
+			Code:    ERR_INVALID_TRAVEL_CLASS,
+			Message: fmt.Sprintf("unsupported travel class %q: use %s", class, strings.Join(SUPPORTED_TRAVEL_CLASSES, ", ")),
+		}
 	}
+	return normalized, nil
+}
 
-	response := responseResult.OK()
-	defer response.ResourceDrop()
+// supportedTravelClasses lists the cabin classes normalizeTravelClass
+// accepts, for hosts building a picker
+func supportedTravelClasses() string {
+	data, _ := marshalJSON(SUPPORTED_TRAVEL_CLASSES)
+	return string(data)
+}
 
-	// Check status
-	status := response.Status()
+// resolveHost picks the Amadeus host: an explicit AMADEUS_HOST wins,
+// otherwise AMADEUS_ENV selects the test or production host
+func resolveHost() (string, error) {
+	if host := getEnvVar("AMADEUS_HOST"); host != "" {
+		return host, nil
+	}
 
-	// Consume the body
-	bodyResult := response.Consume()
-	if bodyResult.IsErr() {
-		return nil, fmt.Errorf("failed to consume body: %v", bodyResult.Err())
+	env := strings.ToLower(strings.TrimSpace(getEnvVar("AMADEUS_ENV")))
+	if env == "" {
+		return "", fmt.Errorf("AMADEUS_HOST or AMADEUS_ENV environment variable is required")
 	}
-	bodyResource := bodyResult.OK()
-	defer bodyResource.ResourceDrop()
+	host, ok := AMADEUS_ENV_HOSTS[env]
+	if !ok {
+		return "", fmt.Errorf("AMADEUS_ENV must be \"test\" or \"production\", got %q", env)
+	}
+	return host, nil
+}
 
-	streamResult := bodyResource.Stream()
-	if streamResult.IsErr() {
-		return nil, fmt.Errorf("failed to get stream: %v", streamResult.Err())
+// validateIATACode checks a required location code is present and has the
+// three-uppercase-letter IATA shape; field names the WIT parameter
+func validateIATACode(field string, code string) error {
+	if strings.TrimSpace(code) == "" {
+		return &PluginError{Code: ERR_MISSING_REQUIRED_PARAM, Message: fmt.Sprintf("%s is required", field)}
+	}
+	valid := len(code) == 3
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			valid = false
+		}
+	}
+	if !valid {
+		return &PluginError{
+			Code:    ERR_INVALID_IATA_CODE,
+			Message: fmt.Sprintf("%s %q is not an IATA code: expected 3 uppercase letters, e.g. \"JFK\"", field, code),
+		}
 	}
-	streamRes := streamResult.OK()
-	defer streamRes.ResourceDrop()
+	return nil
+}
 
-	// Read the body
-	var respBody []byte
-	for {
-		readResult := streamRes.BlockingRead(65536)
-		if readResult.IsErr() {
-			err := readResult.Err()
-			if err.Closed() {
-				break
-			}
-			return nil, fmt.Errorf("failed to read response body: %v", err)
+// validateSearchParams checks the required search fields up front, since
+// Amadeus answers empty values with a cryptic error
+func validateSearchParams(params amadeusflightcomponent.FlightSearchParams) error {
+	if err := validateIATACode("origin-location-code", params.OriginLocationCode); err != nil {
+		return err
+	}
+	if err := validateIATACode("destination-location-code", params.DestinationLocationCode); err != nil {
+		return err
+	}
+	if strings.TrimSpace(params.DepartureDate) == "" {
+		return &PluginError{Code: ERR_MISSING_REQUIRED_PARAM, Message: "departure-date is required"}
+	}
+	if err := validateTravelers(params.Adults, params.Infants); err != nil {
+		return err
+	}
+	if window := params.DepartureTimeWindow.Some(); window != nil {
+		if _, err := parseTimeWindow(*window); err != nil {
+			return err
 		}
-		respBody = append(respBody, readResult.OK().Slice()...)
 	}
+	if avoid := params.AvoidAirports.Some(); avoid != nil {
+		if _, err := parseAirportList("avoid-airports", *avoid); err != nil {
+			return err
+		}
+	}
+	if require := params.RequireConnectionVia.Some(); require != nil {
+		if _, err := parseAirportList("require-connection-via", *require); err != nil {
+			return err
+		}
+	}
+	if weights := params.ValueWeights.Some(); weights != nil {
+		if err := validateValueWeights(*weights); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if status < 200 || status >= 300 {
-		return nil, fmt.Errorf("HTTP error: status code %d, body: %s", status, string(respBody))
+// normalizeSource upper-cases an inventory source and checks it is supported
+func normalizeSource(source string) (string, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(source))
+	if !slices.Contains(SUPPORTED_SOURCES, normalized) {
+		return "", &PluginError{
+			Code:    ERR_INVALID_SOURCE,
+			Message: fmt.Sprintf("unsupported source %q: use %s", source, strings.Join(SUPPORTED_SOURCES, ", ")),
+		}
 	}
+	return normalized, nil
+}
 
-	return respBody, nil
+// normalizeAirlineCodes cleans a comma-separated list of IATA airline codes:
+// spaces and empty entries are dropped and codes are upper-cased. Each code
+// must be two letters or digits (e.g. "BA", "U2").
+func normalizeAirlineCodes(field string, codes string) (string, error) {
+	var normalized []string
+	for _, code := range strings.Split(codes, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		if err := validateAirlineCode(field, code); err != nil {
+			return "", err
+		}
+		normalized = append(normalized, code)
+	}
+	return strings.Join(normalized, ","), nil
 }
 
-func getEnvVar(name string) string {
-	envVars := environment.GetEnvironment().Slice()
-	for _, env := range envVars {
-		if env[0] == name {
-			return env[1]
+// validateAirlineCode checks an upper-cased code is two letters or digits
+func validateAirlineCode(field string, code string) error {
+	valid := len(code) == 2
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			valid = false
 		}
 	}
-	return ""
+	if !valid {
+		return &PluginError{
+			Code:    ERR_INVALID_AIRLINE_CODE,
+			Message: fmt.Sprintf("%s: %q is not an IATA airline code: expected 2 letters or digits, e.g. \"BA\"", field, code),
+		}
+	}
+	return nil
 }
 
 func loadConfig() error {
@@ -185,26 +366,96 @@ func loadConfig() error {
 		return nil
 	}
 
+	// An empty environment means the host withheld it, which would otherwise
+	// surface as whichever variable happens to be read first being unset
+	if !environmentAvailable() {
+		return &PluginError{
+			Code:    ERR_ENVIRONMENT_UNAVAILABLE,
+			Message: "the host provided no environment variables; check that it grants this plugin environment access",
+		}
+	}
+
 	// Load Amadeus host (just the hostname, no protocol)
-	AMADEUS_HOST = getEnvVar("AMADEUS_HOST")
-	if AMADEUS_HOST == "" {
-		return fmt.Errorf("AMADEUS_HOST environment variable is required")
+	host, err := resolveHost()
+	if err != nil {
+		return err
 	}
+	AMADEUS_HOST = host
 
-	config.APIKey = getEnvVar("AMADEUS_API_KEY")
-	config.APISecret = getEnvVar("AMADEUS_API_SECRET")
+	// Optional currency used when a search doesn't specify one
+	defaultCurrency := getEnvVar("AMADEUS_DEFAULT_CURRENCY")
+	if defaultCurrency != "" {
+		normalized, err := normalizeCurrency(defaultCurrency)
+		if err != nil {
+			return fmt.Errorf("AMADEUS_DEFAULT_CURRENCY: %w", err)
+		}
+		config.DefaultCurrency = normalized
+	}
 
-	if config.APIKey == "" || config.APISecret == "" {
+	// Optional locale used when a call doesn't specify one
+	defaultLocale := getEnvVar("AMADEUS_DEFAULT_LOCALE")
+	if defaultLocale != "" {
+		normalized, err := normalizeLocale("AMADEUS_DEFAULT_LOCALE", defaultLocale)
+		if err != nil {
+			return err
+		}
+		config.DefaultLocale = normalized
+	}
+
+	// Credentials, either plain or base64-encoded in the _B64 variants
+	apiKey, err := getSecretEnvVar("AMADEUS_API_KEY")
+	if err != nil {
+		return err
+	}
+	apiSecret, err := getSecretEnvVar("AMADEUS_API_SECRET")
+	if err != nil {
+		return err
+	}
+	config.APIKey = apiKey
+	config.APISecret = apiSecret
+
+	// Credentials passed with the call stand in for the environment's
+	if (config.APIKey == "" || config.APISecret == "") && callCredentials == nil {
 		return fmt.Errorf("AMADEUS_API_KEY and AMADEUS_API_SECRET environment variables are required")
 	}
 
 	return nil
 }
 
+// refreshToken fetches a new access token for the credentials in use: the
+// call's override if there is one, otherwise the configured ones. Callers go
+// through refreshTokenIf so that only one refresh is in flight at a time.
 func refreshToken() error {
+	if callCredentials != nil {
+		tokenResp, err := fetchToken(*callCredentials)
+		if err != nil {
+			return err
+		}
+		tokenMu.Lock()
+		defer tokenMu.Unlock()
+		callToken = tokenResp.AccessToken
+		return nil
+	}
+
+	tokenResp, err := fetchToken(Credentials{APIKey: config.APIKey, APISecret: config.APISecret})
+	if err != nil {
+		return err
+	}
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	config.Token = tokenResp.AccessToken
+	config.Expiration = time.Now().UTC().Unix() + tokenResp.ExpiresIn
+	return nil
+}
+
+// fetchToken requests an access token from the OAuth2 token endpoint
+func fetchToken(credentials Credentials) (*TokenResponse, error) {
 	// OAuth2 token request with proper POST body
-	formData := fmt.Sprintf("grant_type=client_credentials&client_id=%s&client_secret=%s",
-		config.APIKey, config.APISecret)
+	var form QueryBuilder
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", credentials.APIKey)
+	form.Set("client_secret", credentials.APISecret)
+	formData := form.Encode()
 
 	headers := map[string]string{
 		"Content-Type": "application/x-www-form-urlencoded",
@@ -213,104 +464,485 @@ func refreshToken() error {
 	path := "/v1/security/oauth2/token"
 	body := []byte(formData)
 
-	respBody, err := makeHTTPRequest("POST", path, headers, body)
+	resp, err := doRequest(Request{Method: "POST", PathWithQuery: path, Headers: headers, Body: body})
 	if err != nil {
-		return fmt.Errorf("failed to refresh token: %v", err)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.Status == 401 {
+			rejected := "AMADEUS_API_KEY/AMADEUS_API_SECRET"
+			if callCredentials != nil {
+				rejected = "api-key/api-secret"
+			}
+			message := fmt.Sprintf("Amadeus rejected %s; check the credentials match AMADEUS_HOST", rejected)
+			var tokenErr TokenErrorResponse
+			if json.Unmarshal(httpErr.Body, &tokenErr) == nil && tokenErr.ErrorDescription != "" {
+				message = fmt.Sprintf("%s (%s)", message, tokenErr.ErrorDescription)
+			}
+			return nil, &PluginError{Code: ERR_INVALID_API_KEY, Message: message}
+		}
+		if errors.As(err, &httpErr) {
+			// Gateways in front of Amadeus answer with HTML pages, so show
+			// a short snippet rather than the whole body
+			return nil, fmt.Errorf("failed to refresh token: token endpoint returned status %d: %s", httpErr.Status, bodySnippet(httpErr.Body))
+		}
+		return nil, fmt.Errorf("failed to refresh token: %v", err)
+	}
+
+	// Check the response really is JSON before parsing, so a gateway page
+	// or empty body gets a clear message instead of a parse error
+	if len(bytes.TrimSpace(resp.Body)) == 0 {
+		return nil, fmt.Errorf("failed to refresh token: token endpoint returned an empty body (status %d)", resp.Status)
+	}
+	if resp.ContentType != "" && !isJSONContentType(resp.ContentType) {
+		return nil, fmt.Errorf("failed to refresh token: token endpoint returned %s instead of JSON (status %d): %s", resp.ContentType, resp.Status, bodySnippet(resp.Body))
 	}
 
 	var tokenResp TokenResponse
-	if err := json.Unmarshal(respBody, &tokenResp); err != nil {
-		return fmt.Errorf("failed to parse token response: %v", err)
+	if err := json.Unmarshal(resp.Body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %v: %s", err, bodySnippet(resp.Body))
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("failed to refresh token: token response has no access_token: %s", bodySnippet(resp.Body))
 	}
 
-	config.Token = tokenResp.AccessToken
-	config.Expiration = time.Now().UTC().Unix() + tokenResp.ExpiresIn
+	return &tokenResp, nil
+}
 
-	return nil
+// isJSONContentType reports whether a Content-Type header names a JSON
+// media type, including suffixed types such as application/vnd.amadeus+json
+func isJSONContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
 }
 
-func searchFlights(params amadeusflightcomponent.FlightSearchParams) (string, error) {
-	// Load configuration
-	if err := loadConfig(); err != nil {
-		return "", err
+// tokenMu guards the access token and tokenRefresh. The component is built
+// with -scheduler=none, so today export calls and their requests never
+// overlap; the guard keeps the token logic correct if requests are sent
+// from goroutines, as the tests do.
+var tokenMu sync.Mutex
+
+// tokenRefresh is the token refresh in flight, or nil when there is none
+var tokenRefresh *pendingRefresh
+
+type pendingRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// refreshTokenIf refreshes the token when needed reports it must be. The
+// check and the start of a refresh happen together under tokenMu, and a
+// caller arriving while a refresh is in flight waits for its result instead
+// of sending another token request.
+func refreshTokenIf(needed func() bool) error {
+	tokenMu.Lock()
+	if refresh := tokenRefresh; refresh != nil {
+		tokenMu.Unlock()
+		<-refresh.done
+		return refresh.err
+	}
+	if !needed() {
+		tokenMu.Unlock()
+		return nil
 	}
+	refresh := &pendingRefresh{done: make(chan struct{})}
+	tokenRefresh = refresh
+	tokenMu.Unlock()
 
-	// Check if token needs refresh
-	if config.Token == "" || time.Now().UTC().Unix() >= config.Expiration {
-		if err := refreshToken(); err != nil {
-			return "", err
+	refresh.err = refreshToken()
+
+	tokenMu.Lock()
+	tokenRefresh = nil
+	tokenMu.Unlock()
+	close(refresh.done)
+	return refresh.err
+}
+
+// currentToken is the access token requests are sent with
+func currentToken() string {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	return heldToken()
+}
+
+// heldToken is currentToken for callers already holding tokenMu
+func heldToken() string {
+	if callCredentials != nil {
+		return callToken
+	}
+	return config.Token
+}
+
+// tokenStale reports whether the token is missing or expired. A call's
+// override token is fetched once and lives only for that call. tokenMu
+// must be held.
+func tokenStale() bool {
+	if callCredentials != nil {
+		return callToken == ""
+	}
+	return config.Token == "" || time.Now().UTC().Unix() >= config.Expiration
+}
+
+// ensureToken refreshes the access token when it is missing or expired
+func ensureToken() error {
+	return refreshTokenIf(tokenStale)
+}
+
+// refreshRejectedToken replaces a token Amadeus answered with 401. Every
+// request sent with it gets the 401, so only the first caller refreshes;
+// the others wait for that refresh, or find the token already replaced,
+// and reuse its result.
+func refreshRejectedToken(rejected string) error {
+	return refreshTokenIf(func() bool {
+		return heldToken() == rejected || tokenStale()
+	})
+}
+
+// authorizedRequest sends an Amadeus API request with the current bearer
+// token. A 401 means the token was revoked or expired early, so the token is
+// refreshed and the request retried exactly once.
+func authorizedRequest(method string, pathWithQuery string, headers map[string]string, body []byte) ([]byte, error) {
+	// A dry run never reaches Amadeus, so there is no token to fetch
+	if isDryRun() {
+		return makeHTTPRequest(method, pathWithQuery, withAuthorization(headers), body)
+	}
+
+	if err := ensureToken(); err != nil {
+		return nil, err
+	}
+
+	sent := currentToken()
+	respBody, err := makeHTTPRequest(method, pathWithQuery, withAuthorization(headers), body)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.Status == 401 {
+		if err := refreshRejectedToken(sent); err != nil {
+			return nil, err
 		}
+		respBody, err = makeHTTPRequest(method, pathWithQuery, withAuthorization(headers), body)
 	}
 
+	return respBody, err
+}
+
+// authorizedBatch sends several Amadeus requests concurrently with the
+// current bearer token. As with authorizedRequest, a 401 on any of them
+// refreshes the token and the whole batch is resent once.
+func authorizedBatch(requests []Request) []Result {
+	authorize := func() []Request {
+		authorized := make([]Request, len(requests))
+		for i, req := range requests {
+			req.Headers = withAuthorization(req.Headers)
+			authorized[i] = req
+		}
+		return authorized
+	}
+
+	// A dry run never reaches Amadeus, so there is no token to fetch
+	if isDryRun() {
+		return DoBatch(authorize(), REQUEST_MIDDLEWARE...)
+	}
+
+	failAll := func(err error) []Result {
+		results := make([]Result, len(requests))
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+
+	if err := ensureToken(); err != nil {
+		return failAll(err)
+	}
+
+	sent := currentToken()
+	results := DoBatch(authorize(), REQUEST_MIDDLEWARE...)
+	for _, result := range results {
+		var httpErr *HTTPError
+		if errors.As(result.Err, &httpErr) && httpErr.Status == 401 {
+			// Every request in the batch used the same token, so one
+			// refresh covers all of them
+			if err := refreshRejectedToken(sent); err != nil {
+				return failAll(err)
+			}
+			return DoBatch(authorize(), REQUEST_MIDDLEWARE...)
+		}
+	}
+
+	return results
+}
+
+// withAuthorization returns a copy of headers carrying the current bearer token
+func withAuthorization(headers map[string]string) map[string]string {
+	authorized := make(map[string]string, len(headers)+1)
+	for key, value := range headers {
+		authorized[key] = value
+	}
+	authorized["Authorization"] = fmt.Sprintf("Bearer %s", currentToken())
+	return authorized
+}
+
+const FLIGHT_OFFERS_PATH = "/v2/shopping/flight-offers"
+
+// flightOffersPath builds the flight-offers request path for a search; the
+// return date is only sent for round trips, and the currency only when one
+// was resolved
+func flightOffersPath(params amadeusflightcomponent.FlightSearchParams, trip string, currency string) (string, error) {
 	// Build query parameters
-	queryParams := fmt.Sprintf("originLocationCode=%s&destinationLocationCode=%s&departureDate=%s&adults=%d",
-		params.OriginLocationCode,
-		params.DestinationLocationCode,
-		params.DepartureDate,
-		params.Adults)
+	var query QueryBuilder
+	query.Set("originLocationCode", params.OriginLocationCode)
+	query.Set("destinationLocationCode", params.DestinationLocationCode)
+	query.Set("departureDate", params.DepartureDate)
+	query.Set("adults", strconv.Itoa(int(params.Adults)))
 
 	// Add optional parameters
-	if returnDate := params.ReturnDate.Some(); returnDate != nil {
-		queryParams += fmt.Sprintf("&returnDate=%s", *returnDate)
+	if trip == TRIP_ROUND_TRIP {
+		query.Set("returnDate", strings.TrimSpace(*params.ReturnDate.Some()))
 	}
 	if children := params.Children.Some(); children != nil {
-		queryParams += fmt.Sprintf("&children=%d", *children)
+		query.Set("children", strconv.Itoa(int(*children)))
 	}
 	if infants := params.Infants.Some(); infants != nil {
-		queryParams += fmt.Sprintf("&infants=%d", *infants)
+		query.Set("infants", strconv.Itoa(int(*infants)))
 	}
 	if travelClass := params.TravelClass.Some(); travelClass != nil {
-		queryParams += fmt.Sprintf("&travelClass=%s", *travelClass)
+		normalized, err := normalizeTravelClass(*travelClass)
+		if err != nil {
+			return "", err
+		}
+		query.Set("travelClass", normalized)
 	}
 	if includedCodes := params.IncludedAirlineCodes.Some(); includedCodes != nil {
-		queryParams += fmt.Sprintf("&includedAirlineCodes=%s", *includedCodes)
+		normalized, err := normalizeAirlineCodes("included-airline-codes", *includedCodes)
+		if err != nil {
+			return "", err
+		}
+		if normalized != "" {
+			query.Set("includedAirlineCodes", normalized)
+		}
 	}
 	if excludedCodes := params.ExcludedAirlineCodes.Some(); excludedCodes != nil {
-		queryParams += fmt.Sprintf("&excludedAirlineCodes=%s", *excludedCodes)
+		normalized, err := normalizeAirlineCodes("excluded-airline-codes", *excludedCodes)
+		if err != nil {
+			return "", err
+		}
+		if normalized != "" {
+			query.Set("excludedAirlineCodes", normalized)
+		}
 	}
 	if nonStop := params.NonStop.Some(); nonStop != nil {
-		queryParams += fmt.Sprintf("&nonStop=%t", *nonStop)
+		query.Set("nonStop", strconv.FormatBool(*nonStop))
+	}
+	if source := params.Sources.Some(); source != nil {
+		normalized, err := normalizeSource(*source)
+		if err != nil {
+			return "", err
+		}
+		query.Set("sources", normalized)
 	}
-	if currencyCode := params.CurrencyCode.Some(); currencyCode != nil {
-		queryParams += fmt.Sprintf("&currencyCode=%s", *currencyCode)
+	if currency != "" {
+		query.Set("currencyCode", currency)
 	}
 	if maxPrice := params.MaxPrice.Some(); maxPrice != nil {
-		queryParams += fmt.Sprintf("&max=%d", *maxPrice)
+		query.Set("maxPrice", strconv.Itoa(int(*maxPrice)))
 	}
 	if maxResults := params.MaxResults.Some(); maxResults != nil {
-		queryParams += fmt.Sprintf("&max=%d", *maxResults)
+		query.Set("max", strconv.Itoa(int(*maxResults)))
 	} else {
-		queryParams += "&max=10" // Default to 10 results
+		query.Set("max", "10") // Default to 10 results
+	}
+
+	return query.Path(FLIGHT_OFFERS_PATH), nil
+}
+
+// applyOfferFilters runs the optional post-processing passes the search
+// asked for; Amadeus has no parameter for these
+func applyOfferFilters(params amadeusflightcomponent.FlightSearchParams, result *FlightSearchResult) {
+	// Amadeus sometimes repeats an offer under a different ID
+	if dedupe := params.Dedupe.Some(); dedupe != nil && *dedupe {
+		var removed int
+		result.Offers, removed = dedupeOffers(result.Offers)
+		result.DuplicatesRemoved = &removed
+	}
+	if maxStops := params.MaxStops.Some(); maxStops != nil {
+		var removed int
+		result.Offers, removed = filterByMaxStops(result.Offers, int(*maxStops))
+		result.FilteredByMaxStops = &removed
+	}
+	if window := params.DepartureTimeWindow.Some(); window != nil {
+		// Already validated by validateSearchParams
+		parsed, _ := parseTimeWindow(*window)
+		var removed int
+		result.Offers, removed = filterByDepartureWindow(result.Offers, parsed)
+		result.FilteredByTimeWindow = &removed
+	}
+	avoid, require := params.AvoidAirports.Some(), params.RequireConnectionVia.Some()
+	if avoid != nil || require != nil {
+		// Already validated by validateSearchParams
+		var avoidAirports, requireAirports []string
+		if avoid != nil {
+			avoidAirports, _ = parseAirportList("avoid-airports", *avoid)
+		}
+		if require != nil {
+			requireAirports, _ = parseAirportList("require-connection-via", *require)
+		}
+		var removed int
+		result.Offers, removed = filterByConnections(result.Offers, avoidAirports, requireAirports)
+		result.FilteredByConnections = &removed
+	}
+	if exclude := params.ExcludeExpired.Some(); exclude != nil && *exclude {
+		var removed int
+		result.Offers, removed = filterExpired(result.Offers)
+		result.FilteredByExpiry = &removed
+	}
+	// Rank last, so scores compare only the offers that are returned
+	if rank := params.RankByValue.Some(); rank != nil && *rank {
+		rankByValue(result.Offers, valueWeights(params))
+	}
+	result.Count = len(result.Offers)
+}
+
+// fetchOffers validates a search and returns the raw Amadeus response with
+// the trip type. Callers apply any per-call credentials first.
+func fetchOffers(params amadeusflightcomponent.FlightSearchParams) ([]byte, string, bool, error) {
+	// Load configuration
+	if err := loadConfig(); err != nil {
+		return nil, "", false, err
+	}
+
+	if err := validateSearchParams(params); err != nil {
+		return nil, "", false, err
+	}
+
+	// A blank return date is a one-way search, not an invalid round trip
+	trip, err := tripType(params)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	req, err := offersRequest(params, trip)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	// Identical searches within the cache TTL reuse the earlier response; a
+	// dry run always describes the request instead
+	cacheEnabled := isSearchCacheEnabled() && !isDryRun()
+	key := searchCacheKey(req)
+	if cacheEnabled {
+		if respBody, cachedTrip, ok := searches.Get(key, time.Now()); ok {
+			return respBody, cachedTrip, true, nil
+		}
 	}
 
 	// Make API request
-	path := fmt.Sprintf("/v2/shopping/flight-offers?%s", queryParams)
-	headers := map[string]string{
-		"Authorization": fmt.Sprintf("Bearer %s", config.Token),
-		"Accept": "application/json",
+	respBody, err := authorizedRequest(req.Method, req.PathWithQuery, req.Headers, req.Body)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("API request failed: %w", err)
+	}
+	if cacheEnabled {
+		searches.Put(key, respBody, trip, time.Now(), searchCacheTTL())
+	}
+	return respBody, trip, false, nil
+}
+
+// findOffers runs a flight search and returns the normalized, filtered
+// offers shared by search-flights and search-flights-jsonl
+func findOffers(params amadeusflightcomponent.FlightSearchParams) (*FlightSearchResult, error) {
+	release, err := useCredentials(params.APIKey, params.APISecret)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	respBody, err := makeHTTPRequest("GET", path, headers, nil)
+	respBody, trip, cached, err := fetchOffers(params)
 	if err != nil {
-		return "", fmt.Errorf("API request failed: %v", err)
+		return nil, err
 	}
 
-	return string(respBody), nil
+	result, err := normalizeOffers(respBody, trip)
+	if err != nil {
+		return nil, err
+	}
+	if includeRaw := params.IncludeRaw.Some(); includeRaw != nil && *includeRaw {
+		if err := attachRawSegments(respBody, result); err != nil {
+			return nil, err
+		}
+	}
+	result.Cached = cached
+	applyOfferFilters(params, result)
+	return result, nil
 }
 
-func init() {
-	amadeusflightcomponent.Exports.SearchFlights = func(params amadeusflightcomponent.FlightSearchParams) string {
-		result, err := searchFlights(params)
-		if err != nil {
-			errorResp := map[string]string{
-				"error": fmt.Sprintf("Failed to search flights: %v", err),
-			}
-			data, _ := json.Marshal(errorResp)
-			return string(data)
+func searchFlights(params amadeusflightcomponent.FlightSearchParams) (string, error) {
+	result, err := findOffers(params)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := marshalJSON(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %v", err)
+	}
+
+	return string(data), nil
+}
+
+// marshalJSON renders an export's response: compact by default, indented
+// when PRETTY_JSON is "true" so output is readable while debugging. With
+// INCLUDE_HTTP_STATUS=true, objects also get the upstream status as _status.
+func marshalJSON(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(getEnvVar("INCLUDE_HTTP_STATUS"), "true") {
+		data = withStatus(data, lastStatus)
+	}
+	if strings.EqualFold(getEnvVar("PRETTY_JSON"), "true") {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err != nil {
+			return nil, err
+		}
+		return indented.Bytes(), nil
+	}
+	return data, nil
+}
+
+// withStatus prepends a _status key to a compact JSON object. Arrays,
+// and calls that never reached the upstream, are left unchanged.
+func withStatus(data []byte, status int) []byte {
+	if status == 0 || len(data) < 2 || data[0] != '{' {
+		return data
+	}
+	annotated := fmt.Appendf(nil, `{"_status":%d`, status)
+	if string(data) != "{}" {
+		annotated = append(annotated, ',')
+	}
+	return append(annotated, data[1:]...)
+}
+
+// errorJSON renders a JSON error response; structured errors also carry
+// their machine-readable code. Dry-run requests are rendered as-is.
+func errorJSON(message string, err error) string {
+	// A dry run surfaces as an error from the HTTP layer, but it is the
+	// expected result rather than a failure
+	var dryRun *DryRunError
+	if errors.As(err, &dryRun) {
+		result, _ := marshalJSON(dryRun.Request)
+		return string(result)
+	}
+
+	resp := ErrorResponse{Error: message, RequestID: requestID}
+	if err != nil {
+		resp.Error = fmt.Sprintf("%s: %v", message, err)
+		var pluginErr *PluginError
+		if errors.As(err, &pluginErr) {
+			resp.Code = pluginErr.Code
 		}
-		return result
 	}
+	data, _ := marshalJSON(resp)
+	return string(data)
 }
 
 // Required for WASM
-func main() {}
\ No newline at end of file
+func main() {}
@@ -0,0 +1,845 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// setEnv replaces the environment for the rest of the test with the given
+// name/value pairs
+func setEnv(t *testing.T, pairs ...string) {
+	t.Helper()
+	previous := testEnviron
+	testEnviron = nil
+	for i := 0; i+1 < len(pairs); i += 2 {
+		testEnviron = append(testEnviron, [2]string{pairs[i], pairs[i+1]})
+	}
+	t.Cleanup(func() { testEnviron = previous })
+}
+
+// useConfig installs c as the loaded configuration, against the test host,
+// for the rest of the test
+func useConfig(t *testing.T, c *Config) {
+	t.Helper()
+	previous, previousHost := config, AMADEUS_HOST
+	config, AMADEUS_HOST = c, AMADEUS_ENV_HOSTS["test"]
+	t.Cleanup(func() { config, AMADEUS_HOST = previous, previousHost })
+}
+
+const TOKEN_PATH = "/v1/security/oauth2/token"
+
+// tokenResponse is a token endpoint answer issuing token
+func tokenResponse(token string) fakeResponse {
+	return fakeResponse{
+		status:  200,
+		headers: map[string]string{"Content-Type": "application/json"},
+		body:    `{"access_token":"` + token + `","token_type":"Bearer","expires_in":1799}`,
+	}
+}
+
+// authorizations lists the Authorization header of each request sent to path
+func authorizations(fake *fakeTransport, path string) []string {
+	var sent []string
+	for _, req := range fake.sent {
+		if req.PathWithQuery == path {
+			sent = append(sent, req.Headers["Authorization"])
+		}
+	}
+	return sent
+}
+
+func TestAuthorizedRequestRetriesRejectedToken(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "revoked", Expiration: time.Now().Unix() + 600})
+	fake := &fakeTransport{}
+	fake.respond(FLIGHT_OFFERS_PATH,
+		fakeResponse{status: 401, body: `{"errors":[{"code":38190,"title":"Invalid access token"}]}`},
+		fakeResponse{status: 200, body: `{"data":[]}`},
+	)
+	fake.respond(TOKEN_PATH, tokenResponse("fresh"))
+	useTransport(t, fake)
+
+	body, err := authorizedRequest("GET", FLIGHT_OFFERS_PATH, nil, nil)
+	if err != nil {
+		t.Fatalf("authorizedRequest() error = %v", err)
+	}
+	if string(body) != `{"data":[]}` {
+		t.Errorf("body = %s", body)
+	}
+
+	want := []string{"Bearer revoked", "Bearer fresh"}
+	if got := authorizations(fake, FLIGHT_OFFERS_PATH); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+	if config.Token != "fresh" {
+		t.Errorf("config.Token = %q, want the refreshed token kept", config.Token)
+	}
+}
+
+func TestAuthorizedRequestRetriesOnce(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "revoked", Expiration: time.Now().Unix() + 600})
+	fake := &fakeTransport{}
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 401}, fakeResponse{status: 401})
+	fake.respond(TOKEN_PATH, tokenResponse("fresh"))
+	useTransport(t, fake)
+
+	_, err := authorizedRequest("GET", FLIGHT_OFFERS_PATH, nil, nil)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Status != 401 {
+		t.Fatalf("authorizedRequest() error = %v, want the second 401", err)
+	}
+	if got := authorizations(fake, FLIGHT_OFFERS_PATH); len(got) != 2 {
+		t.Errorf("sent %d searches, want the original and one retry", len(got))
+	}
+}
+
+// releaseWhenSent closes release once count requests to path have been
+// sent and the other goroutines have had a moment to catch up with them
+func releaseWhenSent(fake *fakeTransport, path string, count int, release chan struct{}) {
+	for {
+		fake.mu.Lock()
+		sent := len(authorizations(fake, path))
+		fake.mu.Unlock()
+		if sent >= count {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+}
+
+func TestConcurrentSearchesShareTokenRefresh(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "expired", Expiration: time.Now().Unix() - 1})
+	release := make(chan struct{})
+	token := tokenResponse("fresh")
+	token.release = release
+	fake := &fakeTransport{}
+	fake.respond(TOKEN_PATH, token, tokenResponse("second"))
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 200, body: `{"data":[]}`}, fakeResponse{status: 200, body: `{"data":[]}`})
+	useTransport(t, fake)
+
+	params := amadeusflightcomponent.FlightSearchParams{
+		OriginLocationCode:      "MAD",
+		DestinationLocationCode: "JFK",
+		DepartureDate:           "2025-12-20",
+		Adults:                  1,
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = searchFlights(params)
+		}()
+	}
+	releaseWhenSent(fake, TOKEN_PATH, 1, release)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("search %d error = %v", i, err)
+		}
+	}
+	if got := authorizations(fake, TOKEN_PATH); len(got) != 1 {
+		t.Errorf("sent %d token requests, want 1 shared by both searches", len(got))
+	}
+	for _, req := range fake.sent {
+		if strings.HasPrefix(req.PathWithQuery, FLIGHT_OFFERS_PATH) && req.Headers["Authorization"] != "Bearer fresh" {
+			t.Errorf("search sent with %q, want Bearer fresh", req.Headers["Authorization"])
+		}
+	}
+}
+
+func TestConcurrentRejectionsShareTokenRefresh(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "revoked", Expiration: time.Now().Unix() + 600})
+	release := make(chan struct{})
+	token := tokenResponse("fresh")
+	token.release = release
+	fake := &fakeTransport{}
+	fake.respond(TOKEN_PATH, token, tokenResponse("second"))
+	// Both requests go out with the revoked token before either is rejected
+	rejected := make(chan struct{})
+	fake.respond(FLIGHT_OFFERS_PATH,
+		fakeResponse{status: 401, release: rejected}, fakeResponse{status: 401, release: rejected},
+		fakeResponse{status: 200, body: `{"data":[]}`}, fakeResponse{status: 200, body: `{"data":[]}`},
+	)
+	useTransport(t, fake)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = authorizedRequest("GET", FLIGHT_OFFERS_PATH, nil, nil)
+		}()
+	}
+	releaseWhenSent(fake, FLIGHT_OFFERS_PATH, 2, rejected)
+	releaseWhenSent(fake, TOKEN_PATH, 1, release)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("request %d error = %v", i, err)
+		}
+	}
+	if got := authorizations(fake, TOKEN_PATH); len(got) != 1 {
+		t.Errorf("sent %d token requests, want 1 shared by both rejected requests", len(got))
+	}
+	if config.Token != "fresh" {
+		t.Errorf("config.Token = %q, want fresh", config.Token)
+	}
+}
+
+func TestFetchTokenHTMLBody(t *testing.T) {
+	useConfig(t, &Config{})
+	fake := &fakeTransport{}
+	fake.respond(TOKEN_PATH, fakeResponse{
+		status:  200,
+		headers: map[string]string{"Content-Type": "text/html; charset=utf-8"},
+		body:    "<html><body><h1>Service Unavailable</h1></body></html>",
+	})
+	useTransport(t, fake)
+
+	_, err := fetchToken(Credentials{APIKey: "key", APISecret: "secret"})
+	if err == nil {
+		t.Fatal("fetchToken() accepted an HTML body")
+	}
+	for _, want := range []string{"text/html", "instead of JSON", "status 200", "Service Unavailable"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q is missing %q", err, want)
+		}
+	}
+}
+
+func TestFetchTokenGatewayError(t *testing.T) {
+	useConfig(t, &Config{})
+	setEnv(t, "HTTP_MAX_ATTEMPTS", "1")
+	fake := &fakeTransport{}
+	fake.respond(TOKEN_PATH, fakeResponse{status: 502, body: "<html><h1>502 Bad Gateway</h1></html>"})
+	useTransport(t, fake)
+
+	_, err := fetchToken(Credentials{APIKey: "key", APISecret: "secret"})
+	if err == nil || !strings.Contains(err.Error(), "status 502") || !strings.Contains(err.Error(), "502 Bad Gateway") {
+		t.Errorf("fetchToken() error = %v, want the status and a body snippet", err)
+	}
+}
+
+func TestFetchTokenEmptyBody(t *testing.T) {
+	useConfig(t, &Config{})
+	fake := &fakeTransport{}
+	fake.respond(TOKEN_PATH, fakeResponse{status: 200, headers: map[string]string{"Content-Type": "application/json"}, body: " \n"})
+	useTransport(t, fake)
+
+	_, err := fetchToken(Credentials{APIKey: "key", APISecret: "secret"})
+	if err == nil || !strings.Contains(err.Error(), "empty body (status 200)") {
+		t.Errorf("fetchToken() error = %v, want an empty-body error", err)
+	}
+}
+
+func TestFetchTokenRejected(t *testing.T) {
+	useConfig(t, &Config{})
+	fake := &fakeTransport{}
+	fake.respond(TOKEN_PATH, fakeResponse{
+		status: 401,
+		body:   `{"error":"invalid_client","error_description":"Client credentials are invalid","code":38187,"title":"Invalid parameters"}`,
+	})
+	useTransport(t, fake)
+
+	_, err := fetchToken(Credentials{APIKey: "key", APISecret: "secret"})
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_API_KEY {
+		t.Fatalf("fetchToken() error = %v, want %s", err, ERR_INVALID_API_KEY)
+	}
+	if !strings.Contains(pluginErr.Message, "Client credentials are invalid") {
+		t.Errorf("message %q is missing the error description", pluginErr.Message)
+	}
+}
+
+func TestResolveHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     []string
+		want    string
+		wantErr string
+	}{
+		{"test", []string{"AMADEUS_ENV", "test"}, "test.api.amadeus.com", ""},
+		{"production", []string{"AMADEUS_ENV", " Production "}, "api.amadeus.com", ""},
+		{"explicit host wins", []string{"AMADEUS_HOST", "proxy.example.com", "AMADEUS_ENV", "production"}, "proxy.example.com", ""},
+		{"unknown env", []string{"AMADEUS_ENV", "staging"}, "", `AMADEUS_ENV must be "test" or "production", got "staging"`},
+		{"neither", nil, "", "AMADEUS_HOST or AMADEUS_ENV environment variable is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env...)
+			got, err := resolveHost()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("resolveHost() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("resolveHost() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSearchParamsRequired(t *testing.T) {
+	valid := amadeusflightcomponent.FlightSearchParams{
+		OriginLocationCode:      "MAD",
+		DestinationLocationCode: "JFK",
+		DepartureDate:           "2025-12-20",
+		Adults:                  1,
+	}
+	if err := validateSearchParams(valid); err != nil {
+		t.Fatalf("validateSearchParams() error = %v for valid params", err)
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(*amadeusflightcomponent.FlightSearchParams)
+		code    string
+		message string
+	}{
+		{"missing origin", func(p *amadeusflightcomponent.FlightSearchParams) { p.OriginLocationCode = " " },
+			ERR_MISSING_REQUIRED_PARAM, "origin-location-code is required"},
+		{"missing destination", func(p *amadeusflightcomponent.FlightSearchParams) { p.DestinationLocationCode = "" },
+			ERR_MISSING_REQUIRED_PARAM, "destination-location-code is required"},
+		{"missing departure date", func(p *amadeusflightcomponent.FlightSearchParams) { p.DepartureDate = "" },
+			ERR_MISSING_REQUIRED_PARAM, "departure-date is required"},
+		{"lower-case origin", func(p *amadeusflightcomponent.FlightSearchParams) { p.OriginLocationCode = "mad" },
+			ERR_INVALID_IATA_CODE, "origin-location-code"},
+		{"long destination", func(p *amadeusflightcomponent.FlightSearchParams) { p.DestinationLocationCode = "JFKX" },
+			ERR_INVALID_IATA_CODE, "destination-location-code"},
+		{"digits in origin", func(p *amadeusflightcomponent.FlightSearchParams) { p.OriginLocationCode = "M4D" },
+			ERR_INVALID_IATA_CODE, "origin-location-code"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := valid
+			tt.edit(&params)
+			err := validateSearchParams(params)
+			var pluginErr *PluginError
+			if !errors.As(err, &pluginErr) || pluginErr.Code != tt.code {
+				t.Fatalf("validateSearchParams() error = %v, want %s", err, tt.code)
+			}
+			if !strings.Contains(pluginErr.Message, tt.message) {
+				t.Errorf("message = %q, want it to name %q", pluginErr.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestDefaultCurrencyFromEnv(t *testing.T) {
+	useConfig(t, &Config{})
+	setEnv(t, "AMADEUS_HOST", "test.api.amadeus.com", "AMADEUS_API_KEY", "key", "AMADEUS_API_SECRET", "secret",
+		"AMADEUS_DEFAULT_CURRENCY", " eur ")
+
+	if err := loadConfig(); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	resolved, err := resolvePresentation(cm.None[amadeusflightcomponent.Presentation](), cm.None[string]())
+	if err != nil {
+		t.Fatalf("resolvePresentation() error = %v", err)
+	}
+	if resolved.Currency != "EUR" {
+		t.Errorf("Currency = %q, want the env default EUR", resolved.Currency)
+	}
+}
+
+func TestCurrencyParameterOverridesDefault(t *testing.T) {
+	useConfig(t, &Config{DefaultCurrency: "EUR"})
+
+	resolved, err := resolvePresentation(cm.None[amadeusflightcomponent.Presentation](), cm.Some("usd"))
+	if err != nil {
+		t.Fatalf("resolvePresentation() error = %v", err)
+	}
+	if resolved.Currency != "USD" {
+		t.Errorf("Currency = %q, want the explicit USD", resolved.Currency)
+	}
+}
+
+func TestDefaultCurrencyInvalid(t *testing.T) {
+	useConfig(t, &Config{})
+	setEnv(t, "AMADEUS_HOST", "test.api.amadeus.com", "AMADEUS_API_KEY", "key", "AMADEUS_API_SECRET", "secret",
+		"AMADEUS_DEFAULT_CURRENCY", "EURO")
+
+	err := loadConfig()
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_CURRENCY {
+		t.Fatalf("loadConfig() error = %v, want %s", err, ERR_INVALID_CURRENCY)
+	}
+}
+
+func TestRequiredEnv(t *testing.T) {
+	env := func(skip string) []string {
+		var pairs []string
+		for _, name := range REQUIRED_ENV {
+			if name != skip {
+				pairs = append(pairs, name, "value")
+			}
+		}
+		return pairs
+	}
+
+	// The listed variables alone are enough to load
+	useConfig(t, &Config{})
+	setEnv(t, env("")...)
+	if err := loadConfig(); err != nil {
+		t.Errorf("loadConfig() with REQUIRED_ENV error = %v", err)
+	}
+
+	// Each one is needed
+	for _, name := range REQUIRED_ENV {
+		useConfig(t, &Config{})
+		AMADEUS_HOST = ""
+		setEnv(t, env(name)...)
+		if err := loadConfig(); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("without %s: loadConfig() error = %v, want it named", name, err)
+		}
+	}
+}
+
+func TestLoadConfigEnvironmentUnavailable(t *testing.T) {
+	useConfig(t, &Config{})
+	setEnv(t)
+
+	// Reported ahead of the host, the first variable loadConfig reads
+	err := loadConfig()
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_ENVIRONMENT_UNAVAILABLE {
+		t.Fatalf("loadConfig() error = %v, want %s", err, ERR_ENVIRONMENT_UNAVAILABLE)
+	}
+
+	// Any variable at all means the environment is there, just incomplete
+	setEnv(t, "AMADEUS_ENV", "test")
+	err = loadConfig()
+	if err == nil || errors.As(err, &pluginErr) {
+		t.Errorf("loadConfig() error = %v, want the missing credentials", err)
+	}
+}
+
+func TestLoadConfigEncodedCredentials(t *testing.T) {
+	useConfig(t, &Config{})
+	setEnv(t, "AMADEUS_ENV", "test", "AMADEUS_API_KEY_B64", "YjY0LWtleQ==", "AMADEUS_API_SECRET_B64", "YjY0LXNlY3JldA==\n")
+	if err := loadConfig(); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if config.APIKey != "b64-key" || config.APISecret != "b64-secret" {
+		t.Errorf("credentials = %q, %q, want the decoded values", config.APIKey, config.APISecret)
+	}
+
+	// A plain variable wins over its encoded form
+	useConfig(t, &Config{})
+	setEnv(t, "AMADEUS_ENV", "test", "AMADEUS_API_KEY", "plain-key", "AMADEUS_API_KEY_B64", "YjY0LWtleQ==", "AMADEUS_API_SECRET", "plain-secret")
+	if err := loadConfig(); err != nil || config.APIKey != "plain-key" || config.APISecret != "plain-secret" {
+		t.Errorf("loadConfig() = %q, %q, %v, want the plain credentials", config.APIKey, config.APISecret, err)
+	}
+}
+
+func TestLoadConfigUndecodableCredentials(t *testing.T) {
+	useConfig(t, &Config{})
+	setEnv(t, "AMADEUS_ENV", "test", "AMADEUS_API_KEY", "key", "AMADEUS_API_SECRET_B64", "not base64!")
+	err := loadConfig()
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_API_KEY || !strings.Contains(err.Error(), "AMADEUS_API_SECRET_B64") {
+		t.Errorf("loadConfig() error = %v, want %s naming the variable", err, ERR_INVALID_API_KEY)
+	}
+}
+
+func TestSearchFlightsDryRun(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret"})
+	setEnv(t, "AMADEUS_HOST", "test.api.amadeus.com", "AMADEUS_API_KEY", "key", "AMADEUS_API_SECRET", "secret", "DRY_RUN", "true")
+
+	_, err := searchFlights(amadeusflightcomponent.FlightSearchParams{
+		OriginLocationCode:      "MAD",
+		DestinationLocationCode: "NYC",
+		DepartureDate:           "2025-12-20",
+		Adults:                  1,
+		MaxPrice:                cm.Some[uint32](500),
+	})
+	var dryRun *DryRunError
+	if !errors.As(err, &dryRun) {
+		t.Fatalf("searchFlights() error = %v, want a dry run", err)
+	}
+
+	request := dryRun.Request
+	if !request.DryRun || request.Method != "GET" || request.Scheme != "https" || request.Authority != "test.api.amadeus.com" {
+		t.Errorf("request = %+v, want a GET to https://test.api.amadeus.com", request)
+	}
+	if want := FLIGHT_OFFERS_PATH + "?originLocationCode=MAD&destinationLocationCode=NYC&departureDate=2025-12-20&adults=1"; !strings.HasPrefix(request.PathWithQuery, want) {
+		t.Errorf("PathWithQuery = %q, want it to start with %q", request.PathWithQuery, want)
+	}
+	if !strings.Contains(request.PathWithQuery, "&maxPrice=500") {
+		t.Errorf("PathWithQuery = %q, want maxPrice=500", request.PathWithQuery)
+	}
+	if got := request.Headers["Authorization"]; got != "REDACTED" {
+		t.Errorf("Authorization = %q, want it redacted", got)
+	}
+
+	// No token is fetched for a dry run
+	if config.Token != "" {
+		t.Errorf("config.Token = %q, want no token fetched", config.Token)
+	}
+}
+
+func TestSupportedTravelClasses(t *testing.T) {
+	setEnv(t)
+	var classes []string
+	if err := json.Unmarshal([]byte(supportedTravelClasses()), &classes); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(classes, ",") != strings.Join(SUPPORTED_TRAVEL_CLASSES, ",") {
+		t.Errorf("supportedTravelClasses() = %v, want %v", classes, SUPPORTED_TRAVEL_CLASSES)
+	}
+	// Every listed class is accepted as given, and nothing else is
+	for _, class := range classes {
+		if got, err := normalizeTravelClass(class); err != nil || got != class {
+			t.Errorf("normalizeTravelClass(%q) = %q, %v", class, got, err)
+		}
+	}
+	if got, err := normalizeTravelClass("premium-economy"); err != nil || got != "PREMIUM_ECONOMY" {
+		t.Errorf("normalizeTravelClass(premium-economy) = %q, %v", got, err)
+	}
+	var pluginErr *PluginError
+	if _, err := normalizeTravelClass("COACH"); !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_TRAVEL_CLASS {
+		t.Errorf("normalizeTravelClass(COACH) error = %v, want %s", err, ERR_INVALID_TRAVEL_CLASS)
+	}
+}
+
+func TestFlightOffersPathSources(t *testing.T) {
+	params := amadeusflightcomponent.FlightSearchParams{
+		OriginLocationCode:      "MAD",
+		DestinationLocationCode: "JFK",
+		DepartureDate:           "2025-12-20",
+		Adults:                  1,
+	}
+
+	path, err := flightOffersPath(params, TRIP_ONE_WAY, "")
+	if err != nil {
+		t.Fatalf("flightOffersPath() error = %v", err)
+	}
+	if strings.Contains(path, "sources=") {
+		t.Errorf("path = %q, want no sources without the parameter", path)
+	}
+
+	params.Sources = cm.Some(" gds ")
+	path, err = flightOffersPath(params, TRIP_ONE_WAY, "")
+	if err != nil {
+		t.Fatalf("flightOffersPath() error = %v", err)
+	}
+	if !strings.Contains(path, "&sources=GDS") {
+		t.Errorf("path = %q, want sources=GDS", path)
+	}
+
+	params.Sources = cm.Some("NDC")
+	_, err = flightOffersPath(params, TRIP_ONE_WAY, "")
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_SOURCE {
+		t.Errorf("flightOffersPath() error = %v, want %s", err, ERR_INVALID_SOURCE)
+	}
+}
+
+func TestMarshalJSONPretty(t *testing.T) {
+	value := map[string]any{"code": "OK", "items": []int{1, 2}}
+
+	setEnv(t)
+	compact, err := marshalJSON(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(compact) != `{"code":"OK","items":[1,2]}` {
+		t.Errorf("compact = %s", compact)
+	}
+
+	setEnv(t, "PRETTY_JSON", "TRUE")
+	pretty, err := marshalJSON(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"code\": \"OK\",\n  \"items\": [\n    1,\n    2\n  ]\n}"
+	if string(pretty) != want {
+		t.Errorf("pretty = %s, want %s", pretty, want)
+	}
+}
+
+func TestNormalizeAirlineCodes(t *testing.T) {
+	tests := []struct {
+		codes   string
+		want    string
+		wantErr bool
+	}{
+		{"BA,IB", "BA,IB", false},
+		{" ba , u2,,", "BA,U2", false},
+		{" , ", "", false},
+		{"BAW", "", true},
+		{"B-", "", true},
+		{"IB,É1", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeAirlineCodes("included-airline-codes", tt.codes)
+		if tt.wantErr {
+			var pluginErr *PluginError
+			if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_AIRLINE_CODE ||
+				!strings.HasPrefix(pluginErr.Message, "included-airline-codes:") {
+				t.Errorf("normalizeAirlineCodes(%q) error = %v, want %s naming the field", tt.codes, err, ERR_INVALID_AIRLINE_CODE)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeAirlineCodes(%q) = %q, %v, want %q", tt.codes, got, err, tt.want)
+		}
+	}
+}
+
+func TestFlightOffersPathAirlineCodes(t *testing.T) {
+	params := amadeusflightcomponent.FlightSearchParams{
+		OriginLocationCode:      "MAD",
+		DestinationLocationCode: "JFK",
+		DepartureDate:           "2025-12-20",
+		Adults:                  1,
+		IncludedAirlineCodes:    cm.Some("ib, ux"),
+		ExcludedAirlineCodes:    cm.Some(" , "),
+	}
+	path, err := flightOffersPath(params, TRIP_ONE_WAY, "")
+	if err != nil {
+		t.Fatalf("flightOffersPath() error = %v", err)
+	}
+	if !strings.Contains(path, "&includedAirlineCodes=IB%2CUX") {
+		t.Errorf("path = %q, want includedAirlineCodes=IB,UX", path)
+	}
+	// A list with nothing left after cleaning is left out
+	if strings.Contains(path, "excludedAirlineCodes") {
+		t.Errorf("path = %q, want no excludedAirlineCodes", path)
+	}
+}
+
+func TestClearCaches(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	now := time.Now()
+	searches.Put("search", []byte(`{"data":[]}`), TRIP_ONE_WAY, now, time.Minute)
+	t.Cleanup(searches.Clear)
+
+	var resp ClearCachesResponse
+	if err := json.Unmarshal([]byte(clearCaches()), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(resp.Cleared, ",") != "token,config,search" {
+		t.Errorf("cleared = %v, want token, config and search", resp.Cleared)
+	}
+	if config.Token != "" || config.APIKey != "" || AMADEUS_HOST != "" {
+		t.Errorf("config = %+v, host %q, want both reset", config, AMADEUS_HOST)
+	}
+	if _, _, ok := searches.Get("search", now); ok {
+		t.Error("clearCaches() left a cached search")
+	}
+
+	// Clearing again is harmless
+	if err := json.Unmarshal([]byte(clearCaches()), &resp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithStatus(t *testing.T) {
+	tests := []struct {
+		data   string
+		status int
+		want   string
+	}{
+		{`{"a":1}`, 200, `{"_status":200,"a":1}`},
+		{`{}`, 404, `{"_status":404}`},
+		{`[1,2]`, 200, `[1,2]`},
+		{`{"a":1}`, 0, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		if got := string(withStatus([]byte(tt.data), tt.status)); got != tt.want {
+			t.Errorf("withStatus(%s, %d) = %s, want %s", tt.data, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalJSONStatusPretty(t *testing.T) {
+	setEnv(t, "INCLUDE_HTTP_STATUS", "true", "PRETTY_JSON", "true")
+	previous := lastStatus
+	lastStatus = 201
+	t.Cleanup(func() { lastStatus = previous })
+
+	data, err := marshalJSON(map[string]int{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"_status\": 201,\n  \"a\": 1\n}"; string(data) != want {
+		t.Errorf("marshalJSON() = %s, want %s", data, want)
+	}
+}
+
+func TestExportsUseCallCredentials(t *testing.T) {
+	key, secret := cm.Some("tenant_key"), cm.Some("tenant_secret")
+	exports := map[string]struct {
+		path string
+		call func() (string, error)
+	}{
+		"get-price-metrics": {PRICE_METRICS_PATH, func() (string, error) {
+			return getPriceMetrics("MAD", "CDG", "2025-12-21", key, secret)
+		}},
+		"get-checkin-link": {CHECKIN_LINKS_PATH, func() (string, error) {
+			return getCheckinLink("BA", "EN", key, secret)
+		}},
+	}
+	for name, export := range exports {
+		t.Run(name, func(t *testing.T) {
+			useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "configured", Expiration: time.Now().Unix() + 600})
+			fake := &fakeTransport{}
+			fake.respond(TOKEN_PATH, tokenResponse("tenant_token"))
+			fake.respond(export.path, fakeResponse{status: 200, body: `{"data":[]}`})
+			useTransport(t, fake)
+
+			export.call()
+
+			if len(fake.sent) != 2 || !strings.Contains(string(fake.sent[0].Body), "client_id=tenant_key") {
+				t.Fatalf("sent = %+v, want a token request for the call's credentials first", fake.sent)
+			}
+			if got := fake.sent[1].Headers["Authorization"]; got != "Bearer tenant_token" {
+				t.Errorf("Authorization = %q, want the call's token", got)
+			}
+			if config.Token != "configured" || currentToken() != "configured" {
+				t.Errorf("token = %q, want the configured token restored", currentToken())
+			}
+		})
+	}
+}
+
+func TestExportsRejectPartialCallCredentials(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "configured", Expiration: time.Now().Unix() + 600})
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	_, metricsErr := getPriceMetrics("MAD", "CDG", "2025-12-21", cm.Some("tenant_key"), cm.None[string]())
+	_, checkinErr := getCheckinLink("BA", "EN", cm.None[string](), cm.Some("tenant_secret"))
+	for _, err := range []error{metricsErr, checkinErr} {
+		var pluginErr *PluginError
+		if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_MISSING_REQUIRED_PARAM {
+			t.Errorf("error = %v, want %s", err, ERR_MISSING_REQUIRED_PARAM)
+		}
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none", len(fake.sent))
+	}
+}
+
+func TestRequestCompression(t *testing.T) {
+	setEnv(t, "HTTP_COMPRESS_REQUESTS", "true")
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret"})
+	fake := &fakeTransport{}
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 200, body: `{}`}, fakeResponse{status: 200, body: `{}`})
+	fake.respond(TOKEN_PATH, tokenResponse("token"))
+	useTransport(t, fake)
+
+	body := []byte(`{"originDestinations":[{"id":"1"}]}`)
+	if _, err := makeHTTPRequest("POST", FLIGHT_OFFERS_PATH, nil, body); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := makeHTTPRequest("GET", FLIGHT_OFFERS_PATH, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchToken(Credentials{APIKey: "key", APISecret: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	post, get, token := fake.sent[0], fake.sent[1], fake.sent[2]
+	if post.Headers["Content-Encoding"] != "gzip" || post.Headers["Content-Length"] != strconv.Itoa(len(post.Body)) {
+		t.Errorf("POST headers = %v, want gzip with the compressed length", post.Headers)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(post.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, _ := io.ReadAll(reader); !bytes.Equal(decoded, body) {
+		t.Errorf("POST body decodes to %s, want %s", decoded, body)
+	}
+	if _, ok := get.Headers["Content-Encoding"]; ok {
+		t.Error("GET request was marked compressed")
+	}
+	// The OAuth2 endpoint only accepts a plain form
+	if _, ok := token.Headers["Content-Encoding"]; ok || !strings.HasPrefix(string(token.Body), "grant_type=") {
+		t.Errorf("token request = %s %v, want a plain form", token.Body, token.Headers)
+	}
+}
+
+func TestRequestCompressionOff(t *testing.T) {
+	setEnv(t)
+	fake := &fakeTransport{}
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 200, body: `{}`})
+	useTransport(t, fake)
+
+	body := []byte(`{"originDestinations":[{"id":"1"}]}`)
+	if _, err := makeHTTPRequest("POST", FLIGHT_OFFERS_PATH, nil, body); err != nil {
+		t.Fatal(err)
+	}
+	if sent := fake.sent[0]; !bytes.Equal(sent.Body, body) || sent.Headers["Content-Encoding"] != "" {
+		t.Errorf("sent %s %v, want the body uncompressed", sent.Body, sent.Headers)
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	setEnv(t)
+	fake := &fakeTransport{}
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 200, body: `{}`}, fakeResponse{status: 200, body: `{}`}, fakeResponse{status: 200, body: `{}`})
+	useTransport(t, fake)
+
+	body := []byte(`{"originDestinations":[{"id":"1"}]}`)
+	for _, req := range []struct {
+		method string
+		body   []byte
+	}{{"POST", body}, {"POST", nil}, {"GET", nil}} {
+		if _, err := makeHTTPRequest(req.method, FLIGHT_OFFERS_PATH, nil, req.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := fake.sent[0].Headers["Content-Length"]; got != strconv.Itoa(len(body)) {
+		t.Errorf("POST Content-Length = %q, want %d", got, len(body))
+	}
+	// Only requests with a body declare a length
+	for _, sent := range fake.sent[1:] {
+		if got, ok := sent.Headers["Content-Length"]; ok {
+			t.Errorf("%s without a body sent Content-Length %q", sent.Method, got)
+		}
+	}
+}
+
+func TestNoContentResponse(t *testing.T) {
+	setEnv(t)
+	fake := &fakeTransport{}
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 204}, fakeResponse{status: 200}, fakeResponse{status: 200})
+	useTransport(t, fake)
+
+	for _, tt := range []struct {
+		method string
+		want   []byte
+	}{
+		{"POST", []byte(NO_CONTENT_BODY)},
+		{"GET", []byte(NO_CONTENT_BODY)},
+		// A HEAD probe still gets no body at all
+		{"HEAD", nil},
+	} {
+		body, err := makeHTTPRequest(tt.method, FLIGHT_OFFERS_PATH, nil, nil)
+		if err != nil || !bytes.Equal(body, tt.want) || (tt.want == nil) != (body == nil) {
+			t.Errorf("%s: %q, %v, want %q", tt.method, body, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.bytecodealliance.org/cm"
+)
+
+const PRICE_METRICS_PATH = "/v1/analytics/itinerary-price-metrics"
+
+// priceMetricsPath builds the price-metrics request path, pricing in the
+// default currency when one is configured
+func priceMetricsPath(origin string, destination string, departureDate string) string {
+	var query QueryBuilder
+	query.Set("originIataCode", origin)
+	query.Set("destinationIataCode", destination)
+	query.Set("departureDate", departureDate)
+	if config.DefaultCurrency != "" {
+		query.Set("currencyCode", config.DefaultCurrency)
+	}
+	return query.Path(PRICE_METRICS_PATH)
+}
+
+// normalizePriceMetrics converts a raw Amadeus price-metrics response into
+// the plugin's output format
+func normalizePriceMetrics(respBody []byte, result *PriceMetricsResult) error {
+	var raw AmadeusPriceMetricsResponse
+	if err := json.Unmarshal(respBody, &raw); err != nil {
+		return fmt.Errorf("failed to parse price metrics: %v", err)
+	}
+	// Amadeus answers routes it has no history for with an empty data list
+	if len(raw.Data) == 0 {
+		return nil
+	}
+
+	metrics := raw.Data[0]
+	result.Currency = metrics.CurrencyCode
+	result.OneWay = metrics.OneWay
+
+	quartiles := &PriceQuartiles{}
+	for _, metric := range metrics.PriceMetrics {
+		switch metric.QuartileRanking {
+		case "MINIMUM":
+			quartiles.Minimum = metric.Amount
+		case "FIRST":
+			quartiles.First = metric.Amount
+		case "MEDIUM":
+			quartiles.Median = metric.Amount
+		case "THIRD":
+			quartiles.Third = metric.Amount
+		case "MAXIMUM":
+			quartiles.Maximum = metric.Amount
+		}
+	}
+	result.Quartiles = quartiles
+	return nil
+}
+
+// getPriceMetrics looks up how fares for a route and date have historically
+// been distributed, so hosts can tell whether a price is a good deal
+func getPriceMetrics(origin string, destination string, departureDate string, apiKey cm.Option[string], apiSecret cm.Option[string]) (string, error) {
+	release, err := useCredentials(apiKey, apiSecret)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	// Load configuration
+	if err := loadConfig(); err != nil {
+		return "", err
+	}
+
+	if err := validateIATACode("origin", origin); err != nil {
+		return "", err
+	}
+	if err := validateIATACode("destination", destination); err != nil {
+		return "", err
+	}
+	departureDate = strings.TrimSpace(departureDate)
+	if departureDate == "" {
+		return "", &PluginError{Code: ERR_MISSING_REQUIRED_PARAM, Message: "departure-date is required"}
+	}
+
+	headers := map[string]string{
+		"Accept-Language": defaultPresentation().Locale,
+	}
+
+	respBody, err := authorizedRequest("GET", priceMetricsPath(origin, destination, departureDate), headers, nil)
+	if err != nil {
+		return "", fmt.Errorf("API request failed: %w", err)
+	}
+
+	result := &PriceMetricsResult{
+		Origin:        origin,
+		Destination:   destination,
+		DepartureDate: departureDate,
+	}
+	if err := normalizePriceMetrics(respBody, result); err != nil {
+		return "", err
+	}
+
+	data, err := marshalJSON(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %v", err)
+	}
+
+	return string(data), nil
+}
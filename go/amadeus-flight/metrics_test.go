@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.bytecodealliance.org/cm"
+)
+
+// Itinerary price metrics for MAD-CDG on 21 December
+const CAPTURED_PRICE_METRICS = `{"warnings":[],"data":[{"type":"itinerary-price-metric",
+  "origin":{"iataCode":"MAD"},"destination":{"iataCode":"CDG"},"departureDate":"2025-12-21",
+  "transportType":"FLIGHT","currencyCode":"EUR","oneWay":false,
+  "priceMetrics":[
+    {"amount":"84.15","quartileRanking":"MINIMUM"},
+    {"amount":"149.00","quartileRanking":"FIRST"},
+    {"amount":"183.45","quartileRanking":"MEDIUM"},
+    {"amount":"247.10","quartileRanking":"THIRD"},
+    {"amount":"572.23","quartileRanking":"MAXIMUM"}]}],
+  "meta":{"count":1}}`
+
+func TestNormalizePriceMetrics(t *testing.T) {
+	var result PriceMetricsResult
+	if err := normalizePriceMetrics([]byte(CAPTURED_PRICE_METRICS), &result); err != nil {
+		t.Fatalf("normalizePriceMetrics() error = %v", err)
+	}
+	if result.Currency != "EUR" || result.OneWay {
+		t.Errorf("currency, one-way = %q, %t, want EUR round trip", result.Currency, result.OneWay)
+	}
+	want := PriceQuartiles{Minimum: "84.15", First: "149.00", Median: "183.45", Third: "247.10", Maximum: "572.23"}
+	if result.Quartiles == nil || *result.Quartiles != want {
+		t.Errorf("quartiles = %+v, want %+v", result.Quartiles, want)
+	}
+}
+
+func TestNormalizePriceMetricsNoHistory(t *testing.T) {
+	var result PriceMetricsResult
+	if err := normalizePriceMetrics([]byte(`{"warnings":[],"data":[],"meta":{"count":0}}`), &result); err != nil {
+		t.Fatalf("normalizePriceMetrics() error = %v", err)
+	}
+	data, _ := json.Marshal(result)
+	if !strings.Contains(string(data), `"quartiles":null`) {
+		t.Errorf("result = %s, want null quartiles", data)
+	}
+}
+
+func TestGetPriceMetrics(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600, DefaultCurrency: "EUR"})
+	fake := &fakeTransport{}
+	fake.respond(PRICE_METRICS_PATH, fakeResponse{status: 200, body: CAPTURED_PRICE_METRICS})
+	useTransport(t, fake)
+
+	data, err := getPriceMetrics("MAD", "CDG", " 2025-12-21 ", cm.None[string](), cm.None[string]())
+	if err != nil {
+		t.Fatalf("getPriceMetrics() error = %v", err)
+	}
+	var result PriceMetricsResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Origin != "MAD" || result.Destination != "CDG" || result.DepartureDate != "2025-12-21" || result.Quartiles == nil {
+		t.Errorf("result = %+v, want MAD-CDG quartiles for 2025-12-21", result)
+	}
+	want := PRICE_METRICS_PATH + "?originIataCode=MAD&destinationIataCode=CDG&departureDate=2025-12-21&currencyCode=EUR"
+	if got := fake.sent[0].PathWithQuery; got != want {
+		t.Errorf("PathWithQuery = %q, want %q", got, want)
+	}
+}
+
+func TestGetPriceMetricsInvalidParams(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	for _, args := range [][3]string{{"MADRID", "CDG", "2025-12-21"}, {"MAD", "", "2025-12-21"}, {"MAD", "CDG", " "}} {
+		if _, err := getPriceMetrics(args[0], args[1], args[2], cm.None[string](), cm.None[string]()); err == nil {
+			t.Errorf("getPriceMetrics(%q) accepted invalid parameters", args)
+		}
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none", len(fake.sent))
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+)
+
+// Amadeus accepts between two and six legs in one multi-city search
+const (
+	MIN_MULTI_CITY_LEGS = 2
+	MAX_MULTI_CITY_LEGS = 6
+)
+
+// validateLegs checks each leg's airports and date, and that the legs are
+// in travel order. Legs may share a day, as when connecting onward the same
+// evening, and need not join up: an open jaw is a valid trip.
+func validateLegs(legs []amadeusflightcomponent.FlightLeg) error {
+	if len(legs) < MIN_MULTI_CITY_LEGS || len(legs) > MAX_MULTI_CITY_LEGS {
+		return &PluginError{
+			Code:    ERR_INVALID_LEGS,
+			Message: fmt.Sprintf("a multi-city search needs %d to %d legs, got %d", MIN_MULTI_CITY_LEGS, MAX_MULTI_CITY_LEGS, len(legs)),
+		}
+	}
+
+	var previous time.Time
+	for i, leg := range legs {
+		field := fmt.Sprintf("legs[%d]", i)
+		if err := validateIATACode(field+".origin", leg.Origin); err != nil {
+			return err
+		}
+		if err := validateIATACode(field+".destination", leg.Destination); err != nil {
+			return err
+		}
+		if leg.Origin == leg.Destination {
+			return &PluginError{
+				Code:    ERR_INVALID_LEGS,
+				Message: fmt.Sprintf("%s starts and ends at %s", field, leg.Origin),
+			}
+		}
+
+		date := strings.TrimSpace(leg.DepartureDate)
+		if date == "" {
+			return &PluginError{Code: ERR_MISSING_REQUIRED_PARAM, Message: field + ".departure-date is required"}
+		}
+		departure, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return &PluginError{
+				Code:    ERR_INVALID_LEGS,
+				Message: fmt.Sprintf("%s.departure-date %q: expected YYYY-MM-DD", field, leg.DepartureDate),
+			}
+		}
+		if departure.Before(previous) {
+			return &PluginError{
+				Code:    ERR_INVALID_LEGS,
+				Message: fmt.Sprintf("%s departs on %s, before legs[%d] on %s; list legs in travel order", field, date, i-1, previous.Format("2006-01-02")),
+			}
+		}
+		previous = departure
+	}
+	return nil
+}
+
+// multiCityBody builds the POST search body, one origin-destination per leg
+func multiCityBody(params amadeusflightcomponent.MultiCityParams, currency string) (*AmadeusSearchRequest, error) {
+	legs := params.Legs.Slice()
+	if err := validateLegs(legs); err != nil {
+		return nil, err
+	}
+
+	return buildSearchBody(legs, searchOptions{
+		Adults:        params.Adults,
+		Children:      params.Children,
+		Infants:       params.Infants,
+		InfantsInSeat: params.InfantsInSeat,
+		TravelClass:   params.TravelClass,
+		NonStop:       params.NonStop,
+		Currency:      currency,
+		MaxResults:    params.MaxResults,
+	})
+}
+
+// searchMultiCity searches a trip of several one-way legs in one request.
+// Each offer prices the whole trip and has one itinerary per leg, in order.
+func searchMultiCity(params amadeusflightcomponent.MultiCityParams) (string, error) {
+	release, err := useCredentials(params.APIKey, params.APISecret)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	// Load configuration
+	if err := loadConfig(); err != nil {
+		return "", err
+	}
+
+	shown, err := resolvePresentation(params.Presentation, params.CurrencyCode)
+	if err != nil {
+		return "", err
+	}
+	search, err := multiCityBody(params, shown.Currency)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(search)
+	if err != nil {
+		return "", fmt.Errorf("failed to build search request: %v", err)
+	}
+
+	respBody, err := authorizedRequest("POST", FLIGHT_OFFERS_PATH, withAcceptLanguage(postSearchHeaders(), shown.Locale), body)
+	if err != nil {
+		return "", fmt.Errorf("API request failed: %w", err)
+	}
+
+	result, err := normalizeOffers(respBody, TRIP_MULTI_CITY)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := marshalJSON(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %v", err)
+	}
+	return string(data), nil
+}
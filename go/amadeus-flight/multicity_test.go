@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// An open-jaw multi-city offer: into Paris, home from Rome
+const CAPTURED_MULTI_CITY_OFFERS = `{"meta":{"count":1},"data":[
+  {"type":"flight-offer","id":"1","price":{"currency":"EUR","total":"486.70"},
+   "itineraries":[
+     {"duration":"PT2H5M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T07:10:00"},
+       "arrival":{"iataCode":"CDG","at":"2025-12-20T09:15:00"},"carrierCode":"AF","number":"1001","duration":"PT2H5M"}]},
+     {"duration":"PT2H35M","segments":[{"departure":{"iataCode":"FCO","at":"2025-12-27T18:40:00"},
+       "arrival":{"iataCode":"MAD","at":"2025-12-27T21:15:00"},"carrierCode":"IB","number":"3235","duration":"PT2H35M"}]}]}
+]}`
+
+func openJawLegs() []amadeusflightcomponent.FlightLeg {
+	return []amadeusflightcomponent.FlightLeg{
+		{Origin: "MAD", Destination: "CDG", DepartureDate: "2025-12-20"},
+		{Origin: "FCO", Destination: "MAD", DepartureDate: " 2025-12-27 "},
+	}
+}
+
+func TestValidateLegs(t *testing.T) {
+	if err := validateLegs(openJawLegs()); err != nil {
+		t.Errorf("validateLegs(open jaw) error = %v", err)
+	}
+	sameDay := []amadeusflightcomponent.FlightLeg{
+		{Origin: "MAD", Destination: "CDG", DepartureDate: "2025-12-20"},
+		{Origin: "CDG", Destination: "JFK", DepartureDate: "2025-12-20"},
+	}
+	if err := validateLegs(sameDay); err != nil {
+		t.Errorf("validateLegs(same day) error = %v", err)
+	}
+
+	leg := func(origin, destination, date string) amadeusflightcomponent.FlightLeg {
+		return amadeusflightcomponent.FlightLeg{Origin: origin, Destination: destination, DepartureDate: date}
+	}
+	tests := []struct {
+		name string
+		legs []amadeusflightcomponent.FlightLeg
+		code string
+	}{
+		{"one leg", []amadeusflightcomponent.FlightLeg{leg("MAD", "CDG", "2025-12-20")}, ERR_INVALID_LEGS},
+		{"seven legs", make([]amadeusflightcomponent.FlightLeg, 7), ERR_INVALID_LEGS},
+		{"bad airport", []amadeusflightcomponent.FlightLeg{leg("MAD", "CDG", "2025-12-20"), leg("CDG", "Rome", "2025-12-27")}, ERR_INVALID_IATA_CODE},
+		{"round in place", []amadeusflightcomponent.FlightLeg{leg("MAD", "CDG", "2025-12-20"), leg("CDG", "CDG", "2025-12-27")}, ERR_INVALID_LEGS},
+		{"missing date", []amadeusflightcomponent.FlightLeg{leg("MAD", "CDG", "2025-12-20"), leg("CDG", "FCO", " ")}, ERR_MISSING_REQUIRED_PARAM},
+		{"bad date", []amadeusflightcomponent.FlightLeg{leg("MAD", "CDG", "2025-12-20"), leg("CDG", "FCO", "27/12/2025")}, ERR_INVALID_LEGS},
+		{"out of order", []amadeusflightcomponent.FlightLeg{leg("MAD", "CDG", "2025-12-20"), leg("CDG", "FCO", "2025-12-19")}, ERR_INVALID_LEGS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLegs(tt.legs)
+			var pluginErr *PluginError
+			if !errors.As(err, &pluginErr) || pluginErr.Code != tt.code {
+				t.Errorf("error = %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestMultiCityBody(t *testing.T) {
+	params := amadeusflightcomponent.MultiCityParams{
+		Legs:        cm.ToList(openJawLegs()),
+		Adults:      2,
+		TravelClass: cm.Some("business"),
+		NonStop:     cm.Some(true),
+	}
+	body, err := multiCityBody(params, "EUR")
+	if err != nil {
+		t.Fatalf("multiCityBody() error = %v", err)
+	}
+
+	if len(body.OriginDestinations) != 2 || body.CurrencyCode != "EUR" || len(body.Travelers) != 2 {
+		t.Fatalf("body = %+v, want two legs, EUR, and two travelers", body)
+	}
+	second := body.OriginDestinations[1]
+	if second.ID != "2" || second.OriginLocationCode != "FCO" || second.DestinationLocationCode != "MAD" || second.DepartureDateTimeRange.Date != "2025-12-27" {
+		t.Errorf("originDestinations[1] = %+v, want FCO-MAD on 2025-12-27", second)
+	}
+	filters := body.SearchCriteria.FlightFilters
+	if filters == nil || len(filters.CabinRestrictions) != 1 || filters.CabinRestrictions[0].Cabin != "BUSINESS" ||
+		len(filters.CabinRestrictions[0].OriginDestinationIDs) != 2 || filters.ConnectionRestriction == nil {
+		t.Errorf("filters = %+v, want business on both legs, non-stop", filters)
+	}
+}
+
+func TestSearchMultiCity(t *testing.T) {
+	setEnv(t)
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	fake := &fakeTransport{}
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 200, body: CAPTURED_MULTI_CITY_OFFERS})
+	useTransport(t, fake)
+
+	data, err := searchMultiCity(amadeusflightcomponent.MultiCityParams{Legs: cm.ToList(openJawLegs()), Adults: 1})
+	if err != nil {
+		t.Fatalf("searchMultiCity() error = %v", err)
+	}
+	var result FlightSearchResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.TripType != TRIP_MULTI_CITY || len(result.Offers) != 1 || len(result.Offers[0].Itineraries) != 2 {
+		t.Errorf("result = %+v, want one multi-city offer with an itinerary per leg", result)
+	}
+
+	sent := fake.sent[0]
+	if sent.Method != "POST" || sent.Headers["X-HTTP-Method-Override"] != "GET" {
+		t.Errorf("sent %s with %v, want a POST-tunneled GET", sent.Method, sent.Headers)
+	}
+	var body AmadeusSearchRequest
+	if err := json.Unmarshal(sent.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.OriginDestinations) != 2 || body.OriginDestinations[1].OriginLocationCode != "FCO" {
+		t.Errorf("search body = %s, want both legs", sent.Body)
+	}
+}
+
+func TestSearchMultiCityInvalidLegs(t *testing.T) {
+	setEnv(t)
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	legs := openJawLegs()[:1]
+	_, err := searchMultiCity(amadeusflightcomponent.MultiCityParams{Legs: cm.ToList(legs), Adults: 1})
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_LEGS {
+		t.Errorf("error = %v, want %s", err, ERR_INVALID_LEGS)
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none", len(fake.sent))
+	}
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+)
+
+const (
+	TRIP_ONE_WAY    = "one-way"
+	TRIP_ROUND_TRIP = "round-trip"
+	TRIP_MULTI_CITY = "multi-city"
+)
+
+// tripType classifies a search from its dates. A missing or blank return
+// date means one-way, and a return before departure is rejected.
+func tripType(params amadeusflightcomponent.FlightSearchParams) (string, error) {
+	returnDate := params.ReturnDate.Some()
+	if returnDate == nil || strings.TrimSpace(*returnDate) == "" {
+		return TRIP_ONE_WAY, nil
+	}
+
+	departure, err := time.Parse("2006-01-02", params.DepartureDate)
+	if err != nil {
+		return "", fmt.Errorf("invalid departure date %q: expected YYYY-MM-DD", params.DepartureDate)
+	}
+	ret, err := time.Parse("2006-01-02", strings.TrimSpace(*returnDate))
+	if err != nil {
+		return "", fmt.Errorf("invalid return date %q: expected YYYY-MM-DD", *returnDate)
+	}
+	switch {
+	case ret.Before(departure):
+		return "", fmt.Errorf("return date %s is before departure date %s", *returnDate, params.DepartureDate)
+	case ret.Equal(departure):
+		// A same-day return is still a round trip, not two one-ways: Amadeus
+		// accepts equal dates and prices both legs as one offer
+		return TRIP_ROUND_TRIP, nil
+	default:
+		return TRIP_ROUND_TRIP, nil
+	}
+}
+
+// offerKey identifies an offer by its price and the flights it books, so
+// offers that differ only in ID compare equal
+func offerKey(offer FlightOffer) string {
+	var key strings.Builder
+	fmt.Fprintf(&key, "%s %s", offer.TotalPrice, offer.Currency)
+	for _, itinerary := range offer.Itineraries {
+		key.WriteString("|")
+		for _, segment := range itinerary.Segments {
+			fmt.Fprintf(&key, ";%s%s %s %s %s %s",
+				segment.CarrierCode, segment.FlightNumber,
+				segment.DepartureAirport, segment.DepartureTime,
+				segment.ArrivalAirport, segment.ArrivalTime)
+		}
+	}
+	return key.String()
+}
+
+// dedupeOffers drops offers that repeat an earlier offer's segments and
+// price, keeping the first occurrence, and reports how many were dropped
+func dedupeOffers(offers []FlightOffer) ([]FlightOffer, int) {
+	seen := make(map[string]bool, len(offers))
+	unique := make([]FlightOffer, 0, len(offers))
+	for _, offer := range offers {
+		key := offerKey(offer)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, offer)
+	}
+	return unique, len(offers) - len(unique)
+}
+
+// checkedBagsBySegment maps segment IDs to their included checked bags. The
+// first traveler's fare is used; offers without traveler pricing or with no
+// allowance on a segment simply have no entry.
+func checkedBagsBySegment(offer AmadeusFlightOffer) map[string]*CheckedBags {
+	bags := make(map[string]*CheckedBags)
+	if len(offer.TravelerPricings) == 0 {
+		return bags
+	}
+
+	for _, details := range offer.TravelerPricings[0].FareDetailsBySegment {
+		included := details.IncludedCheckedBags
+		if included == nil || (included.Quantity == nil && included.Weight == nil) {
+			continue
+		}
+		bags[details.SegmentID] = &CheckedBags{
+			Quantity:   included.Quantity,
+			Weight:     included.Weight,
+			WeightUnit: included.WeightUnit,
+		}
+	}
+	return bags
+}
+
+// normalizeLinks keeps the links that are absolute http(s) URLs, or returns
+// nil when none are, so the links key is left out
+func normalizeLinks(links AmadeusLinks) map[string]string {
+	var normalized map[string]string
+	for name, raw := range links {
+		var link string
+		if json.Unmarshal(raw, &link) != nil {
+			continue
+		}
+		if !strings.HasPrefix(link, "https://") && !strings.HasPrefix(link, "http://") {
+			continue
+		}
+		if normalized == nil {
+			normalized = make(map[string]string)
+		}
+		normalized[name] = link
+	}
+	return normalized
+}
+
+// cabinsBySegment maps segment IDs to the cabin the fare books on each, e.g.
+// "ECONOMY" or "BUSINESS"; one offer can mix cabins across segments. The
+// first traveler's fare is used, as for checked bags.
+func cabinsBySegment(offer AmadeusFlightOffer) map[string]string {
+	cabins := make(map[string]string)
+	if len(offer.TravelerPricings) == 0 {
+		return cabins
+	}
+
+	for _, details := range offer.TravelerPricings[0].FareDetailsBySegment {
+		if details.Cabin != "" {
+			cabins[details.SegmentID] = details.Cabin
+		}
+	}
+	return cabins
+}
+
+// parseAirportList splits a comma-separated list of IATA airport codes,
+// trimming and upper-casing each one before validating it
+func parseAirportList(field string, codes string) ([]string, error) {
+	var airports []string
+	for _, code := range strings.Split(codes, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		if err := validateIATACode(field, code); err != nil {
+			return nil, err
+		}
+		airports = append(airports, code)
+	}
+	return airports, nil
+}
+
+// connectionAirports lists where an offer changes planes: the arrival
+// airport of every segment but the last in each itinerary
+func connectionAirports(offer FlightOffer) []string {
+	var airports []string
+	for _, itinerary := range offer.Itineraries {
+		for i := 0; i < len(itinerary.Segments)-1; i++ {
+			airports = append(airports, itinerary.Segments[i].ArrivalAirport)
+		}
+	}
+	return airports
+}
+
+// filterByConnections drops offers connecting through an avoided airport,
+// and, when require is set, offers not connecting through any of its
+// airports. It reports how many were dropped.
+func filterByConnections(offers []FlightOffer, avoid []string, require []string) ([]FlightOffer, int) {
+	kept := make([]FlightOffer, 0, len(offers))
+	for _, offer := range offers {
+		connections := connectionAirports(offer)
+		avoided := slices.ContainsFunc(connections, func(airport string) bool {
+			return slices.Contains(avoid, airport)
+		})
+		required := len(require) == 0 || slices.ContainsFunc(connections, func(airport string) bool {
+			return slices.Contains(require, airport)
+		})
+		if !avoided && required {
+			kept = append(kept, offer)
+		}
+	}
+	return kept, len(offers) - len(kept)
+}
+
+// co2EmissionsKg sums the per-segment CO2 estimates of an offer in
+// kilograms. A partial total would understate the trip, so it returns nil
+// unless every segment has a KG estimate; partial reports that some segments
+// had one, so the estimate was dropped rather than never reported.
+func co2EmissionsKg(offer AmadeusFlightOffer) (kg *int, partial bool) {
+	total := 0
+	segments, estimated := 0, 0
+	for _, itinerary := range offer.Itineraries {
+		for _, segment := range itinerary.Segments {
+			segments++
+			for _, emission := range segment.Co2Emissions {
+				if strings.EqualFold(emission.WeightUnit, "KG") {
+					total += emission.Weight
+					estimated++
+					break
+				}
+			}
+		}
+	}
+	if segments == 0 || estimated < segments {
+		return nil, estimated > 0
+	}
+	return &total, false
+}
+
+// ticketingExpired reports whether a last ticketing date is before today in
+// UTC. Amadeus gives the date without a time zone, so the whole UTC day
+// counts; an unreadable date is never expired.
+func ticketingExpired(lastTicketingDate string, now time.Time) bool {
+	deadline, err := time.Parse("2006-01-02", lastTicketingDate)
+	if err != nil {
+		return false
+	}
+	today := now.UTC().Truncate(24 * time.Hour)
+	return deadline.Before(today)
+}
+
+// filterExpired drops offers whose ticketing deadline has passed and reports
+// how many were dropped
+func filterExpired(offers []FlightOffer) ([]FlightOffer, int) {
+	kept := make([]FlightOffer, 0, len(offers))
+	for _, offer := range offers {
+		if !offer.TicketingExpired {
+			kept = append(kept, offer)
+		}
+	}
+	return kept, len(offers) - len(kept)
+}
+
+// filterByMaxStops drops offers with any itinerary over maxStops stops and
+// reports how many were dropped
+func filterByMaxStops(offers []FlightOffer, maxStops int) ([]FlightOffer, int) {
+	kept := make([]FlightOffer, 0, len(offers))
+	for _, offer := range offers {
+		withinLimit := true
+		for _, itinerary := range offer.Itineraries {
+			if itinerary.Stops > maxStops {
+				withinLimit = false
+				break
+			}
+		}
+		if withinLimit {
+			kept = append(kept, offer)
+		}
+	}
+	return kept, len(offers) - len(kept)
+}
+
+// timeWindow is a time-of-day range in minutes after midnight, inclusive at
+// both ends. A start after the end wraps past midnight (e.g. 22:00-02:00).
+type timeWindow struct {
+	start int
+	end   int
+}
+
+// parseTimeWindow parses a window written as "HH:MM-HH:MM"
+func parseTimeWindow(window string) (timeWindow, error) {
+	invalid := &PluginError{
+		Code:    ERR_INVALID_TIME_WINDOW,
+		Message: fmt.Sprintf("invalid departure time window %q: expected HH:MM-HH:MM, e.g. \"06:00-12:00\"", window),
+	}
+
+	startText, endText, found := strings.Cut(strings.TrimSpace(window), "-")
+	if !found {
+		return timeWindow{}, invalid
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(startText))
+	if err != nil {
+		return timeWindow{}, invalid
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(endText))
+	if err != nil {
+		return timeWindow{}, invalid
+	}
+
+	return timeWindow{
+		start: start.Hour()*60 + start.Minute(),
+		end:   end.Hour()*60 + end.Minute(),
+	}, nil
+}
+
+// contains reports whether a minute of the day falls inside the window
+func (w timeWindow) contains(minute int) bool {
+	if w.start <= w.end {
+		return minute >= w.start && minute <= w.end
+	}
+	return minute >= w.start || minute <= w.end
+}
+
+// filterByDepartureWindow keeps offers whose outbound flight leaves inside
+// the window, by local time at the departure airport, and reports how many
+// were dropped. Offers with an unreadable departure time are kept.
+func filterByDepartureWindow(offers []FlightOffer, window timeWindow) ([]FlightOffer, int) {
+	kept := make([]FlightOffer, 0, len(offers))
+	for _, offer := range offers {
+		if len(offer.Itineraries) > 0 && len(offer.Itineraries[0].Segments) > 0 {
+			departure, err := time.Parse("2006-01-02T15:04:05", offer.Itineraries[0].Segments[0].DepartureTime)
+			if err == nil && !window.contains(departure.Hour()*60+departure.Minute()) {
+				continue
+			}
+		}
+		kept = append(kept, offer)
+	}
+	return kept, len(offers) - len(kept)
+}
+
+// layovers computes the gap between each segment's arrival and the next
+// segment's departure. Both times are local to the connecting airport, so
+// subtracting the full timestamps gives the wait even across midnight.
+// Connections with an unreadable or out-of-order time are left out.
+func layovers(segments []Segment) []Layover {
+	var result []Layover
+	for i := 1; i < len(segments); i++ {
+		arrival, err := time.Parse("2006-01-02T15:04:05", segments[i-1].ArrivalTime)
+		if err != nil {
+			continue
+		}
+		departure, err := time.Parse("2006-01-02T15:04:05", segments[i].DepartureTime)
+		if err != nil || departure.Before(arrival) {
+			continue
+		}
+		wait := departure.Sub(arrival)
+		result = append(result, Layover{
+			Airport:         segments[i-1].ArrivalAirport,
+			Duration:        FormatISODuration(wait),
+			DurationMinutes: int(wait / time.Minute),
+		})
+	}
+	return result
+}
+
+// normalizeOffers converts a raw Amadeus flight-offers response into the
+// plugin's flattened output format
+func normalizeOffers(respBody []byte, tripType string) (*FlightSearchResult, error) {
+	var raw AmadeusFlightOffersResponse
+	if err := json.Unmarshal(respBody, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse flight offers: %v", err)
+	}
+
+	result := &FlightSearchResult{
+		TripType: tripType,
+		Links:    normalizeLinks(raw.Meta.Links),
+		Offers:   make([]FlightOffer, 0, len(raw.Data)),
+	}
+
+	now := time.Now()
+	var partialCo2 []string
+	for _, offer := range raw.Data {
+		co2, partial := co2EmissionsKg(offer)
+		if partial {
+			partialCo2 = append(partialCo2, offer.ID)
+		}
+		normalized := FlightOffer{
+			ID:                offer.ID,
+			TotalPrice:        offer.Price.Total,
+			Currency:          offer.Price.Currency,
+			Co2EmissionsKg:    co2,
+			LastTicketingDate: offer.LastTicketingDate,
+			TicketingExpired:  ticketingExpired(offer.LastTicketingDate, now),
+			OneWay:            offer.OneWay,
+			Links:             normalizeLinks(offer.Links),
+			Itineraries:       make([]Itinerary, 0, len(offer.Itineraries)),
+		}
+
+		bags := checkedBagsBySegment(offer)
+		cabins := cabinsBySegment(offer)
+
+		for _, itinerary := range offer.Itineraries {
+			segments := make([]Segment, 0, len(itinerary.Segments))
+			stops := max(len(itinerary.Segments)-1, 0)
+			for _, segment := range itinerary.Segments {
+				stops += segment.NumberOfStops
+				segments = append(segments, Segment{
+					DepartureAirport: segment.Departure.IataCode,
+					DepartureTime:    segment.Departure.At,
+					ArrivalAirport:   segment.Arrival.IataCode,
+					ArrivalTime:      segment.Arrival.At,
+					CarrierCode:      segment.CarrierCode,
+					FlightNumber:     segment.Number,
+					Duration:         segment.Duration,
+					Cabin:            cabins[segment.ID],
+					CheckedBags:      bags[segment.ID],
+				})
+			}
+			normalized.Itineraries = append(normalized.Itineraries, Itinerary{
+				Duration: itinerary.Duration,
+				Stops:    stops,
+				Segments: segments,
+				Layovers: layovers(segments),
+			})
+		}
+
+		result.Offers = append(result.Offers, normalized)
+	}
+
+	if len(partialCo2) > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"co2_emissions_kg unavailable for offers %s: some segments have no estimate",
+			strings.Join(partialCo2, ", "),
+		))
+	}
+
+	result.Count = len(result.Offers)
+	return result, nil
+}
+
+// attachRawSegments sets RawSegments on each offer from the response it was
+// normalized from. It must run before any filter, while result.Offers still
+// lines up with the response's data.
+func attachRawSegments(respBody []byte, result *FlightSearchResult) error {
+	var raw AmadeusRawOffers
+	if err := json.Unmarshal(respBody, &raw); err != nil {
+		return fmt.Errorf("failed to parse flight offers: %v", err)
+	}
+	for i, offer := range raw.Data {
+		if i >= len(result.Offers) {
+			break
+		}
+		segments := []json.RawMessage{}
+		for _, itinerary := range offer.Itineraries {
+			segments = append(segments, itinerary.Segments...)
+		}
+		result.Offers[i].RawSegments = segments
+	}
+	return nil
+}
+
+// jsonlMetadata is a search result with its offers left out; the Offers
+// field shadows the embedded one so it can be omitted
+type jsonlMetadata struct {
+	*FlightSearchResult
+	Offers []FlightOffer `json:"offers,omitempty"`
+}
+
+// offersJSONL renders one compact JSON offer per line, so hosts can split
+// on newlines and handle each offer without parsing the whole response.
+// A last {"metadata": ...} line carries the rest of the result, such as
+// the count, filter counts, and warnings. PRETTY_JSON is ignored here
+// since indenting would break the line framing.
+func offersJSONL(result *FlightSearchResult) (string, error) {
+	var lines strings.Builder
+	for _, offer := range result.Offers {
+		line, err := json.Marshal(offer)
+		if err != nil {
+			return "", err
+		}
+		lines.Write(line)
+		lines.WriteByte('\n')
+	}
+
+	metadata, err := json.Marshal(map[string]jsonlMetadata{"metadata": {FlightSearchResult: result}})
+	if err != nil {
+		return "", err
+	}
+	lines.Write(metadata)
+	lines.WriteByte('\n')
+	return lines.String(), nil
+}
+
+// searchFlightsJSONL is search-flights with the offers as JSON lines
+func searchFlightsJSONL(params amadeusflightcomponent.FlightSearchParams) (string, error) {
+	result, err := findOffers(params)
+	if err != nil {
+		return "", err
+	}
+
+	lines, err := offersJSONL(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %v", err)
+	}
+	return lines, nil
+}
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+	"go.bytecodealliance.org/cm"
+)
+
+func TestTripType(t *testing.T) {
+	tests := []struct {
+		name       string
+		departure  string
+		returnDate cm.Option[string]
+		want       string
+		wantErr    string
+	}{
+		{"one-way", "2025-12-20", cm.None[string](), TRIP_ONE_WAY, ""},
+		{"blank return", "2025-12-20", cm.Some("  "), TRIP_ONE_WAY, ""},
+		{"round trip", "2025-12-20", cm.Some("2025-12-27"), TRIP_ROUND_TRIP, ""},
+		{"same-day return", "2025-12-20", cm.Some("2025-12-20"), TRIP_ROUND_TRIP, ""},
+		{"return before departure", "2025-12-20", cm.Some("2025-12-19"), "", "before departure date"},
+		{"bad return date", "2025-12-20", cm.Some("20/12/2025"), "", "invalid return date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tripType(amadeusflightcomponent.FlightSearchParams{
+				DepartureDate: tt.departure,
+				ReturnDate:    tt.returnDate,
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("tripType() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("tripType() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("tripType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeOffersTripType(t *testing.T) {
+	body := []byte(`{"data":[{"id":"1","price":{"total":"120.50","currency":"EUR"},
+		"itineraries":[{"duration":"PT2H","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T08:00:00"},
+		"arrival":{"iataCode":"CDG","at":"2025-12-20T10:00:00"},"carrierCode":"IB","number":"3436","duration":"PT2H"}]}]}]}`)
+
+	result, err := normalizeOffers(body, TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	if result.TripType != TRIP_ONE_WAY {
+		t.Errorf("TripType = %q, want %q", result.TripType, TRIP_ONE_WAY)
+	}
+	if result.Count != 1 || result.Offers[0].TotalPrice != "120.50" {
+		t.Fatalf("offers = %+v, want the one offer at 120.50", result.Offers)
+	}
+	if segments := result.Offers[0].Itineraries[0].Segments; segments[0].FlightNumber != "3436" {
+		t.Errorf("segments = %+v, want flight 3436", segments)
+	}
+}
+
+// A flight-offers response where offer 2 repeats offer 1 under a new ID and
+// offer 3 books the same flight at a different price
+const CAPTURED_DUPLICATE_OFFERS = `{"meta":{"count":3},"data":[
+  {"type":"flight-offer","id":"1","source":"GDS","price":{"currency":"EUR","total":"215.40","base":"160.00"},
+   "itineraries":[{"duration":"PT8H10M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T12:05:00"},
+     "arrival":{"iataCode":"JFK","terminal":"7","at":"2025-12-20T14:15:00"},"carrierCode":"IB","number":"6251","duration":"PT8H10M","id":"1"}]}]},
+  {"type":"flight-offer","id":"2","source":"GDS","price":{"currency":"EUR","total":"215.40","base":"160.00"},
+   "itineraries":[{"duration":"PT8H10M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T12:05:00"},
+     "arrival":{"iataCode":"JFK","terminal":"7","at":"2025-12-20T14:15:00"},"carrierCode":"IB","number":"6251","duration":"PT8H10M","id":"5"}]}]},
+  {"type":"flight-offer","id":"3","source":"GDS","price":{"currency":"EUR","total":"298.10","base":"240.00"},
+   "itineraries":[{"duration":"PT8H10M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T12:05:00"},
+     "arrival":{"iataCode":"JFK","terminal":"7","at":"2025-12-20T14:15:00"},"carrierCode":"IB","number":"6251","duration":"PT8H10M","id":"9"}]}]}
+]}`
+
+func TestDedupeOffers(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_DUPLICATE_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+
+	unique, removed := dedupeOffers(result.Offers)
+	if removed != 1 {
+		t.Errorf("removed = %d, want 1", removed)
+	}
+	if len(unique) != 2 || unique[0].ID != "1" || unique[1].ID != "3" {
+		t.Errorf("kept %+v, want offers 1 and 3", unique)
+	}
+}
+
+func TestApplyOfferFiltersDedupe(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_DUPLICATE_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+
+	applyOfferFilters(amadeusflightcomponent.FlightSearchParams{Dedupe: cm.Some(true)}, result)
+	if result.DuplicatesRemoved == nil || *result.DuplicatesRemoved != 1 {
+		t.Errorf("DuplicatesRemoved = %v, want 1", result.DuplicatesRemoved)
+	}
+	if len(result.Offers) != 2 {
+		t.Errorf("got %d offers, want 2", len(result.Offers))
+	}
+
+	// Without the flag nothing is removed or reported
+	result, _ = normalizeOffers([]byte(CAPTURED_DUPLICATE_OFFERS), TRIP_ONE_WAY)
+	applyOfferFilters(amadeusflightcomponent.FlightSearchParams{}, result)
+	if result.DuplicatesRemoved != nil || len(result.Offers) != 3 {
+		t.Errorf("without dedupe: removed %v, %d offers", result.DuplicatesRemoved, len(result.Offers))
+	}
+}
+
+// A round-trip offer whose outbound fare includes one bag and whose inbound
+// fare gives a weight allowance, followed by an offer with no traveler
+// pricing at all
+const CAPTURED_BAGGAGE_OFFERS = `{"data":[
+  {"id":"1","price":{"currency":"EUR","total":"512.30"},
+   "itineraries":[
+     {"duration":"PT8H10M","segments":[{"id":"1","departure":{"iataCode":"MAD","at":"2025-12-20T12:05:00"},
+       "arrival":{"iataCode":"JFK","at":"2025-12-20T14:15:00"},"carrierCode":"IB","number":"6251","duration":"PT8H10M"}]},
+     {"duration":"PT7H5M","segments":[{"id":"2","departure":{"iataCode":"JFK","at":"2025-12-27T19:00:00"},
+       "arrival":{"iataCode":"MAD","at":"2025-12-28T08:05:00"},"carrierCode":"IB","number":"6252","duration":"PT7H5M"}]}],
+   "travelerPricings":[{"travelerId":"1","fareOption":"STANDARD","travelerType":"ADULT","fareDetailsBySegment":[
+     {"segmentId":"1","cabin":"ECONOMY","fareBasis":"ADNNALB4","class":"A","includedCheckedBags":{"quantity":1}},
+     {"segmentId":"2","cabin":"ECONOMY","fareBasis":"ADNNALB4","class":"A","includedCheckedBags":{"weight":23,"weightUnit":"KG"}}]}]},
+  {"id":"2","price":{"currency":"EUR","total":"498.00"},
+   "itineraries":[{"duration":"PT8H10M","segments":[{"id":"3","departure":{"iataCode":"MAD","at":"2025-12-20T12:05:00"},
+     "arrival":{"iataCode":"JFK","at":"2025-12-20T14:15:00"},"carrierCode":"UX","number":"91","duration":"PT8H10M"}]}]}
+]}`
+
+func TestNormalizeOffersCheckedBags(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_BAGGAGE_OFFERS), TRIP_ROUND_TRIP)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+
+	outbound := result.Offers[0].Itineraries[0].Segments[0].CheckedBags
+	if outbound == nil || outbound.Quantity == nil || *outbound.Quantity != 1 || outbound.Weight != nil {
+		t.Errorf("outbound bags = %+v, want a quantity of 1", outbound)
+	}
+	inbound := result.Offers[0].Itineraries[1].Segments[0].CheckedBags
+	if inbound == nil || inbound.Weight == nil || *inbound.Weight != 23 || inbound.WeightUnit != "KG" || inbound.Quantity != nil {
+		t.Errorf("inbound bags = %+v, want 23 KG", inbound)
+	}
+
+	// No traveler pricing means no allowance, not an error
+	if bags := result.Offers[1].Itineraries[0].Segments[0].CheckedBags; bags != nil {
+		t.Errorf("offer 2 bags = %+v, want none", bags)
+	}
+	data, _ := json.Marshal(result.Offers[1])
+	if strings.Contains(string(data), "checked_bags") {
+		t.Errorf("offer 2 = %s, want checked_bags left out", data)
+	}
+}
+
+// A direct flight, a one-connection flight, and a direct flight with a
+// technical stop, all MAD-JFK
+func TestNormalizeOffersCabin(t *testing.T) {
+	// One offer can mix cabins: economy out, business back
+	body := strings.Replace(CAPTURED_BAGGAGE_OFFERS, `{"segmentId":"2","cabin":"ECONOMY"`, `{"segmentId":"2","cabin":"BUSINESS"`, 1)
+	result, err := normalizeOffers([]byte(body), TRIP_ROUND_TRIP)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+
+	itineraries := result.Offers[0].Itineraries
+	if got := itineraries[0].Segments[0].Cabin; got != "ECONOMY" {
+		t.Errorf("outbound cabin = %q, want ECONOMY", got)
+	}
+	if got := itineraries[1].Segments[0].Cabin; got != "BUSINESS" {
+		t.Errorf("inbound cabin = %q, want BUSINESS", got)
+	}
+
+	// Without fare details the cabin is unknown and left out
+	data, _ := json.Marshal(result.Offers[1])
+	if strings.Contains(string(data), `"cabin"`) {
+		t.Errorf("offer 2 = %s, want cabin left out", data)
+	}
+}
+
+func TestCabinsBySegmentBlank(t *testing.T) {
+	var offer AmadeusFlightOffer
+	if err := json.Unmarshal([]byte(`{"travelerPricings":[{"fareDetailsBySegment":[{"segmentId":"1","cabin":""}]}]}`), &offer); err != nil {
+		t.Fatal(err)
+	}
+	if cabins := cabinsBySegment(offer); len(cabins) != 0 {
+		t.Errorf("cabinsBySegment() = %v, want blank cabins skipped", cabins)
+	}
+}
+
+const CAPTURED_STOPS_OFFERS = `{"data":[
+  {"id":"1","price":{"currency":"EUR","total":"315.20"},
+   "itineraries":[{"duration":"PT8H10M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T12:05:00"},
+     "arrival":{"iataCode":"JFK","at":"2025-12-20T14:15:00"},"carrierCode":"IB","number":"6251","duration":"PT8H10M","numberOfStops":0}]}]},
+  {"id":"2","price":{"currency":"EUR","total":"241.80"},
+   "itineraries":[{"duration":"PT11H40M","segments":[
+     {"departure":{"iataCode":"MAD","at":"2025-12-20T07:00:00"},"arrival":{"iataCode":"LHR","at":"2025-12-20T08:25:00"},"carrierCode":"BA","number":"459","duration":"PT2H25M","numberOfStops":0},
+     {"departure":{"iataCode":"LHR","at":"2025-12-20T11:00:00"},"arrival":{"iataCode":"JFK","at":"2025-12-20T13:40:00"},"carrierCode":"BA","number":"117","duration":"PT7H40M","numberOfStops":0}]}]},
+  {"id":"3","price":{"currency":"EUR","total":"278.00"},
+   "itineraries":[{"duration":"PT9H55M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T09:30:00"},
+     "arrival":{"iataCode":"JFK","at":"2025-12-20T13:25:00"},"carrierCode":"UX","number":"93","duration":"PT9H55M","numberOfStops":1}]}]}
+]}`
+
+func TestNormalizeOffersStops(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_STOPS_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	for i, want := range []int{0, 1, 1} {
+		if got := result.Offers[i].Itineraries[0].Stops; got != want {
+			t.Errorf("offer %s stops = %d, want %d", result.Offers[i].ID, got, want)
+		}
+	}
+}
+
+func TestNormalizeOffersLayovers(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_STOPS_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	want := []Layover{{Airport: "LHR", Duration: "PT2H35M", DurationMinutes: 155}}
+	if got := result.Offers[1].Itineraries[0].Layovers; !slices.Equal(got, want) {
+		t.Errorf("offer 2 layovers = %+v, want %+v", got, want)
+	}
+	// A direct flight, even with a technical stop, has no connection to wait for
+	for _, i := range []int{0, 2} {
+		if got := result.Offers[i].Itineraries[0].Layovers; got != nil {
+			t.Errorf("offer %s layovers = %+v, want none", result.Offers[i].ID, got)
+		}
+	}
+}
+
+func TestLayovers(t *testing.T) {
+	segment := func(from, departure, to, arrival string) Segment {
+		return Segment{DepartureAirport: from, DepartureTime: departure, ArrivalAirport: to, ArrivalTime: arrival}
+	}
+	tests := []struct {
+		name     string
+		segments []Segment
+		want     []Layover
+	}{
+		{"overnight", []Segment{
+			segment("JFK", "2025-12-20T18:00:00", "KEF", "2025-12-20T22:30:00"),
+			segment("KEF", "2025-12-21T07:40:00", "CPH", "2025-12-21T11:55:00"),
+		}, []Layover{{Airport: "KEF", Duration: "PT9H10M", DurationMinutes: 550}}},
+		{"two connections", []Segment{
+			segment("MAD", "2025-12-20T07:00:00", "LHR", "2025-12-20T08:25:00"),
+			segment("LHR", "2025-12-20T09:10:00", "DUB", "2025-12-20T10:30:00"),
+			segment("DUB", "2025-12-20T12:30:00", "BOS", "2025-12-20T14:45:00"),
+		}, []Layover{
+			{Airport: "LHR", Duration: "PT45M", DurationMinutes: 45},
+			{Airport: "DUB", Duration: "PT2H", DurationMinutes: 120},
+		}},
+		{"unreadable time", []Segment{
+			segment("MAD", "2025-12-20T07:00:00", "LHR", "08:25"),
+			segment("LHR", "2025-12-20T09:10:00", "DUB", "2025-12-20T10:30:00"),
+		}, nil},
+		{"out of order", []Segment{
+			segment("MAD", "2025-12-20T07:00:00", "LHR", "2025-12-20T10:25:00"),
+			segment("LHR", "2025-12-20T09:10:00", "DUB", "2025-12-20T10:30:00"),
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := layovers(tt.segments); !slices.Equal(got, tt.want) {
+				t.Errorf("layovers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOfferFiltersMaxStops(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_STOPS_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+
+	applyOfferFilters(amadeusflightcomponent.FlightSearchParams{MaxStops: cm.Some[uint32](0)}, result)
+	if result.FilteredByMaxStops == nil || *result.FilteredByMaxStops != 2 {
+		t.Errorf("FilteredByMaxStops = %v, want 2", result.FilteredByMaxStops)
+	}
+	if result.Count != 1 || len(result.Offers) != 1 || result.Offers[0].ID != "1" {
+		t.Errorf("count %d, offers %+v, want only the direct offer 1", result.Count, result.Offers)
+	}
+
+	// Without the parameter nothing is filtered or reported
+	result, _ = normalizeOffers([]byte(CAPTURED_STOPS_OFFERS), TRIP_ONE_WAY)
+	applyOfferFilters(amadeusflightcomponent.FlightSearchParams{}, result)
+	if result.FilteredByMaxStops != nil || result.Count != 3 {
+		t.Errorf("without max-stops: filtered %v, count %d", result.FilteredByMaxStops, result.Count)
+	}
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	tests := []struct {
+		window  string
+		want    timeWindow
+		wantErr bool
+	}{
+		{"06:00-12:00", timeWindow{start: 360, end: 720}, false},
+		{" 22:30 - 02:00 ", timeWindow{start: 1350, end: 120}, false},
+		{"00:00-23:59", timeWindow{start: 0, end: 1439}, false},
+		{"06:00", timeWindow{}, true},
+		{"6am-noon", timeWindow{}, true},
+		{"06:00-24:00", timeWindow{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeWindow(tt.window)
+		if tt.wantErr {
+			var pluginErr *PluginError
+			if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_TIME_WINDOW {
+				t.Errorf("parseTimeWindow(%q) error = %v, want %s", tt.window, err, ERR_INVALID_TIME_WINDOW)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseTimeWindow(%q) = %+v, %v, want %+v", tt.window, got, err, tt.want)
+		}
+	}
+}
+
+func TestFilterByDepartureWindow(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_STOPS_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	// Departures are 12:05, 07:00 and 09:30; a fourth offer has no readable time
+	offers := append(result.Offers, FlightOffer{ID: "4", Itineraries: []Itinerary{{Segments: []Segment{{DepartureTime: "soon"}}}}})
+
+	tests := []struct {
+		window  string
+		wantIDs string
+	}{
+		{"06:00-10:00", "2,3,4"},
+		{"09:30-12:05", "1,3,4"},
+		{"22:00-08:00", "2,4"},
+		{"13:00-14:00", "4"},
+	}
+	for _, tt := range tests {
+		window, _ := parseTimeWindow(tt.window)
+		kept, removed := filterByDepartureWindow(offers, window)
+		ids := make([]string, 0, len(kept))
+		for _, offer := range kept {
+			ids = append(ids, offer.ID)
+		}
+		if strings.Join(ids, ",") != tt.wantIDs || removed != len(offers)-len(kept) {
+			t.Errorf("window %s kept %v (removed %d), want %s", tt.window, ids, removed, tt.wantIDs)
+		}
+	}
+}
+
+// A round trip with emissions on both segments, then one missing them on the
+// return, then one reporting only pounds
+const CAPTURED_CO2_OFFERS = `{"data":[
+  {"id":"1","price":{"currency":"EUR","total":"512.30"},
+   "itineraries":[
+     {"duration":"PT8H10M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T12:05:00"},"arrival":{"iataCode":"JFK","at":"2025-12-20T14:15:00"},
+       "carrierCode":"IB","number":"6251","duration":"PT8H10M","co2Emissions":[{"weight":412,"weightUnit":"KG","cabin":"ECONOMY"}]}]},
+     {"duration":"PT7H5M","segments":[{"departure":{"iataCode":"JFK","at":"2025-12-27T19:00:00"},"arrival":{"iataCode":"MAD","at":"2025-12-28T08:05:00"},
+       "carrierCode":"IB","number":"6252","duration":"PT7H5M","co2Emissions":[{"weight":398,"weightUnit":"kg","cabin":"ECONOMY"}]}]}]},
+  {"id":"2","price":{"currency":"EUR","total":"498.00"},
+   "itineraries":[
+     {"duration":"PT8H10M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T12:05:00"},"arrival":{"iataCode":"JFK","at":"2025-12-20T14:15:00"},
+       "carrierCode":"UX","number":"91","duration":"PT8H10M","co2Emissions":[{"weight":405,"weightUnit":"KG","cabin":"ECONOMY"}]}]},
+     {"duration":"PT7H5M","segments":[{"departure":{"iataCode":"JFK","at":"2025-12-27T19:00:00"},"arrival":{"iataCode":"MAD","at":"2025-12-28T08:05:00"},
+       "carrierCode":"UX","number":"92","duration":"PT7H5M"}]}]},
+  {"id":"3","price":{"currency":"EUR","total":"520.00"},
+   "itineraries":[{"duration":"PT8H10M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T12:05:00"},"arrival":{"iataCode":"JFK","at":"2025-12-20T14:15:00"},
+     "carrierCode":"DL","number":"127","duration":"PT8H10M","co2Emissions":[{"weight":900,"weightUnit":"LB","cabin":"ECONOMY"}]}]}]}
+]}`
+
+func TestNormalizeOffersCo2Emissions(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_CO2_OFFERS), TRIP_ROUND_TRIP)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+
+	if got := result.Offers[0].Co2EmissionsKg; got == nil || *got != 810 {
+		t.Errorf("offer 1 emissions = %v, want 810", got)
+	}
+	// A partial or non-KG total is left out rather than understating the trip
+	for _, offer := range result.Offers[1:] {
+		if offer.Co2EmissionsKg != nil {
+			t.Errorf("offer %s emissions = %d, want none", offer.ID, *offer.Co2EmissionsKg)
+		}
+		data, _ := json.Marshal(offer)
+		if strings.Contains(string(data), "co2_emissions_kg") {
+			t.Errorf("offer %s = %s, want co2_emissions_kg left out", offer.ID, data)
+		}
+	}
+}
+
+// Search links in meta, then an offer with a self link and one without
+const CAPTURED_LINKED_OFFERS = `{"meta":{"count":2,"links":{"self":"https://test.api.amadeus.com/v2/shopping/flight-offers?originLocationCode=MAD"}},"data":[
+  {"id":"1","price":{"currency":"EUR","total":"315.20"},"links":{"self":"https://test.api.amadeus.com/v1/shopping/flight-offers/1"},
+   "itineraries":[{"duration":"PT8H10M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T12:05:00"},
+     "arrival":{"iataCode":"JFK","at":"2025-12-20T14:15:00"},"carrierCode":"IB","number":"6251","duration":"PT8H10M"}]}]},
+  {"id":"2","price":{"currency":"EUR","total":"289.90"},
+   "itineraries":[{"duration":"PT9H","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T10:00:00"},
+     "arrival":{"iataCode":"JFK","at":"2025-12-20T13:00:00"},"carrierCode":"UX","number":"91","duration":"PT9H"}]}]}
+]}`
+
+func TestNormalizeOffersLinks(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_LINKED_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	if !strings.HasPrefix(result.Links["self"], "https://test.api.amadeus.com/v2/shopping/flight-offers?") {
+		t.Errorf("links = %v, want the search's self link", result.Links)
+	}
+	if result.Offers[0].Links["self"] != "https://test.api.amadeus.com/v1/shopping/flight-offers/1" {
+		t.Errorf("offer 1 links = %v, want its self link", result.Offers[0].Links)
+	}
+	data, _ := json.Marshal(result.Offers[1])
+	if strings.Contains(string(data), `"links"`) {
+		t.Errorf("offer 2 = %s, want links left out", data)
+	}
+}
+
+func TestNormalizeOffersCo2Warning(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_CO2_OFFERS), TRIP_ROUND_TRIP)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	// Offer 2 lost its partial estimate; offer 3 never had a KG one, so
+	// there is nothing to report for it
+	want := "co2_emissions_kg unavailable for offers 2: some segments have no estimate"
+	if len(result.Warnings) != 1 || result.Warnings[0] != want {
+		t.Errorf("warnings = %q, want %q", result.Warnings, want)
+	}
+
+	// A search where every estimate is complete has no warnings key
+	result, err = normalizeOffers([]byte(CAPTURED_STOPS_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	if data, _ := json.Marshal(result); strings.Contains(string(data), `"warnings"`) {
+		t.Errorf("result = %s, want no warnings", data)
+	}
+}
+
+func TestNormalizeLinks(t *testing.T) {
+	links := AmadeusLinks{
+		"self":     json.RawMessage(`"https://test.api.amadeus.com/v1/shopping/flight-offers/1"`),
+		"legacy":   json.RawMessage(`"http://example.com/offer"`),
+		"relative": json.RawMessage(`"/v1/shopping/flight-offers/1"`),
+		"nested":   json.RawMessage(`{"href":"https://example.com"}`),
+		"number":   json.RawMessage(`42`),
+	}
+	got := normalizeLinks(links)
+	if len(got) != 2 || got["self"] == "" || got["legacy"] != "http://example.com/offer" {
+		t.Errorf("normalizeLinks() = %v, want only the absolute http(s) links", got)
+	}
+
+	// Nothing usable reads as no links at all
+	if got := normalizeLinks(AmadeusLinks{"relative": json.RawMessage(`"/v1"`)}); got != nil {
+		t.Errorf("normalizeLinks(relative) = %v, want nil", got)
+	}
+}
+
+func TestOffersJSONL(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_DUPLICATE_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	applyOfferFilters(amadeusflightcomponent.FlightSearchParams{Dedupe: cm.Some(true)}, result)
+	result.Warnings = []string{"co2_emissions_kg unavailable for offers 1, 3: some segments have no estimate"}
+
+	output, err := offersJSONL(result)
+	if err != nil {
+		t.Fatalf("offersJSONL() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 2 offers and the metadata:\n%s", len(lines), output)
+	}
+	for i, id := range []string{"1", "3"} {
+		var offer FlightOffer
+		if err := json.Unmarshal([]byte(lines[i]), &offer); err != nil || offer.ID != id {
+			t.Errorf("line %d = %s, want offer %s", i, lines[i], id)
+		}
+	}
+
+	var last struct {
+		Metadata map[string]json.RawMessage `json:"metadata"`
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if string(last.Metadata["count"]) != "2" || string(last.Metadata["duplicates_removed"]) != "1" {
+		t.Errorf("metadata = %s, want count 2 and duplicates_removed 1", lines[2])
+	}
+	if !strings.Contains(string(last.Metadata["warnings"]), "co2_emissions_kg") {
+		t.Errorf("metadata = %s, want the warnings kept", lines[2])
+	}
+	if _, ok := last.Metadata["offers"]; ok {
+		t.Errorf("metadata = %s, want the offers left out", lines[2])
+	}
+}
+
+func TestOffersJSONLNoOffers(t *testing.T) {
+	output, err := offersJSONL(&FlightSearchResult{TripType: TRIP_ONE_WAY, Offers: []FlightOffer{}})
+	if err != nil {
+		t.Fatalf("offersJSONL() error = %v", err)
+	}
+	if want := `{"metadata":{"trip_type":"one-way","count":0}}` + "\n"; output != want {
+		t.Errorf("offersJSONL() = %q, want %q", output, want)
+	}
+}
+
+func TestParseAirportList(t *testing.T) {
+	airports, err := parseAirportList("avoid-airports", " lhr, CDG ,,")
+	if err != nil || strings.Join(airports, ",") != "LHR,CDG" {
+		t.Errorf("parseAirportList() = %v, %v, want [LHR CDG]", airports, err)
+	}
+	_, err = parseAirportList("avoid-airports", "LHR,Heathrow")
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_IATA_CODE {
+		t.Errorf("parseAirportList() error = %v, want %s", err, ERR_INVALID_IATA_CODE)
+	}
+}
+
+func TestFilterByConnections(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_STOPS_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+
+	// Offer 2 connects at LHR; offer 3's technical stop is not a connection
+	tests := []struct {
+		name           string
+		avoid, require []string
+		wantIDs        string
+	}{
+		{"avoid", []string{"LHR"}, nil, "1,3"},
+		{"avoid elsewhere", []string{"CDG"}, nil, "1,2,3"},
+		{"require", nil, []string{"CDG", "LHR"}, "2"},
+		{"require elsewhere", nil, []string{"CDG"}, ""},
+		{"avoid and require", []string{"LHR"}, []string{"LHR"}, ""},
+	}
+	for _, tt := range tests {
+		kept, removed := filterByConnections(result.Offers, tt.avoid, tt.require)
+		ids := make([]string, 0, len(kept))
+		for _, offer := range kept {
+			ids = append(ids, offer.ID)
+		}
+		if strings.Join(ids, ",") != tt.wantIDs || removed != len(result.Offers)-len(kept) {
+			t.Errorf("%s: kept %v (removed %d), want %s", tt.name, ids, removed, tt.wantIDs)
+		}
+	}
+}
+
+func TestApplyOfferFiltersConnections(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_STOPS_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	applyOfferFilters(amadeusflightcomponent.FlightSearchParams{AvoidAirports: cm.Some("lhr")}, result)
+	if result.FilteredByConnections == nil || *result.FilteredByConnections != 1 || result.Count != 2 {
+		t.Errorf("filtered %v, count %d, want 1 filtered and 2 left", result.FilteredByConnections, result.Count)
+	}
+}
+
+func TestTicketingExpired(t *testing.T) {
+	now := time.Date(2025, 12, 20, 23, 30, 0, 0, time.FixedZone("EST", -5*3600))
+	tests := map[string]bool{
+		"2025-12-21": false, // today in UTC, so still open
+		"2025-12-20": true,
+		"2024-06-01": true,
+		"2026-01-05": false,
+		"":           false,
+		"21/12/2025": false,
+	}
+	for date, want := range tests {
+		if got := ticketingExpired(date, now); got != want {
+			t.Errorf("ticketingExpired(%q) = %v, want %v", date, got, want)
+		}
+	}
+}
+
+func TestNormalizeOffersLastTicketingDate(t *testing.T) {
+	body := strings.Replace(CAPTURED_STOPS_OFFERS, `"id":"1",`, `"id":"1","lastTicketingDate":"2001-01-01",`, 1)
+	body = strings.Replace(body, `"id":"2",`, `"id":"2","lastTicketingDate":"2999-01-01",`, 1)
+	result, err := normalizeOffers([]byte(body), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	expired, open := result.Offers[0], result.Offers[1]
+	if expired.LastTicketingDate != "2001-01-01" || !expired.TicketingExpired {
+		t.Errorf("offer 1 = %+v, want it flagged expired", expired)
+	}
+	if open.LastTicketingDate != "2999-01-01" || open.TicketingExpired {
+		t.Errorf("offer 2 = %+v, want it open", open)
+	}
+	// Without a date both fields are left out
+	data, _ := json.Marshal(result.Offers[2])
+	if strings.Contains(string(data), "last_ticketing_date") || strings.Contains(string(data), "ticketing_expired") {
+		t.Errorf("offer 3 = %s, want no ticketing fields", data)
+	}
+
+	// exclude-expired drops the flagged offer and counts it
+	applyOfferFilters(amadeusflightcomponent.FlightSearchParams{ExcludeExpired: cm.Some(true)}, result)
+	if result.FilteredByExpiry == nil || *result.FilteredByExpiry != 1 || result.Count != 2 || result.Offers[0].ID != "2" {
+		t.Errorf("filtered %v, offers %d, want offer 1 dropped", result.FilteredByExpiry, result.Count)
+	}
+}
+
+func TestNormalizeOffersOneWay(t *testing.T) {
+	body := strings.Replace(CAPTURED_STOPS_OFFERS, `"id":"2",`, `"id":"2","oneWay":true,`, 1)
+	result, err := normalizeOffers([]byte(body), TRIP_ROUND_TRIP)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	if result.Offers[0].OneWay || !result.Offers[1].OneWay {
+		t.Errorf("one_way = %v, %v, want only offer 2 flagged", result.Offers[0].OneWay, result.Offers[1].OneWay)
+	}
+	// Combined offers leave the field out
+	data, _ := json.Marshal(result.Offers[0])
+	if strings.Contains(string(data), "one_way") {
+		t.Errorf("offer 1 = %s, want no one_way field", data)
+	}
+}
+
+func TestAttachRawSegments(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_STOPS_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	// Without include-raw nothing is attached
+	if data, _ := json.Marshal(result); strings.Contains(string(data), `"raw_segments"`) {
+		t.Errorf("result = %s, want no raw_segments", data)
+	}
+
+	if err := attachRawSegments([]byte(CAPTURED_STOPS_OFFERS), result); err != nil {
+		t.Fatalf("attachRawSegments() error = %v", err)
+	}
+	for i, want := range []int{1, 2, 1} {
+		if got := len(result.Offers[i].RawSegments); got != want {
+			t.Errorf("offer %s has %d raw segments, want %d", result.Offers[i].ID, got, want)
+		}
+	}
+	// Segments are kept as Amadeus sent them, in order
+	var segment struct {
+		CarrierCode string `json:"carrierCode"`
+		Number      string `json:"number"`
+	}
+	if err := json.Unmarshal(result.Offers[1].RawSegments[1], &segment); err != nil || segment.CarrierCode != "BA" || segment.Number != "117" {
+		t.Errorf("second raw segment = %s, want BA117", result.Offers[1].RawSegments[1])
+	}
+}
+
+func TestAttachRawSegmentsFewerOffers(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_STOPS_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	result.Offers = result.Offers[:1]
+
+	if err := attachRawSegments([]byte(CAPTURED_STOPS_OFFERS), result); err != nil {
+		t.Fatalf("attachRawSegments() error = %v", err)
+	}
+	if len(result.Offers) != 1 || len(result.Offers[0].RawSegments) != 1 {
+		t.Errorf("offers = %+v, want the one offer with its segment", result.Offers)
+	}
+
+	if err := attachRawSegments([]byte(`{"data":`), result); err == nil {
+		t.Error("attachRawSegments() of a truncated body succeeded, want an error")
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// Amadeus traveler types for the POST search. A held infant sits on an
+// adult's lap; a seated infant has its own seat and is priced for it.
+const (
+	TRAVELER_ADULT         = "ADULT"
+	TRAVELER_CHILD         = "CHILD"
+	TRAVELER_HELD_INFANT   = "HELD_INFANT"
+	TRAVELER_SEATED_INFANT = "SEATED_INFANT"
+)
+
+// searchOptions are the search settings shared by every POST search,
+// whichever export it comes from
+type searchOptions struct {
+	Adults        uint32
+	Children      cm.Option[uint32]
+	Infants       cm.Option[uint32]
+	InfantsInSeat cm.Option[bool]
+	TravelClass   cm.Option[string]
+	NonStop       cm.Option[bool]
+	// Currency is already resolved (see resolvePresentation); empty leaves
+	// it to Amadeus
+	Currency   string
+	MaxResults cm.Option[uint32]
+}
+
+// validateTravelers checks the traveler counts up front. Every infant must
+// travel with an adult, whether on a lap or in a seat of its own.
+func validateTravelers(adults uint32, infants cm.Option[uint32]) error {
+	if adults == 0 {
+		return &PluginError{Code: ERR_INVALID_TRAVELERS, Message: "at least one adult is required"}
+	}
+	if count := infants.Some(); count != nil && *count > adults {
+		return &PluginError{
+			Code:    ERR_INVALID_TRAVELERS,
+			Message: fmt.Sprintf("%d infants need %d adults to travel with, got %d", *count, *count, adults),
+		}
+	}
+	return nil
+}
+
+// seatsInfants reports whether a search has infants who need their own seat
+func seatsInfants(infants cm.Option[uint32], infantsInSeat cm.Option[bool]) bool {
+	count, seated := infants.Some(), infantsInSeat.Some()
+	return count != nil && *count > 0 && seated != nil && *seated
+}
+
+// addsOneWayOffers reports whether a search asks for one-way offers
+// alongside its round trips. A one-way search has nothing to add.
+func addsOneWayOffers(params amadeusflightcomponent.FlightSearchParams, trip string) bool {
+	add := params.AddOneWayOffers.Some()
+	return add != nil && *add && trip == TRIP_ROUND_TRIP
+}
+
+// searchTravelers lists the travelers for a POST search, numbered adults
+// first. Lap infants are each assigned to an adult; seated infants are not.
+func searchTravelers(options searchOptions) ([]AmadeusSearchTraveler, error) {
+	if err := validateTravelers(options.Adults, options.Infants); err != nil {
+		return nil, err
+	}
+
+	var children, infants uint32
+	if count := options.Children.Some(); count != nil {
+		children = *count
+	}
+	if count := options.Infants.Some(); count != nil {
+		infants = *count
+	}
+
+	travelers := make([]AmadeusSearchTraveler, 0, options.Adults+children+infants)
+	add := func(travelerType string, adultID string) {
+		travelers = append(travelers, AmadeusSearchTraveler{
+			ID:                strconv.Itoa(len(travelers) + 1),
+			TravelerType:      travelerType,
+			AssociatedAdultID: adultID,
+		})
+	}
+	for i := uint32(0); i < options.Adults; i++ {
+		add(TRAVELER_ADULT, "")
+	}
+	for i := uint32(0); i < children; i++ {
+		add(TRAVELER_CHILD, "")
+	}
+	seated := seatsInfants(options.Infants, options.InfantsInSeat)
+	for i := uint32(0); i < infants; i++ {
+		if seated {
+			add(TRAVELER_SEATED_INFANT, "")
+			continue
+		}
+		// Adults are travelers 1..adults, so infant i sits with adult i+1
+		add(TRAVELER_HELD_INFANT, strconv.Itoa(int(i)+1))
+	}
+	return travelers, nil
+}
+
+// buildSearchBody builds a POST search body with one origin-destination per
+// leg. The legs must already be validated.
+func buildSearchBody(legs []amadeusflightcomponent.FlightLeg, options searchOptions) (*AmadeusSearchRequest, error) {
+	travelers, err := searchTravelers(options)
+	if err != nil {
+		return nil, err
+	}
+
+	body := &AmadeusSearchRequest{
+		OriginDestinations: make([]AmadeusOriginDestination, 0, len(legs)),
+		Travelers:          travelers,
+		Sources:            SUPPORTED_SOURCES,
+		SearchCriteria:     AmadeusSearchCriteria{MaxFlightOffers: 10}, // Default to 10 results
+	}
+
+	legIDs := make([]string, 0, len(legs))
+	for i, leg := range legs {
+		originDestination := AmadeusOriginDestination{
+			ID:                      strconv.Itoa(i + 1),
+			OriginLocationCode:      leg.Origin,
+			DestinationLocationCode: leg.Destination,
+		}
+		originDestination.DepartureDateTimeRange.Date = strings.TrimSpace(leg.DepartureDate)
+		body.OriginDestinations = append(body.OriginDestinations, originDestination)
+		legIDs = append(legIDs, originDestination.ID)
+	}
+
+	body.CurrencyCode = options.Currency
+
+	if maxResults := options.MaxResults.Some(); maxResults != nil {
+		body.SearchCriteria.MaxFlightOffers = int(*maxResults)
+	}
+
+	filters := &AmadeusFlightFilters{}
+	if travelClass := options.TravelClass.Some(); travelClass != nil {
+		normalized, err := normalizeTravelClass(*travelClass)
+		if err != nil {
+			return nil, err
+		}
+		filters.CabinRestrictions = []AmadeusCabinRestriction{{
+			Cabin:                normalized,
+			Coverage:             "MOST_SEGMENTS",
+			OriginDestinationIDs: legIDs,
+		}}
+	}
+	if nonStop := options.NonStop.Some(); nonStop != nil && *nonStop {
+		filters.ConnectionRestriction = &AmadeusConnectionRestriction{MaxNumberOfConnections: 0}
+	}
+	if filters.CabinRestrictions != nil || filters.ConnectionRestriction != nil {
+		body.SearchCriteria.FlightFilters = filters
+	}
+
+	return body, nil
+}
+
+// flightSearchBody is the POST equivalent of flightOffersPath, for searches
+// the GET search can't describe
+func flightSearchBody(params amadeusflightcomponent.FlightSearchParams, trip string, currency string) (*AmadeusSearchRequest, error) {
+	legs := []amadeusflightcomponent.FlightLeg{{
+		Origin:        params.OriginLocationCode,
+		Destination:   params.DestinationLocationCode,
+		DepartureDate: params.DepartureDate,
+	}}
+	if trip == TRIP_ROUND_TRIP {
+		legs = append(legs, amadeusflightcomponent.FlightLeg{
+			Origin:        params.DestinationLocationCode,
+			Destination:   params.OriginLocationCode,
+			DepartureDate: strings.TrimSpace(*params.ReturnDate.Some()),
+		})
+	}
+
+	body, err := buildSearchBody(legs, searchOptions{
+		Adults:        params.Adults,
+		Children:      params.Children,
+		Infants:       params.Infants,
+		InfantsInSeat: params.InfantsInSeat,
+		TravelClass:   params.TravelClass,
+		NonStop:       params.NonStop,
+		Currency:      currency,
+		MaxResults:    params.MaxResults,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	carriers := &AmadeusCarrierRestrictions{}
+	if includedCodes := params.IncludedAirlineCodes.Some(); includedCodes != nil {
+		normalized, err := normalizeAirlineCodes("included-airline-codes", *includedCodes)
+		if err != nil {
+			return nil, err
+		}
+		if normalized != "" {
+			carriers.IncludedCarrierCodes = strings.Split(normalized, ",")
+		}
+	}
+	if excludedCodes := params.ExcludedAirlineCodes.Some(); excludedCodes != nil {
+		normalized, err := normalizeAirlineCodes("excluded-airline-codes", *excludedCodes)
+		if err != nil {
+			return nil, err
+		}
+		if normalized != "" {
+			carriers.ExcludedCarrierCodes = strings.Split(normalized, ",")
+		}
+	}
+	if carriers.IncludedCarrierCodes != nil || carriers.ExcludedCarrierCodes != nil {
+		if body.SearchCriteria.FlightFilters == nil {
+			body.SearchCriteria.FlightFilters = &AmadeusFlightFilters{}
+		}
+		body.SearchCriteria.FlightFilters.CarrierRestrictions = carriers
+	}
+	if source := params.Sources.Some(); source != nil {
+		if _, err := normalizeSource(*source); err != nil {
+			return nil, err
+		}
+	}
+	if maxPrice := params.MaxPrice.Some(); maxPrice != nil {
+		body.SearchCriteria.MaxPrice = int(*maxPrice)
+	}
+	body.SearchCriteria.AddOneWayOffers = addsOneWayOffers(params, trip)
+
+	return body, nil
+}
+
+// postSearchHeaders are the headers for a POST search, which Amadeus serves
+// as a POST-tunneled GET, like pricing
+func postSearchHeaders() map[string]string {
+	return map[string]string{
+		"Content-Type":           "application/json",
+		"X-HTTP-Method-Override": "GET",
+	}
+}
+
+// offersRequest builds the flight-offers search for params. The GET search
+// covers everything except seated infants and addOneWayOffers, which only
+// the POST search can describe; both return offers in the same shape.
+func offersRequest(params amadeusflightcomponent.FlightSearchParams, trip string) (Request, error) {
+	shown, err := resolvePresentation(params.Presentation, params.CurrencyCode)
+	if err != nil {
+		return Request{}, err
+	}
+
+	if seatsInfants(params.Infants, params.InfantsInSeat) || addsOneWayOffers(params, trip) {
+		search, err := flightSearchBody(params, trip, shown.Currency)
+		if err != nil {
+			return Request{}, err
+		}
+		body, err := json.Marshal(search)
+		if err != nil {
+			return Request{}, fmt.Errorf("failed to build search request: %v", err)
+		}
+		headers := withAcceptLanguage(postSearchHeaders(), shown.Locale)
+		return Request{Method: "POST", PathWithQuery: FLIGHT_OFFERS_PATH, Headers: headers, Body: body}, nil
+	}
+
+	path, err := flightOffersPath(params, trip, shown.Currency)
+	if err != nil {
+		return Request{}, err
+	}
+	headers := map[string]string{
+		"Accept-Language": shown.Locale,
+	}
+	return Request{Method: "GET", PathWithQuery: path, Headers: headers}, nil
+}
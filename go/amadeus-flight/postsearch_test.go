@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.bytecodealliance.org/cm"
+)
+
+// travelerList renders travelers as "ID:TYPE" or "ID:TYPE@ADULT" entries
+func travelerList(travelers []AmadeusSearchTraveler) string {
+	var list []string
+	for _, traveler := range travelers {
+		entry := traveler.ID + ":" + traveler.TravelerType
+		if traveler.AssociatedAdultID != "" {
+			entry += "@" + traveler.AssociatedAdultID
+		}
+		list = append(list, entry)
+	}
+	return strings.Join(list, ",")
+}
+
+func TestSearchTravelers(t *testing.T) {
+	tests := []struct {
+		name    string
+		options searchOptions
+		want    string
+	}{
+		{"adults only", searchOptions{Adults: 2}, "1:ADULT,2:ADULT"},
+		{"lap infants", searchOptions{Adults: 2, Children: cm.Some[uint32](1), Infants: cm.Some[uint32](2)},
+			"1:ADULT,2:ADULT,3:CHILD,4:HELD_INFANT@1,5:HELD_INFANT@2"},
+		{"seated infants", searchOptions{Adults: 2, Infants: cm.Some[uint32](1), InfantsInSeat: cm.Some(true)},
+			"1:ADULT,2:ADULT,3:SEATED_INFANT"},
+		{"in seat without infants", searchOptions{Adults: 1, InfantsInSeat: cm.Some(true)}, "1:ADULT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			travelers, err := searchTravelers(tt.options)
+			if err != nil {
+				t.Fatalf("searchTravelers() error = %v", err)
+			}
+			if got := travelerList(travelers); got != tt.want {
+				t.Errorf("travelers = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTravelers(t *testing.T) {
+	if err := validateTravelers(2, cm.Some[uint32](2)); err != nil {
+		t.Errorf("validateTravelers(2 adults, 2 infants) error = %v", err)
+	}
+	for _, tt := range []struct {
+		adults  uint32
+		infants cm.Option[uint32]
+	}{
+		{0, cm.None[uint32]()},
+		{1, cm.Some[uint32](2)},
+	} {
+		var pluginErr *PluginError
+		if err := validateTravelers(tt.adults, tt.infants); !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_TRAVELERS {
+			t.Errorf("validateTravelers(%d, %v) error = %v, want %s", tt.adults, tt.infants, err, ERR_INVALID_TRAVELERS)
+		}
+	}
+}
+
+func TestOffersRequest(t *testing.T) {
+	useConfig(t, &Config{})
+	params := roundTripParams()
+	params.Infants = cm.Some[uint32](1)
+
+	// Lap infants fit the GET search
+	req, err := offersRequest(params, TRIP_ROUND_TRIP)
+	if err != nil {
+		t.Fatalf("offersRequest() error = %v", err)
+	}
+	if req.Method != "GET" || !strings.Contains(req.PathWithQuery, "infants=1") || req.Body != nil {
+		t.Errorf("request = %s %s, want a GET with infants=1", req.Method, req.PathWithQuery)
+	}
+
+	// Seated infants need the POST search, with the return as a second leg
+	params.InfantsInSeat = cm.Some(true)
+	params.ExcludedAirlineCodes = cm.Some("ib, ux")
+	req, err = offersRequest(params, TRIP_ROUND_TRIP)
+	if err != nil {
+		t.Fatalf("offersRequest() error = %v", err)
+	}
+	if req.Method != "POST" || req.PathWithQuery != FLIGHT_OFFERS_PATH || req.Headers["X-HTTP-Method-Override"] != "GET" {
+		t.Errorf("request = %s %s with %v, want a POST-tunneled GET", req.Method, req.PathWithQuery, req.Headers)
+	}
+	var body AmadeusSearchRequest
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if got := travelerList(body.Travelers); got != "1:ADULT,2:SEATED_INFANT" {
+		t.Errorf("travelers = %s, want an adult and a seated infant", got)
+	}
+	if len(body.OriginDestinations) != 2 || body.OriginDestinations[1].OriginLocationCode != "JFK" ||
+		body.OriginDestinations[1].DepartureDateTimeRange.Date != "2025-12-27" {
+		t.Errorf("originDestinations = %+v, want MAD-JFK and the JFK-MAD return", body.OriginDestinations)
+	}
+	filters := body.SearchCriteria.FlightFilters
+	if filters == nil || filters.CarrierRestrictions == nil || strings.Join(filters.CarrierRestrictions.ExcludedCarrierCodes, ",") != "IB,UX" {
+		t.Errorf("filters = %+v, want IB and UX excluded", filters)
+	}
+}
+
+func TestOffersRequestAddOneWayOffers(t *testing.T) {
+	useConfig(t, &Config{})
+	params := roundTripParams()
+	params.AddOneWayOffers = cm.Some(true)
+
+	// Only the POST search can ask for one-way offers
+	req, err := offersRequest(params, TRIP_ROUND_TRIP)
+	if err != nil {
+		t.Fatalf("offersRequest() error = %v", err)
+	}
+	if req.Method != "POST" || req.PathWithQuery != FLIGHT_OFFERS_PATH {
+		t.Fatalf("request = %s %s, want the POST search", req.Method, req.PathWithQuery)
+	}
+	var body AmadeusSearchRequest
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.SearchCriteria.AddOneWayOffers || len(body.OriginDestinations) != 2 {
+		t.Errorf("body = %+v, want both legs with addOneWayOffers", body)
+	}
+
+	// A one-way search has nothing to add, so it stays a GET
+	req, err = offersRequest(params, TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("offersRequest() error = %v", err)
+	}
+	if req.Method != "GET" || strings.Contains(req.PathWithQuery, "addOneWayOffers") {
+		t.Errorf("request = %s %s, want a plain GET", req.Method, req.PathWithQuery)
+	}
+}
+
+func TestSearchFlightsTooManyInfants(t *testing.T) {
+	setEnv(t)
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	params := roundTripParams()
+	params.Infants = cm.Some[uint32](2)
+	params.InfantsInSeat = cm.Some(true)
+	_, err := searchFlights(params)
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_TRAVELERS {
+		t.Errorf("error = %v, want %s", err, ERR_INVALID_TRAVELERS)
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none", len(fake.sent))
+	}
+}
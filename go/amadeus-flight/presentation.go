@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// DEFAULT_LOCALE is sent as Accept-Language when neither the call nor
+// AMADEUS_DEFAULT_LOCALE picks one
+const DEFAULT_LOCALE = "en-US"
+
+// presentation is how Amadeus should present a response: the language of
+// its text and the currency of its prices. Currency is empty to let Amadeus
+// use the route's own.
+type presentation struct {
+	Locale   string
+	Currency string
+}
+
+// normalizeLocale checks a locale is a two-letter language, optionally with
+// a two-letter country ("en", "en-US"), and writes it in the usual case
+func normalizeLocale(field string, locale string) (string, error) {
+	lang, country, hasCountry := strings.Cut(strings.TrimSpace(locale), "-")
+	lang, country = strings.ToUpper(lang), strings.ToUpper(country)
+	if !isLetters(lang, 2) || (hasCountry && !isLetters(country, 2)) {
+		return "", &PluginError{
+			Code:    ERR_INVALID_LOCALE,
+			Message: fmt.Sprintf("%s %q: expected a locale like \"en\" or \"en-US\"", field, locale),
+		}
+	}
+	if !hasCountry {
+		return strings.ToLower(lang), nil
+	}
+	return strings.ToLower(lang) + "-" + country, nil
+}
+
+// defaultPresentation is the configured presentation, used by calls that
+// take no presentation of their own. loadConfig must have run.
+func defaultPresentation() presentation {
+	locale := config.DefaultLocale
+	if locale == "" {
+		locale = DEFAULT_LOCALE
+	}
+	return presentation{Locale: locale, Currency: config.DefaultCurrency}
+}
+
+// resolvePresentation validates a call's presentation together with its
+// currency-code, falling back to the configured defaults for anything left
+// out. The two currencies may both be given only if they agree.
+func resolvePresentation(option cm.Option[amadeusflightcomponent.Presentation], currencyCode cm.Option[string]) (presentation, error) {
+	resolved := defaultPresentation()
+
+	var currency string
+	if code := currencyCode.Some(); code != nil {
+		normalized, err := normalizeCurrency(*code)
+		if err != nil {
+			return presentation{}, err
+		}
+		currency = normalized
+	}
+
+	if requested := option.Some(); requested != nil {
+		if locale := requested.Locale.Some(); locale != nil {
+			normalized, err := normalizeLocale("presentation.locale", *locale)
+			if err != nil {
+				return presentation{}, err
+			}
+			resolved.Locale = normalized
+		}
+		if code := requested.Currency.Some(); code != nil {
+			normalized, err := normalizeCurrency(*code)
+			if err != nil {
+				return presentation{}, err
+			}
+			if currency != "" && currency != normalized {
+				return presentation{}, &PluginError{
+					Code:    ERR_INVALID_CURRENCY,
+					Message: fmt.Sprintf("presentation.currency %s conflicts with currency-code %s; give one or make them match", normalized, currency),
+				}
+			}
+			currency = normalized
+		}
+	}
+
+	if currency != "" {
+		resolved.Currency = currency
+	}
+	return resolved, nil
+}
+
+// withAcceptLanguage returns a copy of headers asking for text in locale
+func withAcceptLanguage(headers map[string]string, locale string) map[string]string {
+	localized := make(map[string]string, len(headers)+1)
+	for key, value := range headers {
+		localized[key] = value
+	}
+	localized["Accept-Language"] = locale
+	return localized
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+	"go.bytecodealliance.org/cm"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := map[string]string{
+		"en":      "en",
+		" FR ":    "fr",
+		"en-us":   "en-US",
+		"PT-br":   "pt-BR",
+		"english": "",
+		"en_US":   "",
+		"en-":     "",
+		"":        "",
+	}
+	for locale, want := range tests {
+		got, err := normalizeLocale("locale", locale)
+		if want == "" {
+			var pluginErr *PluginError
+			if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_LOCALE {
+				t.Errorf("normalizeLocale(%q) error = %v, want %s", locale, err, ERR_INVALID_LOCALE)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("normalizeLocale(%q) = %q, %v, want %q", locale, got, err, want)
+		}
+	}
+}
+
+func TestResolvePresentation(t *testing.T) {
+	shown := func(locale, currency string) cm.Option[amadeusflightcomponent.Presentation] {
+		var requested amadeusflightcomponent.Presentation
+		if locale != "" {
+			requested.Locale = cm.Some(locale)
+		}
+		if currency != "" {
+			requested.Currency = cm.Some(currency)
+		}
+		return cm.Some(requested)
+	}
+	none := cm.None[string]()
+	tests := []struct {
+		name         string
+		presentation cm.Option[amadeusflightcomponent.Presentation]
+		currencyCode cm.Option[string]
+		want         presentation
+	}{
+		{"configured defaults", cm.None[amadeusflightcomponent.Presentation](), none, presentation{Locale: "de-DE", Currency: "EUR"}},
+		{"locale only", shown("fr-fr", ""), none, presentation{Locale: "fr-FR", Currency: "EUR"}},
+		{"presentation currency", shown("", "usd"), none, presentation{Locale: "de-DE", Currency: "USD"}},
+		{"matching currencies", shown("", "GBP"), cm.Some("gbp"), presentation{Locale: "de-DE", Currency: "GBP"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, &Config{DefaultLocale: "de-DE", DefaultCurrency: "EUR"})
+			got, err := resolvePresentation(tt.presentation, tt.currencyCode)
+			if err != nil || got != tt.want {
+				t.Errorf("resolvePresentation() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+
+	useConfig(t, &Config{})
+	var pluginErr *PluginError
+	if _, err := resolvePresentation(shown("", "USD"), cm.Some("EUR")); !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_CURRENCY {
+		t.Errorf("conflicting currencies error = %v, want %s", err, ERR_INVALID_CURRENCY)
+	}
+	if _, err := resolvePresentation(shown("french", ""), none); !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_LOCALE {
+		t.Errorf("invalid locale error = %v, want %s", err, ERR_INVALID_LOCALE)
+	}
+	// Without configuration, the locale is DEFAULT_LOCALE and the currency Amadeus's choice
+	if got, _ := resolvePresentation(cm.None[amadeusflightcomponent.Presentation](), none); got != (presentation{Locale: DEFAULT_LOCALE}) {
+		t.Errorf("resolvePresentation() unconfigured = %+v, want %s and no currency", got, DEFAULT_LOCALE)
+	}
+}
+
+func TestDefaultLocaleFromEnv(t *testing.T) {
+	env := []string{"AMADEUS_HOST", "test.api.amadeus.com", "AMADEUS_API_KEY", "key", "AMADEUS_API_SECRET", "secret"}
+	useConfig(t, &Config{})
+	setEnv(t, append(env, "AMADEUS_DEFAULT_LOCALE", "fr-fr")...)
+	if err := loadConfig(); err != nil || defaultPresentation().Locale != "fr-FR" {
+		t.Errorf("locale = %q, %v, want the env default fr-FR", defaultPresentation().Locale, err)
+	}
+
+	useConfig(t, &Config{})
+	setEnv(t, append(env, "AMADEUS_DEFAULT_LOCALE", "french")...)
+	var pluginErr *PluginError
+	if err := loadConfig(); !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_LOCALE {
+		t.Errorf("loadConfig() error = %v, want %s", err, ERR_INVALID_LOCALE)
+	}
+}
+
+func TestOffersRequestPresentation(t *testing.T) {
+	useConfig(t, &Config{})
+	params := roundTripParams()
+	params.Presentation = cm.Some(amadeusflightcomponent.Presentation{Locale: cm.Some("es-es"), Currency: cm.Some("usd")})
+
+	req, err := offersRequest(params, TRIP_ROUND_TRIP)
+	if err != nil {
+		t.Fatalf("offersRequest() error = %v", err)
+	}
+	if req.Headers["Accept-Language"] != "es-ES" || !strings.Contains(req.PathWithQuery, "currencyCode=USD") {
+		t.Errorf("request = %s with %v, want es-ES and USD", req.PathWithQuery, req.Headers)
+	}
+
+	// The POST search carries the same presentation
+	params.Infants = cm.Some[uint32](1)
+	params.InfantsInSeat = cm.Some(true)
+	req, err = offersRequest(params, TRIP_ROUND_TRIP)
+	if err != nil {
+		t.Fatalf("offersRequest() error = %v", err)
+	}
+	var body AmadeusSearchRequest
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if req.Headers["Accept-Language"] != "es-ES" || body.CurrencyCode != "USD" {
+		t.Errorf("POST search = %v with currency %q, want es-ES and USD", req.Headers, body.CurrencyCode)
+	}
+}
+
+func TestSearchCacheKeyLocale(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key"})
+	english := Request{Method: "GET", PathWithQuery: FLIGHT_OFFERS_PATH + "?originLocationCode=MAD", Headers: map[string]string{"Accept-Language": "en-US"}}
+	spanish := english
+	spanish.Headers = withAcceptLanguage(english.Headers, "es-ES")
+	if searchCacheKey(english) == searchCacheKey(spanish) {
+		t.Error("searchCacheKey() is the same for two locales, want responses in each language kept apart")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+)
+
+const PRICING_PATH = "/v1/shopping/flight-offers/pricing"
+
+// Fare rule categories Amadeus reports in fareRules.rules
+const (
+	FARE_RULE_REFUND   = "REFUND"
+	FARE_RULE_EXCHANGE = "EXCHANGE"
+)
+
+// findRawOffer returns the offer with the given ID from a flight-offers
+// response exactly as Amadeus sent it, since pricing must echo it back
+func findRawOffer(respBody []byte, offerID string) (json.RawMessage, *AmadeusFlightOffer, error) {
+	var raw struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse flight offers: %v", err)
+	}
+
+	for _, data := range raw.Data {
+		var offer AmadeusFlightOffer
+		if err := json.Unmarshal(data, &offer); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse flight offers: %v", err)
+		}
+		if offer.ID == offerID {
+			return data, &offer, nil
+		}
+	}
+	return nil, nil, &PluginError{
+		Code:    ERR_OFFER_NOT_FOUND,
+		Message: fmt.Sprintf("no offer with id %q in the search results; search again and use a current id", offerID),
+	}
+}
+
+// pricingBody wraps one flight offer in a flight-offers-pricing request
+func pricingBody(offer json.RawMessage) ([]byte, error) {
+	body := map[string]any{
+		"data": map[string]any{
+			"type":         "flight-offers-pricing",
+			"flightOffers": []json.RawMessage{offer},
+		},
+	}
+	return json.Marshal(body)
+}
+
+// normalizeFareRules reads refundability and change rules from a priced
+// offer. A category Amadeus doesn't mention leaves its flag unknown (nil);
+// notApplicable means the action isn't allowed on this fare.
+func normalizeFareRules(offer AmadeusPricedOffer, detailed map[string]AmadeusDetailedFareRules) *FareRules {
+	rules := &FareRules{Notes: make([]FareNote, 0)}
+	if offer.FareRules != nil {
+		rules.Currency = offer.FareRules.Currency
+		for _, rule := range offer.FareRules.Rules {
+			allowed := !rule.NotApplicable
+			switch strings.ToUpper(rule.Category) {
+			case FARE_RULE_REFUND:
+				rules.Refundable = &allowed
+				if allowed {
+					rules.RefundPenalty = rule.MaxPenaltyAmount
+				}
+			case FARE_RULE_EXCHANGE:
+				rules.Changeable = &allowed
+				if allowed {
+					rules.ChangePenalty = rule.MaxPenaltyAmount
+				}
+			}
+		}
+	}
+
+	for segmentID, fare := range detailed {
+		for _, description := range fare.FareNotes.Descriptions {
+			rules.Notes = append(rules.Notes, FareNote{
+				SegmentID: segmentID,
+				FareBasis: fare.FareBasis,
+				Category:  description.DescriptionType,
+				Text:      description.Text,
+			})
+		}
+	}
+	// Map order is random; order by segment, keeping each segment's notes
+	// in the order Amadeus listed them
+	sort.SliceStable(rules.Notes, func(i, j int) bool {
+		return rules.Notes[i].SegmentID < rules.Notes[j].SegmentID
+	})
+	return rules
+}
+
+// normalizePricing converts a pricing response into the plugin's output,
+// comparing the confirmed price with the one the search returned
+func normalizePricing(respBody []byte, searched *AmadeusFlightOffer, includeFareRules bool) (*PricedOfferResult, error) {
+	var raw AmadeusPricingResponse
+	if err := json.Unmarshal(respBody, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing response: %v", err)
+	}
+	if len(raw.Data.FlightOffers) == 0 {
+		return nil, fmt.Errorf("pricing response has no flight offers")
+	}
+
+	priced := raw.Data.FlightOffers[0]
+	result := &PricedOfferResult{
+		OfferID:       searched.ID,
+		TotalPrice:    priced.Price.Total,
+		Currency:      priced.Price.Currency,
+		SearchedPrice: searched.Price.Total,
+		PriceChanged:  priced.Price.Total != searched.Price.Total || priced.Price.Currency != searched.Price.Currency,
+	}
+	if includeFareRules {
+		result.FareRules = normalizeFareRules(priced, raw.Included.DetailedFareRules)
+	}
+	return result, nil
+}
+
+// priceFlightOffer confirms the current price of one offer from a search,
+// optionally with its fare rules. Amadeus prices the offer object exactly as
+// the search returned it, so the search is run again to get it; offer IDs
+// are only meaningful within the same search parameters.
+func priceFlightOffer(params amadeusflightcomponent.FlightSearchParams, offerID string, includeFareRules bool) (string, error) {
+	release, err := useCredentials(params.APIKey, params.APISecret)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	offerID = strings.TrimSpace(offerID)
+	if offerID == "" {
+		return "", &PluginError{Code: ERR_MISSING_REQUIRED_PARAM, Message: "offer-id is required"}
+	}
+
+	searchBody, _, _, err := fetchOffers(params)
+	if err != nil {
+		return "", err
+	}
+	// Price in the presentation the search used; fetchOffers validated it
+	shown, _ := resolvePresentation(params.Presentation, params.CurrencyCode)
+	offer, searched, err := findRawOffer(searchBody, offerID)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := pricingBody(offer)
+	if err != nil {
+		return "", fmt.Errorf("failed to build pricing request: %v", err)
+	}
+
+	var query QueryBuilder
+	if includeFareRules {
+		query.Set("include", "detailed-fare-rules")
+	}
+	path := query.Path(PRICING_PATH)
+	// Amadeus serves pricing as a POST-tunneled GET
+	headers := map[string]string{
+		"Content-Type":           "application/json",
+		"X-HTTP-Method-Override": "GET",
+		"Accept-Language":        shown.Locale,
+	}
+
+	respBody, err := authorizedRequest("POST", path, headers, body)
+	if err != nil {
+		return "", fmt.Errorf("API request failed: %w", err)
+	}
+
+	result, err := normalizePricing(respBody, searched, includeFareRules)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := marshalJSON(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %v", err)
+	}
+	return string(data), nil
+}
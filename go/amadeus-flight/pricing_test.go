@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A pricing response for offer 2 of CAPTURED_OUTBOUND_OFFERS whose price rose
+// since the search, with fare rules: no refunds, changes for a fee
+const CAPTURED_PRICING = `{"data":{"type":"flight-offers-pricing","flightOffers":[
+  {"type":"flight-offer","id":"2","price":{"currency":"EUR","total":"301.40"},
+   "fareRules":{"currency":"EUR","rules":[
+     {"category":"REFUND","notApplicable":true},
+     {"category":"EXCHANGE","maxPenaltyAmount":"75.00"}]}}]},
+ "included":{"detailed-fare-rules":{
+   "2":{"fareBasis":"QLOWES","fareNotes":{"descriptions":[{"descriptionType":"PENALTIES","text":"CHANGES PERMITTED FOR A FEE"}]}},
+   "1":{"fareBasis":"QLOWES","fareNotes":{"descriptions":[
+     {"descriptionType":"PENALTIES","text":"NON-REFUNDABLE"},
+     {"descriptionType":"VOLUNTARY_CHANGES","text":"CHANGE FEE EUR 75"}]}}}}}`
+
+func TestFindRawOffer(t *testing.T) {
+	raw, offer, err := findRawOffer([]byte(CAPTURED_OUTBOUND_OFFERS), "2")
+	if err != nil {
+		t.Fatalf("findRawOffer() error = %v", err)
+	}
+	if offer.ID != "2" || offer.Price.Total != "289.90" {
+		t.Errorf("offer = %+v, want offer 2 at 289.90", offer)
+	}
+	// Pricing must echo the offer exactly as Amadeus sent it
+	if !strings.Contains(CAPTURED_OUTBOUND_OFFERS, string(raw)) {
+		t.Errorf("raw offer = %s, want the bytes from the search response", raw)
+	}
+
+	_, _, err = findRawOffer([]byte(CAPTURED_OUTBOUND_OFFERS), "9")
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_OFFER_NOT_FOUND {
+		t.Errorf("error = %v, want %s", err, ERR_OFFER_NOT_FOUND)
+	}
+}
+
+func TestNormalizePricing(t *testing.T) {
+	searched := &AmadeusFlightOffer{ID: "2", Price: AmadeusPrice{Currency: "EUR", Total: "289.90"}}
+
+	result, err := normalizePricing([]byte(CAPTURED_PRICING), searched, true)
+	if err != nil {
+		t.Fatalf("normalizePricing() error = %v", err)
+	}
+	if result.TotalPrice != "301.40" || result.SearchedPrice != "289.90" || !result.PriceChanged {
+		t.Errorf("result = %+v, want a change from 289.90 to 301.40", result)
+	}
+
+	rules := result.FareRules
+	if rules == nil {
+		t.Fatal("FareRules = nil, want the fare rules asked for")
+	}
+	if rules.Refundable == nil || *rules.Refundable || rules.RefundPenalty != "" {
+		t.Errorf("refund = %v %q, want not refundable", rules.Refundable, rules.RefundPenalty)
+	}
+	if rules.Changeable == nil || !*rules.Changeable || rules.ChangePenalty != "75.00" || rules.Currency != "EUR" {
+		t.Errorf("change = %v %q %s, want changeable for 75.00 EUR", rules.Changeable, rules.ChangePenalty, rules.Currency)
+	}
+	// Notes are ordered by segment, each segment's in the order given
+	var notes []string
+	for _, note := range rules.Notes {
+		notes = append(notes, note.SegmentID+":"+note.Category)
+	}
+	if got := strings.Join(notes, ","); got != "1:PENALTIES,1:VOLUNTARY_CHANGES,2:PENALTIES" {
+		t.Errorf("notes = %s", got)
+	}
+
+	result, err = normalizePricing([]byte(CAPTURED_PRICING), searched, false)
+	if err != nil || result.FareRules != nil {
+		t.Errorf("without fare rules: %+v, %v, want none", result, err)
+	}
+}
+
+func TestNormalizeFareRulesUnmentioned(t *testing.T) {
+	rules := normalizeFareRules(AmadeusPricedOffer{ID: "1"}, nil)
+	if rules.Refundable != nil || rules.Changeable != nil || rules.Notes == nil {
+		t.Errorf("rules = %+v, want unknown flags and an empty notes list", rules)
+	}
+}
+
+func TestPriceFlightOffer(t *testing.T) {
+	setEnv(t)
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	fake := &fakeTransport{}
+	fake.respond(FLIGHT_OFFERS_PATH, fakeResponse{status: 200, body: CAPTURED_OUTBOUND_OFFERS})
+	fake.respond(PRICING_PATH, fakeResponse{status: 200, body: CAPTURED_PRICING})
+	useTransport(t, fake)
+
+	params, _ := splitLegs(roundTripParams())
+	data, err := priceFlightOffer(params, " 2 ", true)
+	if err != nil {
+		t.Fatalf("priceFlightOffer() error = %v", err)
+	}
+	var result PricedOfferResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.OfferID != "2" || result.TotalPrice != "301.40" || result.FareRules == nil {
+		t.Errorf("result = %+v, want offer 2 repriced with fare rules", result)
+	}
+
+	pricing := fake.sent[1]
+	if pricing.Method != "POST" || pricing.PathWithQuery != PRICING_PATH+"?include=detailed-fare-rules" {
+		t.Errorf("pricing request = %s %s", pricing.Method, pricing.PathWithQuery)
+	}
+	if pricing.Headers["X-HTTP-Method-Override"] != "GET" {
+		t.Errorf("headers = %v, want the POST-tunneled GET override", pricing.Headers)
+	}
+	var body struct {
+		Data struct {
+			Type         string            `json:"type"`
+			FlightOffers []json.RawMessage `json:"flightOffers"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(pricing.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	// The offer goes back field for field; only whitespace may differ
+	raw, _, _ := findRawOffer([]byte(CAPTURED_OUTBOUND_OFFERS), "2")
+	var want bytes.Buffer
+	json.Compact(&want, raw)
+	if body.Data.Type != "flight-offers-pricing" || len(body.Data.FlightOffers) != 1 || string(body.Data.FlightOffers[0]) != want.String() {
+		t.Errorf("pricing body = %s, want offer 2 as searched", pricing.Body)
+	}
+}
+
+func TestPriceFlightOfferMissingID(t *testing.T) {
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	params, _ := splitLegs(roundTripParams())
+	_, err := priceFlightOffer(params, " ", false)
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_MISSING_REQUIRED_PARAM {
+		t.Errorf("error = %v, want %s", err, ERR_MISSING_REQUIRED_PARAM)
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none", len(fake.sent))
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// splitLegs turns a round-trip search into two one-way searches: the
+// outbound leg as given, and the inbound leg with the airports swapped,
+// departing on the return date
+func splitLegs(params amadeusflightcomponent.FlightSearchParams) (amadeusflightcomponent.FlightSearchParams, amadeusflightcomponent.FlightSearchParams) {
+	outbound := params
+	outbound.ReturnDate = cm.None[string]()
+
+	inbound := params
+	inbound.OriginLocationCode = params.DestinationLocationCode
+	inbound.DestinationLocationCode = params.OriginLocationCode
+	inbound.DepartureDate = strings.TrimSpace(*params.ReturnDate.Some())
+	inbound.ReturnDate = cm.None[string]()
+
+	return outbound, inbound
+}
+
+// cheapestOffer returns the lowest-priced offer, skipping offers whose price
+// can't be parsed
+func cheapestOffer(offers []FlightOffer) (*FlightOffer, float64) {
+	var cheapest *FlightOffer
+	var lowest float64
+	for i := range offers {
+		price, err := strconv.ParseFloat(offers[i].TotalPrice, 64)
+		if err != nil {
+			continue
+		}
+		if cheapest == nil || price < lowest {
+			cheapest, lowest = &offers[i], price
+		}
+	}
+	return cheapest, lowest
+}
+
+// cheapestCombination pairs the cheapest outbound and inbound offers. Legs
+// are priced independently, so the cheapest pair is the two cheapest legs.
+// There is no combination when either leg is empty or the currencies differ.
+func cheapestCombination(outbound []FlightOffer, inbound []FlightOffer) *CheapestCombination {
+	out, outPrice := cheapestOffer(outbound)
+	in, inPrice := cheapestOffer(inbound)
+	if out == nil || in == nil || out.Currency != in.Currency {
+		return nil
+	}
+
+	return &CheapestCombination{
+		OutboundOfferID: out.ID,
+		InboundOfferID:  in.ID,
+		TotalPrice:      strconv.FormatFloat(outPrice+inPrice, 'f', 2, 64),
+		Currency:        out.Currency,
+	}
+}
+
+// searchSplitFlights prices the outbound and inbound legs of a round trip as
+// separate one-way searches, sent together, so hosts can mix carriers
+func searchSplitFlights(params amadeusflightcomponent.FlightSearchParams) (string, error) {
+	release, err := useCredentials(params.APIKey, params.APISecret)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	// Load configuration
+	if err := loadConfig(); err != nil {
+		return "", err
+	}
+
+	if err := validateSearchParams(params); err != nil {
+		return "", err
+	}
+
+	trip, err := tripType(params)
+	if err != nil {
+		return "", err
+	}
+	if trip != TRIP_ROUND_TRIP {
+		return "", &PluginError{
+			Code:    ERR_MISSING_REQUIRED_PARAM,
+			Message: "return-date is required to split a search into outbound and inbound legs",
+		}
+	}
+
+	outbound, inbound := splitLegs(params)
+
+	var requests []Request
+	for _, leg := range []amadeusflightcomponent.FlightSearchParams{outbound, inbound} {
+		req, err := offersRequest(leg, TRIP_ONE_WAY)
+		if err != nil {
+			return "", err
+		}
+		requests = append(requests, req)
+	}
+
+	results := authorizedBatch(requests)
+
+	var legs [2]*FlightSearchResult
+	for i, name := range []string{"outbound", "inbound"} {
+		if results[i].Err != nil {
+			return "", fmt.Errorf("%s search failed: %w", name, results[i].Err)
+		}
+		legs[i], err = normalizeOffers(results[i].Response.Body, TRIP_ONE_WAY)
+		if err != nil {
+			return "", fmt.Errorf("%s search: %w", name, err)
+		}
+		if includeRaw := params.IncludeRaw.Some(); includeRaw != nil && *includeRaw {
+			if err := attachRawSegments(results[i].Response.Body, legs[i]); err != nil {
+				return "", fmt.Errorf("%s search: %w", name, err)
+			}
+		}
+		applyOfferFilters(params, legs[i])
+	}
+
+	result := SplitSearchResult{
+		Outbound:            *legs[0],
+		Inbound:             *legs[1],
+		CheapestCombination: cheapestCombination(legs[0].Offers, legs[1].Offers),
+	}
+
+	data, err := marshalJSON(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %v", err)
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// One-way flight-offers responses for each leg of MAD-JFK, 20-27 December
+const (
+	CAPTURED_OUTBOUND_OFFERS = `{"meta":{"count":2},"data":[
+  {"type":"flight-offer","id":"1","price":{"currency":"EUR","total":"315.20"},
+   "itineraries":[{"duration":"PT8H10M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T12:05:00"},
+     "arrival":{"iataCode":"JFK","at":"2025-12-20T14:15:00"},"carrierCode":"IB","number":"6251","duration":"PT8H10M"}]}]},
+  {"type":"flight-offer","id":"2","price":{"currency":"EUR","total":"289.90"},
+   "itineraries":[{"duration":"PT8H30M","segments":[{"departure":{"iataCode":"MAD","at":"2025-12-20T10:00:00"},
+     "arrival":{"iataCode":"JFK","at":"2025-12-20T12:30:00"},"carrierCode":"UX","number":"91","duration":"PT8H30M"}]}]}
+]}`
+	CAPTURED_INBOUND_OFFERS = `{"meta":{"count":1},"data":[
+  {"type":"flight-offer","id":"1","price":{"currency":"EUR","total":"402.15"},
+   "itineraries":[{"duration":"PT7H05M","segments":[{"departure":{"iataCode":"JFK","at":"2025-12-27T19:00:00"},
+     "arrival":{"iataCode":"MAD","at":"2025-12-28T08:05:00"},"carrierCode":"DL","number":"126","duration":"PT7H5M"}]}]}
+]}`
+)
+
+func roundTripParams() amadeusflightcomponent.FlightSearchParams {
+	return amadeusflightcomponent.FlightSearchParams{
+		OriginLocationCode:      "MAD",
+		DestinationLocationCode: "JFK",
+		DepartureDate:           "2025-12-20",
+		ReturnDate:              cm.Some("2025-12-27"),
+		Adults:                  1,
+	}
+}
+
+func TestSplitLegs(t *testing.T) {
+	outbound, inbound := splitLegs(roundTripParams())
+
+	if outbound.OriginLocationCode != "MAD" || outbound.DestinationLocationCode != "JFK" ||
+		outbound.DepartureDate != "2025-12-20" || outbound.ReturnDate.Some() != nil {
+		t.Errorf("outbound = %+v, want one-way MAD-JFK on the 20th", outbound)
+	}
+	if inbound.OriginLocationCode != "JFK" || inbound.DestinationLocationCode != "MAD" ||
+		inbound.DepartureDate != "2025-12-27" || inbound.ReturnDate.Some() != nil {
+		t.Errorf("inbound = %+v, want one-way JFK-MAD on the 27th", inbound)
+	}
+}
+
+func TestCheapestCombination(t *testing.T) {
+	outbound := []FlightOffer{{ID: "1", TotalPrice: "315.20", Currency: "EUR"}, {ID: "2", TotalPrice: "289.90", Currency: "EUR"}}
+	inbound := []FlightOffer{{ID: "7", TotalPrice: "n/a", Currency: "EUR"}, {ID: "8", TotalPrice: "402.15", Currency: "EUR"}}
+
+	got := cheapestCombination(outbound, inbound)
+	want := CheapestCombination{OutboundOfferID: "2", InboundOfferID: "8", TotalPrice: "692.05", Currency: "EUR"}
+	if got == nil || *got != want {
+		t.Errorf("cheapestCombination() = %+v, want %+v", got, want)
+	}
+
+	if got := cheapestCombination(outbound, nil); got != nil {
+		t.Errorf("cheapestCombination() with no inbound = %+v, want nil", got)
+	}
+	usd := []FlightOffer{{ID: "9", TotalPrice: "410.00", Currency: "USD"}}
+	if got := cheapestCombination(outbound, usd); got != nil {
+		t.Errorf("cheapestCombination() across currencies = %+v, want nil", got)
+	}
+}
+
+func TestSearchSplitFlights(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	fake := &fakeTransport{}
+	// The inbound answer arrives first; the legs must still come back in order
+	fake.respond(FLIGHT_OFFERS_PATH,
+		fakeResponse{readyAt: 200 * time.Millisecond, status: 200, body: CAPTURED_OUTBOUND_OFFERS},
+		fakeResponse{readyAt: 100 * time.Millisecond, status: 200, body: CAPTURED_INBOUND_OFFERS},
+	)
+	useTransport(t, fake)
+
+	data, err := searchSplitFlights(roundTripParams())
+	if err != nil {
+		t.Fatalf("searchSplitFlights() error = %v", err)
+	}
+	var result SplitSearchResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Outbound.Count != 2 || result.Inbound.Count != 1 {
+		t.Errorf("counts = %d outbound, %d inbound, want 2 and 1", result.Outbound.Count, result.Inbound.Count)
+	}
+	if result.Outbound.TripType != TRIP_ONE_WAY || result.Inbound.TripType != TRIP_ONE_WAY {
+		t.Errorf("trip types = %q, %q, want one-way legs", result.Outbound.TripType, result.Inbound.TripType)
+	}
+	want := CheapestCombination{OutboundOfferID: "2", InboundOfferID: "1", TotalPrice: "692.05", Currency: "EUR"}
+	if result.CheapestCombination == nil || *result.CheapestCombination != want {
+		t.Errorf("cheapest = %+v, want %+v", result.CheapestCombination, want)
+	}
+
+	if len(fake.sent) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(fake.sent))
+	}
+	if inbound := fake.sent[1].PathWithQuery; !strings.Contains(inbound, "originLocationCode=JFK&destinationLocationCode=MAD&departureDate=2025-12-27") ||
+		strings.Contains(inbound, "returnDate") {
+		t.Errorf("inbound request = %q, want a one-way JFK-MAD search", inbound)
+	}
+}
+
+func TestSearchSplitFlightsRetriesLeg(t *testing.T) {
+	setEnv(t)
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret", Token: "token", Expiration: time.Now().Unix() + 600})
+	fake := &fakeTransport{}
+	// The outbound leg fails transiently; it is retried on its own
+	fake.respond(FLIGHT_OFFERS_PATH,
+		fakeResponse{status: 503},
+		fakeResponse{status: 200, body: CAPTURED_INBOUND_OFFERS},
+		fakeResponse{status: 200, body: CAPTURED_OUTBOUND_OFFERS},
+	)
+	useTransport(t, fake)
+
+	data, err := searchSplitFlights(roundTripParams())
+	if err != nil {
+		t.Fatalf("searchSplitFlights() error = %v", err)
+	}
+	var result SplitSearchResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Outbound.Count != 2 || result.Inbound.Count != 1 {
+		t.Errorf("counts = %d outbound, %d inbound, want both legs", result.Outbound.Count, result.Inbound.Count)
+	}
+	if len(fake.sent) != 3 || fake.sent[2].PathWithQuery != fake.sent[0].PathWithQuery {
+		t.Errorf("sent %d requests, want the outbound leg sent again", len(fake.sent))
+	}
+}
+
+func TestSearchSplitFlightsNeedsReturnDate(t *testing.T) {
+	useConfig(t, &Config{APIKey: "key", APISecret: "secret"})
+	params := roundTripParams()
+	params.ReturnDate = cm.None[string]()
+
+	_, err := searchSplitFlights(params)
+	if err == nil || !strings.Contains(err.Error(), "return-date is required") {
+		t.Errorf("searchSplitFlights() error = %v, want return-date required", err)
+	}
+}
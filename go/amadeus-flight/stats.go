@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SearchSummary is the response returned by summarize-search. The price and
+// duration fields are omitted when no offer has a readable value for them.
+type SearchSummary struct {
+	OfferCount  int    `json:"offer_count"`
+	Currency    string `json:"currency,omitempty"`
+	MinPrice    string `json:"min_price,omitempty"`
+	MaxPrice    string `json:"max_price,omitempty"`
+	MedianPrice string `json:"median_price,omitempty"`
+	// AverageDuration is the mean total flying time per offer, summed over
+	// its itineraries, e.g. "PT7H45M"
+	AverageDuration        string `json:"average_duration,omitempty"`
+	AverageDurationMinutes *int   `json:"average_duration_minutes,omitempty"`
+	// Carriers counts the offers each carrier flies at least one segment of
+	Carriers map[string]int `json:"carriers"`
+}
+
+// median returns the middle of sorted values, or the mean of the two middle
+// ones for an even count
+func median(sorted []float64) float64 {
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// offerDuration totals an offer's itinerary durations; ok is false when one
+// can't be read
+func offerDuration(offer FlightOffer) (time.Duration, bool) {
+	var total time.Duration
+	for _, itinerary := range offer.Itineraries {
+		duration, err := ParseISODuration(itinerary.Duration)
+		if err != nil {
+			return 0, false
+		}
+		total += duration
+	}
+	return total, len(offer.Itineraries) > 0
+}
+
+// summarizeOffers aggregates offers already known to share one currency
+func summarizeOffers(offers []FlightOffer) SearchSummary {
+	summary := SearchSummary{OfferCount: len(offers), Carriers: map[string]int{}}
+
+	var prices []float64
+	var totalDuration time.Duration
+	var timed int
+	for _, offer := range offers {
+		if summary.Currency == "" {
+			summary.Currency = offer.Currency
+		}
+		if price, err := strconv.ParseFloat(offer.TotalPrice, 64); err == nil {
+			prices = append(prices, price)
+		}
+		if duration, ok := offerDuration(offer); ok {
+			totalDuration += duration
+			timed++
+		}
+
+		carriers := map[string]bool{}
+		for _, itinerary := range offer.Itineraries {
+			for _, segment := range itinerary.Segments {
+				if segment.CarrierCode != "" {
+					carriers[segment.CarrierCode] = true
+				}
+			}
+		}
+		for carrier := range carriers {
+			summary.Carriers[carrier]++
+		}
+	}
+
+	if len(prices) > 0 {
+		sort.Float64s(prices)
+		summary.MinPrice = strconv.FormatFloat(prices[0], 'f', 2, 64)
+		summary.MaxPrice = strconv.FormatFloat(prices[len(prices)-1], 'f', 2, 64)
+		summary.MedianPrice = strconv.FormatFloat(median(prices), 'f', 2, 64)
+	}
+	if timed > 0 {
+		average := (totalDuration / time.Duration(timed)).Round(time.Minute)
+		minutes := int(average.Minutes())
+		summary.AverageDuration = FormatISODuration(average)
+		summary.AverageDurationMinutes = &minutes
+	}
+	return summary
+}
+
+// summarizeSearch computes aggregate statistics over a search-flights or
+// search-multi-city response. It sends no requests.
+func summarizeSearch(searchJSON string) (string, error) {
+	var search struct {
+		Offers *[]FlightOffer `json:"offers"`
+	}
+	if err := json.Unmarshal([]byte(searchJSON), &search); err != nil {
+		return "", &PluginError{Code: ERR_INVALID_SEARCH_RESULT, Message: fmt.Sprintf("search result is not valid JSON: %v", err)}
+	}
+	if search.Offers == nil {
+		return "", &PluginError{Code: ERR_INVALID_SEARCH_RESULT, Message: "search result must include offers, as returned by search-flights"}
+	}
+
+	// Prices in different currencies can't be compared without exchange rates
+	offers := *search.Offers
+	for _, offer := range offers {
+		if offer.Currency != offers[0].Currency {
+			return "", &PluginError{
+				Code:    ERR_INVALID_SEARCH_RESULT,
+				Message: fmt.Sprintf("offers are priced in both %s and %s; summarize one currency at a time", offers[0].Currency, offer.Currency),
+			}
+		}
+	}
+
+	data, err := marshalJSON(summarizeOffers(offers))
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %v", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestMedian(t *testing.T) {
+	for _, tt := range []struct {
+		sorted []float64
+		want   float64
+	}{
+		{[]float64{5}, 5},
+		{[]float64{1, 2, 9}, 2},
+		{[]float64{1, 2, 4, 9}, 3},
+	} {
+		if got := median(tt.sorted); got != tt.want {
+			t.Errorf("median(%v) = %v, want %v", tt.sorted, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeSearch(t *testing.T) {
+	result, err := normalizeOffers([]byte(CAPTURED_STOPS_OFFERS), TRIP_ONE_WAY)
+	if err != nil {
+		t.Fatalf("normalizeOffers() error = %v", err)
+	}
+	searchJSON, _ := json.Marshal(result)
+
+	data, err := summarizeSearch(string(searchJSON))
+	if err != nil {
+		t.Fatalf("summarizeSearch() error = %v", err)
+	}
+	var summary SearchSummary
+	if err := json.Unmarshal([]byte(data), &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.OfferCount != 3 || summary.Currency != "EUR" {
+		t.Errorf("summary = %+v, want 3 EUR offers", summary)
+	}
+	if summary.MinPrice != "241.80" || summary.MaxPrice != "315.20" || summary.MedianPrice != "278.00" {
+		t.Errorf("prices = %s/%s/%s, want 241.80/315.20/278.00", summary.MinPrice, summary.MaxPrice, summary.MedianPrice)
+	}
+	// 8h10m, 11h40m, and 9h55m average to 9h55m
+	if summary.AverageDuration != "PT9H55M" || summary.AverageDurationMinutes == nil || *summary.AverageDurationMinutes != 595 {
+		t.Errorf("average duration = %s, %v, want PT9H55M", summary.AverageDuration, summary.AverageDurationMinutes)
+	}
+	if want := map[string]int{"IB": 1, "BA": 1, "UX": 1}; !maps.Equal(summary.Carriers, want) {
+		t.Errorf("carriers = %v, want %v", summary.Carriers, want)
+	}
+}
+
+func TestSummarizeSearchEmpty(t *testing.T) {
+	data, err := summarizeSearch(`{"offers":[]}`)
+	if err != nil {
+		t.Fatalf("summarizeSearch() error = %v", err)
+	}
+	// With nothing to aggregate only the count and carriers remain
+	if want := `{"offer_count":0,"carriers":{}}`; strings.Join(strings.Fields(data), "") != want {
+		t.Errorf("summary = %s, want %s", data, want)
+	}
+}
+
+func TestSummarizeSearchInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		search string
+		want   string
+	}{
+		{"not JSON", `offers`, "not valid JSON"},
+		{"no offers", `{"error":"Failed to search flights"}`, "must include offers"},
+		{"mixed currencies", `{"offers":[{"id":"1","currency":"EUR","total_price":"10.00"},{"id":"2","currency":"USD","total_price":"12.00"}]}`, "both EUR and USD"},
+	} {
+		_, err := summarizeSearch(tt.search)
+		var pluginErr *PluginError
+		if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_SEARCH_RESULT || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %s mentioning %q", tt.name, err, ERR_INVALID_SEARCH_RESULT, tt.want)
+		}
+	}
+}
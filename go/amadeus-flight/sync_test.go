@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// SHARED_FILES are copied between the Go plugins rather than imported from a
+// common module: each plugin builds on its own generated WASI bindings, and
+// stays a standalone template. The copies must match apart from the module
+// path.
+var SHARED_FILES = []string{"http.go", "http_test.go", "query.go", "query_test.go", "sync_test.go", "wasi.go", "wasi_other.go"}
+
+// GO_PLUGINS are the plugins holding a copy of SHARED_FILES, this one
+// included
+var GO_PLUGINS = []string{"../amadeus-flight", "../directions", "../places", "../weather"}
+
+// modulePath reads the module path from the go.mod in dir
+func modulePath(t *testing.T, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.TrimSpace(path)
+		}
+	}
+	t.Fatalf("no module line in %s/go.mod", dir)
+	return ""
+}
+
+func TestSharedFilesInSync(t *testing.T) {
+	module := modulePath(t, ".")
+	for _, peer := range GO_PLUGINS {
+		t.Run(filepath.Base(peer), func(t *testing.T) {
+			// A plugin copied out on its own has nothing to stay in sync with
+			if _, err := os.Stat(peer); os.IsNotExist(err) {
+				t.Skipf("%s not found", peer)
+			}
+			peerModule := modulePath(t, peer)
+			if peerModule == module {
+				t.Skip("this plugin")
+			}
+
+			for _, name := range SHARED_FILES {
+				ours, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				theirs, err := os.ReadFile(filepath.Join(peer, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(ours, bytes.ReplaceAll(theirs, []byte(peerModule), []byte(module))) {
+					t.Errorf("%s differs from %s; make the same change in both", name, filepath.Join(peer, name))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import "encoding/json"
+
+// AmadeusFlightOffersResponse is the subset of the Amadeus flight-offers
+// response the plugin reads when normalizing offers
+type AmadeusFlightOffersResponse struct {
+	Data []AmadeusFlightOffer `json:"data"`
+	Meta struct {
+		Links AmadeusLinks `json:"links"`
+	} `json:"meta"`
+}
+
+type AmadeusFlightOffer struct {
+	ID               string                   `json:"id"`
+	Price            AmadeusPrice             `json:"price"`
+	Itineraries      []AmadeusItinerary       `json:"itineraries"`
+	TravelerPricings []AmadeusTravelerPricing `json:"travelerPricings"`
+	Links            AmadeusLinks             `json:"links"`
+	// LastTicketingDate is the last day, YYYY-MM-DD, the offer can be ticketed
+	LastTicketingDate string `json:"lastTicketingDate"`
+	// OneWay marks a one-way offer returned for addOneWayOffers
+	OneWay bool `json:"oneWay"`
+}
+
+// AmadeusLinks maps link names such as "self" to URLs. Values are kept raw
+// so an unexpected shape drops that link instead of failing the response.
+type AmadeusLinks map[string]json.RawMessage
+
+// AmadeusTravelerPricing holds the fare details for one traveler; fare
+// details are matched to segments by segment ID
+type AmadeusTravelerPricing struct {
+	TravelerID           string               `json:"travelerId"`
+	TravelerType         string               `json:"travelerType"`
+	FareDetailsBySegment []AmadeusFareDetails `json:"fareDetailsBySegment"`
+}
+
+type AmadeusFareDetails struct {
+	SegmentID           string              `json:"segmentId"`
+	Cabin               string              `json:"cabin"`
+	IncludedCheckedBags *AmadeusCheckedBags `json:"includedCheckedBags"`
+}
+
+// AmadeusCheckedBags gives the allowance either as a bag count or as a
+// total weight, depending on the fare
+type AmadeusCheckedBags struct {
+	Quantity   *int   `json:"quantity"`
+	Weight     *int   `json:"weight"`
+	WeightUnit string `json:"weightUnit"`
+}
+
+type AmadeusPrice struct {
+	Currency   string `json:"currency"`
+	Total      string `json:"total"`
+	Base       string `json:"base"`
+	GrandTotal string `json:"grandTotal"`
+}
+
+type AmadeusItinerary struct {
+	Duration string           `json:"duration"`
+	Segments []AmadeusSegment `json:"segments"`
+}
+
+type AmadeusSegment struct {
+	ID            string          `json:"id"`
+	Departure     AmadeusEndpoint `json:"departure"`
+	Arrival       AmadeusEndpoint `json:"arrival"`
+	CarrierCode   string          `json:"carrierCode"`
+	Number        string          `json:"number"`
+	Duration      string          `json:"duration"`
+	NumberOfStops int             `json:"numberOfStops"`
+	// Co2Emissions is only present in some responses, usually one entry per cabin
+	Co2Emissions []AmadeusCo2Emission `json:"co2Emissions"`
+}
+
+// AmadeusRawOffers reads only the segments of a flight-offers response,
+// keeping them undecoded for include-raw
+type AmadeusRawOffers struct {
+	Data []struct {
+		Itineraries []struct {
+			Segments []json.RawMessage `json:"segments"`
+		} `json:"itineraries"`
+	} `json:"data"`
+}
+
+type AmadeusCo2Emission struct {
+	Weight     int    `json:"weight"`
+	WeightUnit string `json:"weightUnit"`
+	Cabin      string `json:"cabin"`
+}
+
+type AmadeusEndpoint struct {
+	IataCode string `json:"iataCode"`
+	Terminal string `json:"terminal,omitempty"`
+	At       string `json:"at"`
+}
+
+// AmadeusFlightDatesResponse is the subset of the Amadeus flight-dates
+// (cheapest date search) response the plugin reads
+type AmadeusFlightDatesResponse struct {
+	Data []AmadeusFlightDate `json:"data"`
+	Meta struct {
+		Currency string `json:"currency"`
+	} `json:"meta"`
+}
+
+type AmadeusFlightDate struct {
+	Origin        string `json:"origin"`
+	Destination   string `json:"destination"`
+	DepartureDate string `json:"departureDate"`
+	ReturnDate    string `json:"returnDate,omitempty"`
+	Price         struct {
+		Total string `json:"total"`
+	} `json:"price"`
+}
+
+// AmadeusPriceMetricsResponse is the subset of the Amadeus itinerary price
+// metrics response the plugin reads
+type AmadeusPriceMetricsResponse struct {
+	Data []struct {
+		CurrencyCode string `json:"currencyCode"`
+		OneWay       bool   `json:"oneWay"`
+		PriceMetrics []struct {
+			Amount          string `json:"amount"`
+			QuartileRanking string `json:"quartileRanking"`
+		} `json:"priceMetrics"`
+	} `json:"data"`
+}
+
+// AmadeusCheckinLinksResponse is the subset of the Amadeus check-in links
+// response the plugin reads
+type AmadeusCheckinLinksResponse struct {
+	Data []struct {
+		Channel string `json:"channel"`
+		Href    string `json:"href"`
+	} `json:"data"`
+}
+
+// AmadeusPricingResponse is the subset of the Amadeus flight-offers pricing
+// response the plugin reads. Detailed fare rules are keyed by segment ID and
+// only present when requested with include=detailed-fare-rules.
+type AmadeusPricingResponse struct {
+	Data struct {
+		FlightOffers []AmadeusPricedOffer `json:"flightOffers"`
+	} `json:"data"`
+	Included struct {
+		DetailedFareRules map[string]AmadeusDetailedFareRules `json:"detailed-fare-rules"`
+	} `json:"included"`
+}
+
+type AmadeusPricedOffer struct {
+	ID        string            `json:"id"`
+	Price     AmadeusPrice      `json:"price"`
+	FareRules *AmadeusFareRules `json:"fareRules"`
+}
+
+// AmadeusFareRules summarizes penalties by category (REFUND, EXCHANGE, ...)
+type AmadeusFareRules struct {
+	Currency string `json:"currency"`
+	Rules    []struct {
+		Category         string `json:"category"`
+		MaxPenaltyAmount string `json:"maxPenaltyAmount"`
+		NotApplicable    bool   `json:"notApplicable"`
+	} `json:"rules"`
+}
+
+type AmadeusDetailedFareRules struct {
+	FareBasis string `json:"fareBasis"`
+	Name      string `json:"name"`
+	FareNotes struct {
+		Descriptions []struct {
+			DescriptionType string `json:"descriptionType"`
+			Text            string `json:"text"`
+		} `json:"descriptions"`
+	} `json:"fareNotes"`
+}
+
+// AmadeusSearchRequest is the body of a POST flight-offers search, which
+// unlike the GET search can describe any number of legs
+type AmadeusSearchRequest struct {
+	CurrencyCode       string                     `json:"currencyCode,omitempty"`
+	OriginDestinations []AmadeusOriginDestination `json:"originDestinations"`
+	Travelers          []AmadeusSearchTraveler    `json:"travelers"`
+	Sources            []string                   `json:"sources"`
+	SearchCriteria     AmadeusSearchCriteria      `json:"searchCriteria"`
+}
+
+type AmadeusOriginDestination struct {
+	ID                      string `json:"id"`
+	OriginLocationCode      string `json:"originLocationCode"`
+	DestinationLocationCode string `json:"destinationLocationCode"`
+	DepartureDateTimeRange  struct {
+		Date string `json:"date"`
+	} `json:"departureDateTimeRange"`
+}
+
+// AmadeusSearchTraveler is one traveler; a held infant names the adult
+// whose lap it sits on
+type AmadeusSearchTraveler struct {
+	ID                string `json:"id"`
+	TravelerType      string `json:"travelerType"`
+	AssociatedAdultID string `json:"associatedAdultId,omitempty"`
+}
+
+type AmadeusSearchCriteria struct {
+	MaxFlightOffers int                   `json:"maxFlightOffers"`
+	MaxPrice        int                   `json:"maxPrice,omitempty"`
+	AddOneWayOffers bool                  `json:"addOneWayOffers,omitempty"`
+	FlightFilters   *AmadeusFlightFilters `json:"flightFilters,omitempty"`
+}
+
+type AmadeusFlightFilters struct {
+	CabinRestrictions     []AmadeusCabinRestriction     `json:"cabinRestrictions,omitempty"`
+	CarrierRestrictions   *AmadeusCarrierRestrictions   `json:"carrierRestrictions,omitempty"`
+	ConnectionRestriction *AmadeusConnectionRestriction `json:"connectionRestriction,omitempty"`
+}
+
+type AmadeusCabinRestriction struct {
+	Cabin                string   `json:"cabin"`
+	Coverage             string   `json:"coverage"`
+	OriginDestinationIDs []string `json:"originDestinationIds"`
+}
+
+type AmadeusCarrierRestrictions struct {
+	IncludedCarrierCodes []string `json:"includedCarrierCodes,omitempty"`
+	ExcludedCarrierCodes []string `json:"excludedCarrierCodes,omitempty"`
+}
+
+type AmadeusConnectionRestriction struct {
+	MaxNumberOfConnections int `json:"maxNumberOfConnections"`
+}
+
+// FlightSearchResult is the normalized response returned by search-flights
+type FlightSearchResult struct {
+	TripType string `json:"trip_type"`
+	Count    int    `json:"count"`
+	// DuplicatesRemoved is only set when the search asked for de-duplication
+	DuplicatesRemoved *int `json:"duplicates_removed,omitempty"`
+	// FilteredByMaxStops is only set when the search set max-stops
+	FilteredByMaxStops *int `json:"filtered_by_max_stops,omitempty"`
+	// FilteredByTimeWindow is only set when the search set departure-time-window
+	FilteredByTimeWindow *int `json:"filtered_by_time_window,omitempty"`
+	// FilteredByConnections is only set when the search set avoid-airports
+	// or require-connection-via
+	FilteredByConnections *int `json:"filtered_by_connections,omitempty"`
+	// FilteredByExpiry is only set when the search set exclude-expired
+	FilteredByExpiry *int `json:"filtered_by_expiry,omitempty"`
+	// Cached is set when SEARCH_CACHE answered the search from an earlier,
+	// identical one instead of calling Amadeus
+	Cached bool `json:"cached,omitempty"`
+	// Links are the response's links from Amadeus, such as "self" for the
+	// search itself
+	Links  map[string]string `json:"links,omitempty"`
+	Offers []FlightOffer     `json:"offers"`
+	// Warnings lists enrichments dropped from some offers without failing
+	// the search, each as "<field> unavailable ...: <reason>"
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// SplitSearchResult is the response returned by search-split-flights
+type SplitSearchResult struct {
+	Outbound FlightSearchResult `json:"outbound"`
+	Inbound  FlightSearchResult `json:"inbound"`
+	// CheapestCombination is omitted when a leg has no offers or the legs
+	// are priced in different currencies
+	CheapestCombination *CheapestCombination `json:"cheapest_combination,omitempty"`
+}
+
+// CheapestCombination is the lowest-priced outbound and inbound pairing
+type CheapestCombination struct {
+	OutboundOfferID string `json:"outbound_offer_id"`
+	InboundOfferID  string `json:"inbound_offer_id"`
+	TotalPrice      string `json:"total_price"`
+	Currency        string `json:"currency"`
+}
+
+type FlightOffer struct {
+	ID         string `json:"id"`
+	TotalPrice string `json:"total_price"`
+	Currency   string `json:"currency"`
+	// Co2EmissionsKg is omitted unless Amadeus reported emissions for every segment
+	Co2EmissionsKg *int `json:"co2_emissions_kg,omitempty"`
+	// LastTicketingDate is omitted when Amadeus doesn't report one
+	LastTicketingDate string `json:"last_ticketing_date,omitempty"`
+	// TicketingExpired is set once LastTicketingDate has passed
+	TicketingExpired bool `json:"ticketing_expired,omitempty"`
+	// OneWay is set on the one-way offers add-one-way-offers asked for; they
+	// have a single itinerary even in a round-trip search
+	OneWay bool `json:"one_way,omitempty"`
+	// Links are the offer's own links from Amadeus, if it sent any
+	Links map[string]string `json:"links,omitempty"`
+	// ValueScore is only set when the search asked for rank-by-value
+	ValueScore  *float64    `json:"value_score,omitempty"`
+	Itineraries []Itinerary `json:"itineraries"`
+	// RawSegments is only set when the search asked for include-raw: every
+	// segment of every itinerary, in order, as Amadeus sent it
+	RawSegments []json.RawMessage `json:"raw_segments,omitempty"`
+}
+
+type Itinerary struct {
+	Duration string `json:"duration"`
+	// Stops counts connections plus technical stops within segments
+	Stops    int       `json:"stops"`
+	Segments []Segment `json:"segments"`
+	// Layovers has one entry per connection, in order; omitted for direct flights
+	Layovers []Layover `json:"layovers,omitempty"`
+}
+
+// Layover is the time spent at a connecting airport between two segments
+type Layover struct {
+	Airport         string `json:"airport"`
+	Duration        string `json:"duration"`
+	DurationMinutes int    `json:"duration_minutes"`
+}
+
+type Segment struct {
+	DepartureAirport string `json:"departure_airport"`
+	DepartureTime    string `json:"departure_time"`
+	ArrivalAirport   string `json:"arrival_airport"`
+	ArrivalTime      string `json:"arrival_time"`
+	CarrierCode      string `json:"carrier_code"`
+	FlightNumber     string `json:"flight_number"`
+	Duration         string `json:"duration"`
+	// Cabin is the fare's cabin on this segment; omitted when not reported
+	Cabin string `json:"cabin,omitempty"`
+	// CheckedBags is omitted when Amadeus doesn't report an allowance
+	CheckedBags *CheckedBags `json:"checked_bags,omitempty"`
+}
+
+// CheckedBags is the included checked-baggage allowance for a segment
+type CheckedBags struct {
+	Quantity   *int   `json:"quantity,omitempty"`
+	Weight     *int   `json:"weight,omitempty"`
+	WeightUnit string `json:"weight_unit,omitempty"`
+}
+
+// PriceMetricsResult is the normalized response returned by get-price-metrics
+type PriceMetricsResult struct {
+	Origin        string `json:"origin"`
+	Destination   string `json:"destination"`
+	DepartureDate string `json:"departure_date"`
+	Currency      string `json:"currency,omitempty"`
+	OneWay        bool   `json:"one_way"`
+	// Quartiles is null when Amadeus has no price history for the route
+	Quartiles *PriceQuartiles `json:"quartiles"`
+}
+
+// CheckinLinksResult is the normalized response returned by get-checkin-link
+type CheckinLinksResult struct {
+	AirlineCode string `json:"airline_code"`
+	Language    string `json:"language"`
+	// Links is empty when Amadeus has no check-in page for the airline
+	Links []CheckinLink `json:"checkin_links"`
+}
+
+// CheckinLink is one check-in page; Channel is "Web", "Mobile", or "All"
+type CheckinLink struct {
+	Channel string `json:"channel"`
+	Href    string `json:"href"`
+}
+
+// PriceQuartiles splits historical fares for a route into quartiles; a fare
+// at or below First is in the cheapest 25%
+type PriceQuartiles struct {
+	Minimum string `json:"minimum"`
+	First   string `json:"first"`
+	Median  string `json:"median"`
+	Third   string `json:"third"`
+	Maximum string `json:"maximum"`
+}
+
+// FlightDatesResult is the normalized response returned by search-flight-dates
+type FlightDatesResult struct {
+	ViewBy   string       `json:"view_by"`
+	Currency string       `json:"currency"`
+	Count    int          `json:"count"`
+	Dates    []FlightDate `json:"dates"`
+}
+
+type FlightDate struct {
+	Origin        string `json:"origin"`
+	Destination   string `json:"destination"`
+	DepartureDate string `json:"departure_date"`
+	ReturnDate    string `json:"return_date,omitempty"`
+	TotalPrice    string `json:"total_price"`
+}
+
+// PricedOfferResult is the normalized response returned by price-flight-offer
+type PricedOfferResult struct {
+	OfferID    string `json:"offer_id"`
+	TotalPrice string `json:"total_price"`
+	Currency   string `json:"currency"`
+	// SearchedPrice is the offer's total in the search that found it
+	SearchedPrice string `json:"searched_price"`
+	PriceChanged  bool   `json:"price_changed"`
+	// FareRules is only set when the call asked for fare rules
+	FareRules *FareRules `json:"fare_rules,omitempty"`
+}
+
+// FareRules are an offer's refund and change conditions. Refundable and
+// Changeable are null when Amadeus didn't say; penalties are maximum amounts
+// in Currency and only set for actions that are allowed.
+type FareRules struct {
+	Refundable    *bool      `json:"refundable"`
+	RefundPenalty string     `json:"refund_penalty,omitempty"`
+	Changeable    *bool      `json:"changeable"`
+	ChangePenalty string     `json:"change_penalty,omitempty"`
+	Currency      string     `json:"currency,omitempty"`
+	Notes         []FareNote `json:"notes"`
+}
+
+// FareNote is one section of a segment's fare rule text (e.g. PENALTIES)
+type FareNote struct {
+	SegmentID string `json:"segment_id"`
+	FareBasis string `json:"fare_basis"`
+	Category  string `json:"category"`
+	Text      string `json:"text"`
+}
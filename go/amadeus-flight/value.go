@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+)
+
+// DEFAULT_VALUE_WEIGHTS favor price, then total flying time, then stops
+var DEFAULT_VALUE_WEIGHTS = amadeusflightcomponent.ValueWeights{
+	Price:    0.5,
+	Duration: 0.3,
+	Stops:    0.2,
+}
+
+// valueWeights returns the search's weights, or the defaults
+func valueWeights(params amadeusflightcomponent.FlightSearchParams) amadeusflightcomponent.ValueWeights {
+	if weights := params.ValueWeights.Some(); weights != nil {
+		return *weights
+	}
+	return DEFAULT_VALUE_WEIGHTS
+}
+
+// validateValueWeights checks that every weight is a finite, non-negative
+// number and that at least one of them counts
+func validateValueWeights(weights amadeusflightcomponent.ValueWeights) error {
+	for _, weight := range []struct {
+		name  string
+		value float64
+	}{
+		{"price", weights.Price},
+		{"duration", weights.Duration},
+		{"stops", weights.Stops},
+	} {
+		if math.IsNaN(weight.value) || math.IsInf(weight.value, 0) || weight.value < 0 {
+			return &PluginError{
+				Code:    ERR_INVALID_WEIGHTS,
+				Message: fmt.Sprintf("value-weights.%s must be zero or more, got %v", weight.name, weight.value),
+			}
+		}
+	}
+	if weights.Price+weights.Duration+weights.Stops == 0 {
+		return &PluginError{Code: ERR_INVALID_WEIGHTS, Message: "at least one value weight must be above zero"}
+	}
+	return nil
+}
+
+// offerMeasures are the three quantities an offer is scored on
+type offerMeasures struct {
+	price    float64
+	duration time.Duration
+	stops    int
+}
+
+// measureOffer totals an offer's price, duration, and stops across its
+// itineraries. ok is false when the price or a duration can't be read.
+func measureOffer(offer FlightOffer) (offerMeasures, bool) {
+	price, err := strconv.ParseFloat(offer.TotalPrice, 64)
+	if err != nil {
+		return offerMeasures{}, false
+	}
+	measures := offerMeasures{price: price}
+	for _, itinerary := range offer.Itineraries {
+		duration, err := ParseISODuration(itinerary.Duration)
+		if err != nil {
+			return offerMeasures{}, false
+		}
+		measures.duration += duration
+		measures.stops += itinerary.Stops
+	}
+	return measures, true
+}
+
+// spread scales value into [0, 1] between the best (lowest) and worst
+// values in the result; when every offer is equal it counts as best
+func spread(value, lowest, highest float64) float64 {
+	if highest == lowest {
+		return 0
+	}
+	return (value - lowest) / (highest - lowest)
+}
+
+// rankByValue scores each offer from 0 to 100, where 100 is the cheapest,
+// shortest, and fewest-stop offer in the result on every weighted measure,
+// and sorts the offers best first. Measures are compared relative to the
+// other offers, so scores only mean something within one response. Offers
+// that can't be measured get no score and keep their order at the end.
+func rankByValue(offers []FlightOffer, weights amadeusflightcomponent.ValueWeights) {
+	measures := make([]offerMeasures, len(offers))
+	measured := make([]bool, len(offers))
+	var lowest, highest offerMeasures
+	first := true
+	for i, offer := range offers {
+		measures[i], measured[i] = measureOffer(offer)
+		if !measured[i] {
+			continue
+		}
+		m := measures[i]
+		if first {
+			lowest, highest, first = m, m, false
+			continue
+		}
+		lowest = offerMeasures{min(lowest.price, m.price), min(lowest.duration, m.duration), min(lowest.stops, m.stops)}
+		highest = offerMeasures{max(highest.price, m.price), max(highest.duration, m.duration), max(highest.stops, m.stops)}
+	}
+
+	total := weights.Price + weights.Duration + weights.Stops
+	for i := range offers {
+		if !measured[i] {
+			offers[i].ValueScore = nil
+			continue
+		}
+		m := measures[i]
+		penalty := weights.Price*spread(m.price, lowest.price, highest.price) +
+			weights.Duration*spread(float64(m.duration), float64(lowest.duration), float64(highest.duration)) +
+			weights.Stops*spread(float64(m.stops), float64(lowest.stops), float64(highest.stops))
+		score := math.Round(1000*(1-penalty/total)) / 10
+		offers[i].ValueScore = &score
+	}
+
+	sort.SliceStable(offers, func(a, b int) bool {
+		scoreA, scoreB := offers[a].ValueScore, offers[b].ValueScore
+		if scoreA == nil || scoreB == nil {
+			return scoreB == nil && scoreA != nil
+		}
+		return *scoreA > *scoreB
+	})
+}
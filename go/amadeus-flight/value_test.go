@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	amadeusflightcomponent "github.com/my_org/amadeus-flight/gen/example/amadeus-flight/amadeus-flight-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// valueOffers are four one-way offers: fast and dear, cheap with a stop,
+// slowest in the middle, and one whose price can't be read
+func valueOffers() []FlightOffer {
+	offer := func(id, price, duration string, stops int) FlightOffer {
+		return FlightOffer{ID: id, TotalPrice: price, Currency: "EUR", Itineraries: []Itinerary{{Duration: duration, Stops: stops}}}
+	}
+	return []FlightOffer{
+		offer("fast", "300.00", "PT8H", 0),
+		offer("unpriced", "n/a", "PT9H", 0),
+		offer("middle", "250.00", "PT11H", 1),
+		offer("cheap", "200.00", "PT10H", 1),
+	}
+}
+
+// scores lists each offer's ID and score in order; -1 stands for no score
+func scores(offers []FlightOffer) ([]string, []float64) {
+	var ids []string
+	var values []float64
+	for _, offer := range offers {
+		ids = append(ids, offer.ID)
+		if offer.ValueScore == nil {
+			values = append(values, -1)
+			continue
+		}
+		values = append(values, *offer.ValueScore)
+	}
+	return ids, values
+}
+
+func TestRankByValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights amadeusflightcomponent.ValueWeights
+		ids     []string
+		scores  []float64
+	}{
+		// Penalties: cheap 0.3*2/3 + 0.2 = 0.4; fast 0.5; middle 0.25 + 0.3 + 0.2 = 0.75
+		{"defaults", DEFAULT_VALUE_WEIGHTS, []string{"cheap", "fast", "middle", "unpriced"}, []float64{60, 50, 25, -1}},
+		{"price only", amadeusflightcomponent.ValueWeights{Price: 1}, []string{"cheap", "middle", "fast", "unpriced"}, []float64{100, 50, 0, -1}},
+		{"stops only", amadeusflightcomponent.ValueWeights{Stops: 2}, []string{"fast", "middle", "cheap", "unpriced"}, []float64{100, 0, 0, -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offers := valueOffers()
+			rankByValue(offers, tt.weights)
+			ids, values := scores(offers)
+			for i := range ids {
+				if ids[i] != tt.ids[i] || values[i] != tt.scores[i] {
+					t.Errorf("ranked %v %v, want %v %v", ids, values, tt.ids, tt.scores)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestRankByValueEqualOffers(t *testing.T) {
+	offers := valueOffers()[:1]
+	offers = append(offers, offers[0])
+	offers[1].ID = "same"
+	rankByValue(offers, DEFAULT_VALUE_WEIGHTS)
+	if ids, values := scores(offers); ids[0] != "fast" || values[0] != 100 || values[1] != 100 {
+		t.Errorf("ranked %v %v, want both best, in their original order", ids, values)
+	}
+}
+
+func TestValidateValueWeights(t *testing.T) {
+	if err := validateValueWeights(DEFAULT_VALUE_WEIGHTS); err != nil {
+		t.Errorf("validateValueWeights(defaults) error = %v", err)
+	}
+	for _, weights := range []amadeusflightcomponent.ValueWeights{
+		{},
+		{Price: -0.5, Duration: 1},
+		{Price: math.NaN()},
+		{Duration: math.Inf(1)},
+	} {
+		var pluginErr *PluginError
+		if err := validateValueWeights(weights); !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_WEIGHTS {
+			t.Errorf("validateValueWeights(%+v) error = %v, want %s", weights, err, ERR_INVALID_WEIGHTS)
+		}
+	}
+}
+
+func TestApplyOfferFiltersRankByValue(t *testing.T) {
+	params := roundTripParams()
+	params.RankByValue = cm.Some(true)
+	result := &FlightSearchResult{Offers: valueOffers()}
+	applyOfferFilters(params, result)
+	if ids, _ := scores(result.Offers); ids[0] != "cheap" || result.Count != 4 {
+		t.Errorf("ranked %v (count %d), want cheap first of 4 with the default weights", ids, result.Count)
+	}
+
+	// Without rank-by-value the order and the missing scores are kept
+	params.RankByValue = cm.None[bool]()
+	result = &FlightSearchResult{Offers: valueOffers()}
+	applyOfferFilters(params, result)
+	if ids, values := scores(result.Offers); ids[0] != "fast" || values[0] != -1 {
+		t.Errorf("offers %v %v, want them as returned, unscored", ids, values)
+	}
+}
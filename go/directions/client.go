@@ -0,0 +1,25 @@
+package main
+
+// host is the authority a request is sent to
+func (req Request) host() string {
+	if req.Authority != "" {
+		return req.Authority
+	}
+	return GOOGLE_MAPS_HOST
+}
+
+// REQUEST_MIDDLEWARE wraps every Google Maps request: errors carry the
+// redacted URL, a success without a body returns NO_CONTENT_BODY, and
+// transient failures are retried
+var REQUEST_MIDDLEWARE = []Middleware{withRequestURLs, withNoContent, withRetries}
+
+// makeHTTPRequest sends a GET request through REQUEST_MIDDLEWARE and returns
+// its body
+func makeHTTPRequest(pathWithQuery string) ([]byte, error) {
+	send := chain(roundTrip, REQUEST_MIDDLEWARE...)
+	response, err := send(Request{Method: "GET", PathWithQuery: pathWithQuery})
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
@@ -0,0 +1,57 @@
+//go:build tinygo
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	directionscomponent "github.com/my_org/directions/gen/example/directions/directions-component"
+)
+
+// The exports are only registered in the TinyGo build. They reach every WASI
+// import the plugin uses, so leaving them out lets go test build the package
+// on the host and run the parsing against captured responses.
+func init() {
+	directionscomponent.Exports.Route = func(origin string, destination string, mode string) string {
+		apiKey := getEnvVar("GOOGLE_MAPS_API_KEY")
+		if apiKey == "" {
+			return errorJSON(missingAPIKey())
+		}
+
+		if strings.TrimSpace(origin) == "" || strings.TrimSpace(destination) == "" {
+			return errorJSON("Invalid route request", &PluginError{
+				Code:    ERR_MISSING_REQUIRED_PARAM,
+				Message: "origin and destination are required",
+			})
+		}
+
+		// Unlike weather units, an unknown mode is rejected rather than defaulted
+		// since a silently different mode gives a misleading route
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		if _, ok := SUPPORTED_MODES[mode]; !ok {
+			return errorJSON("Invalid route request", &PluginError{
+				Code:    ERR_INVALID_MODE,
+				Message: fmt.Sprintf("unsupported mode %q: use driving, walking, transit, or cycling", mode),
+			})
+		}
+
+		route, err := getRoute(apiKey, origin, destination, mode)
+		if err != nil {
+			return errorJSON("Failed to fetch route", err)
+		}
+
+		// Return result as JSON
+		result, err := json.Marshal(route)
+		if err != nil {
+			return errorJSON("Failed to serialize response", err)
+		}
+
+		return string(result)
+	}
+	directionscomponent.Exports.RequiredEnv = func() string {
+		result, _ := json.Marshal(REQUIRED_ENV)
+		return string(result)
+	}
+}
@@ -0,0 +1,1039 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/my_org/directions/gen/wasi/http/types"
+	"go.bytecodealliance.org/cm"
+)
+
+// NEVER marks a fake response that doesn't arrive
+const NEVER time.Duration = -1
+
+// fakeResponse is what fakeTransport answers a request with, readyAt after
+// it was sent
+type fakeResponse struct {
+	readyAt time.Duration
+	status  int
+	headers map[string]string
+	body    string
+	// err fails the request instead, as the host reports a connection error
+	err error
+	// trickle, when set, makes the body never end, each Read delivering one
+	// more byte this long after the last; stall makes it never deliver any
+	trickle time.Duration
+	stall   bool
+	// release, when set, holds the response back until it is closed
+	release chan struct{}
+}
+
+// fakeTransport answers requests by path from a script, on a virtual clock
+// that Wait and Sleep advance. It is safe to use from several goroutines.
+type fakeTransport struct {
+	mu        sync.Mutex
+	now       time.Duration
+	responses map[string][]fakeResponse
+	sent      []OutgoingRequest
+	read      []string
+	closed    []string
+	slept     []time.Duration
+}
+
+// useTransport installs fake as the transport for the rest of the test
+func useTransport(t *testing.T, fake *fakeTransport) {
+	t.Helper()
+	previous := transport
+	transport = fake
+	t.Cleanup(func() { transport = previous })
+}
+
+// respond queues responses for a path, used one per request in order
+func (f *fakeTransport) respond(path string, responses ...fakeResponse) {
+	if f.responses == nil {
+		f.responses = make(map[string][]fakeResponse)
+	}
+	f.responses[path] = append(f.responses[path], responses...)
+}
+
+func (f *fakeTransport) Send(req OutgoingRequest) (PendingResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, req)
+	path, _, _ := strings.Cut(req.PathWithQuery, "?")
+	queued := f.responses[path]
+	if len(queued) == 0 {
+		return nil, errors.New("fake transport: no response for " + path)
+	}
+	f.responses[path] = queued[1:]
+
+	response := queued[0]
+	if response.readyAt != NEVER {
+		response.readyAt += f.now
+	}
+	return &fakePending{transport: f, path: path, response: response}, nil
+}
+
+func (f *fakeTransport) Wait(pending []PendingResponse, deadline time.Duration) []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		var ready []int
+		next := deadline
+		for pos, p := range pending {
+			readyAt := p.(*fakePending).response.readyAt
+			switch {
+			case readyAt == NEVER:
+			case readyAt <= f.now:
+				ready = append(ready, pos)
+			default:
+				next = min(next, readyAt)
+			}
+		}
+		if len(ready) > 0 || f.now >= deadline {
+			return ready
+		}
+		f.now = next
+	}
+}
+
+func (f *fakeTransport) Now() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeTransport) Sleep(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.slept = append(f.slept, d)
+	f.now += d
+}
+
+type fakePending struct {
+	transport *fakeTransport
+	path      string
+	response  fakeResponse
+}
+
+func (p *fakePending) Response() (IncomingResponse, error) {
+	if p.response.release != nil {
+		<-p.response.release
+	}
+	p.transport.mu.Lock()
+	defer p.transport.mu.Unlock()
+	p.transport.read = append(p.transport.read, p.path)
+	if p.response.err != nil {
+		return nil, p.response.err
+	}
+	return &fakeIncoming{transport: p.transport, response: p.response}, nil
+}
+
+func (p *fakePending) Close() {
+	p.transport.mu.Lock()
+	defer p.transport.mu.Unlock()
+	p.transport.closed = append(p.transport.closed, p.path)
+}
+
+type fakeIncoming struct {
+	transport *fakeTransport
+	response  fakeResponse
+	done      bool
+}
+
+func (r *fakeIncoming) Status() int {
+	return r.response.status
+}
+
+func (r *fakeIncoming) Header(name string) string {
+	for key, value := range r.response.headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func (r *fakeIncoming) Read() ([]byte, error) {
+	r.transport.mu.Lock()
+	defer r.transport.mu.Unlock()
+	switch {
+	case r.response.stall:
+		return nil, nil
+	case r.response.trickle > 0:
+		r.transport.now += r.response.trickle
+		return []byte("."), nil
+	}
+	if r.done {
+		return nil, io.EOF
+	}
+	r.done = true
+	return []byte(r.response.body), nil
+}
+
+func (r *fakeIncoming) WaitReadable(deadline time.Duration) {
+	r.transport.mu.Lock()
+	defer r.transport.mu.Unlock()
+	// Only a stalled body waits, and nothing ever arrives
+	if r.response.stall {
+		r.transport.now = max(r.transport.now, deadline)
+	}
+}
+
+func TestDoBatchMixedOrder(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond("/a", fakeResponse{readyAt: 300 * time.Millisecond, status: 200, body: "a"})
+	fake.respond("/b", fakeResponse{readyAt: 100 * time.Millisecond, status: 200, body: "b"})
+	fake.respond("/c", fakeResponse{readyAt: 200 * time.Millisecond, status: 503, body: "c"})
+	useTransport(t, fake)
+
+	results := DoBatch([]Request{
+		{Method: "GET", PathWithQuery: "/a"},
+		{Method: "GET", PathWithQuery: "/b"},
+		{Method: "GET", PathWithQuery: "/c"},
+	})
+
+	if want := []string{"/b", "/c", "/a"}; !reflect.DeepEqual(fake.read, want) {
+		t.Errorf("read order = %v, want %v", fake.read, want)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	for i, want := range []string{"a", "b"} {
+		if results[i].Err != nil {
+			t.Fatalf("results[%d].Err = %v", i, results[i].Err)
+		}
+		if got := string(results[i].Response.Body); got != want {
+			t.Errorf("results[%d] body = %q, want %q", i, got, want)
+		}
+	}
+	var httpErr *HTTPError
+	if !errors.As(results[2].Err, &httpErr) || httpErr.Status != 503 {
+		t.Errorf("results[2].Err = %v, want HTTP 503", results[2].Err)
+	}
+}
+
+func TestDoBatchSameTick(t *testing.T) {
+	fake := &fakeTransport{}
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		fake.respond(path, fakeResponse{status: 200, body: strings.TrimPrefix(path, "/")})
+	}
+	useTransport(t, fake)
+
+	results := DoBatch([]Request{
+		{Method: "GET", PathWithQuery: "/a"},
+		{Method: "GET", PathWithQuery: "/b"},
+		{Method: "GET", PathWithQuery: "/c"},
+		{Method: "GET", PathWithQuery: "/d"},
+	})
+
+	for i, want := range []string{"a", "b", "c", "d"} {
+		if results[i].Err != nil {
+			t.Fatalf("results[%d].Err = %v", i, results[i].Err)
+		}
+		if got := string(results[i].Response.Body); got != want {
+			t.Errorf("results[%d] body = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestDoBatchTimesOutPending(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond("/slow", fakeResponse{readyAt: NEVER})
+	fake.respond("/fast", fakeResponse{readyAt: time.Second, status: 200, body: "fast"})
+	useTransport(t, fake)
+
+	results := DoBatch([]Request{
+		{Method: "GET", PathWithQuery: "/slow"},
+		{Method: "GET", PathWithQuery: "/fast"},
+	})
+
+	var pluginErr *PluginError
+	if !errors.As(results[0].Err, &pluginErr) || pluginErr.Code != ERR_RESPONSE_TIMEOUT {
+		t.Errorf("results[0].Err = %v, want %s", results[0].Err, ERR_RESPONSE_TIMEOUT)
+	}
+	if results[1].Err != nil || string(results[1].Response.Body) != "fast" {
+		t.Errorf("results[1] = %+v, want body fast", results[1])
+	}
+	if len(fake.closed) != 2 {
+		t.Errorf("closed %v, want both requests closed", fake.closed)
+	}
+	if fake.now != DEFAULT_RESPONSE_TIMEOUT {
+		t.Errorf("clock = %v, want the wave to end at %v", fake.now, DEFAULT_RESPONSE_TIMEOUT)
+	}
+}
+
+func TestResponseTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", DEFAULT_RESPONSE_TIMEOUT},
+		{" 5 ", 5 * time.Second},
+		{"0", DEFAULT_RESPONSE_TIMEOUT},
+		{"soon", DEFAULT_RESPONSE_TIMEOUT},
+		{"3600", MAX_RESPONSE_TIMEOUT},
+	}
+	for _, tt := range tests {
+		setEnv(t, "HTTP_TIMEOUT_SECONDS", tt.value)
+		if got := responseTimeout(); got != tt.want {
+			t.Errorf("responseTimeout() with %q = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTripTimesOut(t *testing.T) {
+	setEnv(t, "HTTP_TIMEOUT_SECONDS", "5")
+	fake := &fakeTransport{}
+	fake.respond("/slow", fakeResponse{readyAt: NEVER}, fakeResponse{readyAt: NEVER})
+	useTransport(t, fake)
+
+	// Timeouts are not retried: another wait would likely hang just the same
+	_, err := chain(roundTrip, withRetries)(Request{Method: "GET", PathWithQuery: "/slow"})
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_RESPONSE_TIMEOUT {
+		t.Errorf("error = %v, want %s", err, ERR_RESPONSE_TIMEOUT)
+	}
+	if len(fake.sent) != 1 || len(fake.closed) != 1 {
+		t.Errorf("sent %d, closed %d, want the one request abandoned", len(fake.sent), len(fake.closed))
+	}
+	if fake.now != 5*time.Second {
+		t.Errorf("clock = %v, want the wait to end at 5s", fake.now)
+	}
+}
+
+func TestRoundTripWithinTimeout(t *testing.T) {
+	setEnv(t, "HTTP_TIMEOUT_SECONDS", "5")
+	fake := &fakeTransport{}
+	fake.respond("/slow", fakeResponse{readyAt: 4 * time.Second, status: 200, body: "late"})
+	useTransport(t, fake)
+
+	response, err := roundTrip(Request{Method: "GET", PathWithQuery: "/slow"})
+	if err != nil || string(response.Body) != "late" {
+		t.Errorf("roundTrip() = %+v, %v, want the response that arrived at 4s", response, err)
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	tests := map[string]int{
+		"":    DEFAULT_MAX_IN_FLIGHT,
+		" 3 ": 3,
+		"0":   DEFAULT_MAX_IN_FLIGHT,
+		"-2":  DEFAULT_MAX_IN_FLIGHT,
+		"ten": DEFAULT_MAX_IN_FLIGHT,
+		"500": MAX_IN_FLIGHT_LIMIT,
+	}
+	for value, want := range tests {
+		setEnv(t, "HTTP_MAX_IN_FLIGHT", value)
+		if got := maxInFlight(); got != want {
+			t.Errorf("maxInFlight(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestDoBatchWaves(t *testing.T) {
+	setEnv(t, "HTTP_MAX_IN_FLIGHT", "2")
+	fake := &fakeTransport{}
+	for _, path := range []string{"/a", "/b", "/c"} {
+		fake.respond(path, fakeResponse{readyAt: time.Second, status: 200, body: path})
+	}
+	useTransport(t, fake)
+
+	results := DoBatch([]Request{
+		{Method: "GET", PathWithQuery: "/a"},
+		{Method: "GET", PathWithQuery: "/b"},
+		{Method: "GET", PathWithQuery: "/c"},
+	})
+	for i, path := range []string{"/a", "/b", "/c"} {
+		// Results keep the requests' order across waves
+		if results[i].Err != nil || string(results[i].Response.Body) != path {
+			t.Errorf("results[%d] = %+v, want the response to %s", i, results[i], path)
+		}
+	}
+
+	// The third request waits for the first wave, so it is sent a second in
+	// and answered a second after that
+	if fake.now != 2*time.Second {
+		t.Errorf("clock = %v, want 2s for two waves", fake.now)
+	}
+}
+
+func TestDoBatchMiddleware(t *testing.T) {
+	setEnv(t, "HTTP_MAX_IN_FLIGHT", "2")
+	fake := &fakeTransport{}
+	fake.respond("/a", fakeResponse{status: 503}, fakeResponse{status: 200, body: "a"})
+	fake.respond("/b", fakeResponse{status: 200, body: "b"})
+	fake.respond("/c", fakeResponse{status: 404})
+	useTransport(t, fake)
+
+	results := DoBatch([]Request{
+		{Method: "GET", PathWithQuery: "/a"},
+		{Method: "GET", PathWithQuery: "/b"},
+		{Method: "GET", PathWithQuery: "/c"},
+	}, withRequestURLs, withRetries)
+
+	// The 503 is retried like a single request's, and the others are sent once
+	if results[0].Err != nil || string(results[0].Response.Body) != "a" || string(results[1].Response.Body) != "b" {
+		t.Errorf("results = %+v, %+v, want a after a retry and b", results[0], results[1])
+	}
+	if len(fake.sent) != 4 || len(fake.slept) != 1 {
+		t.Errorf("sent %d and slept %d times, want 4 and 1", len(fake.sent), len(fake.slept))
+	}
+	// The retry goes out before the second wave
+	if fake.sent[2].PathWithQuery != "/a" {
+		t.Errorf("third request = %s, want the retry of /a", fake.sent[2].PathWithQuery)
+	}
+	var reqErr *RequestError
+	if !errors.As(results[2].Err, &reqErr) || !strings.HasSuffix(reqErr.URL, "/c") {
+		t.Errorf("results[2] error = %v, want it annotated with its URL", results[2].Err)
+	}
+}
+
+// compress encodes data with a Content-Encoding coding
+func compress(t *testing.T, coding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch coding {
+	case "gzip":
+		writer = gzip.NewWriter(&buf)
+	case "deflate":
+		writer = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		writer, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		writer = brotli.NewWriter(&buf)
+	default:
+		t.Fatalf("no encoder for %q", coding)
+	}
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	plain := []byte(`{"name":"London","main":{"temp":12.5}}`)
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"none", "", plain},
+		{"identity", "identity", plain},
+		{"gzip", "gzip", compress(t, "gzip", plain)},
+		{"x-gzip", "x-gzip", compress(t, "gzip", plain)},
+		{"deflate", "deflate", compress(t, "deflate", plain)},
+		{"raw deflate", "deflate", compress(t, "raw-deflate", plain)},
+		{"brotli", "br", compress(t, "br", plain)},
+		{"stacked", "gzip, br", compress(t, "br", compress(t, "gzip", plain))},
+		{"upper case", "GZIP", compress(t, "gzip", plain)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeBody(tt.encoding, tt.body)
+			if err != nil {
+				t.Fatalf("decodeBody() error = %v", err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("decodeBody() = %q, want %q", got, plain)
+			}
+		})
+	}
+}
+
+func TestDecodeBodyUnsupported(t *testing.T) {
+	_, err := decodeBody("zstd", []byte("data"))
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_UNSUPPORTED_ENCODING {
+		t.Errorf("decodeBody() error = %v, want %s", err, ERR_UNSUPPORTED_ENCODING)
+	}
+}
+
+func TestDecodeBodyCorrupt(t *testing.T) {
+	if _, err := decodeBody("gzip", []byte("not gzip")); err == nil {
+		t.Error("decodeBody() accepted a corrupt gzip body")
+	}
+}
+
+func TestRoundTripDecodesBody(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{
+		status:  200,
+		headers: map[string]string{"Content-Encoding": "br"},
+		body:    string(compress(t, "br", []byte(`{"ok":true}`))),
+	})
+	useTransport(t, fake)
+
+	response, err := roundTrip(Request{Method: "GET", PathWithQuery: "/data"})
+	if err != nil {
+		t.Fatalf("roundTrip() error = %v", err)
+	}
+	if string(response.Body) != `{"ok":true}` {
+		t.Errorf("body = %q, want the decoded JSON", response.Body)
+	}
+	if got := fake.sent[0].Headers["Accept-Encoding"]; got != ACCEPT_ENCODING {
+		t.Errorf("Accept-Encoding = %q, want %q", got, ACCEPT_ENCODING)
+	}
+}
+
+func TestDefaultAccept(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{status: 200, body: `{}`}, fakeResponse{status: 200, body: `{}`})
+	useTransport(t, fake)
+
+	for _, headers := range []map[string]string{nil, {"accept": "text/csv"}} {
+		if _, err := roundTrip(Request{Method: "GET", PathWithQuery: "/data", Headers: headers}); err != nil {
+			t.Fatalf("roundTrip() error = %v", err)
+		}
+	}
+	if got := fake.sent[0].Headers["Accept"]; got != DEFAULT_ACCEPT {
+		t.Errorf("Accept = %q, want %q", got, DEFAULT_ACCEPT)
+	}
+	// A request's own Accept wins, whatever its case, and isn't sent twice
+	if got, ok := fake.sent[1].Headers["Accept"]; ok || fake.sent[1].Headers["accept"] != "text/csv" {
+		t.Errorf("headers = %v (Accept %q), want only the request's accept", fake.sent[1].Headers, got)
+	}
+}
+
+func TestClassifyErrorCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		code        types.ErrorCode
+		want        string
+		wantMessage string
+	}{
+		{"DNS timeout", types.ErrorCodeDNSTimeout(), ERR_DNS_ERROR, ""},
+		{"DNS error", types.ErrorCodeDNSError(types.DNSErrorPayload{Rcode: cm.Some("NXDOMAIN")}), ERR_DNS_ERROR, "rcode NXDOMAIN"},
+		{"TLS protocol", types.ErrorCodeTLSProtocolError(), ERR_TLS_ERROR, ""},
+		{"TLS certificate", types.ErrorCodeTLSCertificateError(), ERR_TLS_ERROR, ""},
+		{"TLS alert", types.ErrorCodeTLSAlertReceived(types.TLSAlertReceivedPayload{AlertMessage: cm.Some("handshake failure")}), ERR_TLS_ERROR, "handshake failure"},
+		{"connection refused", types.ErrorCodeConnectionRefused(), ERR_CONNECTION_REFUSED, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyErrorCode("failed to handle request", tt.code)
+			var pluginErr *PluginError
+			if !errors.As(err, &pluginErr) || pluginErr.Code != tt.want {
+				t.Fatalf("classifyErrorCode() = %v, want code %s", err, tt.want)
+			}
+			if !strings.HasPrefix(pluginErr.Message, "failed to handle request: ") || !strings.Contains(pluginErr.Message, tt.wantMessage) {
+				t.Errorf("message = %q, want the context and %q", pluginErr.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestClassifyErrorCodeOther(t *testing.T) {
+	err := classifyErrorCode("HTTP error", types.ErrorCodeConnectionTimeout())
+	var pluginErr *PluginError
+	if err == nil || errors.As(err, &pluginErr) {
+		t.Errorf("classifyErrorCode() = %#v, want a plain error", err)
+	}
+}
+
+func TestConnectionErrorNotRetried(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{err: classifyErrorCode("HTTP error", types.ErrorCodeConnectionRefused())})
+	useTransport(t, fake)
+
+	_, err := chain(roundTrip, withRetries)(Request{Method: "GET", PathWithQuery: "/data"})
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_CONNECTION_REFUSED {
+		t.Errorf("error = %v, want %s", err, ERR_CONNECTION_REFUSED)
+	}
+	if len(fake.sent) != 1 {
+		t.Errorf("sent %d requests, want no retry of a refused connection", len(fake.sent))
+	}
+}
+
+// captureLog sends log lines to the returned slice for the rest of the test
+func captureLog(t *testing.T) *[]string {
+	t.Helper()
+	var lines []string
+	previous := logSink
+	SetLogSink(func(line string) { lines = append(lines, line) })
+	t.Cleanup(func() { logSink = previous })
+	return &lines
+}
+
+func TestTLSErrorNotRetried(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{err: classifyErrorCode("HTTP error", types.ErrorCodeTLSCertificateError())})
+	useTransport(t, fake)
+
+	// The host's trust store rejected the certificate; trying again won't
+	// change its mind
+	_, err := chain(roundTrip, withRetries)(Request{Method: "GET", PathWithQuery: "/data"})
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_TLS_ERROR {
+		t.Errorf("error = %v, want %s", err, ERR_TLS_ERROR)
+	}
+	if len(fake.sent) != 1 {
+		t.Errorf("sent %d requests, want no retry of a TLS failure", len(fake.sent))
+	}
+}
+
+func TestLoggingRedactsSecrets(t *testing.T) {
+	setEnv(t, "HTTP_LOG", "true")
+	lines := captureLog(t)
+	fake := &fakeTransport{}
+	fake.respond("/oauth2/token", fakeResponse{status: 200, body: `{"access_token":"tok-123","expires_in":1799}`})
+	useTransport(t, fake)
+
+	_, err := roundTrip(Request{
+		Method:        "POST",
+		PathWithQuery: "/oauth2/token?appid=app-456&units=metric",
+		Headers:       map[string]string{"Authorization": "Bearer bearer-789"},
+		Body:          []byte("grant_type=client_credentials&client_id=id-1&client_secret=secret-000"),
+	})
+	if err != nil {
+		t.Fatalf("roundTrip() error = %v", err)
+	}
+
+	logged := strings.Join(*lines, "\n")
+	if len(*lines) != 2 {
+		t.Fatalf("logged %d lines, want the request and the response:\n%s", len(*lines), logged)
+	}
+	for _, secret := range []string{"tok-123", "app-456", "bearer-789", "secret-000"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("log leaks %q:\n%s", secret, logged)
+		}
+	}
+	for _, want := range []string{"appid=REDACTED&units=metric", "Authorization:REDACTED", "grant_type=client_credentials&client_id=REDACTED&client_secret=REDACTED", `"access_token":"REDACTED"`} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("log is missing %q:\n%s", want, logged)
+		}
+	}
+
+	// The request itself still carries the secrets
+	if fake.sent[0].Headers["Authorization"] != "Bearer bearer-789" || !strings.Contains(fake.sent[0].PathWithQuery, "appid=app-456") {
+		t.Errorf("sent %+v, want the secrets intact", fake.sent[0])
+	}
+}
+
+func TestLoggingOff(t *testing.T) {
+	setEnv(t)
+	lines := captureLog(t)
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{status: 200})
+	useTransport(t, fake)
+
+	if _, err := roundTrip(Request{Method: "GET", PathWithQuery: "/data"}); err != nil {
+		t.Fatalf("roundTrip() error = %v", err)
+	}
+	if len(*lines) != 0 {
+		t.Errorf("logged %q without HTTP_LOG", *lines)
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	tests := map[string]string{
+		"/data/2.5/weather?q=London&appid=abc&units=metric": "/data/2.5/weather?q=London&appid=REDACTED&units=metric",
+		"/v1/x?APIKEY=abc&key=def":                          "/v1/x?APIKEY=REDACTED&key=REDACTED",
+		"/v1/x?client_secret=abc&access_token=def":          "/v1/x?client_secret=REDACTED&access_token=REDACTED",
+		"/v1/x?keyword=abc":                                 "/v1/x?keyword=abc",
+		"/v1/x":                                             "/v1/x",
+	}
+	for in, want := range tests {
+		if got := redactQuery(in); got != want {
+			t.Errorf("redactQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestReadBodyDeadlineTrickle(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{status: 200, trickle: time.Second})
+	useTransport(t, fake)
+
+	_, err := roundTrip(Request{Method: "GET", PathWithQuery: "/data"})
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_BODY_READ_TIMEOUT {
+		t.Fatalf("roundTrip() error = %v, want %s", err, ERR_BODY_READ_TIMEOUT)
+	}
+	if fake.now != BODY_READ_TIMEOUT {
+		t.Errorf("gave up at %v, want %v", fake.now, BODY_READ_TIMEOUT)
+	}
+	if !strings.Contains(pluginErr.Message, "(30 bytes received)") {
+		t.Errorf("message = %q, want the bytes received", pluginErr.Message)
+	}
+}
+
+func TestReadBodyDeadlineStall(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{status: 200, stall: true})
+	useTransport(t, fake)
+
+	_, err := roundTrip(Request{Method: "GET", PathWithQuery: "/data"})
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_BODY_READ_TIMEOUT {
+		t.Fatalf("roundTrip() error = %v, want %s", err, ERR_BODY_READ_TIMEOUT)
+	}
+	if len(fake.closed) != 1 {
+		t.Errorf("closed %v, want the response released", fake.closed)
+	}
+}
+
+func TestReadBodyContentLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		length string
+		body   string
+		want   string
+	}{
+		{"exact", "11", `{"ok":true}`, ""},
+		{"no header", "", `{"ok":true}`, ""},
+		{"unparseable header", "lots", `{"ok":true}`, ""},
+		{"truncated", "100", `{"cut":`, ERR_TRUNCATED_BODY},
+		{"bogus huge length", "18446744073709551615", `{"ok":true}`, ERR_TRUNCATED_BODY},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.length != "" {
+				headers["Content-Length"] = tt.length
+			}
+			fake := &fakeTransport{}
+			fake.respond("/data", fakeResponse{status: 200, headers: headers, body: tt.body})
+			useTransport(t, fake)
+
+			resp, err := roundTrip(Request{Method: "GET", PathWithQuery: "/data"})
+			if tt.want == "" {
+				if err != nil || string(resp.Body) != tt.body {
+					t.Errorf("roundTrip() = %v, %v, want the body %q", resp, err, tt.body)
+				}
+				return
+			}
+			var pluginErr *PluginError
+			if !errors.As(err, &pluginErr) || pluginErr.Code != tt.want {
+				t.Errorf("roundTrip() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTripHEAD(t *testing.T) {
+	fake := &fakeTransport{}
+	// A body that never arrives would stall the read; HEAD must not wait on it
+	fake.respond("/data",
+		fakeResponse{status: 200, headers: map[string]string{"Content-Length": "5000", "Content-Type": "application/json"}, stall: true},
+		fakeResponse{status: 404, stall: true},
+	)
+	useTransport(t, fake)
+
+	resp, err := roundTrip(Request{Method: "HEAD", PathWithQuery: "/data"})
+	if err != nil {
+		t.Fatalf("roundTrip(HEAD) error = %v", err)
+	}
+	if resp.Status != 200 || resp.ContentType != "application/json" || resp.Body != nil {
+		t.Errorf("response = %+v, want a bodiless 200", resp)
+	}
+
+	_, err = roundTrip(Request{Method: "HEAD", PathWithQuery: "/data"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Status != 404 {
+		t.Errorf("roundTrip(HEAD) error = %v, want a 404", err)
+	}
+}
+
+func TestSendRequestUnsupportedMethod(t *testing.T) {
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	for _, method := range []string{"DELETE", "PATCH", ""} {
+		if _, err := sendRequest(Request{Method: method, PathWithQuery: "/data"}); err == nil || !strings.Contains(err.Error(), "unsupported HTTP method") {
+			t.Errorf("sendRequest(%q) error = %v, want it rejected", method, err)
+		}
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none", len(fake.sent))
+	}
+
+	// Methods are matched regardless of case
+	fake.respond("/data", fakeResponse{status: 200})
+	if _, err := roundTrip(Request{Method: "head", PathWithQuery: "/data"}); err != nil {
+		t.Errorf("roundTrip(head) error = %v", err)
+	}
+}
+
+func TestSendRequestLowercasePost(t *testing.T) {
+	setEnv(t)
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{status: 200, body: "ok"})
+	useTransport(t, fake)
+
+	// A lowercase method still gets the POST handling, not just the POST verb
+	body := []byte(`{"query":"London"}`)
+	if _, err := roundTrip(Request{Method: "post", PathWithQuery: "/data", Body: body}); err != nil {
+		t.Fatalf("roundTrip(post) error = %v", err)
+	}
+	sent := fake.sent[0]
+	if sent.Method != "POST" || sent.Headers["Content-Length"] != strconv.Itoa(len(body)) {
+		t.Errorf("sent %s with Content-Length %q, want POST with %d", sent.Method, sent.Headers["Content-Length"], len(body))
+	}
+}
+
+func TestWithNoContent(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond("/data",
+		fakeResponse{status: 204},
+		fakeResponse{status: 200, body: `{"ok":true}`},
+		fakeResponse{status: 200},
+	)
+	useTransport(t, fake)
+
+	send := chain(roundTrip, withNoContent)
+	for _, tt := range []struct {
+		method string
+		want   string
+	}{
+		{"GET", NO_CONTENT_BODY},
+		{"GET", `{"ok":true}`},
+		{"HEAD", ""},
+	} {
+		resp, err := send(Request{Method: tt.method, PathWithQuery: "/data"})
+		if err != nil || string(resp.Body) != tt.want {
+			t.Errorf("%s: %v, %v, want the body %q", tt.method, resp, err, tt.want)
+		}
+	}
+}
+
+func TestWithRequestURLs(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{status: 502})
+	useTransport(t, fake)
+
+	_, err := chain(roundTrip, withRequestURLs)(Request{Method: "get", PathWithQuery: "/data?q=London&appid=secret"})
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("error = %v, want a RequestError", err)
+	}
+	if reqErr.Method != "GET" || !strings.HasPrefix(reqErr.URL, "https://") || !strings.HasSuffix(reqErr.URL, "/data?q=London&appid=REDACTED") {
+		t.Errorf("request = %s %s, want the redacted URL", reqErr.Method, reqErr.URL)
+	}
+	// The underlying failure is still reachable, and the secret isn't shown
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Status != 502 || strings.Contains(err.Error(), "secret") {
+		t.Errorf("error = %v, want the 502 without the key", err)
+	}
+}
+
+func TestWithRequestURLsPassesThrough(t *testing.T) {
+	ok := func(Request) (*Response, error) { return &Response{Status: 200}, nil }
+	if _, err := chain(ok, withRequestURLs)(Request{Method: "GET", PathWithQuery: "/data"}); err != nil {
+		t.Errorf("error = %v, want nil", err)
+	}
+	// A dry run is not a failure, so it isn't annotated
+	dryRun := &DryRunError{}
+	stub := func(Request) (*Response, error) { return nil, dryRun }
+	if _, err := chain(stub, withRequestURLs)(Request{Method: "GET", PathWithQuery: "/data"}); err != dryRun {
+		t.Errorf("error = %v, want the dry run unchanged", err)
+	}
+}
+
+func TestStartRequest(t *testing.T) {
+	t.Cleanup(func() { requestID = "" })
+
+	setEnv(t, "REQUEST_ID", "trace-42")
+	if got := startRequest(); got != "trace-42" || requestID != "trace-42" {
+		t.Errorf("startRequest() = %q, want the host's REQUEST_ID", got)
+	}
+
+	setEnv(t)
+	first, second := startRequest(), startRequest()
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if !uuid.MatchString(first) || first == second {
+		t.Errorf("startRequest() = %q then %q, want distinct version 4 UUIDs", first, second)
+	}
+}
+
+func TestRequestIDSentAndReported(t *testing.T) {
+	t.Cleanup(func() { requestID = "" })
+	setEnv(t, "REQUEST_ID", "trace-42")
+	startRequest()
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{status: 500, body: `{"message":"boom"}`})
+	useTransport(t, fake)
+
+	_, err := roundTrip(Request{Method: "GET", PathWithQuery: "/data"})
+	if got := fake.sent[0].Headers[REQUEST_ID_HEADER]; got != "trace-42" {
+		t.Errorf("%s header = %q, want trace-42", REQUEST_ID_HEADER, got)
+	}
+
+	var resp ErrorResponse
+	if jsonErr := json.Unmarshal([]byte(errorJSON("Failed", err)), &resp); jsonErr != nil {
+		t.Fatal(jsonErr)
+	}
+	if resp.RequestID != "trace-42" {
+		t.Errorf("request_id = %q, want trace-42", resp.RequestID)
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	tests := map[string]int{"": DEFAULT_MAX_ATTEMPTS, "5": 5, " 1 ": 1, "0": DEFAULT_MAX_ATTEMPTS, "many": DEFAULT_MAX_ATTEMPTS, "99": MAX_ATTEMPTS_LIMIT}
+	for value, want := range tests {
+		setEnv(t, "HTTP_MAX_ATTEMPTS", value)
+		if got := maxAttempts(); got != want {
+			t.Errorf("maxAttempts() with %q = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestStatusClasses(t *testing.T) {
+	tests := []struct {
+		status                                  int
+		success, redirect, clientErr, serverErr bool
+	}{
+		{199, false, false, false, false},
+		{200, true, false, false, false},
+		{204, true, false, false, false},
+		{299, true, false, false, false},
+		{301, false, true, false, false},
+		{404, false, false, true, false},
+		{429, false, false, true, false},
+		{500, false, false, false, true},
+		{599, false, false, false, true},
+		{600, false, false, false, false},
+	}
+	for _, tt := range tests {
+		if IsSuccess(tt.status) != tt.success || IsRedirect(tt.status) != tt.redirect ||
+			IsClientError(tt.status) != tt.clientErr || IsServerError(tt.status) != tt.serverErr {
+			t.Errorf("status %d: success, redirect, client, server = %v, %v, %v, %v",
+				tt.status, IsSuccess(tt.status), IsRedirect(tt.status), IsClientError(tt.status), IsServerError(tt.status))
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&HTTPError{Status: 429}, true},
+		{&HTTPError{Status: 500}, true},
+		{&HTTPError{Status: 503}, true},
+		{&RequestError{Method: "GET", URL: "https://example.com", Err: &HTTPError{Status: 502}}, true},
+		{&HTTPError{Status: 400}, false},
+		{&HTTPError{Status: 404}, false},
+		{errors.New("connection reset"), false},
+	}
+	for _, tt := range tests {
+		if got := isRetryable(tt.err); got != tt.want {
+			t.Errorf("isRetryable(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	// Jitter keeps each delay within [backoff/2, backoff]
+	for attempt, backoff := range map[int]time.Duration{1: 500 * time.Millisecond, 2: time.Second, 5: RETRY_MAX_DELAY, 9: RETRY_MAX_DELAY} {
+		for range 20 {
+			delay, ok := retryDelay(attempt, &HTTPError{Status: 503})
+			if !ok || delay < backoff/2 || delay > backoff {
+				t.Fatalf("retryDelay(%d) = %v, %t, want within [%v, %v]", attempt, delay, ok, backoff/2, backoff)
+			}
+		}
+	}
+
+	if delay, ok := retryDelay(1, &HTTPError{Status: 429, RetryAfter: "3"}); !ok || delay != 3*time.Second {
+		t.Errorf("retryDelay() with Retry-After 3 = %v, %t, want 3s", delay, ok)
+	}
+	if _, ok := retryDelay(1, &HTTPError{Status: 429, RetryAfter: "60"}); ok {
+		t.Error("retryDelay() with Retry-After 60 = ok, want the wait left to the host")
+	}
+}
+
+func TestRetriesTransientFailures(t *testing.T) {
+	setEnv(t)
+	fake := &fakeTransport{}
+	fake.respond("/data",
+		fakeResponse{status: 503, body: "unavailable"},
+		fakeResponse{status: 429, body: "slow down"},
+		fakeResponse{status: 200, body: `{"ok":true}`},
+	)
+	useTransport(t, fake)
+
+	response, err := chain(roundTrip, withRetries)(Request{Method: "GET", PathWithQuery: "/data"})
+	if err != nil || string(response.Body) != `{"ok":true}` {
+		t.Fatalf("response = %v, %v, want the third attempt's body", response, err)
+	}
+	if len(fake.sent) != 3 || len(fake.slept) != 2 {
+		t.Errorf("sent %d and slept %d times, want 3 and 2", len(fake.sent), len(fake.slept))
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	setEnv(t, "HTTP_MAX_ATTEMPTS", "2")
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{status: 500}, fakeResponse{status: 500}, fakeResponse{status: 200})
+	fake.respond("/missing", fakeResponse{status: 404})
+	useTransport(t, fake)
+
+	var httpErr *HTTPError
+	if _, err := chain(roundTrip, withRetries)(Request{Method: "GET", PathWithQuery: "/data"}); !errors.As(err, &httpErr) || httpErr.Status != 500 {
+		t.Errorf("error = %v, want the last 500 after HTTP_MAX_ATTEMPTS", err)
+	}
+	if _, err := chain(roundTrip, withRetries)(Request{Method: "GET", PathWithQuery: "/missing"}); !errors.As(err, &httpErr) || httpErr.Status != 404 {
+		t.Errorf("error = %v, want the 404", err)
+	}
+	if len(fake.sent) != 3 {
+		t.Errorf("sent %d requests, want 2 tries of /data and 1 of /missing", len(fake.sent))
+	}
+}
+
+func TestRetryLogLine(t *testing.T) {
+	t.Cleanup(func() { requestID = "" })
+	requestID = "trace-42"
+
+	err := &HTTPError{Status: 503, Body: []byte("unavailable")}
+	line := retryLogLine(2, 3, 750*time.Millisecond, err)
+	want := fmt.Sprintf("--- retry request_id=trace-42 attempt=2 max_attempts=3 delay_ms=750 status=503 reason=%q", err.Error())
+	if line != want {
+		t.Errorf("retryLogLine() = %s\nwant %s", line, want)
+	}
+
+	// Failures without a status leave it out
+	line = retryLogLine(2, 3, time.Second, errors.New("connection reset"))
+	if strings.Contains(line, "status=") || !strings.HasSuffix(line, `delay_ms=1000 reason="connection reset"`) {
+		t.Errorf("retryLogLine() = %s, want no status", line)
+	}
+}
+
+func TestRetriesLogged(t *testing.T) {
+	setEnv(t, "HTTP_LOG", "true")
+	lines := captureLog(t)
+	fake := &fakeTransport{}
+	fake.respond("/data", fakeResponse{status: 429, body: "slow down"}, fakeResponse{status: 200, body: `{"ok":true}`})
+	useTransport(t, fake)
+
+	if _, err := chain(roundTrip, withRetries)(Request{Method: "GET", PathWithQuery: "/data"}); err != nil {
+		t.Fatal(err)
+	}
+	var retries []string
+	for _, line := range *lines {
+		if strings.HasPrefix(line, "--- retry ") {
+			retries = append(retries, line)
+		}
+	}
+	if len(retries) != 1 || !strings.Contains(retries[0], " attempt=2 ") || !strings.Contains(retries[0], " status=429 ") {
+		t.Errorf("retry lines = %q, want one for attempt 2 after the 429", retries)
+	}
+}
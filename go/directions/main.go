@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const GOOGLE_MAPS_HOST = "maps.googleapis.com"
+const DIRECTIONS_PATH = "/maps/api/directions/json"
+
+// Machine-readable codes returned in the "code" field of error responses
+const (
+	ERR_INVALID_API_KEY         = "INVALID_API_KEY"
+	ERR_INVALID_MODE            = "INVALID_MODE"
+	ERR_LOCATION_NOT_FOUND      = "LOCATION_NOT_FOUND"
+	ERR_NO_ROUTE                = "NO_ROUTE"
+	ERR_RATE_LIMITED            = "RATE_LIMITED"
+	ERR_INVALID_REQUEST         = "INVALID_REQUEST"
+	ERR_UPSTREAM_ERROR          = "UPSTREAM_ERROR"
+	ERR_MISSING_REQUIRED_PARAM  = "MISSING_REQUIRED_PARAM"
+	ERR_ENVIRONMENT_UNAVAILABLE = "ENVIRONMENT_UNAVAILABLE"
+)
+
+// SUPPORTED_MODES maps the plugin's travel modes to Google's mode names
+var SUPPORTED_MODES = map[string]string{
+	"driving": "driving",
+	"walking": "walking",
+	"transit": "transit",
+	"cycling": "bicycling",
+}
+
+// ErrorResponse is the JSON shape returned by exports when a call fails
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	Code      string `json:"code,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// PluginError is an error carrying a machine-readable code so hosts can
+// tell failure modes apart without parsing messages
+type PluginError struct {
+	Code    string
+	Message string
+}
+
+func (e *PluginError) Error() string {
+	return e.Message
+}
+
+type RouteResponse struct {
+	Origin          string `json:"origin"`
+	Destination     string `json:"destination"`
+	Mode            string `json:"mode"`
+	DistanceMeters  int    `json:"distance_meters"`
+	DistanceText    string `json:"distance_text"`
+	DurationSeconds int    `json:"duration_seconds"`
+	DurationText    string `json:"duration_text"`
+	Steps           []Step `json:"steps"`
+}
+
+type Step struct {
+	Instruction     string `json:"instruction"`
+	DistanceMeters  int    `json:"distance_meters"`
+	DurationSeconds int    `json:"duration_seconds"`
+	TravelMode      string `json:"travel_mode"`
+	TransitLine     string `json:"transit_line,omitempty"`
+}
+
+type GoogleTextValue struct {
+	Text  string `json:"text"`
+	Value int    `json:"value"`
+}
+
+type GoogleDirectionsResponse struct {
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message"`
+	Routes       []struct {
+		Legs []struct {
+			StartAddress string          `json:"start_address"`
+			EndAddress   string          `json:"end_address"`
+			Distance     GoogleTextValue `json:"distance"`
+			Duration     GoogleTextValue `json:"duration"`
+			Steps        []struct {
+				HTMLInstructions string          `json:"html_instructions"`
+				Distance         GoogleTextValue `json:"distance"`
+				Duration         GoogleTextValue `json:"duration"`
+				TravelMode       string          `json:"travel_mode"`
+				TransitDetails   *struct {
+					Line struct {
+						Name      string `json:"name"`
+						ShortName string `json:"short_name"`
+					} `json:"line"`
+				} `json:"transit_details"`
+			} `json:"steps"`
+		} `json:"legs"`
+	} `json:"routes"`
+}
+
+func getEnvVar(name string) string {
+	envVars := environ()
+	for _, env := range envVars {
+		if env[0] == name {
+			return env[1]
+		}
+	}
+	return ""
+}
+
+// REQUIRED_ENV lists the variables the plugin can't run without; keep it in
+// step with the API key check in init
+var REQUIRED_ENV = []string{"GOOGLE_MAPS_API_KEY"}
+
+// environmentAvailable reports whether the host passed the plugin any
+// environment at all. A host that denies environment access hands over an
+// empty list, which would otherwise look like every variable being unset.
+func environmentAvailable() bool {
+	return len(environ()) > 0
+}
+
+// missingAPIKey explains an empty GOOGLE_MAPS_API_KEY: either the host
+// withheld the environment entirely or the key is simply not configured
+func missingAPIKey() (string, error) {
+	if !environmentAvailable() {
+		return "Environment unavailable", &PluginError{
+			Code:    ERR_ENVIRONMENT_UNAVAILABLE,
+			Message: "the host provided no environment variables; check that it grants this plugin environment access",
+		}
+	}
+	return "GOOGLE_MAPS_API_KEY environment variable not set", nil
+}
+
+// stripTags turns Google's HTML step instructions into plain text
+func stripTags(html string) string {
+	var text strings.Builder
+	inTag := false
+	for _, r := range html {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag = false
+			text.WriteRune(' ')
+		case !inTag:
+			text.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+// classifyDirectionsStatus maps Google's in-body status codes to structured
+// errors; Google answers most failures with HTTP 200
+func classifyDirectionsStatus(status string, message string) error {
+	if message == "" {
+		message = status
+	}
+
+	switch status {
+	case "OK":
+		return nil
+	case "REQUEST_DENIED":
+		return &PluginError{Code: ERR_INVALID_API_KEY, Message: fmt.Sprintf("Google rejected GOOGLE_MAPS_API_KEY (%s)", message)}
+	case "NOT_FOUND":
+		return &PluginError{Code: ERR_LOCATION_NOT_FOUND, Message: "origin or destination could not be geocoded"}
+	case "ZERO_RESULTS":
+		return &PluginError{Code: ERR_NO_ROUTE, Message: "no route found between origin and destination for this mode"}
+	case "OVER_QUERY_LIMIT", "OVER_DAILY_LIMIT":
+		return &PluginError{Code: ERR_RATE_LIMITED, Message: message}
+	case "INVALID_REQUEST", "MAX_WAYPOINTS_EXCEEDED", "MAX_ROUTE_LENGTH_EXCEEDED":
+		return &PluginError{Code: ERR_INVALID_REQUEST, Message: message}
+	default:
+		return &PluginError{Code: ERR_UPSTREAM_ERROR, Message: message}
+	}
+}
+
+func getRoute(apiKey string, origin string, destination string, mode string) (*RouteResponse, error) {
+	startRequest()
+
+	// Build the path with query
+	var query QueryBuilder
+	query.Set("origin", origin)
+	query.Set("destination", destination)
+	query.Set("mode", SUPPORTED_MODES[mode])
+	query.Set("key", apiKey)
+
+	// Make the HTTP request
+	body, err := makeHTTPRequest(query.Path(DIRECTIONS_PATH))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRoute(body, mode)
+}
+
+// parseRoute turns a Google Directions response body into the plugin's
+// route summary
+func parseRoute(body []byte, mode string) (*RouteResponse, error) {
+	var directions GoogleDirectionsResponse
+	if err := json.Unmarshal(body, &directions); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
+	}
+
+	if err := classifyDirectionsStatus(directions.Status, directions.ErrorMessage); err != nil {
+		return nil, err
+	}
+	if len(directions.Routes) == 0 || len(directions.Routes[0].Legs) == 0 {
+		return nil, &PluginError{Code: ERR_NO_ROUTE, Message: "no route found between origin and destination for this mode"}
+	}
+
+	// Without waypoints the first route has exactly one leg
+	leg := directions.Routes[0].Legs[0]
+	routeResponse := &RouteResponse{
+		Origin:          leg.StartAddress,
+		Destination:     leg.EndAddress,
+		Mode:            mode,
+		DistanceMeters:  leg.Distance.Value,
+		DistanceText:    leg.Distance.Text,
+		DurationSeconds: leg.Duration.Value,
+		DurationText:    leg.Duration.Text,
+		Steps:           make([]Step, 0, len(leg.Steps)),
+	}
+
+	for _, s := range leg.Steps {
+		step := Step{
+			Instruction:     stripTags(s.HTMLInstructions),
+			DistanceMeters:  s.Distance.Value,
+			DurationSeconds: s.Duration.Value,
+			TravelMode:      strings.ToLower(s.TravelMode),
+		}
+		if s.TransitDetails != nil {
+			step.TransitLine = s.TransitDetails.Line.ShortName
+			if step.TransitLine == "" {
+				step.TransitLine = s.TransitDetails.Line.Name
+			}
+		}
+		routeResponse.Steps = append(routeResponse.Steps, step)
+	}
+
+	return routeResponse, nil
+}
+
+// errorJSON renders a JSON error response; structured errors also carry
+// their machine-readable code
+func errorJSON(message string, err error) string {
+	// A dry run surfaces as an error from the HTTP layer, but it is the
+	// expected result rather than a failure
+	var dryRun *DryRunError
+	if errors.As(err, &dryRun) {
+		result, _ := json.Marshal(dryRun.Request)
+		return string(result)
+	}
+
+	resp := ErrorResponse{Error: message, RequestID: requestID}
+	if err != nil {
+		resp.Error = fmt.Sprintf("%s: %v", message, err)
+		var pluginErr *PluginError
+		if errors.As(err, &pluginErr) {
+			resp.Code = pluginErr.Code
+		}
+	}
+	result, _ := json.Marshal(resp)
+	return string(result)
+}
+
+// Required for WASM
+func main() {}
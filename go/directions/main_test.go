@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// setEnv replaces the environment for the rest of the test with the given
+// name/value pairs
+func setEnv(t *testing.T, pairs ...string) {
+	t.Helper()
+	previous := testEnviron
+	testEnviron = nil
+	for i := 0; i+1 < len(pairs); i += 2 {
+		testEnviron = append(testEnviron, [2]string{pairs[i], pairs[i+1]})
+	}
+	t.Cleanup(func() { testEnviron = previous })
+}
+
+// A transit route from the Directions API, trimmed to the fields the plugin
+// reads
+const CAPTURED_TRANSIT_ROUTE = `{
+  "geocoded_waypoints": [{"geocoder_status": "OK"}, {"geocoder_status": "OK"}],
+  "routes": [{
+    "summary": "",
+    "legs": [{
+      "start_address": "Alexanderplatz, 10178 Berlin, Germany",
+      "end_address": "Potsdamer Platz, 10785 Berlin, Germany",
+      "distance": {"text": "4.6 km", "value": 4621},
+      "duration": {"text": "17 mins", "value": 1020},
+      "steps": [
+        {
+          "html_instructions": "Walk to <b>S+U Alexanderplatz</b>",
+          "distance": {"text": "0.2 km", "value": 190},
+          "duration": {"text": "3 mins", "value": 180},
+          "travel_mode": "WALKING"
+        },
+        {
+          "html_instructions": "Subway towards Ruhleben",
+          "distance": {"text": "4.2 km", "value": 4211},
+          "duration": {"text": "11 mins", "value": 660},
+          "travel_mode": "TRANSIT",
+          "transit_details": {"line": {"name": "U-Bahn Linie 2", "short_name": "U2"}}
+        },
+        {
+          "html_instructions": "Bus towards <b>Zoo</b><div style=\"font-size:0.9em\">Stop on request</div>",
+          "distance": {"text": "0.1 km", "value": 120},
+          "duration": {"text": "2 mins", "value": 120},
+          "travel_mode": "TRANSIT",
+          "transit_details": {"line": {"name": "Zoo Shuttle"}}
+        },
+        {
+          "html_instructions": "Walk to Potsdamer Platz",
+          "distance": {"text": "0.1 km", "value": 100},
+          "duration": {"text": "1 min", "value": 60},
+          "travel_mode": "WALKING"
+        }
+      ]
+    }]
+  }],
+  "status": "OK"
+}`
+
+func TestParseRoute(t *testing.T) {
+	route, err := parseRoute([]byte(CAPTURED_TRANSIT_ROUTE), "transit")
+	if err != nil {
+		t.Fatalf("parseRoute() error = %v", err)
+	}
+
+	if route.Origin != "Alexanderplatz, 10178 Berlin, Germany" || route.Destination != "Potsdamer Platz, 10785 Berlin, Germany" {
+		t.Errorf("origin, destination = %q, %q", route.Origin, route.Destination)
+	}
+	if route.Mode != "transit" {
+		t.Errorf("Mode = %q, want transit", route.Mode)
+	}
+	if route.DistanceMeters != 4621 || route.DistanceText != "4.6 km" {
+		t.Errorf("distance = %d %q, want 4621 \"4.6 km\"", route.DistanceMeters, route.DistanceText)
+	}
+	if route.DurationSeconds != 1020 || route.DurationText != "17 mins" {
+		t.Errorf("duration = %d %q, want 1020 \"17 mins\"", route.DurationSeconds, route.DurationText)
+	}
+
+	want := []Step{
+		{Instruction: "Walk to S+U Alexanderplatz", DistanceMeters: 190, DurationSeconds: 180, TravelMode: "walking"},
+		{Instruction: "Subway towards Ruhleben", DistanceMeters: 4211, DurationSeconds: 660, TravelMode: "transit", TransitLine: "U2"},
+		{Instruction: "Bus towards Zoo Stop on request", DistanceMeters: 120, DurationSeconds: 120, TravelMode: "transit", TransitLine: "Zoo Shuttle"},
+		{Instruction: "Walk to Potsdamer Platz", DistanceMeters: 100, DurationSeconds: 60, TravelMode: "walking"},
+	}
+	if len(route.Steps) != len(want) {
+		t.Fatalf("got %d steps, want %d", len(route.Steps), len(want))
+	}
+	for i := range want {
+		if route.Steps[i] != want[i] {
+			t.Errorf("steps[%d] = %+v, want %+v", i, route.Steps[i], want[i])
+		}
+	}
+}
+
+func TestParseRouteStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"denied", `{"status":"REQUEST_DENIED","error_message":"The provided API key is invalid.","routes":[]}`, ERR_INVALID_API_KEY},
+		{"not found", `{"status":"NOT_FOUND","routes":[]}`, ERR_LOCATION_NOT_FOUND},
+		{"zero results", `{"status":"ZERO_RESULTS","routes":[]}`, ERR_NO_ROUTE},
+		{"ok without routes", `{"status":"OK","routes":[]}`, ERR_NO_ROUTE},
+		{"over limit", `{"status":"OVER_QUERY_LIMIT","routes":[]}`, ERR_RATE_LIMITED},
+		{"unknown", `{"status":"UNKNOWN_ERROR","routes":[]}`, ERR_UPSTREAM_ERROR},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRoute([]byte(tt.body), "driving")
+			var pluginErr *PluginError
+			if !errors.As(err, &pluginErr) || pluginErr.Code != tt.want {
+				t.Errorf("parseRoute() error = %v, want code %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRouteInvalidJSON(t *testing.T) {
+	if _, err := parseRoute([]byte("<html>"), "driving"); err == nil {
+		t.Error("parseRoute() accepted a non-JSON body")
+	}
+}
+
+func TestStripTags(t *testing.T) {
+	tests := map[string]string{
+		"Head <b>north</b> on <b>Main St</b>":          "Head north on Main St",
+		"Turn left<div>Destination on the right</div>": "Turn left Destination on the right",
+		"  plain   text ":                              "plain text",
+		"":                                             "",
+	}
+	for in, want := range tests {
+		if got := stripTags(in); got != want {
+			t.Errorf("stripTags(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestGetRouteQuery(t *testing.T) {
+	setEnv(t)
+	fake := &fakeTransport{}
+	fake.respond(DIRECTIONS_PATH, fakeResponse{status: 200, body: CAPTURED_TRANSIT_ROUTE})
+	useTransport(t, fake)
+
+	// A key with query metacharacters must not leak into other parameters
+	if _, err := getRoute("k&mode=walking", "Alexanderplatz", "Potsdamer Platz, Berlin", "transit"); err != nil {
+		t.Fatalf("getRoute() error = %v", err)
+	}
+	_, rawQuery, _ := strings.Cut(fake.sent[0].PathWithQuery, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("key") != "k&mode=walking" || len(query["mode"]) != 1 || query.Get("mode") != "transit" {
+		t.Errorf("query = %v, want the key escaped and one transit mode", query)
+	}
+	if query.Get("destination") != "Potsdamer Platz, Berlin" {
+		t.Errorf("destination = %q, want Potsdamer Platz, Berlin", query.Get("destination"))
+	}
+}
+
+func TestGetRouteTimesOut(t *testing.T) {
+	setEnv(t, "HTTP_TIMEOUT_SECONDS", "5")
+	fake := &fakeTransport{}
+	fake.respond(DIRECTIONS_PATH, fakeResponse{readyAt: NEVER})
+	useTransport(t, fake)
+
+	_, err := getRoute("key", "Alexanderplatz", "Potsdamer Platz", "transit")
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_RESPONSE_TIMEOUT {
+		t.Errorf("error = %v, want %s", err, ERR_RESPONSE_TIMEOUT)
+	}
+}
+
+func TestGetRouteRetriesServerErrors(t *testing.T) {
+	setEnv(t)
+	fake := &fakeTransport{}
+	fake.respond(DIRECTIONS_PATH, fakeResponse{status: 503}, fakeResponse{status: 200, body: CAPTURED_TRANSIT_ROUTE})
+	useTransport(t, fake)
+
+	route, err := getRoute("key", "Alexanderplatz", "Potsdamer Platz", "transit")
+	if err != nil || route.DistanceMeters != 4621 {
+		t.Fatalf("getRoute() = %+v, %v, want the route after one retry", route, err)
+	}
+	if len(fake.sent) != 2 {
+		t.Errorf("sent %d requests, want 2", len(fake.sent))
+	}
+}
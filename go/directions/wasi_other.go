@@ -0,0 +1,16 @@
+//go:build !tinygo
+
+package main
+
+// Outside TinyGo there is no WASI host, so host builds (go test) get
+// stand-ins for what it would provide
+
+// testEnviron is the environment environ reports in host builds
+var testEnviron [][2]string
+
+func environ() [][2]string {
+	return testEnviron
+}
+
+// transport is nil in host builds until a test installs a fake
+var transport Transport
@@ -0,0 +1,47 @@
+//go:build tinygo
+
+package main
+
+import (
+	"encoding/json"
+
+	placescomponent "github.com/my_org/places/gen/example/places/places-component"
+)
+
+// The exports are only registered in the TinyGo build. They reach every WASI
+// import the plugin uses, so leaving them out lets go test build the package
+// on the host and run the parsing against captured responses.
+func init() {
+	placescomponent.Exports.Nearby = func(lat float64, lon float64, category string) string {
+		apiKey := getEnvVar("GOOGLE_MAPS_API_KEY")
+		if apiKey == "" {
+			return errorJSON(missingAPIKey())
+		}
+
+		if err := validateCoordinates(lat, lon); err != nil {
+			return errorJSON("Invalid nearby request", err)
+		}
+
+		category, err := normalizeCategory(category)
+		if err != nil {
+			return errorJSON("Invalid nearby request", err)
+		}
+
+		places, err := getNearby(apiKey, lat, lon, category)
+		if err != nil {
+			return errorJSON("Failed to fetch nearby places", err)
+		}
+
+		// Return result as JSON
+		result, err := json.Marshal(places)
+		if err != nil {
+			return errorJSON("Failed to serialize response", err)
+		}
+
+		return string(result)
+	}
+	placescomponent.Exports.RequiredEnv = func() string {
+		result, _ := json.Marshal(REQUIRED_ENV)
+		return string(result)
+	}
+}
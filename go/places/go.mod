@@ -0,0 +1,10 @@
+module github.com/my_org/places
+
+go 1.23.0
+
+require (
+	github.com/andybalholm/brotli v1.1.1
+	go.bytecodealliance.org/cm v0.3.0
+)
+
+replace github.com/my_org/places => ./
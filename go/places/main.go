@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const GOOGLE_MAPS_HOST = "maps.googleapis.com"
+const NEARBY_SEARCH_PATH = "/maps/api/place/nearbysearch/json"
+
+// EARTH_RADIUS_METERS is the mean Earth radius used for distances
+const EARTH_RADIUS_METERS = 6371000.0
+
+// Machine-readable codes returned in the "code" field of error responses
+const (
+	ERR_INVALID_API_KEY         = "INVALID_API_KEY"
+	ERR_INVALID_CATEGORY        = "INVALID_CATEGORY"
+	ERR_INVALID_COORDINATES     = "INVALID_COORDINATES"
+	ERR_RATE_LIMITED            = "RATE_LIMITED"
+	ERR_INVALID_REQUEST         = "INVALID_REQUEST"
+	ERR_UPSTREAM_ERROR          = "UPSTREAM_ERROR"
+	ERR_ENVIRONMENT_UNAVAILABLE = "ENVIRONMENT_UNAVAILABLE"
+)
+
+// SUPPORTED_CATEGORIES maps the plugin's categories to Google place types
+var SUPPORTED_CATEGORIES = map[string]string{
+	"restaurant":  "restaurant",
+	"cafe":        "cafe",
+	"bar":         "bar",
+	"bakery":      "bakery",
+	"takeaway":    "meal_takeaway",
+	"supermarket": "supermarket",
+	"pharmacy":    "pharmacy",
+	"hotel":       "lodging",
+	"museum":      "museum",
+	"park":        "park",
+}
+
+// ErrorResponse is the JSON shape returned by exports when a call fails
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	Code      string `json:"code,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// PluginError is an error carrying a machine-readable code so hosts can
+// tell failure modes apart without parsing messages
+type PluginError struct {
+	Code    string
+	Message string
+}
+
+func (e *PluginError) Error() string {
+	return e.Message
+}
+
+type NearbyResponse struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Category  string  `json:"category"`
+	Count     int     `json:"count"`
+	Places    []Place `json:"places"`
+}
+
+type Place struct {
+	Name           string   `json:"name"`
+	Address        string   `json:"address,omitempty"`
+	Latitude       float64  `json:"latitude"`
+	Longitude      float64  `json:"longitude"`
+	DistanceMeters int      `json:"distance_meters"`
+	Rating         *float64 `json:"rating,omitempty"`
+	RatingCount    int      `json:"rating_count,omitempty"`
+	OpenNow        *bool    `json:"open_now,omitempty"`
+}
+
+type GooglePlacesResponse struct {
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message"`
+	Results      []struct {
+		Name     string `json:"name"`
+		Vicinity string `json:"vicinity"`
+		Geometry struct {
+			Location struct {
+				Lat float64 `json:"lat"`
+				Lng float64 `json:"lng"`
+			} `json:"location"`
+		} `json:"geometry"`
+		Rating           *float64 `json:"rating"`
+		UserRatingsTotal int      `json:"user_ratings_total"`
+		OpeningHours     *struct {
+			OpenNow *bool `json:"open_now"`
+		} `json:"opening_hours"`
+	} `json:"results"`
+}
+
+func getEnvVar(name string) string {
+	envVars := environ()
+	for _, env := range envVars {
+		if env[0] == name {
+			return env[1]
+		}
+	}
+	return ""
+}
+
+// REQUIRED_ENV lists the variables the plugin can't run without; keep it in
+// step with the API key check in init
+var REQUIRED_ENV = []string{"GOOGLE_MAPS_API_KEY"}
+
+// environmentAvailable reports whether the host passed the plugin any
+// environment at all. A host that denies environment access hands over an
+// empty list, which would otherwise look like every variable being unset.
+func environmentAvailable() bool {
+	return len(environ()) > 0
+}
+
+// missingAPIKey explains an empty GOOGLE_MAPS_API_KEY: either the host
+// withheld the environment entirely or the key is simply not configured
+func missingAPIKey() (string, error) {
+	if !environmentAvailable() {
+		return "Environment unavailable", &PluginError{
+			Code:    ERR_ENVIRONMENT_UNAVAILABLE,
+			Message: "the host provided no environment variables; check that it grants this plugin environment access",
+		}
+	}
+	return "GOOGLE_MAPS_API_KEY environment variable not set", nil
+}
+
+// validateCoordinates rejects a search center outside the valid ranges
+func validateCoordinates(lat float64, lon float64) error {
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return &PluginError{
+			Code:    ERR_INVALID_COORDINATES,
+			Message: fmt.Sprintf("lat must be between -90 and 90 and lon between -180 and 180, got %v,%v", lat, lon),
+		}
+	}
+	return nil
+}
+
+// normalizeCategory trims and lower-cases a category, rejecting one that
+// isn't in SUPPORTED_CATEGORIES. Like directions modes, an unknown category
+// is rejected rather than widened to every kind of place.
+func normalizeCategory(category string) (string, error) {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if _, ok := SUPPORTED_CATEGORIES[category]; !ok {
+		return "", &PluginError{
+			Code:    ERR_INVALID_CATEGORY,
+			Message: fmt.Sprintf("unsupported category %q: use restaurant, cafe, bar, bakery, takeaway, supermarket, pharmacy, hotel, museum, or park", category),
+		}
+	}
+	return category, nil
+}
+
+// distanceMeters is the great-circle distance between two points
+func distanceMeters(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EARTH_RADIUS_METERS * math.Asin(math.Sqrt(a))
+}
+
+// classifyPlacesStatus maps Google's in-body status codes to structured
+// errors; like the Directions API, most failures arrive with HTTP 200
+func classifyPlacesStatus(status string, message string) error {
+	if message == "" {
+		message = status
+	}
+
+	switch status {
+	case "OK", "ZERO_RESULTS":
+		return nil
+	case "REQUEST_DENIED":
+		return &PluginError{Code: ERR_INVALID_API_KEY, Message: fmt.Sprintf("Google rejected GOOGLE_MAPS_API_KEY (%s)", message)}
+	case "OVER_QUERY_LIMIT":
+		return &PluginError{Code: ERR_RATE_LIMITED, Message: message}
+	case "INVALID_REQUEST":
+		return &PluginError{Code: ERR_INVALID_REQUEST, Message: message}
+	default:
+		return &PluginError{Code: ERR_UPSTREAM_ERROR, Message: message}
+	}
+}
+
+// normalizePlaces shapes a Nearby Search response, measuring each place's
+// distance from the search center
+func normalizePlaces(body []byte, lat float64, lon float64, category string) (*NearbyResponse, error) {
+	var places GooglePlacesResponse
+	if err := json.Unmarshal(body, &places); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
+	}
+
+	if err := classifyPlacesStatus(places.Status, places.ErrorMessage); err != nil {
+		return nil, err
+	}
+
+	nearbyResponse := &NearbyResponse{
+		Latitude:  lat,
+		Longitude: lon,
+		Category:  category,
+		Places:    make([]Place, 0, len(places.Results)),
+	}
+
+	for _, r := range places.Results {
+		place := Place{
+			Name:           r.Name,
+			Address:        r.Vicinity,
+			Latitude:       r.Geometry.Location.Lat,
+			Longitude:      r.Geometry.Location.Lng,
+			DistanceMeters: int(math.Round(distanceMeters(lat, lon, r.Geometry.Location.Lat, r.Geometry.Location.Lng))),
+			Rating:         r.Rating,
+			RatingCount:    r.UserRatingsTotal,
+		}
+		if r.OpeningHours != nil {
+			place.OpenNow = r.OpeningHours.OpenNow
+		}
+		nearbyResponse.Places = append(nearbyResponse.Places, place)
+	}
+
+	// Google ranks by distance already, but only approximately
+	sort.SliceStable(nearbyResponse.Places, func(i, j int) bool {
+		return nearbyResponse.Places[i].DistanceMeters < nearbyResponse.Places[j].DistanceMeters
+	})
+	nearbyResponse.Count = len(nearbyResponse.Places)
+
+	return nearbyResponse, nil
+}
+
+func getNearby(apiKey string, lat float64, lon float64, category string) (*NearbyResponse, error) {
+	startRequest()
+
+	// Build the path with query; rankby=distance returns the closest places
+	// first and requires a type instead of a radius
+	var query QueryBuilder
+	query.Set("location", strconv.FormatFloat(lat, 'f', -1, 64)+","+strconv.FormatFloat(lon, 'f', -1, 64))
+	query.Set("rankby", "distance")
+	query.Set("type", SUPPORTED_CATEGORIES[category])
+	query.Set("key", apiKey)
+
+	// Make the HTTP request
+	body, err := makeHTTPRequest(query.Path(NEARBY_SEARCH_PATH))
+	if err != nil {
+		return nil, err
+	}
+
+	return normalizePlaces(body, lat, lon, category)
+}
+
+// errorJSON renders a JSON error response; structured errors also carry
+// their machine-readable code
+func errorJSON(message string, err error) string {
+	// A dry run surfaces as an error from the HTTP layer, but it is the
+	// expected result rather than a failure
+	var dryRun *DryRunError
+	if errors.As(err, &dryRun) {
+		result, _ := json.Marshal(dryRun.Request)
+		return string(result)
+	}
+
+	resp := ErrorResponse{Error: message, RequestID: requestID}
+	if err != nil {
+		resp.Error = fmt.Sprintf("%s: %v", message, err)
+		var pluginErr *PluginError
+		if errors.As(err, &pluginErr) {
+			resp.Code = pluginErr.Code
+		}
+	}
+	result, _ := json.Marshal(resp)
+	return string(result)
+}
+
+// Required for WASM
+func main() {}
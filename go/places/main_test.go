@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// setEnv replaces the environment for the rest of the test with the given
+// name/value pairs
+func setEnv(t *testing.T, pairs ...string) {
+	t.Helper()
+	previous := testEnviron
+	testEnviron = nil
+	for i := 0; i+1 < len(pairs); i += 2 {
+		testEnviron = append(testEnviron, [2]string{pairs[i], pairs[i+1]})
+	}
+	t.Cleanup(func() { testEnviron = previous })
+}
+
+// A Nearby Search around Trafalgar Square (51.5074,-0.1278), trimmed to the
+// fields the plugin reads. Google's order is only roughly by distance: the
+// second result is nearer than the first.
+const CAPTURED_NEARBY = `{
+  "html_attributions": [],
+  "results": [
+    {
+      "name": "Café Concerto",
+      "vicinity": "1 Strand, London",
+      "geometry": {"location": {"lat": 51.508, "lng": -0.1278}},
+      "rating": 4.2,
+      "user_ratings_total": 318,
+      "opening_hours": {"open_now": true}
+    },
+    {
+      "name": "Kiosk",
+      "vicinity": "Trafalgar Square, London",
+      "geometry": {"location": {"lat": 51.5074, "lng": -0.127}}
+    },
+    {
+      "name": "Leicester Coffee",
+      "vicinity": "12 Leicester Square, London",
+      "geometry": {"location": {"lat": 51.5101, "lng": -0.134}},
+      "rating": 3.9,
+      "user_ratings_total": 57,
+      "opening_hours": {}
+    }
+  ],
+  "status": "OK"
+}`
+
+func TestNormalizePlaces(t *testing.T) {
+	nearby, err := normalizePlaces([]byte(CAPTURED_NEARBY), 51.5074, -0.1278, "cafe")
+	if err != nil {
+		t.Fatalf("normalizePlaces() error = %v", err)
+	}
+
+	if nearby.Category != "cafe" || nearby.Count != 3 || len(nearby.Places) != 3 {
+		t.Fatalf("nearby = %+v, want three cafes", nearby)
+	}
+
+	// Distances are rounded to the metre and the places re-sorted by them
+	wantDistances := map[string]int{"Kiosk": 55, "Café Concerto": 67, "Leicester Coffee": 524}
+	for i, name := range []string{"Kiosk", "Café Concerto", "Leicester Coffee"} {
+		place := nearby.Places[i]
+		if place.Name != name || place.DistanceMeters != wantDistances[name] {
+			t.Errorf("places[%d] = %s at %dm, want %s at %dm", i, place.Name, place.DistanceMeters, name, wantDistances[name])
+		}
+	}
+
+	kiosk, concerto, leicester := nearby.Places[0], nearby.Places[1], nearby.Places[2]
+	if concerto.Rating == nil || *concerto.Rating != 4.2 || concerto.RatingCount != 318 {
+		t.Errorf("Café Concerto rating = %v (%d), want 4.2 (318)", concerto.Rating, concerto.RatingCount)
+	}
+	if concerto.OpenNow == nil || !*concerto.OpenNow || concerto.Address != "1 Strand, London" {
+		t.Errorf("Café Concerto = %+v, want open at 1 Strand", concerto)
+	}
+	// Unrated places and unknown opening hours stay null rather than zero
+	if kiosk.Rating != nil || kiosk.RatingCount != 0 || kiosk.OpenNow != nil {
+		t.Errorf("Kiosk = %+v, want no rating or opening hours", kiosk)
+	}
+	if leicester.OpenNow != nil {
+		t.Errorf("Leicester Coffee open_now = %v, want null for empty opening_hours", *leicester.OpenNow)
+	}
+}
+
+func TestNormalizePlacesZeroResults(t *testing.T) {
+	nearby, err := normalizePlaces([]byte(`{"results":[],"status":"ZERO_RESULTS"}`), 0, 0, "museum")
+	if err != nil {
+		t.Fatalf("normalizePlaces() error = %v", err)
+	}
+	if nearby.Count != 0 || nearby.Places == nil {
+		t.Errorf("nearby = %+v, want an empty, non-null places list", nearby)
+	}
+}
+
+func TestNormalizePlacesStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		code   string
+	}{
+		{"REQUEST_DENIED", ERR_INVALID_API_KEY},
+		{"OVER_QUERY_LIMIT", ERR_RATE_LIMITED},
+		{"INVALID_REQUEST", ERR_INVALID_REQUEST},
+		{"UNKNOWN_ERROR", ERR_UPSTREAM_ERROR},
+	}
+	for _, tt := range tests {
+		body := `{"results":[],"status":"` + tt.status + `","error_message":"details"}`
+		_, err := normalizePlaces([]byte(body), 0, 0, "cafe")
+		var pluginErr *PluginError
+		if !errors.As(err, &pluginErr) || pluginErr.Code != tt.code {
+			t.Errorf("status %s: error = %v, want %s", tt.status, err, tt.code)
+		}
+	}
+}
+
+func TestNormalizeCategory(t *testing.T) {
+	category, err := normalizeCategory("  Hotel ")
+	if err != nil || category != "hotel" {
+		t.Errorf("normalizeCategory(\"  Hotel \") = %q, %v, want hotel", category, err)
+	}
+
+	for _, category := range []string{"", "lodging", "zoo"} {
+		_, err := normalizeCategory(category)
+		var pluginErr *PluginError
+		if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_CATEGORY {
+			t.Errorf("normalizeCategory(%q) error = %v, want %s", category, err, ERR_INVALID_CATEGORY)
+		}
+	}
+}
+
+func TestValidateCoordinates(t *testing.T) {
+	if err := validateCoordinates(51.5074, -0.1278); err != nil {
+		t.Errorf("validateCoordinates(London) error = %v", err)
+	}
+	for _, point := range [][2]float64{{91, 0}, {0, -181}} {
+		var pluginErr *PluginError
+		if err := validateCoordinates(point[0], point[1]); !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_COORDINATES {
+			t.Errorf("validateCoordinates(%v) error = %v, want %s", point, err, ERR_INVALID_COORDINATES)
+		}
+	}
+}
+
+func TestGetNearbyQuery(t *testing.T) {
+	setEnv(t)
+	fake := &fakeTransport{}
+	fake.respond(NEARBY_SEARCH_PATH, fakeResponse{status: 200, body: CAPTURED_NEARBY})
+	useTransport(t, fake)
+
+	// A key with query metacharacters must not leak into other parameters
+	if _, err := getNearby("k&type=bar", 51.5074, -0.1278, "cafe"); err != nil {
+		t.Fatalf("getNearby() error = %v", err)
+	}
+	_, rawQuery, _ := strings.Cut(fake.sent[0].PathWithQuery, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("key") != "k&type=bar" || len(query["type"]) != 1 || query.Get("type") != "cafe" {
+		t.Errorf("query = %v, want the key escaped and one cafe type", query)
+	}
+	if query.Get("location") != "51.5074,-0.1278" || query.Get("rankby") != "distance" {
+		t.Errorf("location, rankby = %q, %q, want 51.5074,-0.1278 by distance", query.Get("location"), query.Get("rankby"))
+	}
+}
+
+func TestGetNearbyTimesOut(t *testing.T) {
+	setEnv(t, "HTTP_TIMEOUT_SECONDS", "5")
+	fake := &fakeTransport{}
+	fake.respond(NEARBY_SEARCH_PATH, fakeResponse{readyAt: NEVER})
+	useTransport(t, fake)
+
+	_, err := getNearby("key", 51.5074, -0.1278, "cafe")
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_RESPONSE_TIMEOUT {
+		t.Errorf("error = %v, want %s", err, ERR_RESPONSE_TIMEOUT)
+	}
+}
+
+func TestGetNearbyRetriesServerErrors(t *testing.T) {
+	setEnv(t)
+	fake := &fakeTransport{}
+	fake.respond(NEARBY_SEARCH_PATH, fakeResponse{status: 503}, fakeResponse{status: 200, body: CAPTURED_NEARBY})
+	useTransport(t, fake)
+
+	nearby, err := getNearby("key", 51.5074, -0.1278, "cafe")
+	if err != nil || nearby.Count != 3 {
+		t.Fatalf("getNearby() = %+v, %v, want the places after one retry", nearby, err)
+	}
+	if len(fake.sent) != 2 {
+		t.Errorf("sent %d requests, want 2", len(fake.sent))
+	}
+}
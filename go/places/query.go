@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// QueryBuilder builds a URL query string from key/value pairs. Keys and
+// values are both escaped, and pairs keep the order they were first set in,
+// so the same parameters always produce the same string for logs, cache
+// keys, and redaction.
+type QueryBuilder struct {
+	params []queryParam
+}
+
+type queryParam struct {
+	key   string
+	value string
+}
+
+// Set adds key=value, or replaces the value in place when key is already
+// set, so a key is never sent twice
+func (q *QueryBuilder) Set(key string, value string) {
+	for i := range q.params {
+		if q.params[i].key == key {
+			q.params[i].value = value
+			return
+		}
+	}
+	q.params = append(q.params, queryParam{key: key, value: value})
+}
+
+// Encode renders the pairs as "a=1&b=2", without a leading "?"
+func (q *QueryBuilder) Encode() string {
+	pairs := make([]string, len(q.params))
+	for i, param := range q.params {
+		pairs[i] = url.QueryEscape(param.key) + "=" + url.QueryEscape(param.value)
+	}
+	return strings.Join(pairs, "&")
+}
+
+// Path appends the query to path, or returns path alone when nothing is set
+func (q *QueryBuilder) Path(path string) string {
+	if len(q.params) == 0 {
+		return path
+	}
+	return path + "?" + q.Encode()
+}
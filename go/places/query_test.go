@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestQueryBuilder(t *testing.T) {
+	var query QueryBuilder
+	query.Set("q", "São Paulo, BR")
+	query.Set("units", "metric")
+	query.Set("a&b", "1=2")
+	// Setting a key again replaces its value where it stands
+	query.Set("q", "New York")
+
+	want := "q=New+York&units=metric&a%26b=1%3D2"
+	if got := query.Encode(); got != want {
+		t.Errorf("Encode() = %q, want %q", got, want)
+	}
+	if got := query.Path("/data"); got != "/data?"+want {
+		t.Errorf("Path() = %q, want %q", got, "/data?"+want)
+	}
+}
+
+func TestQueryBuilderEmpty(t *testing.T) {
+	var query QueryBuilder
+	if got := query.Encode(); got != "" {
+		t.Errorf("Encode() = %q, want empty", got)
+	}
+	if got := query.Path("/data"); got != "/data" {
+		t.Errorf("Path() = %q, want the path alone", got)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.bytecodealliance.org/cm"
+)
+
+const AIR_POLLUTION_FORECAST_PATH = "/data/2.5/air_pollution/forecast"
+
+// AQI_LABELS names OpenWeather's air quality index levels, 1 (best) to 5
+var AQI_LABELS = map[int]string{
+	1: "good",
+	2: "fair",
+	3: "moderate",
+	4: "poor",
+	5: "very poor",
+}
+
+// OpenWeatherAirPollutionResponse is the air pollution forecast payload
+type OpenWeatherAirPollutionResponse struct {
+	Coord struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"coord"`
+	List []struct {
+		Dt   int64 `json:"dt"`
+		Main struct {
+			AQI int `json:"aqi"`
+		} `json:"main"`
+		Components AirComponents `json:"components"`
+	} `json:"list"`
+}
+
+// AirComponents are pollutant concentrations in μg/m³
+type AirComponents struct {
+	CO   float64 `json:"co"`
+	NO   float64 `json:"no"`
+	NO2  float64 `json:"no2"`
+	O3   float64 `json:"o3"`
+	SO2  float64 `json:"so2"`
+	PM25 float64 `json:"pm2_5"`
+	PM10 float64 `json:"pm10"`
+	NH3  float64 `json:"nh3"`
+}
+
+type AirQualityForecastResponse struct {
+	Lat    float64            `json:"lat"`
+	Lon    float64            `json:"lon"`
+	Hourly []HourlyAirQuality `json:"hourly"`
+}
+
+// HourlyAirQuality is the forecast air quality for one hour
+type HourlyAirQuality struct {
+	Time       int64         `json:"time"`
+	AQI        int           `json:"aqi"`
+	Quality    string        `json:"quality,omitempty"`
+	Components AirComponents `json:"components"`
+}
+
+// normalizeAirQualityForecast shapes an air pollution forecast. An empty
+// list, which OpenWeather returns where it has no forecast, is an empty
+// hourly array rather than an error.
+func normalizeAirQualityForecast(body []byte) (*AirQualityForecastResponse, error) {
+	var forecast OpenWeatherAirPollutionResponse
+	if err := json.Unmarshal(body, &forecast); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
+	}
+
+	response := &AirQualityForecastResponse{
+		Lat:    forecast.Coord.Lat,
+		Lon:    forecast.Coord.Lon,
+		Hourly: make([]HourlyAirQuality, 0, len(forecast.List)),
+	}
+	for _, hour := range forecast.List {
+		response.Hourly = append(response.Hourly, HourlyAirQuality{
+			Time:       hour.Dt,
+			AQI:        hour.Main.AQI,
+			Quality:    AQI_LABELS[hour.Main.AQI],
+			Components: hour.Components,
+		})
+	}
+	return response, nil
+}
+
+func getAirQualityForecast(apiKey string, lat float64, lon float64) (*AirQualityForecastResponse, error) {
+	var query QueryBuilder
+	query.Set("lat", formatCoordinate(lat))
+	query.Set("lon", formatCoordinate(lon))
+	query.Set("appid", apiKey)
+	pathWithQuery := query.Path(AIR_POLLUTION_FORECAST_PATH)
+
+	body, err := makeHTTPRequest(pathWithQuery)
+	if err != nil {
+		return nil, classifyOpenWeatherError(err)
+	}
+	return normalizeAirQualityForecast(body)
+}
+
+// forecastAirQuality returns the hourly air quality forecast for a point
+func forecastAirQuality(lat float64, lon float64, keyOverride cm.Option[string]) string {
+	startRequest()
+
+	apiKey := callAPIKey(keyOverride)
+	if apiKey == "" {
+		return errorJSON(missingAPIKey())
+	}
+
+	if err := validateCoordinates(lat, lon); err != nil {
+		return errorJSON("Invalid coordinates", err)
+	}
+
+	forecast, err := getAirQualityForecast(apiKey, lat, lon)
+	if err != nil {
+		return errorJSON("Failed to fetch air quality forecast", err)
+	}
+
+	result, err := marshalJSON(forecast)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+	return string(result)
+}
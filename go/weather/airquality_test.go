@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.bytecodealliance.org/cm"
+)
+
+// Two hours of an air pollution forecast for London
+const CAPTURED_AIR_POLLUTION_FORECAST = `{"coord":{"lon":-0.1257,"lat":51.5085},"list":[
+  {"main":{"aqi":2},"components":{"co":230.31,"no":0.2,"no2":14.74,"o3":58.65,"so2":1.82,"pm2_5":3.91,"pm10":5.27,"nh3":0.55},"dt":1700000000},
+  {"main":{"aqi":4},"components":{"co":267.03,"no":1.1,"no2":27.42,"o3":31.47,"so2":2.59,"pm2_5":29.62,"pm10":34.18,"nh3":1.03},"dt":1700003600}]}`
+
+func TestNormalizeAirQualityForecast(t *testing.T) {
+	forecast, err := normalizeAirQualityForecast([]byte(CAPTURED_AIR_POLLUTION_FORECAST))
+	if err != nil {
+		t.Fatalf("normalizeAirQualityForecast() error = %v", err)
+	}
+	if forecast.Lat != 51.5085 || forecast.Lon != -0.1257 || len(forecast.Hourly) != 2 {
+		t.Fatalf("forecast = %+v, want two hours for London", forecast)
+	}
+
+	first, second := forecast.Hourly[0], forecast.Hourly[1]
+	if first.Time != 1700000000 || first.AQI != 2 || first.Quality != "fair" || first.Components.PM25 != 3.91 {
+		t.Errorf("hourly[0] = %+v, want fair air with 3.91 PM2.5", first)
+	}
+	if second.AQI != 4 || second.Quality != "poor" || second.Components.NO2 != 27.42 {
+		t.Errorf("hourly[1] = %+v, want poor air with 27.42 NO2", second)
+	}
+}
+
+func TestNormalizeAirQualityForecastEmpty(t *testing.T) {
+	forecast, err := normalizeAirQualityForecast([]byte(`{"coord":{"lon":0,"lat":0},"list":[]}`))
+	if err != nil {
+		t.Fatalf("normalizeAirQualityForecast() error = %v", err)
+	}
+	if forecast.Hourly == nil || len(forecast.Hourly) != 0 {
+		t.Errorf("hourly = %v, want an empty, non-null list", forecast.Hourly)
+	}
+
+	// An index outside 1-5 keeps its number but gets no label
+	forecast, err = normalizeAirQualityForecast([]byte(`{"list":[{"main":{"aqi":0},"dt":1700000000}]}`))
+	if err != nil || forecast.Hourly[0].Quality != "" {
+		t.Errorf("forecast = %+v, %v, want no quality label", forecast, err)
+	}
+}
+
+func TestForecastAirQuality(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	fake.respond(AIR_POLLUTION_FORECAST_PATH, fakeResponse{status: 200, body: CAPTURED_AIR_POLLUTION_FORECAST})
+	useTransport(t, fake)
+
+	var forecast AirQualityForecastResponse
+	if err := json.Unmarshal([]byte(forecastAirQuality(51.5085, -0.1257, cm.None[string]())), &forecast); err != nil {
+		t.Fatal(err)
+	}
+	if len(forecast.Hourly) != 2 {
+		t.Errorf("forecast = %+v, want two hours", forecast)
+	}
+	if want := AIR_POLLUTION_FORECAST_PATH + "?lat=51.5085&lon=-0.1257&appid=secret"; fake.sent[0].PathWithQuery != want {
+		t.Errorf("sent %q, want %q", fake.sent[0].PathWithQuery, want)
+	}
+}
+
+func TestForecastAirQualityInvalidCoordinates(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	var resp ErrorResponse
+	if err := json.Unmarshal([]byte(forecastAirQuality(91, 0, cm.None[string]())), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != ERR_INVALID_COORDINATES {
+		t.Errorf("code = %q, want %s", resp.Code, ERR_INVALID_COORDINATES)
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none", len(fake.sent))
+	}
+}
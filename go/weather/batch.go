@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.bytecodealliance.org/cm"
+)
+
+// GROUP_PATH fetches current weather for several city IDs in one request
+const GROUP_PATH = "/data/2.5/group"
+
+// MAX_BATCH_LOCATIONS matches the most city IDs the group endpoint accepts
+const MAX_BATCH_LOCATIONS = 20
+
+// BatchWeatherResponse holds one entry per requested location, in order
+type BatchWeatherResponse struct {
+	Results []BatchWeatherEntry `json:"results"`
+}
+
+// BatchWeatherEntry is the outcome for one location; either Weather or
+// Error is set
+type BatchWeatherEntry struct {
+	Location string           `json:"location"`
+	Weather  *WeatherResponse `json:"weather,omitempty"`
+	Error    *ErrorResponse   `json:"error,omitempty"`
+}
+
+// OpenWeatherGroupResponse is the group endpoint's payload; each list item
+// has the same shape as a current-weather response
+type OpenWeatherGroupResponse struct {
+	List []json.RawMessage `json:"list"`
+}
+
+func newBatchEntry(location string, weather *WeatherResponse, err error) BatchWeatherEntry {
+	entry := BatchWeatherEntry{Location: location, Weather: weather}
+	if err != nil {
+		resp := newErrorResponse("Failed to fetch weather", err)
+		entry.Error = &resp
+	}
+	return entry
+}
+
+// allCityIDs reports whether every location is a numeric city ID
+func allCityIDs(locations []string) bool {
+	for _, location := range locations {
+		if !isCityID(location) {
+			return false
+		}
+	}
+	return true
+}
+
+// getWeatherGroup fetches city IDs with a single group request. IDs missing
+// from the response get a LOCATION_NOT_FOUND entry.
+func getWeatherGroup(apiKey string, locations []string, unit string) ([]BatchWeatherEntry, error) {
+	// Both sides are keyed on the parsed ID, since the response spells it
+	// without the spaces or leading zeros a caller may have used
+	ids := make([]int64, len(locations))
+	idList := make([]string, len(locations))
+	for i, location := range locations {
+		ids[i], _ = parseCityID(location) // checked by allCityIDs
+		idList[i] = strconv.FormatInt(ids[i], 10)
+	}
+	var query QueryBuilder
+	query.Set("id", strings.Join(idList, ","))
+	query.Set("appid", apiKey)
+	query.Set("units", unit)
+	pathWithQuery := query.Path(GROUP_PATH)
+
+	body, err := makeHTTPRequest(pathWithQuery)
+	if err != nil {
+		return nil, classifyOpenWeatherError(err)
+	}
+
+	var group OpenWeatherGroupResponse
+	if err := json.Unmarshal(body, &group); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
+	}
+
+	// The group endpoint doesn't promise to keep the request order
+	byID := make(map[int64]*WeatherResponse, len(group.List))
+	for _, item := range group.List {
+		var city struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.Unmarshal(item, &city); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON response: %v", err)
+		}
+		weather, err := parseWeather(item, unit)
+		if err != nil {
+			return nil, err
+		}
+		byID[city.ID] = weather
+	}
+
+	entries := make([]BatchWeatherEntry, len(locations))
+	for i, location := range locations {
+		weather, ok := byID[ids[i]]
+		if !ok {
+			entries[i] = newBatchEntry(location, nil, &PluginError{
+				Code:    ERR_LOCATION_NOT_FOUND,
+				Message: fmt.Sprintf("OpenWeather has no city with ID %d", ids[i]),
+			})
+			continue
+		}
+		entries[i] = newBatchEntry(location, weather, nil)
+	}
+	return entries, nil
+}
+
+// getWeatherEach fetches each location with its own request, sent together
+// with DoBatch. A failure only affects its own entry.
+func getWeatherEach(apiKey string, locations []string, unit string) ([]BatchWeatherEntry, error) {
+	requests := make([]Request, len(locations))
+	for i, location := range locations {
+		requests[i] = Request{Method: "GET", PathWithQuery: weatherPath(OPENWEATHER_PATH, apiKey, location, unit)}
+	}
+	results := DoBatch(requests, REQUEST_MIDDLEWARE...)
+
+	// Every request fails the same way in dry-run mode; describe the first
+	var dryRun *DryRunError
+	if errors.As(results[0].Err, &dryRun) {
+		return nil, results[0].Err
+	}
+
+	entries := make([]BatchWeatherEntry, len(locations))
+	for i, result := range results {
+		if result.Err != nil {
+			entries[i] = newBatchEntry(locations[i], nil, classifyOpenWeatherError(result.Err))
+			continue
+		}
+		weather, err := parseWeather(result.Response.Body, unit)
+		entries[i] = newBatchEntry(locations[i], weather, err)
+	}
+	return entries, nil
+}
+
+// checkWeatherBatch fetches current weather for several locations. When
+// every location is a city ID, one group request replaces N lookups.
+func checkWeatherBatch(locations []string, unit string, keyOverride cm.Option[string]) string {
+	startRequest()
+
+	apiKey := callAPIKey(keyOverride)
+	if apiKey == "" {
+		return errorJSON(missingAPIKey())
+	}
+
+	if len(locations) > MAX_BATCH_LOCATIONS {
+		return errorJSON("Invalid locations", &PluginError{
+			Code:    ERR_TOO_MANY_LOCATIONS,
+			Message: fmt.Sprintf("%d locations requested; at most %d are allowed per call", len(locations), MAX_BATCH_LOCATIONS),
+		})
+	}
+
+	unit, err := resolveUnit(unit)
+	if err != nil {
+		return errorJSON("Invalid configuration", err)
+	}
+
+	response := BatchWeatherResponse{Results: make([]BatchWeatherEntry, 0, len(locations))}
+	if len(locations) > 0 {
+		if allCityIDs(locations) {
+			response.Results, err = getWeatherGroup(apiKey, locations, unit)
+		} else {
+			response.Results, err = getWeatherEach(apiKey, locations, unit)
+		}
+		if err != nil {
+			return errorJSON("Failed to fetch weather", err)
+		}
+	}
+
+	result, err := marshalJSON(response)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+	return string(result)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.bytecodealliance.org/cm"
+)
+
+// A group response for London and Paris, in the opposite order to the request
+const CAPTURED_GROUP = `{"cnt":2,"list":[
+  {"coord":{"lon":2.3488,"lat":48.8534},"sys":{"country":"FR","sunrise":1699945200,"sunset":1699978800},
+   "weather":[{"id":800,"main":"Clear","description":"clear sky","icon":"01d"}],
+   "main":{"temp":9.8,"feels_like":8.1,"humidity":76},"wind":{"speed":3.1,"deg":200},"dt":1700000000,"id":2988507,"name":"Paris"},
+  {"coord":{"lon":-0.1257,"lat":51.5085},"sys":{"country":"GB","sunrise":1699946100,"sunset":1699978500},
+   "weather":[{"id":500,"main":"Rain","description":"light rain","icon":"10d"}],
+   "main":{"temp":12.5,"feels_like":11.9,"humidity":81},"wind":{"speed":4.6,"deg":230},"dt":1700000000,"id":2643743,"name":"London"}
+]}`
+
+func checkBatch(t *testing.T, locations []string) BatchWeatherResponse {
+	t.Helper()
+	var response BatchWeatherResponse
+	if err := json.Unmarshal([]byte(checkWeatherBatch(locations, "metric", cm.None[string]())), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestCheckWeatherBatchGroup(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	fake.respond(GROUP_PATH, fakeResponse{status: 200, body: CAPTURED_GROUP})
+	useTransport(t, fake)
+
+	// Leading zeros and spaces still match the IDs in the response
+	response := checkBatch(t, []string{"02643743", " 2988507", "123"})
+
+	if len(fake.sent) != 1 {
+		t.Fatalf("sent %d requests, want one group request", len(fake.sent))
+	}
+	if want := "id=2643743%2C2988507%2C123"; !strings.Contains(fake.sent[0].PathWithQuery, want) {
+		t.Errorf("PathWithQuery = %q, want %q", fake.sent[0].PathWithQuery, want)
+	}
+	if len(response.Results) != 3 {
+		t.Fatalf("got %d results, want 3", len(response.Results))
+	}
+	for i, want := range []string{"London", "Paris"} {
+		entry := response.Results[i]
+		if entry.Weather == nil || entry.Weather.Location != want || entry.Error != nil {
+			t.Errorf("results[%d] = %+v, want %s", i, entry, want)
+		}
+	}
+	if entry := response.Results[0]; entry.Location != "02643743" {
+		t.Errorf("results[0].Location = %q, want the location as given", entry.Location)
+	}
+	if entry := response.Results[2]; entry.Error == nil || entry.Error.Code != ERR_LOCATION_NOT_FOUND {
+		t.Errorf("results[2] = %+v, want %s", entry, ERR_LOCATION_NOT_FOUND)
+	}
+}
+
+func TestCheckWeatherBatchEach(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", "HTTP_MAX_ATTEMPTS", "1")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH,
+		fakeResponse{status: 200, body: CAPTURED_CURRENT},
+		fakeResponse{status: 404, body: `{"cod":"404","message":"city not found"}`},
+	)
+	useTransport(t, fake)
+
+	// A city name means every location is looked up on its own
+	response := checkBatch(t, []string{"2643743", "Lodnon"})
+
+	if len(fake.sent) != 2 {
+		t.Fatalf("sent %d requests, want one per location", len(fake.sent))
+	}
+	if entry := response.Results[0]; entry.Weather == nil || entry.Weather.Location != "London" {
+		t.Errorf("results[0] = %+v, want London", entry)
+	}
+	if entry := response.Results[1]; entry.Error == nil || entry.Error.Code != ERR_LOCATION_NOT_FOUND {
+		t.Errorf("results[1] = %+v, want %s", entry, ERR_LOCATION_NOT_FOUND)
+	}
+}
+
+func TestCheckWeatherBatchTooMany(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	var resp ErrorResponse
+	locations := make([]string, MAX_BATCH_LOCATIONS+1)
+	if err := json.Unmarshal([]byte(checkWeatherBatch(locations, "metric", cm.None[string]())), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != ERR_TOO_MANY_LOCATIONS || len(fake.sent) != 0 {
+		t.Errorf("code = %q after %d requests, want %s and none sent", resp.Code, len(fake.sent), ERR_TOO_MANY_LOCATIONS)
+	}
+}
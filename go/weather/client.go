@@ -0,0 +1,27 @@
+package main
+
+// host is the authority a request is sent to
+func (req Request) host() string {
+	if req.Authority != "" {
+		return req.Authority
+	}
+	return OPENWEATHER_HOST
+}
+
+// REQUEST_MIDDLEWARE wraps every OpenWeather request, single or batched. A
+// rejected or rate-limited key fails over to the next rotation key at once,
+// and only when every key has failed is the request retried (see
+// withRetries); a success without a body, such as a 204, returns
+// NO_CONTENT_BODY, and errors carry the redacted URL that was attempted.
+var REQUEST_MIDDLEWARE = []Middleware{withRequestURLs, withRetries, withKeyFailover, withNoContent}
+
+// makeHTTPRequest sends a GET request through REQUEST_MIDDLEWARE and returns
+// its body
+func makeHTTPRequest(pathWithQuery string) ([]byte, error) {
+	send := chain(roundTrip, REQUEST_MIDDLEWARE...)
+	response, err := send(Request{Method: "GET", PathWithQuery: pathWithQuery})
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
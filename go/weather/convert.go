@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// METERS_PER_SECOND_PER_MPH converts wind speed; OpenWeather reports m/s for
+// metric and mph for imperial
+const METERS_PER_SECOND_PER_MPH = 0.44704
+
+// convertTemperature converts a temperature between unit systems
+func convertTemperature(value float64, from string, to string) float64 {
+	if from == to {
+		return value
+	}
+	if to == "imperial" {
+		return value*9/5 + 32
+	}
+	return (value - 32) * 5 / 9
+}
+
+// convertWindSpeed converts a wind speed between unit systems
+func convertWindSpeed(value float64, from string, to string) float64 {
+	if from == to {
+		return value
+	}
+	if to == "imperial" {
+		return value / METERS_PER_SECOND_PER_MPH
+	}
+	return value * METERS_PER_SECOND_PER_MPH
+}
+
+// roundTo2 keeps converted values as tidy as OpenWeather's own
+func roundTo2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// convertUnits converts a weather response returned by an earlier call to
+// another unit system. Only the fields present are touched, so output that
+// went through a field mask converts too.
+func convertUnits(weatherJSON string, targetUnit string) string {
+	startRequest()
+
+	target := strings.ToLower(strings.TrimSpace(targetUnit))
+	if !slices.Contains(SUPPORTED_UNITS, target) {
+		return errorJSON("Invalid target unit", &PluginError{
+			Code:    ERR_INVALID_UNIT,
+			Message: fmt.Sprintf("unsupported unit %q: use %s", targetUnit, strings.Join(SUPPORTED_UNITS, " or ")),
+		})
+	}
+
+	var weather map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(weatherJSON), &weather); err != nil {
+		return errorJSON("Invalid weather JSON", err)
+	}
+
+	var source string
+	if err := json.Unmarshal(weather["unit"], &source); err != nil || !slices.Contains(SUPPORTED_UNITS, source) {
+		return errorJSON("Invalid weather JSON", &PluginError{
+			Code:    ERR_INVALID_UNIT,
+			Message: "weather JSON must include a \"unit\" of metric or imperial",
+		})
+	}
+
+	conversions := map[string]func(float64, string, string) float64{
+		"temperature":            convertTemperature,
+		"feels_like_temperature": convertTemperature,
+		"wind_chill":             convertTemperature,
+		"heat_index":             convertTemperature,
+		"wind_speed":             convertWindSpeed,
+	}
+	for field, convert := range conversions {
+		raw, ok := weather[field]
+		if !ok {
+			continue
+		}
+		var value float64
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return errorJSON("Invalid weather JSON", fmt.Errorf("%s: %v", field, err))
+		}
+		// Converting a value near the float64 limit overflows to infinity,
+		// which has no JSON form
+		converted := roundTo2(convert(value, source, target))
+		if field != "wind_speed" {
+			if err := validateTemperature(field, converted); err != nil {
+				return errorJSON("Invalid weather JSON", err)
+			}
+		}
+		encoded, err := json.Marshal(converted)
+		if err != nil {
+			return errorJSON("Invalid weather JSON", fmt.Errorf("%s: %v", field, err))
+		}
+		weather[field] = encoded
+	}
+	weather["unit"], _ = json.Marshal(target)
+
+	result, err := marshalJSON(weather)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+	return string(result)
+}
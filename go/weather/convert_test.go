@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConvertUnits(t *testing.T) {
+	setEnv(t)
+	input := `{"location":"London","temperature":12.5,"feels_like_temperature":-40,"unit":"metric","wind_speed":4.6,"humidity":81}`
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(convertUnits(input, " Imperial ")), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"location":               "London",
+		"temperature":            54.5,
+		"feels_like_temperature": -40.0,
+		"unit":                   "imperial",
+		"wind_speed":             10.29,
+		"humidity":               81.0,
+	}
+	for field, value := range want {
+		if got[field] != value {
+			t.Errorf("%s = %v, want %v", field, got[field], value)
+		}
+	}
+}
+
+func TestConvertUnitsDerivedIndices(t *testing.T) {
+	setEnv(t)
+	var got map[string]any
+	if err := json.Unmarshal([]byte(convertUnits(`{"temperature":35,"heat_index":45,"wind_chill":-10,"unit":"metric"}`, "imperial")), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["heat_index"] != 113.0 || got["wind_chill"] != 14.0 {
+		t.Errorf("converted = %v, want the indices in °F", got)
+	}
+}
+
+func TestConvertUnitsMasked(t *testing.T) {
+	setEnv(t)
+	// Output that went through a field mask has no wind speed to convert
+	var got map[string]any
+	if err := json.Unmarshal([]byte(convertUnits(`{"temperature":54.5,"unit":"imperial"}`, "metric")), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["temperature"] != 12.5 || got["unit"] != "metric" {
+		t.Errorf("converted = %v, want 12.5 metric", got)
+	}
+	if _, ok := got["wind_speed"]; ok {
+		t.Errorf("converted = %v, want no wind_speed added", got)
+	}
+}
+
+func TestConvertUnitsInvalid(t *testing.T) {
+	setEnv(t)
+	tests := []struct {
+		name   string
+		input  string
+		target string
+		want   string
+	}{
+		{"unknown target", `{"temperature":12.5,"unit":"metric"}`, "kelvin", ERR_INVALID_UNIT},
+		{"missing unit", `{"temperature":12.5}`, "imperial", ERR_INVALID_UNIT},
+		{"unknown source", `{"temperature":12.5,"unit":"standard"}`, "imperial", ERR_INVALID_UNIT},
+		{"not json", `London 12.5C`, "imperial", ""},
+		{"non-numeric field", `{"temperature":"warm","unit":"metric"}`, "imperial", ""},
+		{"overflowing temperature", `{"temperature":1.7e308,"unit":"metric"}`, "imperial", ERR_INVALID_TEMPERATURE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp ErrorResponse
+			if err := json.Unmarshal([]byte(convertUnits(tt.input, tt.target)), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error == "" || resp.Code != tt.want {
+				t.Errorf("convertUnits() = %+v, want an error with code %q", resp, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+//go:build tinygo
+
+package main
+
+import (
+	weathercomponent "github.com/my_org/weather/gen/example/weather/weather-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// The exports are only registered in the TinyGo build. They reach every WASI
+// import the plugin uses, so leaving them out lets go test build the package
+// on the host and exercise the helpers against stand-ins (see wasi_other.go).
+func init() {
+	weathercomponent.Exports.CheckWeather = func(location string, unit string) string {
+		return checkWeather(location, unit, weathercomponent.WeatherOptions{})
+	}
+	weathercomponent.Exports.CheckWeatherWithOptions = checkWeather
+	weathercomponent.Exports.CheckWeatherTyped = checkWeatherTyped
+	weathercomponent.Exports.CheckWeatherFull = func(location string, unit string, apiKey cm.Option[string]) string {
+		return checkWeatherFull(location, unit, FORECAST_DAYS, apiKey)
+	}
+	weathercomponent.Exports.CheckWeatherFullDays = func(location string, unit string, days uint8, apiKey cm.Option[string]) string {
+		return checkWeatherFull(location, unit, int(days), apiKey)
+	}
+	weathercomponent.Exports.CheckWeatherBatch = func(locations cm.List[string], unit string, apiKey cm.Option[string]) string {
+		return checkWeatherBatch(locations.Slice(), unit, apiKey)
+	}
+	weathercomponent.Exports.Geocode = checkGeocode
+	weathercomponent.Exports.CheckAlerts = checkAlerts
+	weathercomponent.Exports.CheckPrecipitation = checkPrecipitation
+	weathercomponent.Exports.CheckOnecall = checkOneCall
+	weathercomponent.Exports.ForecastAirQuality = forecastAirQuality
+	weathercomponent.Exports.CheckDailyUv = checkDailyUV
+	weathercomponent.Exports.CheckHistorical = checkHistorical
+	weathercomponent.Exports.ConvertUnits = convertUnits
+	weathercomponent.Exports.ClearCaches = clearCaches
+	weathercomponent.Exports.SupportedUnits = supportedUnits
+	weathercomponent.Exports.RequiredEnv = func() string {
+		result, _ := marshalJSON(REQUIRED_ENV)
+		return string(result)
+	}
+	weathercomponent.Exports.ValidateKey = validateKey
+}
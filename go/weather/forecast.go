@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.bytecodealliance.org/cm"
+)
+
+const FORECAST_PATH = "/data/2.5/forecast"
+
+// FORECAST_DAYS is how far ahead the 5-day / 3-hour forecast reaches, and
+// the most days check-weather-full-days can keep
+const FORECAST_DAYS = 5
+
+// OpenWeatherForecastResponse is the subset of the 5-day / 3-hour forecast
+// response the plugin reads
+type OpenWeatherForecastResponse struct {
+	City struct {
+		Name string `json:"name"`
+	} `json:"city"`
+	List []struct {
+		Dt   int64 `json:"dt"`
+		Main struct {
+			Temp      float64 `json:"temp"`
+			FeelsLike float64 `json:"feels_like"`
+			Humidity  int     `json:"humidity"`
+		} `json:"main"`
+		Weather []struct {
+			Description string `json:"description"`
+		} `json:"weather"`
+	} `json:"list"`
+}
+
+type ForecastResponse struct {
+	Location string          `json:"location"`
+	Unit     string          `json:"unit"`
+	Entries  []ForecastEntry `json:"entries"`
+}
+
+// ForecastEntry is one 3-hour forecast step; time is a Unix timestamp (UTC)
+type ForecastEntry struct {
+	Time                 int64    `json:"time"`
+	Temperature          float64  `json:"temperature"`
+	FeelsLikeTemperature float64  `json:"feels_like_temperature"`
+	Humidity             int      `json:"humidity"`
+	WeatherConditions    []string `json:"weather_conditions"`
+}
+
+// FullWeatherResponse combines current conditions and the forecast. A
+// section that failed is null and its error is listed under errors.
+type FullWeatherResponse struct {
+	Current  *WeatherResponse         `json:"current"`
+	Forecast *ForecastResponse        `json:"forecast"`
+	Errors   map[string]ErrorResponse `json:"errors,omitempty"`
+}
+
+// parseForecast builds the plugin's forecast response from a forecast body
+func parseForecast(body []byte, unit string) (*ForecastResponse, error) {
+	var forecastData OpenWeatherForecastResponse
+	if err := json.Unmarshal(body, &forecastData); err != nil {
+		if tempErr := temperatureDecodeError(err); tempErr != nil {
+			return nil, tempErr
+		}
+		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
+	}
+
+	forecast := &ForecastResponse{
+		Location: forecastData.City.Name,
+		Unit:     unit,
+		Entries:  make([]ForecastEntry, 0, len(forecastData.List)),
+	}
+	for _, item := range forecastData.List {
+		entry := ForecastEntry{
+			Time:                 item.Dt,
+			Temperature:          item.Main.Temp,
+			FeelsLikeTemperature: item.Main.FeelsLike,
+			Humidity:             item.Main.Humidity,
+			WeatherConditions:    make([]string, 0, len(item.Weather)),
+		}
+		for _, w := range item.Weather {
+			if w.Description != "" {
+				entry.WeatherConditions = append(entry.WeatherConditions, w.Description)
+			}
+		}
+		forecast.Entries = append(forecast.Entries, entry)
+	}
+
+	return forecast, nil
+}
+
+// validateForecastDays checks a forecast horizon is 1 to FORECAST_DAYS days
+func validateForecastDays(days int) error {
+	if days < 1 || days > FORECAST_DAYS {
+		return &PluginError{
+			Code:    ERR_INVALID_DAYS,
+			Message: fmt.Sprintf("days %d out of range: must be 1 to %d", days, FORECAST_DAYS),
+		}
+	}
+	return nil
+}
+
+// truncateForecast keeps the entries within days of the first one. The
+// steps are 3 hours apart, so each day is normally 8 entries.
+func truncateForecast(forecast *ForecastResponse, days int) {
+	if len(forecast.Entries) == 0 {
+		return
+	}
+	cutoff := forecast.Entries[0].Time + int64(days)*24*60*60
+	for i, entry := range forecast.Entries {
+		if entry.Time >= cutoff {
+			forecast.Entries = forecast.Entries[:i]
+			return
+		}
+	}
+}
+
+// checkWeatherFull fetches current conditions and the forecast for the next
+// days (1 to FORECAST_DAYS) in one batch. If only one section fails, the
+// other is still returned.
+func checkWeatherFull(location string, unit string, days int, keyOverride cm.Option[string]) string {
+	startRequest()
+
+	if err := checkFeature(FEATURE_FORECAST); err != nil {
+		return errorJSON("Export disabled", err)
+	}
+
+	if err := validateForecastDays(days); err != nil {
+		return errorJSON("Invalid days", err)
+	}
+
+	apiKey := callAPIKey(keyOverride)
+	if apiKey == "" {
+		return errorJSON(missingAPIKey())
+	}
+
+	unit, err := resolveUnit(unit)
+	if err != nil {
+		return errorJSON("Invalid configuration", err)
+	}
+
+	results := DoBatch([]Request{
+		{Method: "GET", PathWithQuery: weatherPath(OPENWEATHER_PATH, apiKey, location, unit)},
+		{Method: "GET", PathWithQuery: weatherPath(FORECAST_PATH, apiKey, location, unit)},
+	}, REQUEST_MIDDLEWARE...)
+
+	// Both requests fail the same way in dry-run mode; describe the first
+	var dryRun *DryRunError
+	if errors.As(results[0].Err, &dryRun) {
+		return errorJSON("", results[0].Err)
+	}
+
+	full := FullWeatherResponse{}
+	var currentErr, forecastErr error
+
+	if results[0].Err != nil {
+		currentErr = classifyOpenWeatherError(results[0].Err)
+	} else {
+		full.Current, currentErr = parseWeather(results[0].Response.Body, unit)
+	}
+	if results[1].Err != nil {
+		forecastErr = classifyOpenWeatherError(results[1].Err)
+	} else {
+		full.Forecast, forecastErr = parseForecast(results[1].Response.Body, unit)
+		if forecastErr == nil {
+			truncateForecast(full.Forecast, days)
+		}
+	}
+
+	// With nothing to return, fail the call like check-weather would
+	if currentErr != nil && forecastErr != nil {
+		return errorJSON("Failed to fetch weather", currentErr)
+	}
+
+	if currentErr != nil {
+		full.Errors = map[string]ErrorResponse{"current": newErrorResponse("Failed to fetch weather", currentErr)}
+	}
+	if forecastErr != nil {
+		full.Errors = map[string]ErrorResponse{"forecast": newErrorResponse("Failed to fetch forecast", forecastErr)}
+	}
+
+	result, err := marshalJSON(full)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+	return string(result)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.bytecodealliance.org/cm"
+)
+
+// Current conditions and a forecast for London, trimmed to a few fields and
+// (for the forecast) entries
+const (
+	CAPTURED_CURRENT = `{"coord":{"lon":-0.1257,"lat":51.5085},
+  "weather":[{"id":500,"main":"Rain","description":"light rain","icon":"10d"}],
+  "main":{"temp":12.5,"feels_like":11.9,"temp_min":11.1,"temp_max":13.4,"pressure":1012,"humidity":81},
+  "wind":{"speed":4.6,"deg":230},"dt":1700000000,
+  "sys":{"country":"GB","sunrise":1699946100,"sunset":1699978500},"timezone":0,"id":2643743,"name":"London","cod":200}`
+	CAPTURED_FORECAST = `{"cod":"200","message":0,"cnt":3,"list":[
+  {"dt":1700006400,"main":{"temp":11.8,"feels_like":11.2,"humidity":84},"weather":[{"id":500,"description":"light rain"}]},
+  {"dt":1700017200,"main":{"temp":10.9,"feels_like":10.1,"humidity":88},"weather":[{"id":804,"description":"overcast clouds"}]},
+  {"dt":1700092800,"main":{"temp":9.4,"feels_like":7.9,"humidity":79},"weather":[{"id":800,"description":"clear sky"}]}
+],"city":{"id":2643743,"name":"London","country":"GB","timezone":0}}`
+)
+
+func TestCheckWeatherFull(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	fake.respond(FORECAST_PATH, fakeResponse{status: 200, body: CAPTURED_FORECAST})
+	useTransport(t, fake)
+
+	var full FullWeatherResponse
+	if err := json.Unmarshal([]byte(checkWeatherFull("London", "metric", FORECAST_DAYS, cm.None[string]())), &full); err != nil {
+		t.Fatal(err)
+	}
+
+	if full.Current == nil || full.Current.Location != "London" || full.Current.Temperature != 12.5 {
+		t.Errorf("current = %+v, want London at 12.5", full.Current)
+	}
+	if full.Forecast == nil || len(full.Forecast.Entries) != 3 || full.Forecast.Entries[1].WeatherConditions[0] != "overcast clouds" {
+		t.Errorf("forecast = %+v, want the three captured entries", full.Forecast)
+	}
+	if full.Errors != nil {
+		t.Errorf("errors = %v, want none", full.Errors)
+	}
+	if len(fake.sent) != 2 {
+		t.Errorf("sent %d requests, want current and forecast", len(fake.sent))
+	}
+}
+
+func TestCheckWeatherFullForecastFails(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true", "HTTP_MAX_ATTEMPTS", "1")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	fake.respond(FORECAST_PATH, fakeResponse{status: 429, body: `{"cod":429,"message":"Your account is temporary blocked"}`})
+	useTransport(t, fake)
+
+	var full FullWeatherResponse
+	if err := json.Unmarshal([]byte(checkWeatherFull("London", "metric", FORECAST_DAYS, cm.None[string]())), &full); err != nil {
+		t.Fatal(err)
+	}
+
+	if full.Current == nil || full.Current.Location != "London" {
+		t.Errorf("current = %+v, want the successful section kept", full.Current)
+	}
+	if full.Forecast != nil {
+		t.Errorf("forecast = %+v, want null", full.Forecast)
+	}
+	if full.Errors["forecast"].Code != ERR_RATE_LIMITED {
+		t.Errorf("errors = %+v, want forecast RATE_LIMITED", full.Errors)
+	}
+	if _, ok := full.Errors["current"]; ok {
+		t.Errorf("errors = %+v, want no current error", full.Errors)
+	}
+}
+
+func TestCheckWeatherFullBothFail(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 404, body: `{"cod":"404","message":"city not found"}`})
+	fake.respond(FORECAST_PATH, fakeResponse{status: 404, body: `{"cod":"404","message":"city not found"}`})
+	useTransport(t, fake)
+
+	var resp ErrorResponse
+	if err := json.Unmarshal([]byte(checkWeatherFull("Lodnon", "metric", FORECAST_DAYS, cm.None[string]())), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != ERR_LOCATION_NOT_FOUND {
+		t.Errorf("code = %q, want the call to fail with %s", resp.Code, ERR_LOCATION_NOT_FOUND)
+	}
+}
+
+func TestTruncateForecast(t *testing.T) {
+	forecast, err := parseForecast([]byte(CAPTURED_FORECAST), "metric")
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncateForecast(forecast, 1)
+	if len(forecast.Entries) != 2 {
+		t.Errorf("kept %d entries, want the 2 within a day of the first", len(forecast.Entries))
+	}
+
+	// An empty forecast is left as it is
+	empty := &ForecastResponse{}
+	truncateForecast(empty, 1)
+	if len(empty.Entries) != 0 {
+		t.Errorf("entries = %+v, want none", empty.Entries)
+	}
+}
+
+func TestValidateForecastDays(t *testing.T) {
+	for _, days := range []int{1, FORECAST_DAYS} {
+		if err := validateForecastDays(days); err != nil {
+			t.Errorf("validateForecastDays(%d) error = %v", days, err)
+		}
+	}
+	for _, days := range []int{0, -1, FORECAST_DAYS + 1} {
+		var pluginErr *PluginError
+		if err := validateForecastDays(days); !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_DAYS {
+			t.Errorf("validateForecastDays(%d) error = %v, want %s", days, err, ERR_INVALID_DAYS)
+		}
+	}
+}
+
+func TestCheckWeatherFullDays(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	fake.respond(FORECAST_PATH, fakeResponse{status: 200, body: CAPTURED_FORECAST})
+	useTransport(t, fake)
+
+	var full FullWeatherResponse
+	if err := json.Unmarshal([]byte(checkWeatherFull("London", "metric", 1, cm.None[string]())), &full); err != nil {
+		t.Fatal(err)
+	}
+	if full.Forecast == nil || len(full.Forecast.Entries) != 2 {
+		t.Errorf("forecast = %+v, want the 2 entries of the first day", full.Forecast)
+	}
+	if full.Current == nil || full.Current.Location != "London" {
+		t.Errorf("current = %+v, want it unaffected by days", full.Current)
+	}
+}
+
+func TestCheckWeatherFullDaysOutOfRange(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true")
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	var resp ErrorResponse
+	if err := json.Unmarshal([]byte(checkWeatherFull("London", "metric", FORECAST_DAYS+1, cm.None[string]())), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != ERR_INVALID_DAYS {
+		t.Errorf("code = %q, want %s", resp.Code, ERR_INVALID_DAYS)
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none", len(fake.sent))
+	}
+}
+
+func TestParseForecastNonFiniteTemperature(t *testing.T) {
+	body := strings.Replace(CAPTURED_FORECAST, `"temp":10.9`, `"temp":1e999`, 1)
+	_, err := parseForecast([]byte(body), "metric")
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_TEMPERATURE {
+		t.Errorf("error = %v, want %s", err, ERR_INVALID_TEMPERATURE)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.bytecodealliance.org/cm"
+)
+
+const GEOCODE_PATH = "/geo/1.0/direct"
+
+// GEOCODE_CACHE_SIZE bounds how many city lookups are remembered
+const GEOCODE_CACHE_SIZE = 128
+
+// GEOCODE_CANDIDATE_LIMIT is the most places the disambiguate option lists;
+// it is also the geocoding API's own maximum
+const GEOCODE_CANDIDATE_LIMIT = 5
+
+// OpenWeatherGeocodeResult is one match from the direct geocoding API
+type OpenWeatherGeocodeResult struct {
+	Name    string  `json:"name"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	Country string  `json:"country"`
+	State   string  `json:"state"`
+}
+
+// AmbiguousLocationResponse is returned instead of the weather when the
+// disambiguate option is set and a name matches more than one place
+type AmbiguousLocationResponse struct {
+	Location   string            `json:"location"`
+	Ambiguous  bool              `json:"ambiguous"`
+	Candidates []GeocodeResponse `json:"candidates"`
+}
+
+type GeocodeResponse struct {
+	Name    string  `json:"name"`
+	State   string  `json:"state,omitempty"`
+	Country string  `json:"country"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+}
+
+// geocodeCache is a fixed-size LRU of geocode results. It only lives as
+// long as the plugin instance; losing it on restart just costs a lookup.
+type geocodeCache struct {
+	capacity int
+	order    *list.List // front is most recently used
+	entries  map[string]*list.Element
+}
+
+type geocodeCacheEntry struct {
+	key      string
+	response GeocodeResponse
+}
+
+func newGeocodeCache(capacity int) *geocodeCache {
+	return &geocodeCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element, capacity),
+	}
+}
+
+// Get returns a cached result and marks it most recently used
+func (c *geocodeCache) Get(key string) (GeocodeResponse, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return GeocodeResponse{}, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*geocodeCacheEntry).response, true
+}
+
+// Clear removes every entry
+func (c *geocodeCache) Clear() {
+	c.order.Init()
+	clear(c.entries)
+}
+
+// Put stores a result, evicting the least recently used entry when full
+func (c *geocodeCache) Put(key string, response GeocodeResponse) {
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*geocodeCacheEntry).response = response
+		c.order.MoveToFront(element)
+		return
+	}
+
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*geocodeCacheEntry).key)
+	}
+	c.entries[key] = c.order.PushFront(&geocodeCacheEntry{key: key, response: response})
+}
+
+var geocodes = newGeocodeCache(GEOCODE_CACHE_SIZE)
+
+// geocodeCacheKey folds case and surrounding space so "Austin" and
+// " austin" share an entry
+func geocodeCacheKey(location string) string {
+	return strings.ToLower(strings.TrimSpace(location))
+}
+
+// fetchGeocodeMatches asks the geocoding API for up to limit places matching
+// a name, in OpenWeather's order of relevance
+func fetchGeocodeMatches(apiKey string, location string, limit int) ([]GeocodeResponse, error) {
+	var query QueryBuilder
+	query.Set("q", location)
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("appid", apiKey)
+	pathWithQuery := query.Path(GEOCODE_PATH)
+
+	body, err := makeHTTPRequest(pathWithQuery)
+	if err != nil {
+		return nil, classifyOpenWeatherError(err)
+	}
+
+	var matches []OpenWeatherGeocodeResult
+	if err := json.Unmarshal(body, &matches); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
+	}
+	// Unlike the weather endpoint, geocoding answers an unknown place with an empty list
+	if len(matches) == 0 {
+		return nil, &PluginError{
+			Code:    ERR_LOCATION_NOT_FOUND,
+			Message: fmt.Sprintf("OpenWeather could not geocode %q; check the spelling or use 'City,CountryCode'", location),
+		}
+	}
+
+	responses := make([]GeocodeResponse, len(matches))
+	for i, match := range matches {
+		responses[i] = GeocodeResponse{
+			Name:    match.Name,
+			State:   match.State,
+			Country: match.Country,
+			Lat:     match.Lat,
+			Lon:     match.Lon,
+		}
+	}
+	return responses, nil
+}
+
+// geocode resolves a place name to coordinates, using the cache when the
+// same query was looked up before. Failures are not cached.
+func geocode(apiKey string, location string) (*GeocodeResponse, error) {
+	key := geocodeCacheKey(location)
+	if cached, ok := geocodes.Get(key); ok {
+		return &cached, nil
+	}
+
+	matches, err := fetchGeocodeMatches(apiKey, location, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	response := matches[0]
+	geocodes.Put(key, response)
+	return &response, nil
+}
+
+// geocodeCandidates returns the distinct places a name could mean, up to
+// GEOCODE_CANDIDATE_LIMIT. OpenWeather can list one place more than once,
+// so matches with the same name, state, and country count once.
+func geocodeCandidates(apiKey string, location string) ([]GeocodeResponse, error) {
+	matches, err := fetchGeocodeMatches(apiKey, location, GEOCODE_CANDIDATE_LIMIT)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(matches))
+	candidates := make([]GeocodeResponse, 0, len(matches))
+	for _, match := range matches {
+		key := match.Name + "|" + match.State + "|" + match.Country
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		candidates = append(candidates, match)
+	}
+	return candidates, nil
+}
+
+func checkGeocode(location string, keyOverride cm.Option[string]) string {
+	startRequest()
+
+	apiKey := callAPIKey(keyOverride)
+	if apiKey == "" {
+		return errorJSON(missingAPIKey())
+	}
+
+	response, err := geocode(apiKey, location)
+	if err != nil {
+		return errorJSON("Failed to geocode location", err)
+	}
+
+	result, err := marshalJSON(response)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+	return string(result)
+}
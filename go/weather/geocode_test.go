@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	weathercomponent "github.com/my_org/weather/gen/example/weather/weather-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// Geocoding matches for Springfield, with Springfield, Illinois listed twice
+const CAPTURED_SPRINGFIELD_MATCHES = `[
+  {"name":"Springfield","lat":39.7990,"lon":-89.6440,"country":"US","state":"Illinois"},
+  {"name":"Springfield","lat":37.2153,"lon":-93.2982,"country":"US","state":"Missouri"},
+  {"name":"Springfield","lat":39.8017,"lon":-89.6437,"country":"US","state":"Illinois"},
+  {"name":"Springfield","lat":42.1015,"lon":-72.5898,"country":"US","state":"Massachusetts"}
+]`
+
+func TestGeocodeCacheHitAndMiss(t *testing.T) {
+	cache := newGeocodeCache(2)
+	london := GeocodeResponse{Name: "London", Country: "GB", Lat: 51.5073, Lon: -0.1277}
+	cache.Put("london", london)
+
+	if got, ok := cache.Get("london"); !ok || got != london {
+		t.Errorf("Get(london) = %+v, %v, want a hit", got, ok)
+	}
+	if _, ok := cache.Get("paris"); ok {
+		t.Error("Get(paris) hit an entry that was never stored")
+	}
+}
+
+func TestGeocodeCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newGeocodeCache(2)
+	cache.Put("london", GeocodeResponse{Name: "London"})
+	cache.Put("paris", GeocodeResponse{Name: "Paris"})
+
+	// Reading london makes paris the least recently used
+	cache.Get("london")
+	cache.Put("berlin", GeocodeResponse{Name: "Berlin"})
+
+	if _, ok := cache.Get("paris"); ok {
+		t.Error("paris survived, want it evicted")
+	}
+	for _, key := range []string{"london", "berlin"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+
+	// Storing an existing key refreshes it without evicting anything
+	cache.Put("london", GeocodeResponse{Name: "London, GB"})
+	if got, _ := cache.Get("london"); got.Name != "London, GB" {
+		t.Errorf("Get(london) = %+v, want the updated entry", got)
+	}
+	if _, ok := cache.Get("berlin"); !ok {
+		t.Error("updating london evicted berlin")
+	}
+
+	cache.Clear()
+	if _, ok := cache.Get("london"); ok {
+		t.Error("Clear left london cached")
+	}
+}
+
+func TestGeocodeUsesCache(t *testing.T) {
+	geocodes.Clear()
+	t.Cleanup(geocodes.Clear)
+	fake := &fakeTransport{}
+	fake.respond(GEOCODE_PATH, fakeResponse{
+		status: 200,
+		body:   `[{"name":"Austin","lat":30.2711,"lon":-97.7437,"country":"US","state":"Texas"}]`,
+	})
+	useTransport(t, fake)
+
+	for _, location := range []string{"Austin", " austin "} {
+		response, err := geocode("secret", location)
+		if err != nil {
+			t.Fatalf("geocode(%q) error = %v", location, err)
+		}
+		if response.Name != "Austin" || response.State != "Texas" {
+			t.Errorf("geocode(%q) = %+v", location, response)
+		}
+	}
+	if len(fake.sent) != 1 {
+		t.Errorf("sent %d geocode requests, want the second lookup cached", len(fake.sent))
+	}
+}
+
+func TestGeocodeCandidates(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond(GEOCODE_PATH, fakeResponse{status: 200, body: CAPTURED_SPRINGFIELD_MATCHES})
+	useTransport(t, fake)
+
+	candidates, err := geocodeCandidates("secret", "Springfield")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The repeated Illinois match counts once, keeping the first
+	var states []string
+	for _, candidate := range candidates {
+		states = append(states, candidate.State)
+	}
+	if len(candidates) != 3 || states[0] != "Illinois" || states[1] != "Missouri" || states[2] != "Massachusetts" || candidates[0].Lat != 39.7990 {
+		t.Errorf("candidates = %+v, want Illinois, Missouri, and Massachusetts", candidates)
+	}
+	if got := sentQuery(t, fake, GEOCODE_PATH).Get("limit"); got != "5" {
+		t.Errorf("limit = %q, want %d", got, GEOCODE_CANDIDATE_LIMIT)
+	}
+}
+
+func TestCheckWeatherDisambiguate(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	fake.respond(GEOCODE_PATH, fakeResponse{status: 200, body: CAPTURED_SPRINGFIELD_MATCHES})
+	useTransport(t, fake)
+
+	var resp AmbiguousLocationResponse
+	options := weathercomponent.WeatherOptions{Disambiguate: cm.Some(true)}
+	if err := json.Unmarshal([]byte(checkWeather(" Springfield ", "metric", options)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Ambiguous || resp.Location != "Springfield" || len(resp.Candidates) != 3 {
+		t.Errorf("response = %+v, want the three candidates", resp)
+	}
+	// The weather isn't fetched until the host picks a place
+	if len(fake.sent) != 1 || !strings.HasPrefix(fake.sent[0].PathWithQuery, GEOCODE_PATH) {
+		t.Errorf("sent %+v, want only the geocoding request", fake.sent)
+	}
+}
+
+func TestCheckWeatherDisambiguateUnambiguous(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	fake.respond(GEOCODE_PATH, fakeResponse{status: 200, body: `[{"name":"London","lat":51.5073,"lon":-0.1277,"country":"GB"}]`})
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT}, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	useTransport(t, fake)
+
+	options := weathercomponent.WeatherOptions{Disambiguate: cm.Some(true)}
+	// A single match, and a city ID that skips geocoding, both return the
+	// weather itself
+	for _, location := range []string{"London", "2643743"} {
+		var weather WeatherResponse
+		if err := json.Unmarshal([]byte(checkWeather(location, "metric", options)), &weather); err != nil {
+			t.Fatal(err)
+		}
+		if weather.Location != "London" || weather.Temperature != 12.5 {
+			t.Errorf("%s: weather = %+v, want London at 12.5", location, weather)
+		}
+	}
+	if len(fake.sent) != 3 {
+		t.Errorf("sent %d requests, want one geocoding and two weather", len(fake.sent))
+	}
+}
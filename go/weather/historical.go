@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.bytecodealliance.org/cm"
+)
+
+const DAY_SUMMARY_PATH = "/data/3.0/onecall/day_summary"
+
+// EARLIEST_HISTORICAL_DATE is the first day One Call's day summary covers
+const EARLIEST_HISTORICAL_DATE = "1979-01-02"
+
+// OpenWeatherDaySummary is the subset of a One Call day summary the plugin
+// reads. The temperature readings are taken at 06:00, 12:00, 18:00, and
+// 00:00 local time.
+type OpenWeatherDaySummary struct {
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Tz          string  `json:"tz"`
+	Date        string  `json:"date"`
+	Temperature struct {
+		Min       float64 `json:"min"`
+		Max       float64 `json:"max"`
+		Morning   float64 `json:"morning"`
+		Afternoon float64 `json:"afternoon"`
+		Evening   float64 `json:"evening"`
+		Night     float64 `json:"night"`
+	} `json:"temperature"`
+	Precipitation struct {
+		Total float64 `json:"total"`
+	} `json:"precipitation"`
+	Wind struct {
+		Max struct {
+			Speed     float64 `json:"speed"`
+			Direction float64 `json:"direction"`
+		} `json:"max"`
+	} `json:"wind"`
+}
+
+type HistoricalResponse struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+	// Date is the local day summarized, and UTCOffset the location's offset
+	// as OpenWeather reports it (e.g. "+02:00")
+	Date        string                `json:"date"`
+	UTCOffset   string                `json:"utc_offset"`
+	Unit        string                `json:"unit"`
+	Temperature HistoricalTemperature `json:"temperature"`
+	// Precipitation is the day's total in mm
+	Precipitation float64        `json:"precipitation"`
+	Wind          HistoricalWind `json:"wind"`
+}
+
+// HistoricalTemperature is the day's range in °C. Mean averages the four
+// readings across the day rather than every hour.
+type HistoricalTemperature struct {
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+// HistoricalWind is the day's strongest wind, in m/s and degrees
+type HistoricalWind struct {
+	MaxSpeed  float64 `json:"max_speed"`
+	Direction float64 `json:"direction"`
+}
+
+// validateHistoricalDate checks a YYYY-MM-DD date is between
+// EARLIEST_HISTORICAL_DATE and today (UTC)
+func validateHistoricalDate(date string, now time.Time) (string, error) {
+	date = strings.TrimSpace(date)
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return "", &PluginError{
+			Code:    ERR_INVALID_DATE,
+			Message: fmt.Sprintf("date %q: expected YYYY-MM-DD", date),
+		}
+	}
+
+	earliest, _ := time.Parse("2006-01-02", EARLIEST_HISTORICAL_DATE)
+	today := now.UTC().Truncate(24 * time.Hour)
+	if day.Before(earliest) || day.After(today) {
+		return "", &PluginError{
+			Code:    ERR_INVALID_DATE,
+			Message: fmt.Sprintf("date %s out of range: must be %s to %s", date, EARLIEST_HISTORICAL_DATE, today.Format("2006-01-02")),
+		}
+	}
+	return date, nil
+}
+
+// normalizeDaySummary shapes a day summary into the daily aggregates
+func normalizeDaySummary(body []byte) (*HistoricalResponse, error) {
+	var summary OpenWeatherDaySummary
+	if err := json.Unmarshal(body, &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
+	}
+
+	temperature := summary.Temperature
+	mean := (temperature.Morning + temperature.Afternoon + temperature.Evening + temperature.Night) / 4
+	return &HistoricalResponse{
+		Lat:       summary.Lat,
+		Lon:       summary.Lon,
+		Date:      summary.Date,
+		UTCOffset: summary.Tz,
+		Unit:      "metric",
+		Temperature: HistoricalTemperature{
+			Min:  temperature.Min,
+			Max:  temperature.Max,
+			Mean: roundTo2(mean),
+		},
+		Precipitation: summary.Precipitation.Total,
+		Wind: HistoricalWind{
+			MaxSpeed:  summary.Wind.Max.Speed,
+			Direction: summary.Wind.Max.Direction,
+		},
+	}, nil
+}
+
+func getHistorical(apiKey string, lat float64, lon float64, date string) (*HistoricalResponse, error) {
+	var query QueryBuilder
+	query.Set("lat", formatCoordinate(lat))
+	query.Set("lon", formatCoordinate(lon))
+	query.Set("date", date)
+	query.Set("appid", apiKey)
+	query.Set("units", "metric")
+	pathWithQuery := query.Path(DAY_SUMMARY_PATH)
+
+	body, err := makeHTTPRequest(pathWithQuery)
+	if err != nil {
+		return nil, classifyOpenWeatherError(err)
+	}
+	return normalizeDaySummary(body)
+}
+
+// checkHistorical returns the daily aggregates for a point on a past date
+func checkHistorical(lat float64, lon float64, date string, keyOverride cm.Option[string]) string {
+	startRequest()
+
+	if err := checkFeature(FEATURE_FORECAST); err != nil {
+		return errorJSON("Export disabled", err)
+	}
+
+	apiKey := callAPIKey(keyOverride)
+	if apiKey == "" {
+		return errorJSON(missingAPIKey())
+	}
+
+	if err := validateCoordinates(lat, lon); err != nil {
+		return errorJSON("Invalid coordinates", err)
+	}
+
+	date, err := validateHistoricalDate(date, time.Now())
+	if err != nil {
+		return errorJSON("Invalid date", err)
+	}
+
+	historical, err := getHistorical(apiKey, lat, lon, date)
+	if err != nil {
+		return errorJSON("Failed to fetch historical weather", err)
+	}
+
+	result, err := marshalJSON(historical)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+	return string(result)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.bytecodealliance.org/cm"
+)
+
+// One Call's day summary for London on 2024-06-01
+const CAPTURED_DAY_SUMMARY = `{"lat":51.5085,"lon":-0.1257,"tz":"+01:00","date":"2024-06-01","units":"metric",
+  "cloud_cover":{"afternoon":75},"humidity":{"afternoon":58},"precipitation":{"total":1.4},
+  "temperature":{"min":10.2,"max":19.8,"afternoon":18.9,"night":11.3,"evening":16.1,"morning":12.6},
+  "pressure":{"afternoon":1014},"wind":{"max":{"speed":6.7,"direction":240}}}`
+
+func TestValidateHistoricalDate(t *testing.T) {
+	now := time.Date(2024, 6, 2, 0, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	tests := []struct {
+		date  string
+		valid bool
+	}{
+		{" 2024-06-01 ", true}, // today in UTC, though tomorrow is already here in CEST
+		{"2024-05-31", true},
+		{EARLIEST_HISTORICAL_DATE, true},
+		{"1979-01-01", false},
+		{"2024-06-02", false},
+		{"01/06/2024", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		date, err := validateHistoricalDate(tt.date, now)
+		if tt.valid {
+			if err != nil || date != strings.TrimSpace(tt.date) {
+				t.Errorf("validateHistoricalDate(%q) = %q, %v, want it accepted", tt.date, date, err)
+			}
+			continue
+		}
+		var pluginErr *PluginError
+		if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_DATE {
+			t.Errorf("validateHistoricalDate(%q) error = %v, want %s", tt.date, err, ERR_INVALID_DATE)
+		}
+	}
+}
+
+func TestNormalizeDaySummary(t *testing.T) {
+	historical, err := normalizeDaySummary([]byte(CAPTURED_DAY_SUMMARY))
+	if err != nil {
+		t.Fatalf("normalizeDaySummary() error = %v", err)
+	}
+	want := HistoricalResponse{
+		Lat: 51.5085, Lon: -0.1257, Date: "2024-06-01", UTCOffset: "+01:00", Unit: "metric",
+		// The mean of the four readings: (12.6 + 18.9 + 16.1 + 11.3) / 4
+		Temperature:   HistoricalTemperature{Min: 10.2, Max: 19.8, Mean: 14.73},
+		Precipitation: 1.4,
+		Wind:          HistoricalWind{MaxSpeed: 6.7, Direction: 240},
+	}
+	if *historical != want {
+		t.Errorf("historical = %+v, want %+v", *historical, want)
+	}
+}
+
+func TestCheckHistorical(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true")
+	fake := &fakeTransport{}
+	fake.respond(DAY_SUMMARY_PATH, fakeResponse{status: 200, body: CAPTURED_DAY_SUMMARY})
+	useTransport(t, fake)
+
+	var historical HistoricalResponse
+	if err := json.Unmarshal([]byte(checkHistorical(51.5085, -0.1257, "2024-06-01", cm.None[string]())), &historical); err != nil {
+		t.Fatal(err)
+	}
+	if historical.Date != "2024-06-01" || historical.Temperature.Max != 19.8 {
+		t.Errorf("historical = %+v, want London's 2024-06-01", historical)
+	}
+	query := sentQuery(t, fake, DAY_SUMMARY_PATH)
+	if query.Get("date") != "2024-06-01" || query.Get("units") != "metric" || query.Get("lat") != "51.5085" {
+		t.Errorf("sent %s, want the day in metric at London", fake.sent[0].PathWithQuery)
+	}
+}
+
+func TestCheckHistoricalRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      []string
+		lat      float64
+		date     string
+		wantCode string
+	}{
+		{"disabled", []string{"OPENWEATHER_API_KEY", "secret"}, 51.5, "2024-06-01", ERR_FEATURE_DISABLED},
+		{"bad coordinates", []string{"OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true"}, 91, "2024-06-01", ERR_INVALID_COORDINATES},
+		{"future date", []string{"OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true"}, 51.5, "2999-01-01", ERR_INVALID_DATE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env...)
+			fake := &fakeTransport{}
+			useTransport(t, fake)
+
+			var resp ErrorResponse
+			if err := json.Unmarshal([]byte(checkHistorical(tt.lat, -0.13, tt.date, cm.None[string]())), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != tt.wantCode || len(fake.sent) != 0 {
+				t.Errorf("code = %q with %d requests, want %s and none sent", resp.Code, len(fake.sent), tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,901 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/my_org/weather/gen/wasi/http/types"
+)
+
+// Machine-readable codes for transport-level failures
+const (
+	ERR_UNSUPPORTED_ENCODING = "UNSUPPORTED_ENCODING"
+	ERR_DNS_ERROR            = "DNS_ERROR"
+	ERR_TLS_ERROR            = "TLS_ERROR"
+	ERR_CONNECTION_REFUSED   = "CONNECTION_REFUSED"
+	ERR_BODY_READ_TIMEOUT    = "BODY_READ_TIMEOUT"
+	ERR_TRUNCATED_BODY       = "TRUNCATED_BODY"
+	ERR_RESPONSE_TIMEOUT     = "RESPONSE_TIMEOUT"
+)
+
+// BODY_READ_TIMEOUT bounds the total time spent reading one response body,
+// so an upstream trickling bytes can't keep the read loop alive forever
+const BODY_READ_TIMEOUT = 30 * time.Second
+
+// DEFAULT_RESPONSE_TIMEOUT bounds the wait for a response to arrive, so a
+// host that never answers fails the call instead of hanging it. The
+// HTTP_TIMEOUT_SECONDS variable overrides it, up to MAX_RESPONSE_TIMEOUT.
+const (
+	DEFAULT_RESPONSE_TIMEOUT = 30 * time.Second
+	MAX_RESPONSE_TIMEOUT     = 5 * time.Minute
+)
+
+// MAX_PREALLOCATE caps how much of an advertised Content-Length is allocated
+// up front, so a bogus header can't force a huge allocation
+const MAX_PREALLOCATE = 8 << 20
+
+// DEFAULT_ACCEPT is sent as Accept unless a request sets its own
+const DEFAULT_ACCEPT = "application/json"
+
+// ACCEPT_ENCODING lists the content codings decodeBody understands
+const ACCEPT_ENCODING = "gzip, deflate, br"
+
+// SECRET_QUERY_PARAMS and SECRET_HEADERS name values that must never be
+// echoed back to the host or logged. SECRET_QUERY_PARAMS also covers form
+// and top-level JSON body fields.
+var SECRET_QUERY_PARAMS = []string{"appid", "apikey", "key", "client_id", "client_secret", "access_token"}
+var SECRET_HEADERS = []string{"Authorization"}
+
+// REQUEST_ID_HEADER carries the correlation ID on every outgoing request
+const REQUEST_ID_HEADER = "X-Request-ID"
+
+// SUPPORTED_METHODS are the HTTP methods the transport can send
+var SUPPORTED_METHODS = []string{"GET", "POST", "HEAD"}
+
+// NO_CONTENT_BODY stands in for the body of a successful response that has
+// none, such as a 204, so callers always get JSON to parse
+const NO_CONTENT_BODY = `{"status":"ok"}`
+
+// requestID is the correlation ID of the export call in progress
+var requestID string
+
+// lastStatus is the status of the most recent upstream response in the
+// export call in progress, or 0 if none has been received
+var lastStatus int
+
+// startRequest resets per-call state for a new export call and picks its
+// correlation ID: REQUEST_ID when the host set it, otherwise a random UUID
+func startRequest() string {
+	lastStatus = 0
+	requestID = getEnvVar("REQUEST_ID")
+	if requestID == "" {
+		requestID = newUUID()
+	}
+	return requestID
+}
+
+// newUUID returns a random version 4 UUID, or "" if no randomness is available
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// logSink receives each HTTP log line when HTTP_LOG is enabled
+var logSink = func(line string) {
+	fmt.Fprintln(os.Stderr, line)
+}
+
+// SetLogSink replaces where HTTP log lines are written (stderr by default)
+func SetLogSink(sink func(line string)) {
+	logSink = sink
+}
+
+// DryRunRequest describes a request that dry-run mode built but did not send
+type DryRunRequest struct {
+	DryRun        bool              `json:"dry_run"`
+	Method        string            `json:"method"`
+	Scheme        string            `json:"scheme"`
+	Authority     string            `json:"authority"`
+	PathWithQuery string            `json:"path_with_query"`
+	Headers       map[string]string `json:"headers"`
+	Body          string            `json:"body,omitempty"`
+}
+
+// DryRunError stops a request before it is sent, carrying its description
+// back up to the export
+type DryRunError struct {
+	Request DryRunRequest
+}
+
+func (e *DryRunError) Error() string {
+	return "dry run: request not sent"
+}
+
+// Request describes an outgoing HTTP request to the upstream API
+type Request struct {
+	// Authority is the host to send to, empty for the plugin's API host (see
+	// Request.host)
+	Authority     string
+	Method        string
+	PathWithQuery string
+	Headers       map[string]string
+	Body          []byte
+	// CompressBody gzips Body before sending and sets Content-Encoding;
+	// only for endpoints known to accept compressed requests
+	CompressBody bool
+}
+
+// Response is a successful HTTP response with its body fully read. HEAD
+// responses have no body.
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Result is the outcome of one request in a batch; either Response or Err is set
+type Result struct {
+	Response *Response
+	Err      error
+}
+
+// Transport is what the HTTP helpers need from the host: handing requests
+// over, waiting on responses, reading bodies, and a clock to measure
+// deadlines against. The TinyGo build drives WASI HTTP (see wasi.go); host
+// tests substitute a fake.
+type Transport interface {
+	// Send hands a request to the host and returns its response without
+	// waiting for it
+	Send(req OutgoingRequest) (PendingResponse, error)
+	// Wait blocks until at least one of pending is ready or the clock
+	// reaches deadline, and returns the positions of the ready ones, none
+	// once the deadline has passed
+	Wait(pending []PendingResponse, deadline time.Duration) []int
+	// Now reads the monotonic clock
+	Now() time.Duration
+	// Sleep blocks for d
+	Sleep(d time.Duration)
+}
+
+// OutgoingRequest is a request as handed to the host, its headers final
+type OutgoingRequest struct {
+	Method        string
+	Authority     string
+	PathWithQuery string
+	Headers       map[string]string
+	Body          []byte
+}
+
+// PendingResponse is the response to a sent request, which may not have
+// arrived yet
+type PendingResponse interface {
+	// Response returns the response once Wait has reported it ready
+	Response() (IncomingResponse, error)
+	// Close releases the response, abandoning the request if it is still
+	// in flight
+	Close()
+}
+
+// IncomingResponse is a response whose status and headers have arrived and
+// whose body is read in chunks
+type IncomingResponse interface {
+	Status() int
+	// Header returns the first value of a response header, or "" if absent
+	Header(name string) string
+	// Read returns the part of the body available now, which may be empty,
+	// or io.EOF once the body has ended
+	Read() ([]byte, error)
+	// WaitReadable blocks until more of the body can be read or the clock
+	// reaches deadline
+	WaitReadable(deadline time.Duration)
+}
+
+// HTTPError is returned when the upstream answers with a non-2xx status,
+// keeping the body so callers can inspect error payloads. RetryAfter is the
+// raw Retry-After header, empty when the upstream didn't send one.
+type HTTPError struct {
+	Status     int
+	Body       []byte
+	RetryAfter string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP error: status code %d, body: %s", e.Status, string(e.Body))
+}
+
+// RequestError is a failed request annotated with what was attempted. URL
+// has its secret query parameters redacted, so the error can be shown to the
+// host or logged as-is.
+type RequestError struct {
+	Method string
+	URL    string
+	Err    error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%v (%s %s)", e.Err, e.Method, e.URL)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// requestURL is the full URL of a request, with secrets redacted
+func requestURL(req Request) string {
+	return "https://" + req.host() + redactQuery(req.PathWithQuery)
+}
+
+// withRequestURL annotates err with the request that failed. A dry run is
+// not a failure, so it is passed through unchanged.
+func withRequestURL(err error, req Request) error {
+	var dryRun *DryRunError
+	if err == nil || errors.As(err, &dryRun) {
+		return err
+	}
+	return &RequestError{Method: strings.ToUpper(req.Method), URL: requestURL(req), Err: err}
+}
+
+// IsSuccess reports whether an HTTP status is 2xx
+func IsSuccess(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// IsRedirect reports whether an HTTP status is 3xx
+func IsRedirect(status int) bool {
+	return status >= 300 && status < 400
+}
+
+// IsClientError reports whether an HTTP status is 4xx
+func IsClientError(status int) bool {
+	return status >= 400 && status < 500
+}
+
+// IsServerError reports whether an HTTP status is 5xx
+func IsServerError(status int) bool {
+	return status >= 500 && status < 600
+}
+
+// outgoingHeaders merges the default headers with the request's own; the
+// request's values win
+func outgoingHeaders(req Request) map[string]string {
+	headers := map[string]string{
+		"User-Agent": "Mozilla/5.0 (compatible; noorle/1.0)",
+	}
+	if requestID != "" {
+		headers[REQUEST_ID_HEADER] = requestID
+	}
+	for key, value := range req.Headers {
+		headers[key] = value
+	}
+	if !hasHeader(req.Headers, "Accept") {
+		headers["Accept"] = DEFAULT_ACCEPT
+	}
+	if !hasHeader(req.Headers, "Accept-Encoding") {
+		headers["Accept-Encoding"] = ACCEPT_ENCODING
+	}
+	if req.CompressBody && len(req.Body) > 0 {
+		headers["Content-Encoding"] = "gzip"
+	}
+	return headers
+}
+
+// compressBody gzips a request body
+func compressBody(body []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// sendRequest builds the outgoing request and hands it to the transport,
+// returning the pending response without waiting for it
+func sendRequest(req Request) (PendingResponse, error) {
+	// Methods are matched case-insensitively, so normalize once up front
+	// rather than at each comparison below
+	req.Method = strings.ToUpper(req.Method)
+
+	// An unknown method is a caller bug; sending it as a GET would hide it
+	if !slices.Contains(SUPPORTED_METHODS, req.Method) {
+		return nil, fmt.Errorf("unsupported HTTP method %q", req.Method)
+	}
+
+	headers := outgoingHeaders(req)
+
+	// In dry-run mode nothing is sent; the caller gets the request back
+	if isDryRun() {
+		return nil, &DryRunError{Request: DryRunRequest{
+			DryRun:        true,
+			Method:        req.Method,
+			Scheme:        "https",
+			Authority:     req.host(),
+			PathWithQuery: redactQuery(req.PathWithQuery),
+			Headers:       redactHeaders(headers),
+			Body:          redactBody(req.Body),
+		}}
+	}
+
+	if isLoggingEnabled() {
+		logSink(fmt.Sprintf("--> %s %s headers=%v body=%s",
+			req.Method, redactQuery(req.PathWithQuery), redactHeaders(headers), redactBody(req.Body)))
+	}
+
+	// Compress after logging so the log shows the readable body
+	body := req.Body
+	if req.CompressBody && len(body) > 0 {
+		compressed, err := compressBody(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress body: %v", err)
+		}
+		body = compressed
+	}
+
+	// Declare the length of POST bodies rather than leaving the host to
+	// stream them chunked, which strict upstreams reject. It is set after
+	// compression so it counts the bytes actually written.
+	if req.Method == "POST" && len(body) > 0 {
+		headers["Content-Length"] = strconv.Itoa(len(body))
+	}
+
+	return transport.Send(OutgoingRequest{
+		Method:        req.Method,
+		Authority:     req.host(),
+		PathWithQuery: req.PathWithQuery,
+		Headers:       headers,
+		Body:          body,
+	})
+}
+
+// classifyErrorCode turns a WASI HTTP error code into an error. DNS, TLS, and
+// refused-connection failures usually mean a misconfigured host, so they get
+// their own codes; anything else keeps a plain message.
+func classifyErrorCode(context string, code types.ErrorCode) error {
+	message := fmt.Sprintf("%s: %v", context, code)
+
+	switch {
+	case code.DNSTimeout():
+		return &PluginError{Code: ERR_DNS_ERROR, Message: message}
+	case code.DNSError() != nil:
+		if rcode := code.DNSError().Rcode.Some(); rcode != nil {
+			message = fmt.Sprintf("%s (rcode %s)", message, *rcode)
+		}
+		return &PluginError{Code: ERR_DNS_ERROR, Message: message}
+	case code.TLSProtocolError(), code.TLSCertificateError():
+		// WASI HTTP has no TLS options, so the host's trust store decides
+		return &PluginError{Code: ERR_TLS_ERROR, Message: message}
+	case code.TLSAlertReceived() != nil:
+		if alert := code.TLSAlertReceived().AlertMessage.Some(); alert != nil {
+			message = fmt.Sprintf("%s (%s)", message, *alert)
+		}
+		return &PluginError{Code: ERR_TLS_ERROR, Message: message}
+	case code.ConnectionRefused():
+		return &PluginError{Code: ERR_CONNECTION_REFUSED, Message: message}
+	}
+
+	return fmt.Errorf("%s", message)
+}
+
+// isDryRun reports whether DRY_RUN asks for requests to be described
+// instead of sent
+func isDryRun() bool {
+	return strings.EqualFold(getEnvVar("DRY_RUN"), "true")
+}
+
+// isLoggingEnabled reports whether HTTP_LOG asks for requests and responses,
+// bodies included, to be written to the log sink
+func isLoggingEnabled() bool {
+	return strings.EqualFold(getEnvVar("HTTP_LOG"), "true")
+}
+
+// redactQuery replaces the values of secret query parameters, keeping the
+// parameter order intact
+func redactQuery(pathWithQuery string) string {
+	path, query, found := strings.Cut(pathWithQuery, "?")
+	if !found {
+		return pathWithQuery
+	}
+
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		for _, secret := range SECRET_QUERY_PARAMS {
+			if strings.EqualFold(key, secret) {
+				params[i] = key + "=REDACTED"
+			}
+		}
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+// redactHeaders returns a copy of headers with secret values replaced
+func redactHeaders(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for key, value := range headers {
+		redacted[key] = value
+		for _, secret := range SECRET_HEADERS {
+			if strings.EqualFold(key, secret) {
+				redacted[key] = "REDACTED"
+			}
+		}
+	}
+	return redacted
+}
+
+// redactBody renders a request or response body with secret fields replaced.
+// JSON objects are redacted by top-level key; anything else is treated as a
+// form body, which shares the query string encoding.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) == nil {
+		for key := range fields {
+			for _, secret := range SECRET_QUERY_PARAMS {
+				if strings.EqualFold(key, secret) {
+					fields[key] = json.RawMessage(`"REDACTED"`)
+				}
+			}
+		}
+		redacted, _ := json.Marshal(fields)
+		return string(redacted)
+	}
+
+	return strings.TrimPrefix(redactQuery("?"+string(body)), "?")
+}
+
+// bodySnippet renders the start of a body for error messages, redacted and
+// truncated so an HTML error page can't swamp the message
+func bodySnippet(body []byte) string {
+	snippet := redactBody(bytes.TrimSpace(body))
+	if len(snippet) > 200 {
+		snippet = strings.ToValidUTF8(snippet[:200], "") + "..."
+	}
+	return snippet
+}
+
+// hasHeader reports whether headers contains name, ignoring case
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeBody reverses the Content-Encoding applied by the upstream so the
+// JSON parser always sees plain bytes. Codings are listed in the order they
+// were applied, so they are undone from last to first.
+func decodeBody(contentEncoding string, body []byte) ([]byte, error) {
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		var reader io.Reader
+		switch coding := strings.ToLower(strings.TrimSpace(codings[i])); coding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			gzipReader, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode gzip body: %v", err)
+			}
+			reader = gzipReader
+		case "deflate":
+			// "deflate" means zlib-wrapped data, but some servers send raw DEFLATE
+			zlibReader, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				reader = flate.NewReader(bytes.NewReader(body))
+			} else {
+				reader = zlibReader
+			}
+		case "br":
+			reader = brotli.NewReader(bytes.NewReader(body))
+		default:
+			return nil, &PluginError{
+				Code:    ERR_UNSUPPORTED_ENCODING,
+				Message: fmt.Sprintf("unsupported Content-Encoding %q", coding),
+			}
+		}
+
+		decoded, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s body: %v", strings.TrimSpace(codings[i]), err)
+		}
+		body = decoded
+	}
+	return body, nil
+}
+
+// readResponse collects a ready response and reads its body to the end,
+// except for HEAD requests, whose responses have none. Non-2xx statuses are
+// reported as *HTTPError.
+func readResponse(pending PendingResponse, method string) (*Response, error) {
+	response, err := pending.Response()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check status
+	status := response.Status()
+	contentEncoding := response.Header("Content-Encoding")
+	contentType := response.Header("Content-Type")
+	retryAfter := response.Header("Retry-After")
+	contentLength, lengthErr := strconv.ParseUint(response.Header("Content-Length"), 10, 64)
+	lastStatus = status
+	hasLength := lengthErr == nil
+
+	// A HEAD response's Content-Length describes the body a GET would get,
+	// so there is nothing to read or check against it
+	if strings.EqualFold(method, "HEAD") {
+		if isLoggingEnabled() {
+			logSink(fmt.Sprintf("<-- %d request_id=%s (HEAD, no body)", status, requestID))
+		}
+		if !IsSuccess(status) {
+			return nil, &HTTPError{Status: status, RetryAfter: retryAfter}
+		}
+		return &Response{Status: status, ContentType: contentType}, nil
+	}
+
+	// Read the body without blocking, waiting on either more data or the
+	// deadline, so a slow upstream can't stall the read past the budget
+	deadline := transport.Now() + BODY_READ_TIMEOUT
+
+	// Content-Length lets the buffer be sized once; without it, grow as needed
+	var body []byte
+	if hasLength {
+		body = make([]byte, 0, min(contentLength, MAX_PREALLOCATE))
+	}
+	for {
+		chunk, err := response.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, chunk...)
+
+		if transport.Now() >= deadline {
+			return nil, &PluginError{
+				Code:    ERR_BODY_READ_TIMEOUT,
+				Message: fmt.Sprintf("response body not fully read within %v (%d bytes received)", BODY_READ_TIMEOUT, len(body)),
+			}
+		}
+		if len(chunk) == 0 {
+			response.WaitReadable(deadline)
+		}
+	}
+
+	// The stream closing early means the connection dropped mid-body; the
+	// parser would otherwise see silently truncated data
+	if hasLength && uint64(len(body)) < contentLength {
+		return nil, &PluginError{
+			Code:    ERR_TRUNCATED_BODY,
+			Message: fmt.Sprintf("response body truncated: got %d of %d bytes", len(body), contentLength),
+		}
+	}
+
+	body, err = decodeBody(contentEncoding, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if isLoggingEnabled() {
+		logSink(fmt.Sprintf("<-- %d request_id=%s body=%s", status, requestID, redactBody(body)))
+	}
+
+	if !IsSuccess(status) {
+		return nil, &HTTPError{Status: status, Body: body, RetryAfter: retryAfter}
+	}
+
+	return &Response{Status: status, ContentType: contentType, Body: body}, nil
+}
+
+// doRequest sends a single request and waits for the full response,
+// retrying transient failures (see retryDelay). Callers that need the status
+// or content type as well as the body use it directly.
+func doRequest(req Request) (*Response, error) {
+	return chain(roundTrip, withRetries)(req)
+}
+
+// RoundTripper sends one request and waits for its full response. The HTTP
+// helpers are built from a base RoundTripper, roundTrip, wrapped in
+// middleware that each add one concern.
+type RoundTripper func(req Request) (*Response, error)
+
+// Middleware wraps a RoundTripper with one concern, such as retries
+type Middleware func(next RoundTripper) RoundTripper
+
+// chain wraps base in middlewares, the first being the outermost, so
+// chain(base, a, b) runs a, then b, then base
+func chain(base RoundTripper, middlewares ...Middleware) RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		base = middlewares[i](base)
+	}
+	return base
+}
+
+// withRequestURLs annotates failures with the redacted URL of the request
+// (see RequestError)
+func withRequestURLs(next RoundTripper) RoundTripper {
+	return func(req Request) (*Response, error) {
+		response, err := next(req)
+		return response, withRequestURL(err, req)
+	}
+}
+
+// withNoContent gives a bodiless success, such as a 204, NO_CONTENT_BODY as
+// its body. HEAD responses are left alone since they never have one.
+func withNoContent(next RoundTripper) RoundTripper {
+	return func(req Request) (*Response, error) {
+		response, err := next(req)
+		if err != nil || strings.EqualFold(req.Method, "HEAD") {
+			return response, err
+		}
+		if response.Status == 204 || len(response.Body) == 0 {
+			response.Body = []byte(NO_CONTENT_BODY)
+		}
+		return response, nil
+	}
+}
+
+// withRetries retries transient failures (see retryDelay), up to
+// HTTP_MAX_ATTEMPTS tries in all
+func withRetries(next RoundTripper) RoundTripper {
+	return func(req Request) (*Response, error) {
+		attempts := maxAttempts()
+		for attempt := 1; ; attempt++ {
+			response, err := next(req)
+			if err == nil || attempt >= attempts || !isRetryable(err) {
+				return response, err
+			}
+			delay, ok := retryDelay(attempt, err)
+			if !ok {
+				return nil, err
+			}
+			if isLoggingEnabled() {
+				logSink(retryLogLine(attempt+1, attempts, delay, err))
+			}
+			transport.Sleep(delay)
+		}
+	}
+}
+
+// retryLogLine describes a retry as key=value pairs for HTTP_LOG: the
+// attempt about to be made, the wait before it, and the failure that
+// triggered it, with its status when it was an HTTP error
+func retryLogLine(attempt int, attempts int, delay time.Duration, err error) string {
+	line := fmt.Sprintf("--- retry request_id=%s attempt=%d max_attempts=%d delay_ms=%d",
+		requestID, attempt, attempts, delay.Milliseconds())
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		line += fmt.Sprintf(" status=%d", httpErr.Status)
+	}
+	return line + fmt.Sprintf(" reason=%q", err.Error())
+}
+
+// roundTrip sends a request once and waits for the full response
+func roundTrip(req Request) (*Response, error) {
+	pending, err := sendRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer pending.Close()
+
+	// Wait for the response or the deadline, whichever comes first.
+	// Closing the pending response on return abandons a request that timed
+	// out.
+	timeout := responseTimeout()
+	if ready := transport.Wait([]PendingResponse{pending}, transport.Now()+timeout); len(ready) == 0 {
+		return nil, responseTimeoutError(timeout)
+	}
+
+	return readResponse(pending, req.Method)
+}
+
+// responseTimeout reads HTTP_TIMEOUT_SECONDS, falling back to the default
+// when unset or invalid
+func responseTimeout() time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(getEnvVar("HTTP_TIMEOUT_SECONDS")))
+	if err != nil || seconds < 1 {
+		return DEFAULT_RESPONSE_TIMEOUT
+	}
+	return min(time.Duration(seconds)*time.Second, MAX_RESPONSE_TIMEOUT)
+}
+
+// responseTimeoutError reports a request that got no response in time
+func responseTimeoutError(timeout time.Duration) error {
+	return &PluginError{
+		Code:    ERR_RESPONSE_TIMEOUT,
+		Message: fmt.Sprintf("no response within %v", timeout),
+	}
+}
+
+// Retry settings for transient upstream failures. Every request the plugins
+// send is safe to repeat, so any method is retried.
+const (
+	DEFAULT_MAX_ATTEMPTS = 3
+	MAX_ATTEMPTS_LIMIT   = 10
+	RETRY_BASE_DELAY     = 500 * time.Millisecond
+	RETRY_MAX_DELAY      = 8 * time.Second
+)
+
+// maxAttempts reads HTTP_MAX_ATTEMPTS (tries per request, including the
+// first), falling back to the default when unset or invalid
+func maxAttempts() int {
+	attempts, err := strconv.Atoi(strings.TrimSpace(getEnvVar("HTTP_MAX_ATTEMPTS")))
+	if err != nil || attempts < 1 {
+		return DEFAULT_MAX_ATTEMPTS
+	}
+	return min(attempts, MAX_ATTEMPTS_LIMIT)
+}
+
+// isRetryable reports whether a failure is likely to clear up on its own:
+// rate limiting (429) and server errors (5xx)
+func isRetryable(err error) bool {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+	return httpErr.Status == 429 || IsServerError(httpErr.Status)
+}
+
+// retryDelay picks the wait before retry number attempt. The backoff doubles
+// from RETRY_BASE_DELAY up to RETRY_MAX_DELAY and is jittered into
+// [delay/2, delay], so instances rate-limited together don't all retry at
+// once. A Retry-After header in seconds raises the wait; ok is false when it
+// asks for longer than RETRY_MAX_DELAY, leaving the wait to the host.
+func retryDelay(attempt int, err error) (delay time.Duration, ok bool) {
+	delay = min(RETRY_BASE_DELAY<<(attempt-1), RETRY_MAX_DELAY)
+	delay = delay/2 + jitter(delay/2)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		if seconds, convErr := strconv.Atoi(strings.TrimSpace(httpErr.RetryAfter)); convErr == nil {
+			wait := time.Duration(seconds) * time.Second
+			if wait > RETRY_MAX_DELAY {
+				return 0, false
+			}
+			delay = max(delay, wait)
+		}
+	}
+	return delay, true
+}
+
+// jitter returns a random duration in [0, limit]. crypto/rand reads from the
+// WASI random interface, so it works inside the component.
+func jitter(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0
+	}
+	return time.Duration(binary.LittleEndian.Uint64(b[:]) % uint64(limit+1))
+}
+
+// DEFAULT_MAX_IN_FLIGHT bounds how many batch requests are outstanding at
+// once, so a large batch doesn't trip the upstream's rate limit. The
+// HTTP_MAX_IN_FLIGHT variable overrides it, up to MAX_IN_FLIGHT_LIMIT.
+const (
+	DEFAULT_MAX_IN_FLIGHT = 5
+	MAX_IN_FLIGHT_LIMIT   = 20
+)
+
+// maxInFlight reads HTTP_MAX_IN_FLIGHT, falling back to the default when
+// unset or invalid
+func maxInFlight() int {
+	limit, err := strconv.Atoi(strings.TrimSpace(getEnvVar("HTTP_MAX_IN_FLIGHT")))
+	if err != nil || limit < 1 {
+		return DEFAULT_MAX_IN_FLIGHT
+	}
+	return min(limit, MAX_IN_FLIGHT_LIMIT)
+}
+
+// DoBatch sends requests in waves of at most maxInFlight, waiting for each
+// wave to finish before starting the next. Within a wave, responses are read
+// as soon as they become ready (see doWave). Each request's outcome then
+// goes through middlewares as a single request's would, so retries and the
+// like apply to batches too; they run one request at a time, after the wave.
+// Results are returned in the same order as requests.
+func DoBatch(requests []Request, middlewares ...Middleware) []Result {
+	results := make([]Result, len(requests))
+	limit := maxInFlight()
+	for start := 0; start < len(requests); start += limit {
+		end := min(start+limit, len(requests))
+		doWave(requests[start:end], results[start:end])
+		if len(middlewares) == 0 {
+			continue
+		}
+		for i := start; i < end; i++ {
+			results[i].Response, results[i].Err = chain(sentInWave(results[i]), middlewares...)(requests[i])
+		}
+	}
+	return results
+}
+
+// sentInWave is the RoundTripper a batched request's middlewares wrap: its
+// first call answers with result, the outcome the request's wave already
+// got, and any later call, such as a retry, sends the request again
+func sentInWave(result Result) RoundTripper {
+	sent := false
+	return func(req Request) (*Response, error) {
+		if sent {
+			return roundTrip(req)
+		}
+		sent = true
+		return result.Response, result.Err
+	}
+}
+
+// doWave issues every request up front, then waits on all of them at once,
+// reading each response as soon as it becomes ready into the matching entry
+// of results. The wave shares one response deadline; requests still pending
+// when it passes fail with RESPONSE_TIMEOUT.
+func doWave(requests []Request, results []Result) {
+	// In-flight requests; the two slices share indexes
+	var pending []PendingResponse
+	var indexes []int
+
+	for i, req := range requests {
+		response, err := sendRequest(req)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		pending = append(pending, response)
+		indexes = append(indexes, i)
+	}
+
+	timeout := responseTimeout()
+	deadline := transport.Now() + timeout
+
+	for len(pending) > 0 {
+		ready := transport.Wait(pending, deadline)
+		if len(ready) == 0 {
+			for pos := range pending {
+				results[indexes[pos]].Err = responseTimeoutError(timeout)
+				pending[pos].Close()
+			}
+			break
+		}
+
+		// Remove from the back so earlier positions stay valid
+		sort.Sort(sort.Reverse(sort.IntSlice(ready)))
+		for _, pos := range ready {
+			response, err := readResponse(pending[pos], requests[indexes[pos]].Method)
+			results[indexes[pos]] = Result{Response: response, Err: err}
+			pending[pos].Close()
+
+			pending = append(pending[:pos], pending[pos+1:]...)
+			indexes = append(indexes[:pos], indexes[pos+1:]...)
+		}
+	}
+}
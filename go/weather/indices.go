@@ -0,0 +1,78 @@
+package main
+
+import "math"
+
+// Regimes for the derived indices, in °F and mph. Wind chill is only defined
+// in the cold with some wind, and the heat index only in the heat.
+const (
+	WIND_CHILL_MAX_TEMPERATURE = 50.0
+	WIND_CHILL_MIN_WIND_SPEED  = 3.0
+	HEAT_INDEX_MIN_TEMPERATURE = 80.0
+)
+
+// windChill is the NWS wind chill for an air temperature in °F and wind
+// speed in mph; ok is false outside its regime
+func windChill(temperature float64, windSpeed float64) (float64, bool) {
+	if temperature > WIND_CHILL_MAX_TEMPERATURE || windSpeed <= WIND_CHILL_MIN_WIND_SPEED {
+		return 0, false
+	}
+	v := math.Pow(windSpeed, 0.16)
+	return 35.74 + 0.6215*temperature - 35.75*v + 0.4275*temperature*v, true
+}
+
+// heatIndex is the NWS heat index for an air temperature in °F and relative
+// humidity in percent: Steadman's simple estimate, replaced by the Rothfusz
+// regression and its humidity adjustments when that estimate reaches 80 °F.
+// ok is false outside its regime.
+func heatIndex(temperature float64, humidity float64) (float64, bool) {
+	if temperature < HEAT_INDEX_MIN_TEMPERATURE {
+		return 0, false
+	}
+	t, rh := temperature, humidity
+
+	simple := 0.5 * (t + 61 + (t-68)*1.2 + rh*0.094)
+	if (simple+t)/2 < 80 {
+		return simple, true
+	}
+
+	index := -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh -
+		0.00683783*t*t - 0.05481717*rh*rh + 0.00122874*t*t*rh +
+		0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+	if rh < 13 && t <= 112 {
+		index -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+	}
+	if rh > 85 && t <= 87 {
+		index += (rh - 85) / 10 * ((87 - t) / 5)
+	}
+	return index, true
+}
+
+// setDerivedIndices adds wind_chill or heat_index to a weather response,
+// whichever its temperature calls for. The formulas work in °F and mph, so
+// metric values are converted in and out. When the input an index needs
+// wasn't reported, the index is left out and a warning says why.
+func (w *WeatherResponse) setDerivedIndices(unit string) {
+	temperature := convertTemperature(w.Temperature, unit, "imperial")
+
+	if temperature <= WIND_CHILL_MAX_TEMPERATURE {
+		if w.WindSpeed == nil {
+			w.Warnings = append(w.Warnings, "wind_chill unavailable: no wind speed reported")
+			return
+		}
+		if chill, ok := windChill(temperature, convertWindSpeed(*w.WindSpeed, unit, "imperial")); ok {
+			value := roundTo2(convertTemperature(chill, "imperial", unit))
+			w.WindChill = &value
+		}
+	}
+
+	if temperature >= HEAT_INDEX_MIN_TEMPERATURE {
+		if w.Humidity == nil {
+			w.Warnings = append(w.Warnings, "heat_index unavailable: no humidity reported")
+			return
+		}
+		if index, ok := heatIndex(temperature, float64(*w.Humidity)); ok {
+			value := roundTo2(convertTemperature(index, "imperial", unit))
+			w.HeatIndex = &value
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	weathercomponent "github.com/my_org/weather/gen/example/weather/weather-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// Checked against the NWS wind chill and heat index charts, which round to
+// whole degrees
+func TestWindChill(t *testing.T) {
+	tests := []struct {
+		temperature, windSpeed, want float64
+	}{
+		{0, 15, -19},
+		{32, 10, 24},
+		{40, 5, 36},
+	}
+	for _, tt := range tests {
+		got, ok := windChill(tt.temperature, tt.windSpeed)
+		if !ok || math.Abs(got-tt.want) > 0.5 {
+			t.Errorf("windChill(%v °F, %v mph) = %.2f, %v, want about %v", tt.temperature, tt.windSpeed, got, ok, tt.want)
+		}
+	}
+
+	// Outside the regime there is no wind chill
+	for _, tt := range [][2]float64{{51, 20}, {30, 3}} {
+		if _, ok := windChill(tt[0], tt[1]); ok {
+			t.Errorf("windChill(%v °F, %v mph) ok, want none", tt[0], tt[1])
+		}
+	}
+}
+
+func TestHeatIndex(t *testing.T) {
+	tests := []struct {
+		temperature, humidity, want float64
+	}{
+		{80, 40, 80},  // Steadman's estimate
+		{90, 70, 106}, // Rothfusz
+		{100, 10, 95}, // low humidity adjustment
+		{85, 90, 102}, // high humidity adjustment
+	}
+	for _, tt := range tests {
+		got, ok := heatIndex(tt.temperature, tt.humidity)
+		if !ok || math.Abs(got-tt.want) > 1 {
+			t.Errorf("heatIndex(%v °F, %v%%) = %.2f, %v, want about %v", tt.temperature, tt.humidity, got, ok, tt.want)
+		}
+	}
+	if _, ok := heatIndex(79, 90); ok {
+		t.Error("heatIndex(79 °F) ok, want none below 80 °F")
+	}
+}
+
+func TestSetDerivedIndices(t *testing.T) {
+	wind, humidity := 8.0, 60
+
+	// Metric values are converted to °F and mph and back
+	cold := WeatherResponse{Temperature: -5, WindSpeed: &wind, Humidity: &humidity}
+	cold.setDerivedIndices("metric")
+	if cold.WindChill == nil || *cold.WindChill != -12.82 || cold.HeatIndex != nil {
+		t.Errorf("cold = chill %v, heat %v, want a -12.82 °C wind chill only", cold.WindChill, cold.HeatIndex)
+	}
+
+	hot := WeatherResponse{Temperature: 35, WindSpeed: &wind, Humidity: &humidity}
+	hot.setDerivedIndices("metric")
+	if hot.HeatIndex == nil || *hot.HeatIndex != 45.05 || hot.WindChill != nil {
+		t.Errorf("hot = chill %v, heat %v, want a 45.05 °C heat index only", hot.WindChill, hot.HeatIndex)
+	}
+
+	// In between, neither applies
+	mild := WeatherResponse{Temperature: 20, WindSpeed: &wind, Humidity: &humidity}
+	mild.setDerivedIndices("metric")
+	if mild.WindChill != nil || mild.HeatIndex != nil || len(mild.Warnings) != 0 {
+		t.Errorf("mild = %+v, want no indices and no warnings", mild)
+	}
+}
+
+func TestSetDerivedIndicesMissingInput(t *testing.T) {
+	cold := WeatherResponse{Temperature: 20, Unit: "imperial"}
+	cold.setDerivedIndices("imperial")
+	if cold.WindChill != nil || len(cold.Warnings) != 1 || !strings.HasPrefix(cold.Warnings[0], "wind_chill unavailable") {
+		t.Errorf("cold = %+v, want a warning about the missing wind speed", cold)
+	}
+
+	hot := WeatherResponse{Temperature: 95, Unit: "imperial"}
+	hot.setDerivedIndices("imperial")
+	if hot.HeatIndex != nil || len(hot.Warnings) != 1 || !strings.HasPrefix(hot.Warnings[0], "heat_index unavailable") {
+		t.Errorf("hot = %+v, want a warning about the missing humidity", hot)
+	}
+}
+
+func TestCheckWeatherDerivedIndices(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	cold := strings.Replace(CAPTURED_CURRENT, `"temp":12.5`, `"temp":-5`, 1)
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: cold}, fakeResponse{status: 200, body: cold})
+	useTransport(t, fake)
+
+	var weather WeatherResponse
+	options := weathercomponent.WeatherOptions{DerivedIndices: cm.Some(true)}
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", options)), &weather); err != nil {
+		t.Fatal(err)
+	}
+	if weather.WindChill == nil {
+		t.Errorf("weather = %+v, want a wind chill", weather)
+	}
+
+	// Without the option the indices are left out
+	data := checkWeather("London", "metric", weathercomponent.WeatherOptions{})
+	if strings.Contains(data, "wind_chill") {
+		t.Errorf("response = %s, want no wind_chill", data)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import "errors"
+
+// KEY_CHECK_CITY_ID is the location validate-key asks for: a city ID,
+// London's, so the request needs no geocoding and can't be ambiguous
+const KEY_CHECK_CITY_ID = "2643743"
+
+// KeyValidation is returned by validate-key. Reason explains a rejected key.
+type KeyValidation struct {
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// checkAPIKey makes one current-weather request, the cheapest call the key
+// grants, and reports whether OpenWeather accepted the key. Failures other
+// than a rejected key are returned as errors, since they say nothing about
+// the key. The request goes straight to doRequest so a rejected key never
+// fails over to another from OPENWEATHER_API_KEYS.
+func checkAPIKey(apiKey string) (*KeyValidation, error) {
+	_, err := doRequest(Request{Method: "GET", PathWithQuery: weatherPath(OPENWEATHER_PATH, apiKey, KEY_CHECK_CITY_ID, "metric")})
+	if err == nil {
+		return &KeyValidation{Valid: true}, nil
+	}
+
+	err = classifyOpenWeatherError(err)
+	var pluginErr *PluginError
+	if errors.As(err, &pluginErr) && pluginErr.Code == ERR_INVALID_API_KEY {
+		return &KeyValidation{Valid: false, Reason: pluginErr.Message}, nil
+	}
+	return nil, err
+}
+
+// validateKey reports whether the configured API key works
+func validateKey() string {
+	startRequest()
+
+	apiKey := openWeatherAPIKey()
+	if apiKey == "" {
+		return errorJSON(missingAPIKey())
+	}
+
+	validation, err := checkAPIKey(apiKey)
+	if err != nil {
+		return errorJSON("Failed to validate API key", err)
+	}
+
+	result, err := marshalJSON(validation)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+	return string(result)
+}
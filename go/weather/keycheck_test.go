@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	useTransport(t, fake)
+
+	if result := validateKey(); result != `{"valid":true}` {
+		t.Errorf("validateKey() = %s, want valid", result)
+	}
+	// The check asks for London by ID, so no geocoding is involved
+	if query := sentQuery(t, fake, OPENWEATHER_PATH); query.Get("id") != KEY_CHECK_CITY_ID || query.Get("appid") != "secret" {
+		t.Errorf("sent %s, want London's city ID with the key", fake.sent[0].PathWithQuery)
+	}
+}
+
+func TestValidateKeyRejected(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "wrong")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{
+		status: 401,
+		body:   `{"cod":401, "message": "Invalid API key. Please see https://openweathermap.org/faq#error401 for more info."}`,
+	})
+	useTransport(t, fake)
+
+	var validation KeyValidation
+	if err := json.Unmarshal([]byte(validateKey()), &validation); err != nil {
+		t.Fatal(err)
+	}
+	if validation.Valid || !strings.Contains(validation.Reason, "Invalid API key") {
+		t.Errorf("validation = %+v, want invalid with OpenWeather's message", validation)
+	}
+}
+
+func TestValidateKeyErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      []string
+		response fakeResponse
+		want     string
+	}{
+		{"missing key", []string{"HTTP_MAX_ATTEMPTS", "1"}, fakeResponse{status: 503}, "OPENWEATHER_API_KEY environment variable not set"},
+		// An outage says nothing about the key, so it is an error
+		{"upstream failure", []string{"OPENWEATHER_API_KEY", "secret", "HTTP_MAX_ATTEMPTS", "1"}, fakeResponse{status: 503}, "Failed to validate API key"},
+		// Neither does a request that never got an answer
+		{"transport error", []string{"OPENWEATHER_API_KEY", "secret", "HTTP_MAX_ATTEMPTS", "1"}, fakeResponse{err: errors.New("connection reset")}, "Failed to validate API key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env...)
+			fake := &fakeTransport{}
+			fake.respond(OPENWEATHER_PATH, tt.response)
+			useTransport(t, fake)
+
+			result := validateKey()
+			if result == `{"valid":true}` {
+				t.Fatalf("validateKey() = %s, want an error", result)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal([]byte(result), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(resp.Error, tt.want) || resp.Code == ERR_INVALID_API_KEY {
+				t.Errorf("response = %+v, want %q", resp, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// keyCursor is the position of the next key to hand out from
+// OPENWEATHER_API_KEYS; it persists across calls for the instance's lifetime
+var keyCursor int
+
+// rotationKeys lists the keys in OPENWEATHER_API_KEYS, trimmed and with
+// blanks and repeats dropped, or nil when it is unset
+func rotationKeys() []string {
+	var keys []string
+	for _, key := range strings.Split(getEnvVar("OPENWEATHER_API_KEYS"), ",") {
+		key = strings.TrimSpace(key)
+		if key != "" && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// nextRotationKey hands out the keys in OPENWEATHER_API_KEYS round-robin,
+// one per call, or returns "" when it is unset
+func nextRotationKey() string {
+	keys := rotationKeys()
+	if len(keys) == 0 {
+		return ""
+	}
+	key := keys[keyCursor%len(keys)]
+	keyCursor = (keyCursor + 1) % len(keys)
+	return key
+}
+
+// isKeyFailure reports whether a request failed because of the key it used:
+// rejected (401) or rate limited (429), either of which another key may not be
+func isKeyFailure(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && (httpErr.Status == 401 || httpErr.Status == 429)
+}
+
+// withKeyFailover resends a request whose OPENWEATHER_API_KEYS key was
+// rejected or rate limited with each of the following keys in turn, until
+// one succeeds or all have been tried
+func withKeyFailover(next RoundTripper) RoundTripper {
+	return func(req Request) (*Response, error) {
+		response, err := next(req)
+		for _, key := range fallbackKeys(req.PathWithQuery) {
+			if err == nil || !isKeyFailure(err) {
+				break
+			}
+			if isLoggingEnabled() {
+				logSink(fmt.Sprintf("--- %v; trying the next API key", err))
+			}
+			retry := req
+			retry.PathWithQuery = withAPIKey(req.PathWithQuery, key)
+			response, err = next(retry)
+		}
+		return response, err
+	}
+}
+
+// fallbackKeys lists the other rotation keys to try after the one in
+// pathWithQuery, in rotation order. Requests using a key from elsewhere,
+// such as a per-call override, get none.
+func fallbackKeys(pathWithQuery string) []string {
+	keys := rotationKeys()
+	if len(keys) < 2 {
+		return nil
+	}
+	_, rawQuery, _ := strings.Cut(pathWithQuery, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil
+	}
+	current := slices.Index(keys, query.Get("appid"))
+	if current < 0 {
+		return nil
+	}
+	return append(slices.Clone(keys[current+1:]), keys[:current]...)
+}
+
+// withAPIKey swaps the appid in pathWithQuery for key. QueryBuilder escapes
+// the key, so the swap matches and writes it escaped too.
+func withAPIKey(pathWithQuery string, key string) string {
+	_, rawQuery, _ := strings.Cut(pathWithQuery, "?")
+	query, _ := url.ParseQuery(rawQuery)
+	return strings.Replace(pathWithQuery, "appid="+url.QueryEscape(query.Get("appid")), "appid="+url.QueryEscape(key), 1)
+}
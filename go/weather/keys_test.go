@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.bytecodealliance.org/cm"
+)
+
+// resetKeyCursor starts the OPENWEATHER_API_KEYS rotation from its first
+// key for the rest of the test
+func resetKeyCursor(t *testing.T) {
+	t.Helper()
+	previous := keyCursor
+	t.Cleanup(func() { keyCursor = previous })
+	keyCursor = 0
+}
+
+func TestRotationKeys(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEYS", " one, ,two,one,three ")
+	if keys := rotationKeys(); strings.Join(keys, ",") != "one,two,three" {
+		t.Errorf("rotationKeys() = %v, want one,two,three", keys)
+	}
+	setEnv(t)
+	if keys := rotationKeys(); keys != nil {
+		t.Errorf("rotationKeys() unset = %v, want nil", keys)
+	}
+}
+
+func TestNextRotationKey(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEYS", "one,two,three")
+	resetKeyCursor(t)
+	var got []string
+	for range 4 {
+		got = append(got, nextRotationKey())
+	}
+	if strings.Join(got, ",") != "one,two,three,one" {
+		t.Errorf("keys handed out = %v, want round-robin", got)
+	}
+
+	// The rotation takes precedence over OPENWEATHER_API_KEY
+	setEnv(t, "OPENWEATHER_API_KEYS", "one,two", "OPENWEATHER_API_KEY", "single")
+	if key := openWeatherAPIKey(); key != "two" {
+		t.Errorf("openWeatherAPIKey() = %q, want the next rotation key", key)
+	}
+}
+
+func TestFallbackKeys(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEYS", "one,two,three")
+	tests := map[string][]string{
+		"/data/2.5/weather?q=London&appid=two":    {"three", "one"},
+		"/data/2.5/weather?q=London&appid=one":    {"two", "three"},
+		"/data/2.5/weather?q=London&appid=tenant": nil,
+		"/data/2.5/weather?q=London":              nil,
+	}
+	for path, want := range tests {
+		if got := fallbackKeys(path); !slices.Equal(got, want) {
+			t.Errorf("fallbackKeys(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	setEnv(t, "OPENWEATHER_API_KEYS", "one")
+	if got := fallbackKeys("/data/2.5/weather?appid=one"); got != nil {
+		t.Errorf("fallbackKeys() with one key = %v, want nil", got)
+	}
+}
+
+func TestWithAPIKey(t *testing.T) {
+	path := "/data/2.5/weather?q=London&appid=one&units=metric"
+	if got, want := withAPIKey(path, "two"), "/data/2.5/weather?q=London&appid=two&units=metric"; got != want {
+		t.Errorf("withAPIKey() = %q, want %q", got, want)
+	}
+}
+
+func TestKeyFailoverBeforeRetry(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEYS", "one,two", "HTTP_MAX_ATTEMPTS", "3")
+	resetKeyCursor(t)
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH,
+		fakeResponse{status: 429},
+		fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	useTransport(t, fake)
+
+	if _, err := makeHTTPRequest(weatherPath(OPENWEATHER_PATH, "one", "London", "metric")); err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+	// The rate-limited key hands over to the free one without a retry wait
+	if len(fake.sent) != 2 || !strings.Contains(fake.sent[1].PathWithQuery, "appid=two") {
+		t.Errorf("sent %d requests, want the second with key two", len(fake.sent))
+	}
+	if len(fake.slept) != 0 {
+		t.Errorf("slept %v, want failover without a wait", fake.slept)
+	}
+}
+
+func TestKeyFailoverExhaustedRetries(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEYS", "one,two", "HTTP_MAX_ATTEMPTS", "2")
+	resetKeyCursor(t)
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH,
+		fakeResponse{status: 429}, fakeResponse{status: 429},
+		fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	useTransport(t, fake)
+
+	if _, err := makeHTTPRequest(weatherPath(OPENWEATHER_PATH, "one", "London", "metric")); err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+	// Only once both keys are rate limited is there a wait, after which the
+	// rotation starts again from the call's key
+	var keys []string
+	for _, req := range fake.sent {
+		keys = append(keys, sentKey(req.PathWithQuery))
+	}
+	if strings.Join(keys, ",") != "one,two,one" || len(fake.slept) != 1 {
+		t.Errorf("sent with keys %v after %d waits, want one,two,one after one", keys, len(fake.slept))
+	}
+}
+
+// sentKey is the appid a request was sent with
+func sentKey(pathWithQuery string) string {
+	_, key, _ := strings.Cut(pathWithQuery, "appid=")
+	key, _, _ = strings.Cut(key, "&")
+	return key
+}
+
+func TestKeyFailoverBatched(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEYS", "one,two", FEATURE_FORECAST, "true")
+	resetKeyCursor(t)
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 429}, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	fake.respond(FORECAST_PATH, fakeResponse{status: 200, body: CAPTURED_FORECAST})
+	useTransport(t, fake)
+
+	var full FullWeatherResponse
+	if err := json.Unmarshal([]byte(checkWeatherFull("London", "metric", FORECAST_DAYS, cm.None[string]())), &full); err != nil {
+		t.Fatal(err)
+	}
+	// The batched current-weather request fails over like a single one
+	if full.Current == nil || full.Forecast == nil || len(full.Errors) != 0 {
+		t.Errorf("response = %+v, want both parts", full)
+	}
+	if last := fake.sent[len(fake.sent)-1]; sentKey(last.PathWithQuery) != "two" || len(fake.slept) != 0 {
+		t.Errorf("last request used key %q after %d waits, want two without a wait", sentKey(last.PathWithQuery), len(fake.slept))
+	}
+}
@@ -1,137 +1,682 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/url"
+	"math"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	weathercomponent "github.com/my_org/weather/gen/example/weather/weather-component"
-	"github.com/my_org/weather/gen/wasi/cli/environment"
-	outgoinghandler "github.com/my_org/weather/gen/wasi/http/outgoing-handler"
-	"github.com/my_org/weather/gen/wasi/http/types"
-	"github.com/my_org/weather/gen/wasi/io/poll"
 	"go.bytecodealliance.org/cm"
 )
 
 const OPENWEATHER_HOST = "api.openweathermap.org"
 const OPENWEATHER_PATH = "/data/2.5/weather"
 
+// Environment variables that enable experimental exports
+const (
+	FEATURE_FORECAST = "ENABLE_FORECAST" // check-weather-full(-days), check-precipitation, check-onecall, check-daily-uv, check-historical
+	FEATURE_ALERTS   = "ENABLE_ALERTS"   // check-alerts
+)
+
+// SUPPORTED_UNITS are the unit systems accepted by the weather exports
+var SUPPORTED_UNITS = []string{"metric", "imperial"}
+
+// Machine-readable codes returned in the "code" field of error responses
+const (
+	ERR_INVALID_API_KEY         = "INVALID_API_KEY"
+	ERR_INVALID_FIELD           = "INVALID_FIELD"
+	ERR_LOCATION_NOT_FOUND      = "LOCATION_NOT_FOUND"
+	ERR_INVALID_COORDINATES     = "INVALID_COORDINATES"
+	ERR_INVALID_UNIT            = "INVALID_UNIT"
+	ERR_FEATURE_DISABLED        = "FEATURE_DISABLED"
+	ERR_RATE_LIMITED            = "RATE_LIMITED"
+	ERR_INVALID_EXCLUDE         = "INVALID_EXCLUDE"
+	ERR_INVALID_UTC_OFFSET      = "INVALID_UTC_OFFSET"
+	ERR_TOO_MANY_LOCATIONS      = "TOO_MANY_LOCATIONS"
+	ERR_INVALID_TEMPERATURE     = "INVALID_TEMPERATURE"
+	ERR_ENVIRONMENT_UNAVAILABLE = "ENVIRONMENT_UNAVAILABLE"
+	ERR_UNEXPECTED_FIELD        = "UNEXPECTED_FIELD"
+	ERR_INVALID_DATE            = "INVALID_DATE"
+	ERR_INVALID_DAYS            = "INVALID_DAYS"
+)
+
+// ErrorResponse is the JSON shape returned by exports when a call fails
+type ErrorResponse struct {
+	Error      string `json:"error"`
+	Code       string `json:"code,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+// PluginError is an error carrying a machine-readable code so hosts can
+// tell failure modes apart without parsing messages
+type PluginError struct {
+	Code    string
+	Message string
+	// RetryAfter is how many seconds to wait before retrying, when known
+	RetryAfter int
+}
+
+func (e *PluginError) Error() string {
+	return e.Message
+}
+
+// OpenWeatherError is the error payload OpenWeather sends with 4xx responses
+type OpenWeatherError struct {
+	Message string `json:"message"`
+}
+
 type WeatherResponse struct {
-	Location             string   `json:"location"`
-	Temperature          float64  `json:"temperature"`
-	FeelsLikeTemperature float64  `json:"feels_like_temperature"`
-	WindSpeed            *float64 `json:"wind_speed,omitempty"`
-	WindDegrees          *int     `json:"wind_degrees,omitempty"`
-	Humidity             *int     `json:"humidity,omitempty"`
-	Unit                 string   `json:"unit"`
-	WeatherConditions    []string `json:"weather_conditions"`
+	Location             string  `json:"location"`
+	Temperature          float64 `json:"temperature"`
+	FeelsLikeTemperature float64 `json:"feels_like_temperature"`
+	// ComfortCategory is only set when the caller asks for it
+	ComfortCategory string `json:"comfort_category,omitempty"`
+	// UVIndex is only set when the caller asks for it and One Call has one
+	UVIndex *float64 `json:"uv_index,omitempty"`
+	// WindChill and HeatIndex are only set when the caller asks for derived
+	// indices and the temperature is in the index's regime
+	WindChill         *float64 `json:"wind_chill,omitempty"`
+	HeatIndex         *float64 `json:"heat_index,omitempty"`
+	WindSpeed         *float64 `json:"wind_speed,omitempty"`
+	WindDegrees       *int     `json:"wind_degrees,omitempty"`
+	Humidity          *int     `json:"humidity,omitempty"`
+	Unit              string   `json:"unit"`
+	WeatherConditions []string `json:"weather_conditions"`
+	// Conditions carries the same conditions with their IDs and icon codes;
+	// weather_conditions stays as plain descriptions for existing hosts
+	Conditions []WeatherCondition `json:"conditions"`
+	// ConditionGroup is the group of the primary (first) condition
+	ConditionGroup string `json:"condition_group,omitempty"`
+	// ObservedAt, Sunrise, and Sunset are RFC 3339 times in the location's
+	// own UTC offset unless the caller picked another
+	ObservedAt string `json:"observed_at,omitempty"`
+	Sunrise    string `json:"sunrise,omitempty"`
+	Sunset     string `json:"sunset,omitempty"`
+	// Warnings lists the optional fields and enrichments left out of an
+	// otherwise complete response, each with the reason
+	Warnings []string `json:"warnings,omitempty"`
+
+	// timestamps keeps the Unix times so they can be rendered at another offset
+	timestamps weatherTimestamps
+	// lat and lon locate the matched city for follow-up One Call requests
+	lat, lon float64
 }
 
+// WeatherCondition is one OpenWeather condition. ID is OpenWeather's
+// condition code (e.g. 800 for clear sky) and Icon its icon code (e.g. "01d"),
+// see https://openweathermap.org/weather-conditions
+type WeatherCondition struct {
+	ID          int    `json:"id"`
+	Main        string `json:"main"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+	// ConditionGroup is omitted for codes outside OpenWeather's documented ranges
+	ConditionGroup string `json:"condition_group,omitempty"`
+}
+
+type weatherTimestamps struct {
+	observedAt int64
+	sunrise    int64
+	sunset     int64
+}
+
+// OpenWeatherResponse keeps optional fields as raw JSON so a single
+// malformed field can be dropped without failing the whole response
 type OpenWeatherResponse struct {
-	Name string `json:"name"`
+	Name  string `json:"name"`
+	Coord struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"coord"`
 	Main struct {
-		Temp      float64 `json:"temp"`
-		FeelsLike float64 `json:"feels_like"`
-		Humidity  int     `json:"humidity"`
+		Temp      float64         `json:"temp"`
+		FeelsLike float64         `json:"feels_like"`
+		Humidity  json.RawMessage `json:"humidity"`
 	} `json:"main"`
-	Wind struct {
-		Speed float64 `json:"speed"`
-		Deg   int     `json:"deg"`
-	} `json:"wind"`
-	Weather []struct {
-		Description string `json:"description"`
-	} `json:"weather"`
+	Wind    json.RawMessage `json:"wind"`
+	Weather json.RawMessage `json:"weather"`
+	Dt      int64           `json:"dt"`
+	// Timezone is the location's shift from UTC in seconds
+	Timezone int `json:"timezone"`
+	Sys      struct {
+		Sunrise int64 `json:"sunrise"`
+		Sunset  int64 `json:"sunset"`
+	} `json:"sys"`
 }
 
-func makeHTTPRequest(pathWithQuery string) ([]byte, error) {
-	// Create headers
-	headers := types.NewFields()
-	userAgent := cm.ToList([]uint8("Mozilla/5.0 (compatible; noorle/1.0"))
-	headers.Append("User-Agent", types.FieldValue(userAgent))
+type OpenWeatherWind struct {
+	Speed json.RawMessage `json:"speed"`
+	Deg   json.RawMessage `json:"deg"`
+}
 
+type OpenWeatherCondition struct {
+	ID          int    `json:"id"`
+	Main        string `json:"main"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+}
 
-	// Create the request
-	request := types.NewOutgoingRequest(headers)
+func getEnvVar(name string) string {
+	envVars := environ()
+	for _, env := range envVars {
+		if env[0] == name {
+			return env[1]
+		}
+	}
+	return ""
+}
 
+// getSecretEnvVar reads a secret from name, or when that is unset from
+// name_B64, base64-decoded, for secret stores that inject encoded values.
+// Whitespace around the decoded value, such as the newline `echo key |
+// base64` encodes, is trimmed.
+func getSecretEnvVar(name string) (string, error) {
+	if value := getEnvVar(name); value != "" {
+		return value, nil
+	}
+	encoded := strings.TrimSpace(getEnvVar(name + "_B64"))
+	if encoded == "" {
+		return "", nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", &PluginError{
+			Code:    ERR_INVALID_API_KEY,
+			Message: fmt.Sprintf("%s_B64 is not valid base64: %v", name, err),
+		}
+	}
+	return strings.TrimSpace(string(decoded)), nil
+}
+
+// REQUIRED_ENV lists the variables the plugin can't run without; keep it in
+// step with the exports' API key checks. Everything else is optional.
+var REQUIRED_ENV = []string{"OPENWEATHER_API_KEY"}
 
-	// Set request properties
-	request.SetMethod(types.MethodGet())
-	request.SetScheme(cm.Some(types.SchemeHTTPS()))
-	request.SetAuthority(cm.Some(OPENWEATHER_HOST))
-	request.SetPathWithQuery(cm.Some(pathWithQuery))
+// environmentAvailable reports whether the host passed the plugin any
+// environment at all. A host that denies environment access hands over an
+// empty list, which would otherwise look like every variable being unset.
+func environmentAvailable() bool {
+	return len(environ()) > 0
+}
 
-	// Send the request
-	futureResponseResult := outgoinghandler.Handle(request, cm.None[types.RequestOptions]())
-	if futureResponseResult.IsErr() {
-		return nil, fmt.Errorf("failed to handle request: %v", futureResponseResult.Err())
+// readAPIKeyFile reads the key from the file named by OPENWEATHER_API_KEY_FILE,
+// for hosts that mount secrets as files. The path must fall inside a
+// directory the host preopened. Surrounding whitespace, such as the trailing
+// newline most secret files end with, is trimmed.
+func readAPIKeyFile() (string, error) {
+	path := strings.TrimSpace(getEnvVar("OPENWEATHER_API_KEY_FILE"))
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
 	}
-	futureResponse := futureResponseResult.OK()
-	defer futureResponse.ResourceDrop()
+	return strings.TrimSpace(string(data)), nil
+}
 
-	// Subscribe to the response
-	pollable := futureResponse.Subscribe()
-	defer pollable.ResourceDrop()
+// openWeatherAPIKey returns the API key for a call: the next key from
+// OPENWEATHER_API_KEYS when several are configured, otherwise the key file,
+// falling back to OPENWEATHER_API_KEY (or OPENWEATHER_API_KEY_B64) when the
+// file is unset, unreadable, or empty
+func openWeatherAPIKey() string {
+	if key := nextRotationKey(); key != "" {
+		return key
+	}
+	if key, err := readAPIKeyFile(); err == nil && key != "" {
+		return key
+	}
+	key, _ := getSecretEnvVar("OPENWEATHER_API_KEY")
+	return key
+}
 
-	// Wait for the response
-	poll.Poll(cm.ToList([]types.Pollable{pollable}))
+// callAPIKey returns the API key for an export call: the call's own api-key
+// when it brings a non-blank one, used for this call only and never stored,
+// otherwise openWeatherAPIKey()
+func callAPIKey(override cm.Option[string]) string {
+	if key := override.Some(); key != nil && strings.TrimSpace(*key) != "" {
+		return strings.TrimSpace(*key)
+	}
+	return openWeatherAPIKey()
+}
 
-	// Get the response
-	optionResult := futureResponse.Get()
-	result := optionResult.Some()
-	if result == nil {
-		return nil, fmt.Errorf("request timed out")
+// missingAPIKey explains an empty API key: either the host withheld the
+// environment entirely, the key file could not be read, the encoded key
+// could not be decoded, or the key is simply not configured
+func missingAPIKey() (string, error) {
+	if !environmentAvailable() {
+		return "Environment unavailable", &PluginError{
+			Code:    ERR_ENVIRONMENT_UNAVAILABLE,
+			Message: "the host provided no environment variables; check that it grants this plugin environment access",
+		}
+	}
+	if _, err := readAPIKeyFile(); err != nil {
+		return "OPENWEATHER_API_KEY_FILE could not be read and OPENWEATHER_API_KEY is not set", err
+	}
+	if _, err := getSecretEnvVar("OPENWEATHER_API_KEY"); err != nil {
+		return "OPENWEATHER_API_KEY_B64 could not be decoded", err
 	}
+	return "OPENWEATHER_API_KEY environment variable not set", nil
+}
 
-	// Handle the response
-	if result.IsErr() {
-		return nil, fmt.Errorf("request failed: %v", result.Err())
+// resolveUnit picks the unit system for a call: a supported explicit unit
+// wins, then WEATHER_DEFAULT_UNIT, then metric
+func resolveUnit(unit string) (string, error) {
+	unit = strings.ToLower(strings.TrimSpace(unit))
+	if slices.Contains(SUPPORTED_UNITS, unit) {
+		return unit, nil
 	}
 
-	responseResult := result.OK()
-	if responseResult.IsErr() {
-		return nil, fmt.Errorf("HTTP error: %v", responseResult.Err())
+	fallback := strings.ToLower(strings.TrimSpace(getEnvVar("WEATHER_DEFAULT_UNIT")))
+	if fallback == "" {
+		return "metric", nil
+	}
+	if !slices.Contains(SUPPORTED_UNITS, fallback) {
+		return "", &PluginError{
+			Code:    ERR_INVALID_UNIT,
+			Message: fmt.Sprintf("WEATHER_DEFAULT_UNIT %q is not supported: use %s", fallback, strings.Join(SUPPORTED_UNITS, " or ")),
+		}
 	}
+	return fallback, nil
+}
 
-	response := responseResult.OK()
-	defer response.ResourceDrop()
+// supportedUnits lists the unit systems resolveUnit accepts, for hosts
+// building a picker
+func supportedUnits() string {
+	result, _ := marshalJSON(SUPPORTED_UNITS)
+	return string(result)
+}
 
-	// Check status
-	status := response.Status()
-	if status < 200 || status >= 300 {
-		return nil, fmt.Errorf("HTTP error: status code %d", status)
+// checkFeature gates an experimental export behind its ENABLE_* variable;
+// experimental features are off unless the variable is "true"
+func checkFeature(flag string) error {
+	if strings.EqualFold(getEnvVar(flag), "true") {
+		return nil
+	}
+	return &PluginError{
+		Code:    ERR_FEATURE_DISABLED,
+		Message: fmt.Sprintf("this export is experimental; set %s=true to enable it", flag),
 	}
+}
+
+// isCityID reports whether location is a pure integer OpenWeather city ID
+func isCityID(location string) bool {
+	_, ok := parseCityID(location)
+	return ok
+}
 
-	// Consume the body
-	bodyResult := response.Consume()
-	if bodyResult.IsErr() {
-		return nil, fmt.Errorf("failed to consume body: %v", bodyResult.Err())
+// parseCityID parses a city ID, ignoring surrounding spaces and leading
+// zeros, so "02643743" and " 2643743" name the same city
+func parseCityID(location string) (int64, bool) {
+	id, err := strconv.ParseUint(strings.TrimSpace(location), 10, 63)
+	return int64(id), err == nil
+}
+
+// classifyOpenWeatherError maps well-known OpenWeather failures to structured
+// errors and passes anything else through unchanged. The URL a RequestError
+// carries is kept on the classified error.
+func classifyOpenWeatherError(err error) error {
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return &RequestError{Method: reqErr.Method, URL: reqErr.URL, Err: classifyOpenWeatherError(reqErr.Err)}
+	}
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return err
+	}
+
+	// Best effort: the upstream message is only used to enrich the error
+	var upstream OpenWeatherError
+	_ = json.Unmarshal(httpErr.Body, &upstream)
+
+	switch httpErr.Status {
+	case 401:
+		message := "OpenWeather rejected OPENWEATHER_API_KEY; check the key is correct and activated"
+		if upstream.Message != "" {
+			message = fmt.Sprintf("%s (%s)", message, upstream.Message)
+		}
+		return &PluginError{Code: ERR_INVALID_API_KEY, Message: message}
+	case 404:
+		// {"cod":"404","message":"city not found"} for misspelled or unknown places
+		message := "OpenWeather could not find the location; check the spelling or use 'City,CountryCode'"
+		if upstream.Message != "" {
+			message = fmt.Sprintf("%s (%s)", message, upstream.Message)
+		}
+		return &PluginError{Code: ERR_LOCATION_NOT_FOUND, Message: message}
+	case 429:
+		// {"cod":429,"message":"Your account is temporary blocked due to exceeding of requests limitation..."}
+		message := "OpenWeather rate limit exceeded; slow down or upgrade the plan"
+		if upstream.Message != "" {
+			message = fmt.Sprintf("%s (%s)", message, upstream.Message)
+		}
+		return &PluginError{Code: ERR_RATE_LIMITED, Message: message, RetryAfter: parseRetryAfter(httpErr.RetryAfter)}
+	}
+
+	return err
+}
+
+// parseRetryAfter converts a Retry-After header, given either as seconds or
+// as an HTTP date, to seconds from now. It returns 0 when absent or invalid.
+func parseRetryAfter(value string) int {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(seconds, 0)
+	}
+	if at, err := time.Parse(time.RFC1123, value); err == nil {
+		return max(int(math.Ceil(time.Until(at).Seconds())), 0)
+	}
+	return 0
+}
+
+// decodeOptional decodes an optional upstream field into target, recording a
+// warning instead of failing when it has an unexpected type. It reports
+// whether target was set.
+func decodeOptional(raw json.RawMessage, target any, field string, warnings *[]string) bool {
+	if len(raw) == 0 || string(raw) == "null" {
+		return false
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		*warnings = append(*warnings, fmt.Sprintf("dropped malformed field %s: %v", field, err))
+		return false
+	}
+	return true
+}
+
+// ClearCachesResponse confirms which caches clear-caches emptied
+type ClearCachesResponse struct {
+	Cleared []string `json:"cleared"`
+}
+
+// clearCaches empties the geocode cache, e.g. after rotating the API key.
+// It is safe to call when the cache is already empty.
+func clearCaches() string {
+	startRequest()
+
+	geocodes.Clear()
+
+	result, _ := marshalJSON(ClearCachesResponse{Cleared: []string{"geocode"}})
+	return string(result)
+}
+
+// MIN_UTC_OFFSET_MINUTES and MAX_UTC_OFFSET_MINUTES bound the offsets in use
+// worldwide, UTC-12:00 to UTC+14:00
+const (
+	MIN_UTC_OFFSET_MINUTES = -720
+	MAX_UTC_OFFSET_MINUTES = 840
+)
+
+// validateUTCOffset rejects offsets no timezone uses
+func validateUTCOffset(minutes int32) error {
+	if minutes < MIN_UTC_OFFSET_MINUTES || minutes > MAX_UTC_OFFSET_MINUTES {
+		return &PluginError{
+			Code:    ERR_INVALID_UTC_OFFSET,
+			Message: fmt.Sprintf("utc-offset-minutes %d out of range: must be %d..%d", minutes, MIN_UTC_OFFSET_MINUTES, MAX_UTC_OFFSET_MINUTES),
+		}
+	}
+	return nil
+}
+
+// comfortThreshold is the lowest feels-like temperature of a comfort category
+type comfortThreshold struct {
+	min      float64
+	category string
+}
+
+// COMFORT_THRESHOLDS lists each unit's categories from warmest to coolest.
+// The imperial thresholds are the metric ones rounded to whole degrees
+// Fahrenheit (18 °C is 64.4 °F), so the two can disagree within a degree.
+var COMFORT_THRESHOLDS = map[string][]comfortThreshold{
+	"metric": {
+		{30, "hot"},
+		{25, "warm"},
+		{18, "comfortable"},
+		{10, "cool"},
+	},
+	"imperial": {
+		{86, "hot"},
+		{77, "warm"},
+		{64, "comfortable"},
+		{50, "cool"},
+	},
+}
+
+// comfortCategory labels a feels-like temperature; anything below the
+// coolest threshold is cold
+func comfortCategory(feelsLike float64, unit string) string {
+	for _, threshold := range COMFORT_THRESHOLDS[unit] {
+		if feelsLike >= threshold.min {
+			return threshold.category
+		}
+	}
+	return "cold"
+}
+
+// Condition groups. OpenWeather numbers its condition codes by group (2xx
+// thunderstorm, 3xx drizzle, and so on), so the groups are stable even when
+// descriptions and new codes within a group change.
+const (
+	CONDITION_THUNDERSTORM = "THUNDERSTORM"
+	CONDITION_DRIZZLE      = "DRIZZLE"
+	CONDITION_RAIN         = "RAIN"
+	CONDITION_SNOW         = "SNOW"
+	CONDITION_ATMOSPHERE   = "ATMOSPHERE"
+	CONDITION_CLEAR        = "CLEAR"
+	CONDITION_CLOUDS       = "CLOUDS"
+	// CONDITION_UNKNOWN is the top-level group of a response OpenWeather
+	// sent without any condition
+	CONDITION_UNKNOWN = "UNKNOWN"
+)
+
+// conditionGroup maps an OpenWeather condition code to its group, or ""
+// for a code outside the documented ranges
+func conditionGroup(id int) string {
+	switch {
+	case id >= 200 && id < 300:
+		return CONDITION_THUNDERSTORM
+	case id >= 300 && id < 400:
+		return CONDITION_DRIZZLE
+	case id >= 500 && id < 600:
+		return CONDITION_RAIN
+	case id >= 600 && id < 700:
+		return CONDITION_SNOW
+	case id >= 700 && id < 800:
+		return CONDITION_ATMOSPHERE
+	case id == 800:
+		return CONDITION_CLEAR
+	case id > 800 && id < 900:
+		return CONDITION_CLOUDS
 	}
-	bodyResource := bodyResult.OK()
-	defer bodyResource.ResourceDrop()
+	return ""
+}
 
-	streamResult := bodyResource.Stream()
-	if streamResult.IsErr() {
-		return nil, fmt.Errorf("failed to get stream: %v", streamResult.Err())
+// validateTemperature rejects NaN and infinite temperatures, which have no
+// JSON form and would otherwise fail serialization with a generic error
+func validateTemperature(field string, value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return &PluginError{
+			Code:    ERR_INVALID_TEMPERATURE,
+			Message: fmt.Sprintf("%s is %v, not a finite number", field, value),
+		}
 	}
-	stream := streamResult.OK()
-	defer stream.ResourceDrop()
+	return nil
+}
 
-	// Read the body
-	var body []byte
-	for {
-		readResult := stream.BlockingRead(65536)
-		if readResult.IsErr() {
-			err := readResult.Err()
-			if err.Closed() {
-				break
+// temperatureDecodeError reports a parse failure caused by a temperature a
+// float64 can't hold: a number out of range such as 1e999, or a quoted
+// "NaN" or "Infinity" from a misbehaving proxy. Other errors give nil.
+func temperatureDecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		return nil
+	}
+	field := typeErr.Field[strings.LastIndex(typeErr.Field, ".")+1:]
+	if field != "temp" && field != "feels_like" {
+		return nil
+	}
+	return &PluginError{
+		Code:    ERR_INVALID_TEMPERATURE,
+		Message: fmt.Sprintf("%s must be a finite number, got %s", typeErr.Field, typeErr.Value),
+	}
+}
+
+// formatTimestamp renders a Unix time as RFC 3339 at a fixed UTC offset.
+// OpenWeather leaves missing times as 0, which renders as "".
+func formatTimestamp(unix int64, offsetSeconds int) string {
+	if unix == 0 {
+		return ""
+	}
+	return time.Unix(unix, 0).In(time.FixedZone("", offsetSeconds)).Format(time.RFC3339)
+}
+
+// setUTCOffset renders every timestamp in the response at offsetSeconds
+func (w *WeatherResponse) setUTCOffset(offsetSeconds int) {
+	w.ObservedAt = formatTimestamp(w.timestamps.observedAt, offsetSeconds)
+	w.Sunrise = formatTimestamp(w.timestamps.sunrise, offsetSeconds)
+	w.Sunset = formatTimestamp(w.timestamps.sunset, offsetSeconds)
+}
+
+// weatherFieldNames lists the JSON keys of WeatherResponse, read from the
+// struct tags so the field mask never drifts from the actual output
+func weatherFieldNames() []string {
+	t := reflect.TypeOf(WeatherResponse{})
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+	return names
+}
+
+// parseFields splits a comma-separated field mask and validates each name.
+// An empty mask selects every field.
+func parseFields(mask string) ([]string, error) {
+	known := weatherFieldNames()
+
+	var fields []string
+	for _, field := range strings.Split(mask, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !slices.Contains(known, field) {
+			return nil, &PluginError{
+				Code:    ERR_INVALID_FIELD,
+				Message: fmt.Sprintf("unknown field %q: valid fields are %s", field, strings.Join(known, ", ")),
 			}
-			return nil, fmt.Errorf("failed to read response body: %v", err)
 		}
-		body = append(body, readResult.OK().Slice()...)
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// maskFields keeps only the requested top-level keys of a JSON object
+func maskFields(data []byte, fields []string) ([]byte, error) {
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	masked := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			masked[field] = value
+		}
+	}
+	return marshalJSON(masked)
+}
+
+// marshalJSON renders an export's response: compact by default, indented
+// when PRETTY_JSON is "true" so output is readable while debugging. With
+// INCLUDE_HTTP_STATUS=true, objects also get the upstream status as _status.
+func marshalJSON(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(getEnvVar("INCLUDE_HTTP_STATUS"), "true") {
+		data = withStatus(data, lastStatus)
+	}
+	if strings.EqualFold(getEnvVar("PRETTY_JSON"), "true") {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err != nil {
+			return nil, err
+		}
+		return indented.Bytes(), nil
+	}
+	return data, nil
+}
+
+// withStatus prepends a _status key to a compact JSON object. Arrays,
+// and calls that never reached the upstream, are left unchanged.
+func withStatus(data []byte, status int) []byte {
+	if status == 0 || len(data) < 2 || data[0] != '{' {
+		return data
+	}
+	annotated := fmt.Appendf(nil, `{"_status":%d`, status)
+	if string(data) != "{}" {
+		annotated = append(annotated, ',')
+	}
+	return append(annotated, data[1:]...)
+}
+
+// errorJSON renders a JSON error response; structured errors also carry
+// their machine-readable code. Dry-run requests are rendered as-is.
+func errorJSON(message string, err error) string {
+	// A dry run surfaces as an error from the HTTP layer, but it is the
+	// expected result rather than a failure
+	var dryRun *DryRunError
+	if errors.As(err, &dryRun) {
+		result, _ := marshalJSON(dryRun.Request)
+		return string(result)
+	}
+
+	result, _ := marshalJSON(newErrorResponse(message, err))
+	return string(result)
+}
+
+// newErrorResponse builds the error shape used by errorJSON, for callers
+// that embed errors inside a larger response
+func newErrorResponse(message string, err error) ErrorResponse {
+	resp := ErrorResponse{Error: message, RequestID: requestID}
+	if err != nil {
+		resp.Error = fmt.Sprintf("%s: %v", message, err)
+		var pluginErr *PluginError
+		if errors.As(err, &pluginErr) {
+			resp.Code = pluginErr.Code
+			resp.RetryAfter = pluginErr.RetryAfter
+		}
 	}
+	return resp
+}
 
-	return body, nil
+// weatherPath builds the request path for a current-weather or forecast
+// lookup; both endpoints take the same location and unit parameters
+func weatherPath(endpoint string, apiKey string, location string, unit string) string {
+	// Numeric locations are OpenWeather city IDs, which are unambiguous;
+	// anything else is a city name
+	var query QueryBuilder
+	if isCityID(location) {
+		query.Set("id", strings.TrimSpace(location))
+	} else {
+		query.Set("q", location)
+	}
+	query.Set("appid", apiKey)
+	query.Set("units", unit)
+	return query.Path(endpoint)
 }
 
 func getWeather(apiKey string, location string, unit string) (*WeatherResponse, error) {
@@ -140,110 +685,209 @@ func getWeather(apiKey string, location string, unit string) (*WeatherResponse,
 		unitQuery = "metric"
 	}
 
-	// URL-encode the location parameter
-	encodedLocation := url.QueryEscape(location)
-
-	// Build the path with query
-	pathWithQuery := fmt.Sprintf(
-		"%s?q=%s&appid=%s&units=%s",
-		OPENWEATHER_PATH, encodedLocation, apiKey, unitQuery,
-	)
-
 	// Make the HTTP request
-	body, err := makeHTTPRequest(pathWithQuery)
+	body, err := makeHTTPRequest(weatherPath(OPENWEATHER_PATH, apiKey, location, unitQuery))
 	if err != nil {
-		return nil, err
+		return nil, classifyOpenWeatherError(err)
 	}
 
+	return parseWeather(body, unitQuery)
+}
+
+// parseWeather builds the plugin's response from a current-weather body
+func parseWeather(body []byte, unit string) (*WeatherResponse, error) {
 	// Parse JSON
 	var weatherData OpenWeatherResponse
-	err = json.Unmarshal(body, &weatherData)
+	err := json.Unmarshal(body, &weatherData)
 	if err != nil {
+		if tempErr := temperatureDecodeError(err); tempErr != nil {
+			return nil, tempErr
+		}
 		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
 	}
+	if err := validateTemperature("temperature", weatherData.Main.Temp); err != nil {
+		return nil, err
+	}
+	if err := validateTemperature("feels_like_temperature", weatherData.Main.FeelsLike); err != nil {
+		return nil, err
+	}
 
 	// Build response
 	weatherResponse := &WeatherResponse{
 		Location:             weatherData.Name,
 		Temperature:          weatherData.Main.Temp,
 		FeelsLikeTemperature: weatherData.Main.FeelsLike,
-		Unit:                 unitQuery,
+		Unit:                 unit,
 		WeatherConditions:    make([]string, 0),
+		Conditions:           make([]WeatherCondition, 0),
+		timestamps: weatherTimestamps{
+			observedAt: weatherData.Dt,
+			sunrise:    weatherData.Sys.Sunrise,
+			sunset:     weatherData.Sys.Sunset,
+		},
+		lat: weatherData.Coord.Lat,
+		lon: weatherData.Coord.Lon,
 	}
+	weatherResponse.setUTCOffset(weatherData.Timezone)
 
-	// Add optional fields
-	if weatherData.Wind.Speed > 0 {
-		windSpeed := weatherData.Wind.Speed
-		weatherResponse.WindSpeed = &windSpeed
+	// With STRICT_JSON set, report fields OpenWeather added since the schema
+	if err := checkStrict(body, &currentWeatherSchema{}, "current weather", &weatherResponse.Warnings); err != nil {
+		return nil, err
 	}
-	if weatherData.Wind.Deg > 0 {
-		windDeg := weatherData.Wind.Deg
-		weatherResponse.WindDegrees = &windDeg
+
+	// Add optional fields; a malformed one is dropped with a warning
+	warnings := &weatherResponse.Warnings
+	var wind OpenWeatherWind
+	if decodeOptional(weatherData.Wind, &wind, "wind", warnings) {
+		var windSpeed float64
+		if decodeOptional(wind.Speed, &windSpeed, "wind.speed", warnings) && windSpeed > 0 {
+			weatherResponse.WindSpeed = &windSpeed
+		}
+		var windDeg int
+		if decodeOptional(wind.Deg, &windDeg, "wind.deg", warnings) && windDeg > 0 {
+			weatherResponse.WindDegrees = &windDeg
+		}
 	}
-	if weatherData.Main.Humidity > 0 {
-		humidity := weatherData.Main.Humidity
+	var humidity int
+	if decodeOptional(weatherData.Main.Humidity, &humidity, "main.humidity", warnings) && humidity > 0 {
 		weatherResponse.Humidity = &humidity
 	}
 
 	// Add weather conditions
-	for _, w := range weatherData.Weather {
-		if w.Description != "" {
-			weatherResponse.WeatherConditions = append(weatherResponse.WeatherConditions, w.Description)
+	var conditions []OpenWeatherCondition
+	decoded := decodeOptional(weatherData.Weather, &conditions, "weather", warnings)
+	if decoded {
+		for _, w := range conditions {
+			if w.Description != "" {
+				weatherResponse.WeatherConditions = append(weatherResponse.WeatherConditions, w.Description)
+			}
+			if w.ID != 0 || w.Description != "" {
+				weatherResponse.Conditions = append(weatherResponse.Conditions, WeatherCondition{
+					ID:             w.ID,
+					Main:           w.Main,
+					Description:    w.Description,
+					Icon:           w.Icon,
+					ConditionGroup: conditionGroup(w.ID),
+				})
+			}
+		}
+		if len(conditions) > 0 {
+			weatherResponse.ConditionGroup = conditionGroup(conditions[0].ID)
+		}
+	}
+	if len(conditions) == 0 {
+		// Flag the degraded response; a malformed array already has a warning
+		weatherResponse.ConditionGroup = CONDITION_UNKNOWN
+		if decoded || len(weatherData.Weather) == 0 || string(weatherData.Weather) == "null" {
+			*warnings = append(*warnings, "condition_group unknown: OpenWeather reported no weather conditions")
 		}
 	}
 
 	return weatherResponse, nil
 }
 
-func init() {
-	weathercomponent.Exports.CheckWeather = func(location string, unit string) string {
-		// Get API key from environment using WASI
-		var apiKey string
-		envVars := environment.GetEnvironment().Slice()
-		for _, env := range envVars {
-			if env[0] == "OPENWEATHER_API_KEY" {
-				apiKey = env[1]
-				break
-			}
+// checkWeather implements both weather exports; the plain export passes
+// zero-value options
+func checkWeather(location string, unit string, options weathercomponent.WeatherOptions) string {
+	startRequest()
+
+	// Get API key from environment using WASI, unless the call brings its own
+	apiKey := callAPIKey(options.APIKey)
+
+	if apiKey == "" {
+		return errorJSON(missingAPIKey())
+	}
+
+	// Validate the field mask before spending a request on it
+	var fields []string
+	if mask := options.Fields.Some(); mask != nil {
+		var err error
+		fields, err = parseFields(*mask)
+		if err != nil {
+			return errorJSON("Invalid options", err)
 		}
+	}
 
-		if apiKey == "" {
-			errorResp := map[string]string{
-				"error": "OPENWEATHER_API_KEY environment variable not set",
-			}
-			result, _ := json.Marshal(errorResp)
-			return string(result)
+	offset := options.UtcOffsetMinutes.Some()
+	if offset != nil {
+		if err := validateUTCOffset(*offset); err != nil {
+			return errorJSON("Invalid options", err)
 		}
+	}
 
-		// Normalize unit parameter
-		unit = strings.ToLower(unit)
-		if unit != "metric" && unit != "imperial" {
-			unit = "metric" // Default to metric if invalid unit provided
+	// The UV index comes from One Call, which is behind the forecast flag
+	wantUV := false
+	if uvIndex := options.UvIndex.Some(); uvIndex != nil && *uvIndex {
+		if err := checkFeature(FEATURE_FORECAST); err != nil {
+			return errorJSON("Invalid options", err)
 		}
+		wantUV = true
+	}
+
+	// Normalize unit parameter, falling back to the configured default
+	unit, err := resolveUnit(unit)
+	if err != nil {
+		return errorJSON("Invalid configuration", err)
+	}
 
-		// Call the weather API
-		weather, err := getWeather(apiKey, location, unit)
+	// City IDs are already unambiguous; a name matching several places
+	// returns the candidates for the host to choose from instead
+	if disambiguate := options.Disambiguate.Some(); disambiguate != nil && *disambiguate && !isCityID(location) {
+		candidates, err := geocodeCandidates(apiKey, location)
 		if err != nil {
-			errorResp := map[string]string{
-				"error": fmt.Sprintf("Failed to fetch weather: %v", err),
+			return errorJSON("Failed to geocode location", err)
+		}
+		if len(candidates) > 1 {
+			result, err := marshalJSON(AmbiguousLocationResponse{
+				Location:   strings.TrimSpace(location),
+				Ambiguous:  true,
+				Candidates: candidates,
+			})
+			if err != nil {
+				return errorJSON("Failed to serialize response", err)
 			}
-			result, _ := json.Marshal(errorResp)
 			return string(result)
 		}
+	}
 
-		// Return result as JSON
-		result, err := json.Marshal(weather)
+	// Call the weather API
+	weather, err := getWeather(apiKey, location, unit)
+	if err != nil {
+		return errorJSON("Failed to fetch weather", err)
+	}
+	if offset != nil {
+		weather.setUTCOffset(int(*offset) * 60)
+	}
+	if comfort := options.ComfortCategory.Some(); comfort != nil && *comfort {
+		weather.ComfortCategory = comfortCategory(weather.FeelsLikeTemperature, unit)
+	}
+	if derived := options.DerivedIndices.Some(); derived != nil && *derived {
+		weather.setDerivedIndices(unit)
+	}
+	if wantUV {
+		// The weather is still worth returning when only the UV lookup fails
+		uv, err := getCurrentUV(apiKey, weather.lat, weather.lon)
 		if err != nil {
-			errorResp := map[string]string{
-				"error": fmt.Sprintf("Failed to serialize response: %v", err),
-			}
-			result, _ = json.Marshal(errorResp)
-			return string(result)
+			weather.Warnings = append(weather.Warnings, fmt.Sprintf("uv_index unavailable: %v", err))
 		}
+		weather.UVIndex = uv
+	}
 
-		return string(result)
+	// Return result as JSON
+	result, err := marshalJSON(weather)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+
+	if len(fields) > 0 {
+		result, err = maskFields(result, fields)
+		if err != nil {
+			return errorJSON("Failed to serialize response", err)
+		}
 	}
+
+	return string(result)
 }
 
 // Required for WASM
-func main() {}
\ No newline at end of file
+func main() {}
@@ -0,0 +1,898 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	weathercomponent "github.com/my_org/weather/gen/example/weather/weather-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// setEnv replaces the environment for the rest of the test with the given
+// name/value pairs
+func setEnv(t *testing.T, pairs ...string) {
+	t.Helper()
+	previous := testEnviron
+	testEnviron = nil
+	for i := 0; i+1 < len(pairs); i += 2 {
+		testEnviron = append(testEnviron, [2]string{pairs[i], pairs[i+1]})
+	}
+	t.Cleanup(func() { testEnviron = previous })
+}
+
+func TestIsCityID(t *testing.T) {
+	tests := []struct {
+		location string
+		want     bool
+	}{
+		{"2643743", true},
+		{" 2643743 ", true},
+		{"London", false},
+		{"London,GB", false},
+		{"-2643743", false},
+		{"02643743", true},
+		{"99999999999999999999", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isCityID(tt.location); got != tt.want {
+			t.Errorf("isCityID(%q) = %v, want %v", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestWeatherPathCityID(t *testing.T) {
+	got := weatherPath(OPENWEATHER_PATH, "secret", " 2643743", "metric")
+	want := "/data/2.5/weather?id=2643743&appid=secret&units=metric"
+	if got != want {
+		t.Errorf("weatherPath = %q, want %q", got, want)
+	}
+}
+
+func TestWeatherPathCityName(t *testing.T) {
+	got := weatherPath(OPENWEATHER_PATH, "secret", "São Paulo", "imperial")
+	want := "/data/2.5/weather?q=S%C3%A3o+Paulo&appid=secret&units=imperial"
+	if got != want {
+		t.Errorf("weatherPath = %q, want %q", got, want)
+	}
+}
+
+func TestClassifyOpenWeatherError401(t *testing.T) {
+	body := []byte(`{"cod":401, "message": "Invalid API key. Please see https://openweathermap.org/faq#error401 for more info."}`)
+	err := classifyOpenWeatherError(&RequestError{
+		Method: "GET",
+		URL:    "https://api.openweathermap.org/data/2.5/weather?q=London&appid=REDACTED",
+		Err:    &HTTPError{Status: 401, Body: body},
+	})
+
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_API_KEY {
+		t.Fatalf("err = %v, want code %s", err, ERR_INVALID_API_KEY)
+	}
+	if !strings.Contains(pluginErr.Message, "Invalid API key") {
+		t.Errorf("message %q does not carry the upstream message", pluginErr.Message)
+	}
+
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) || !strings.Contains(reqErr.URL, "appid=REDACTED") {
+		t.Errorf("err = %v, want the request URL kept", err)
+	}
+
+	resp := newErrorResponse("Failed to fetch weather", err)
+	if resp.Code != ERR_INVALID_API_KEY {
+		t.Errorf("error response code = %q, want %q", resp.Code, ERR_INVALID_API_KEY)
+	}
+}
+
+func TestClassifyOpenWeatherError401WithoutBody(t *testing.T) {
+	err := classifyOpenWeatherError(&HTTPError{Status: 401})
+
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_API_KEY {
+		t.Fatalf("err = %v, want code %s", err, ERR_INVALID_API_KEY)
+	}
+	if strings.Contains(pluginErr.Message, "(") {
+		t.Errorf("message %q has an upstream detail without a body", pluginErr.Message)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := map[string]int{
+		"120":  120,
+		" 30 ": 30,
+		"-5":   0,
+		"":     0,
+		"soon": 0,
+		time.Now().Add(90 * time.Second).UTC().Format(time.RFC1123): 90,
+		"Wed, 21 Oct 2015 07:28:00 GMT":                             0,
+	}
+	for value, want := range tests {
+		// An HTTP date is rounded up from the time left, so allow a second of drift
+		if got := parseRetryAfter(value); got < want-1 || got > want {
+			t.Errorf("parseRetryAfter(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestCheckWeatherRateLimited(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", "HTTP_MAX_ATTEMPTS", "1")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{
+		status:  429,
+		headers: map[string]string{"Retry-After": "60"},
+		body:    `{"cod":429,"message":"Your account is temporary blocked due to exceeding of requests limitation of your subscription type."}`,
+	})
+	useTransport(t, fake)
+
+	var resp ErrorResponse
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", weathercomponent.WeatherOptions{})), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != ERR_RATE_LIMITED || resp.RetryAfter != 60 {
+		t.Errorf("response = %+v, want %s with retry_after 60", resp, ERR_RATE_LIMITED)
+	}
+	if !strings.Contains(resp.Error, "temporary blocked") {
+		t.Errorf("error %q does not carry the upstream message", resp.Error)
+	}
+}
+
+func TestCheckWeatherCityNotFound(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	fake.respond("/data/2.5/weather", fakeResponse{
+		status:  404,
+		headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+		body:    `{"cod":"404","message":"city not found"}`,
+	})
+	useTransport(t, fake)
+
+	var resp ErrorResponse
+	if err := json.Unmarshal([]byte(checkWeather("Lodnon", "metric", weathercomponent.WeatherOptions{})), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != ERR_LOCATION_NOT_FOUND {
+		t.Errorf("code = %q, want %q", resp.Code, ERR_LOCATION_NOT_FOUND)
+	}
+	if !strings.Contains(resp.Error, "city not found") {
+		t.Errorf("error %q does not carry the upstream message", resp.Error)
+	}
+}
+
+func TestCheckWeatherEnvironmentUnavailable(t *testing.T) {
+	setEnv(t)
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	var resp ErrorResponse
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", weathercomponent.WeatherOptions{})), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != ERR_ENVIRONMENT_UNAVAILABLE {
+		t.Errorf("code = %q, want %q", resp.Code, ERR_ENVIRONMENT_UNAVAILABLE)
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none", len(fake.sent))
+	}
+
+	// A set but unrelated variable means the key is simply not configured
+	setEnv(t, "WEATHER_DEFAULT_UNIT", "metric")
+	resp = ErrorResponse{}
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", weathercomponent.WeatherOptions{})), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code == ERR_ENVIRONMENT_UNAVAILABLE || !strings.Contains(resp.Error, "OPENWEATHER_API_KEY") {
+		t.Errorf("resp = %+v, want the missing key named", resp)
+	}
+}
+
+func TestResolveUnit(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		unit    string
+		want    string
+		wantErr bool
+	}{
+		{"no default, empty", "", "", "metric", false},
+		{"no default, invalid", "", "kelvin", "metric", false},
+		{"default for empty", "imperial", "", "imperial", false},
+		{"default for invalid", " Imperial ", "kelvin", "imperial", false},
+		{"explicit wins", "imperial", "metric", "metric", false},
+		{"explicit is normalized", "", " IMPERIAL ", "imperial", false},
+		{"invalid default", "fahrenheit", "", "", true},
+		{"invalid default unused", "fahrenheit", "metric", "metric", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, "WEATHER_DEFAULT_UNIT", tt.env)
+			got, err := resolveUnit(tt.unit)
+			if tt.wantErr {
+				var pluginErr *PluginError
+				if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_UNIT {
+					t.Fatalf("resolveUnit() error = %v, want %s", err, ERR_INVALID_UNIT)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("resolveUnit(%q) = %q, %v, want %q", tt.unit, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := parseFields(" temperature, weather_conditions ,,")
+	if err != nil {
+		t.Fatalf("parseFields() error = %v", err)
+	}
+	if len(fields) != 2 || fields[0] != "temperature" || fields[1] != "weather_conditions" {
+		t.Errorf("parseFields() = %q, want [temperature weather_conditions]", fields)
+	}
+
+	if fields, err := parseFields(""); err != nil || fields != nil {
+		t.Errorf("parseFields(\"\") = %q, %v, want no mask", fields, err)
+	}
+}
+
+func TestParseFieldsUnknown(t *testing.T) {
+	_, err := parseFields("temperature,temp")
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_FIELD {
+		t.Fatalf("parseFields() error = %v, want %s", err, ERR_INVALID_FIELD)
+	}
+	if !strings.Contains(pluginErr.Message, `"temp"`) || !strings.Contains(pluginErr.Message, "feels_like_temperature") {
+		t.Errorf("message = %q, want the bad name and the valid ones", pluginErr.Message)
+	}
+}
+
+func TestMaskFields(t *testing.T) {
+	data := []byte(`{"location":"London","temperature":12.5,"unit":"metric","weather_conditions":["light rain"]}`)
+
+	masked, err := maskFields(data, []string{"temperature", "weather_conditions"})
+	if err != nil {
+		t.Fatalf("maskFields() error = %v", err)
+	}
+	if want := `{"temperature":12.5,"weather_conditions":["light rain"]}`; string(masked) != want {
+		t.Errorf("maskFields() = %s, want %s", masked, want)
+	}
+}
+
+func TestCheckWeatherDryRun(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", "DRY_RUN", "true")
+
+	var request DryRunRequest
+	if err := json.Unmarshal([]byte(checkWeather("São Paulo", "imperial", weathercomponent.WeatherOptions{})), &request); err != nil {
+		t.Fatalf("dry run output is not a request: %v", err)
+	}
+
+	if !request.DryRun || request.Method != "GET" || request.Scheme != "https" || request.Authority != OPENWEATHER_HOST {
+		t.Errorf("request = %+v, want a GET to https://%s", request, OPENWEATHER_HOST)
+	}
+	if want := "/data/2.5/weather?q=S%C3%A3o+Paulo&appid=REDACTED&units=imperial"; request.PathWithQuery != want {
+		t.Errorf("PathWithQuery = %q, want %q", request.PathWithQuery, want)
+	}
+	if request.Headers["Accept"] != DEFAULT_ACCEPT || request.Headers["User-Agent"] == "" {
+		t.Errorf("Headers = %v, want Accept and User-Agent", request.Headers)
+	}
+	if strings.Contains(request.PathWithQuery, "secret") {
+		t.Errorf("PathWithQuery = %q leaks the API key", request.PathWithQuery)
+	}
+}
+
+func TestSupportedUnits(t *testing.T) {
+	setEnv(t)
+	var units []string
+	if err := json.Unmarshal([]byte(supportedUnits()), &units); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(units, ",") != strings.Join(SUPPORTED_UNITS, ",") {
+		t.Errorf("supportedUnits() = %v, want %v", units, SUPPORTED_UNITS)
+	}
+	// Every listed unit is accepted as given
+	for _, unit := range units {
+		if got, err := resolveUnit(unit); err != nil || got != unit {
+			t.Errorf("resolveUnit(%q) = %q, %v", unit, got, err)
+		}
+	}
+}
+
+func TestRequiredEnv(t *testing.T) {
+	// The listed variables alone are enough for a lookup
+	var pairs []string
+	for _, name := range REQUIRED_ENV {
+		pairs = append(pairs, name, "secret")
+	}
+	setEnv(t, pairs...)
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	useTransport(t, fake)
+
+	var weather WeatherResponse
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", weathercomponent.WeatherOptions{})), &weather); err != nil || weather.Location == "" {
+		t.Errorf("checkWeather() with REQUIRED_ENV = %+v, %v, want a result", weather, err)
+	}
+
+	// Each one is needed
+	for _, name := range REQUIRED_ENV {
+		setEnv(t, "WEATHER_DEFAULT_UNIT", "metric")
+		var resp ErrorResponse
+		if err := json.Unmarshal([]byte(checkWeather("London", "metric", weathercomponent.WeatherOptions{})), &resp); err != nil || !strings.Contains(resp.Error, name) {
+			t.Errorf("without %s: %+v, want it named", name, resp)
+		}
+	}
+}
+
+func TestParseWeatherMalformedOptionalFields(t *testing.T) {
+	body := strings.Replace(CAPTURED_CURRENT, `"humidity":81`, `"humidity":"81%"`, 1)
+	body = strings.Replace(body, `"speed":4.6`, `"speed":"fast"`, 1)
+
+	weather, err := parseWeather([]byte(body), "metric")
+	if err != nil {
+		t.Fatalf("parseWeather() error = %v", err)
+	}
+	if weather.Temperature != 12.5 || weather.Location != "London" {
+		t.Errorf("weather = %+v, want the required fields kept", weather)
+	}
+	if weather.Humidity != nil || weather.WindSpeed != nil {
+		t.Errorf("humidity, wind speed = %v, %v, want both dropped", weather.Humidity, weather.WindSpeed)
+	}
+	if weather.WindDegrees == nil || *weather.WindDegrees != 230 {
+		t.Errorf("WindDegrees = %v, want 230 kept beside the malformed speed", weather.WindDegrees)
+	}
+	warnings := strings.Join(weather.Warnings, "\n")
+	if !strings.Contains(warnings, "main.humidity") || !strings.Contains(warnings, "wind.speed") {
+		t.Errorf("warnings = %q, want main.humidity and wind.speed named", weather.Warnings)
+	}
+}
+
+func TestParseWeatherMalformedRequiredField(t *testing.T) {
+	body := strings.Replace(CAPTURED_CURRENT, `"temp":12.5`, `"temp":"warm"`, 1)
+	if _, err := parseWeather([]byte(body), "metric"); err == nil {
+		t.Error("parseWeather() accepted a malformed temperature")
+	}
+}
+
+func TestParseWeatherConditions(t *testing.T) {
+	body := strings.Replace(CAPTURED_CURRENT,
+		`"weather":[{"id":500,"main":"Rain","description":"light rain","icon":"10d"}]`,
+		`"weather":[{"id":500,"main":"Rain","description":"light rain","icon":"10d"},{},{"id":701,"main":"Mist","icon":"50d"}]`, 1)
+	weather, err := parseWeather([]byte(body), "metric")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty entry is skipped; one without a description still has its ID
+	want := []WeatherCondition{
+		{ID: 500, Main: "Rain", Description: "light rain", Icon: "10d", ConditionGroup: "RAIN"},
+		{ID: 701, Main: "Mist", Icon: "50d", ConditionGroup: "ATMOSPHERE"},
+	}
+	if len(weather.Conditions) != len(want) {
+		t.Fatalf("Conditions = %+v, want %+v", weather.Conditions, want)
+	}
+	for i := range want {
+		if weather.Conditions[i] != want[i] {
+			t.Errorf("Conditions[%d] = %+v, want %+v", i, weather.Conditions[i], want[i])
+		}
+	}
+	if strings.Join(weather.WeatherConditions, ",") != "light rain" {
+		t.Errorf("WeatherConditions = %v, want only the described condition", weather.WeatherConditions)
+	}
+}
+
+func TestParseWeatherNoConditions(t *testing.T) {
+	body := strings.Replace(CAPTURED_CURRENT, `"weather":[{"id":500,"main":"Rain","description":"light rain","icon":"10d"}]`, `"weather":[]`, 1)
+	weather, err := parseWeather([]byte(body), "metric")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(weather)
+	if !strings.Contains(string(data), `"conditions":[]`) {
+		t.Errorf("response = %s, want an empty conditions list rather than null", data)
+	}
+}
+
+func TestConditionGroup(t *testing.T) {
+	tests := map[int]string{
+		200: CONDITION_THUNDERSTORM,
+		232: CONDITION_THUNDERSTORM,
+		311: CONDITION_DRIZZLE,
+		500: CONDITION_RAIN,
+		622: CONDITION_SNOW,
+		781: CONDITION_ATMOSPHERE,
+		800: CONDITION_CLEAR,
+		804: CONDITION_CLOUDS,
+		0:   "",
+		450: "",
+		900: "",
+	}
+	for id, want := range tests {
+		if got := conditionGroup(id); got != want {
+			t.Errorf("conditionGroup(%d) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestParseWeatherConditionGroup(t *testing.T) {
+	// The top-level group follows the primary (first) condition
+	body := strings.Replace(CAPTURED_CURRENT,
+		`"weather":[{"id":500,"main":"Rain","description":"light rain","icon":"10d"}]`,
+		`"weather":[{"id":803,"main":"Clouds","description":"broken clouds","icon":"04d"},{"id":999,"main":"Unknown"}]`, 1)
+	weather, err := parseWeather([]byte(body), "metric")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weather.ConditionGroup != CONDITION_CLOUDS || weather.Conditions[1].ConditionGroup != "" {
+		t.Errorf("groups = %q, %+v, want CLOUDS and none for the unknown code", weather.ConditionGroup, weather.Conditions)
+	}
+}
+
+func TestParseWeatherUnknownConditionGroup(t *testing.T) {
+	const original = `"weather":[{"id":500,"main":"Rain","description":"light rain","icon":"10d"}],`
+	for _, tt := range []struct {
+		name    string
+		weather string
+		warning string
+	}{
+		{"empty", `"weather":[],`, "condition_group unknown: OpenWeather reported no weather conditions"},
+		{"null", `"weather":null,`, "condition_group unknown: OpenWeather reported no weather conditions"},
+		{"missing", ``, "condition_group unknown: OpenWeather reported no weather conditions"},
+		// The malformed field's own warning already explains it
+		{"malformed", `"weather":"rain",`, "dropped malformed field weather:"},
+	} {
+		body := strings.Replace(CAPTURED_CURRENT, original, tt.weather, 1)
+		weather, err := parseWeather([]byte(body), "metric")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if weather.ConditionGroup != CONDITION_UNKNOWN {
+			t.Errorf("%s: condition group = %q, want %s", tt.name, weather.ConditionGroup, CONDITION_UNKNOWN)
+		}
+		if len(weather.Warnings) != 1 || !strings.HasPrefix(weather.Warnings[0], tt.warning) {
+			t.Errorf("%s: warnings = %q, want only %q", tt.name, weather.Warnings, tt.warning)
+		}
+	}
+}
+
+func TestParseWeatherNonFiniteTemperature(t *testing.T) {
+	tests := []struct{ old, new string }{
+		{`"temp":12.5`, `"temp":1e999`},
+		{`"temp":12.5`, `"temp":"NaN"`},
+		{`"feels_like":11.9`, `"feels_like":"-Infinity"`},
+	}
+	for _, tt := range tests {
+		body := strings.Replace(CAPTURED_CURRENT, tt.old, tt.new, 1)
+		_, err := parseWeather([]byte(body), "metric")
+		var pluginErr *PluginError
+		if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_TEMPERATURE {
+			t.Errorf("%s: error = %v, want %s", tt.new, err, ERR_INVALID_TEMPERATURE)
+		}
+	}
+}
+
+func TestValidateTemperature(t *testing.T) {
+	if err := validateTemperature("temperature", -89.2); err != nil {
+		t.Errorf("validateTemperature(-89.2) error = %v", err)
+	}
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		var pluginErr *PluginError
+		if err := validateTemperature("temperature", value); !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_TEMPERATURE {
+			t.Errorf("validateTemperature(%v) error = %v, want %s", value, err, ERR_INVALID_TEMPERATURE)
+		}
+	}
+}
+
+func TestMarshalJSONPretty(t *testing.T) {
+	value := map[string]any{"code": "OK", "items": []int{1, 2}}
+
+	setEnv(t)
+	compact, err := marshalJSON(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(compact) != `{"code":"OK","items":[1,2]}` {
+		t.Errorf("compact = %s", compact)
+	}
+
+	setEnv(t, "PRETTY_JSON", "TRUE")
+	pretty, err := marshalJSON(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"code\": \"OK\",\n  \"items\": [\n    1,\n    2\n  ]\n}"
+	if string(pretty) != want {
+		t.Errorf("pretty = %s, want %s", pretty, want)
+	}
+}
+
+func TestCheckFeature(t *testing.T) {
+	setEnv(t, FEATURE_FORECAST, "TRUE", FEATURE_ALERTS, "yes")
+	if err := checkFeature(FEATURE_FORECAST); err != nil {
+		t.Errorf("checkFeature(%s) error = %v, want enabled", FEATURE_FORECAST, err)
+	}
+	// Only "true" enables a feature
+	var pluginErr *PluginError
+	if err := checkFeature(FEATURE_ALERTS); !errors.As(err, &pluginErr) || pluginErr.Code != ERR_FEATURE_DISABLED {
+		t.Errorf("checkFeature(%s) error = %v, want %s", FEATURE_ALERTS, err, ERR_FEATURE_DISABLED)
+	}
+}
+
+func TestExperimentalExportsDisabled(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	exports := map[string]string{
+		"check-weather-full":  checkWeatherFull("London", "metric", FORECAST_DAYS, cm.None[string]()),
+		"check-alerts":        checkAlerts(51.5, -0.13, cm.None[string]()),
+		"check-precipitation": checkPrecipitation(51.5, -0.13, cm.None[string]()),
+	}
+	for name, output := range exports {
+		var resp ErrorResponse
+		if err := json.Unmarshal([]byte(output), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != ERR_FEATURE_DISABLED {
+			t.Errorf("%s = %s, want %s", name, output, ERR_FEATURE_DISABLED)
+		}
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none while disabled", len(fake.sent))
+	}
+}
+
+func TestParseWeatherTimestamps(t *testing.T) {
+	body := strings.Replace(CAPTURED_CURRENT, `"timezone":0`, `"timezone":-18000`, 1)
+	weather, err := parseWeather([]byte(body), "metric")
+	if err != nil {
+		t.Fatalf("parseWeather() error = %v", err)
+	}
+	// Rendered at the location's own offset by default
+	want := [3]string{"2023-11-14T17:13:20-05:00", "2023-11-14T02:15:00-05:00", "2023-11-14T11:15:00-05:00"}
+	if got := [3]string{weather.ObservedAt, weather.Sunrise, weather.Sunset}; got != want {
+		t.Errorf("observed, sunrise, sunset = %v, want %v", got, want)
+	}
+
+	weather.setUTCOffset(330 * 60)
+	if weather.ObservedAt != "2023-11-15T03:43:20+05:30" {
+		t.Errorf("ObservedAt at +05:30 = %q", weather.ObservedAt)
+	}
+	if got := formatTimestamp(0, 0); got != "" {
+		t.Errorf("formatTimestamp(0) = %q, want a missing time left empty", got)
+	}
+}
+
+func TestCheckWeatherUTCOffset(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	useTransport(t, fake)
+
+	options := weathercomponent.WeatherOptions{UtcOffsetMinutes: cm.Some[int32](60)}
+	var weather WeatherResponse
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", options)), &weather); err != nil {
+		t.Fatal(err)
+	}
+	if weather.ObservedAt != "2023-11-14T23:13:20+01:00" || weather.Sunset != "2023-11-14T17:15:00+01:00" {
+		t.Errorf("observed, sunset = %q, %q, want them at +01:00", weather.ObservedAt, weather.Sunset)
+	}
+}
+
+func TestCheckWeatherUTCOffsetOutOfRange(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	for _, minutes := range []int32{MIN_UTC_OFFSET_MINUTES - 1, MAX_UTC_OFFSET_MINUTES + 1} {
+		options := weathercomponent.WeatherOptions{UtcOffsetMinutes: cm.Some(minutes)}
+		var resp ErrorResponse
+		if err := json.Unmarshal([]byte(checkWeather("London", "metric", options)), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != ERR_INVALID_UTC_OFFSET {
+			t.Errorf("offset %d: code = %q, want %s", minutes, resp.Code, ERR_INVALID_UTC_OFFSET)
+		}
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none for an invalid offset", len(fake.sent))
+	}
+}
+
+func TestComfortCategory(t *testing.T) {
+	tests := []struct {
+		feelsLike float64
+		unit      string
+		want      string
+	}{
+		{31, "metric", "hot"},
+		{30, "metric", "hot"},
+		{29.9, "metric", "warm"},
+		{18, "metric", "comfortable"},
+		{11.9, "metric", "cool"},
+		{9.9, "metric", "cold"},
+		{-20, "metric", "cold"},
+		{86, "imperial", "hot"},
+		{77, "imperial", "warm"},
+		{64.4, "imperial", "comfortable"},
+		{50, "imperial", "cool"},
+		{49, "imperial", "cold"},
+	}
+	for _, tt := range tests {
+		if got := comfortCategory(tt.feelsLike, tt.unit); got != tt.want {
+			t.Errorf("comfortCategory(%v, %s) = %q, want %q", tt.feelsLike, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestCheckWeatherComfortCategory(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	useTransport(t, fake)
+
+	// Feels like 11.9 °C
+	options := weathercomponent.WeatherOptions{ComfortCategory: cm.Some(true)}
+	var weather WeatherResponse
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", options)), &weather); err != nil {
+		t.Fatal(err)
+	}
+	if weather.ComfortCategory != "cool" {
+		t.Errorf("ComfortCategory = %q, want cool", weather.ComfortCategory)
+	}
+
+	// Left out of the response unless asked for
+	data := checkWeather("London", "metric", weathercomponent.WeatherOptions{})
+	if strings.Contains(data, "comfort_category") {
+		t.Errorf("response = %s, want no comfort_category", data)
+	}
+}
+
+func TestClearCaches(t *testing.T) {
+	setEnv(t)
+	geocodes.Put("london", GeocodeResponse{Name: "London"})
+	t.Cleanup(geocodes.Clear)
+
+	var resp ClearCachesResponse
+	if err := json.Unmarshal([]byte(clearCaches()), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(resp.Cleared, ",") != "geocode" {
+		t.Errorf("cleared = %v, want geocode", resp.Cleared)
+	}
+	if _, ok := geocodes.Get("london"); ok {
+		t.Error("clearCaches() left london cached")
+	}
+}
+
+func TestWithStatus(t *testing.T) {
+	tests := []struct {
+		data   string
+		status int
+		want   string
+	}{
+		{`{"a":1}`, 200, `{"_status":200,"a":1}`},
+		{`{}`, 404, `{"_status":404}`},
+		{`[1,2]`, 200, `[1,2]`},
+		{`{"a":1}`, 0, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		if got := string(withStatus([]byte(tt.data), tt.status)); got != tt.want {
+			t.Errorf("withStatus(%s, %d) = %s, want %s", tt.data, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestCheckWeatherIncludeHTTPStatus(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", "INCLUDE_HTTP_STATUS", "true")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	useTransport(t, fake)
+
+	var weather struct {
+		Status int `json:"_status"`
+	}
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", weathercomponent.WeatherOptions{})), &weather); err != nil {
+		t.Fatal(err)
+	}
+	if weather.Status != 200 {
+		t.Errorf("_status = %d, want 200", weather.Status)
+	}
+
+	// clearCaches makes no upstream call, so the previous status must not leak
+	if strings.Contains(clearCaches(), "_status") {
+		t.Error("clearCaches() carried over the previous call's _status")
+	}
+}
+
+// KEYED_EXPORTS calls each export that takes an api-key with key
+var KEYED_EXPORTS = map[string]func(key cm.Option[string]){
+	"check-weather-with-options": func(key cm.Option[string]) {
+		checkWeather("London", "metric", weathercomponent.WeatherOptions{APIKey: key})
+	},
+	"check-weather-typed":  func(key cm.Option[string]) { checkWeatherTyped("London", "metric", key) },
+	"check-weather-batch":  func(key cm.Option[string]) { checkWeatherBatch([]string{"London", "Paris"}, "metric", key) },
+	"check-weather-full":   func(key cm.Option[string]) { checkWeatherFull("London", "metric", FORECAST_DAYS, key) },
+	"geocode":              func(key cm.Option[string]) { checkGeocode("London", key) },
+	"check-alerts":         func(key cm.Option[string]) { checkAlerts(51.5, -0.13, key) },
+	"check-precipitation":  func(key cm.Option[string]) { checkPrecipitation(51.5, -0.13, key) },
+	"check-onecall":        func(key cm.Option[string]) { checkOneCall(51.5, -0.13, "metric", "", key) },
+	"forecast-air-quality": func(key cm.Option[string]) { forecastAirQuality(51.5, -0.13, key) },
+	"check-daily-uv":       func(key cm.Option[string]) { checkDailyUV(51.5, -0.13, key) },
+	"check-historical":     func(key cm.Option[string]) { checkHistorical(51.5, -0.13, "2024-06-01", key) },
+}
+
+// sentKeys runs call against a fake transport and returns the appid of each
+// request it sent
+func sentKeys(t *testing.T, call func()) []string {
+	t.Helper()
+	geocodes.Clear()
+	t.Cleanup(geocodes.Clear)
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	call()
+
+	if len(fake.sent) == 0 {
+		t.Fatal("sent no requests")
+	}
+	keys := make([]string, len(fake.sent))
+	for i, req := range fake.sent {
+		keys[i] = sentKey(req.PathWithQuery)
+	}
+	return keys
+}
+
+func TestExportsUseCallAPIKey(t *testing.T) {
+	for name, call := range KEYED_EXPORTS {
+		t.Run(name, func(t *testing.T) {
+			setEnv(t, "OPENWEATHER_API_KEYS", "first,second", FEATURE_FORECAST, "true", FEATURE_ALERTS, "true", "HTTP_MAX_ATTEMPTS", "1")
+			resetKeyCursor(t)
+
+			for _, key := range sentKeys(t, func() { call(cm.Some("tenant")) }) {
+				if key != "tenant" {
+					t.Errorf("appid = %q, want the call's api-key", key)
+				}
+			}
+			if keyCursor != 0 {
+				t.Errorf("keyCursor = %d, want the rotation left alone", keyCursor)
+			}
+		})
+	}
+}
+
+func TestExportsFallBackToConfiguredKey(t *testing.T) {
+	for name, call := range KEYED_EXPORTS {
+		t.Run(name, func(t *testing.T) {
+			setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true", FEATURE_ALERTS, "true", "HTTP_MAX_ATTEMPTS", "1")
+
+			for _, key := range sentKeys(t, func() { call(cm.None[string]()) }) {
+				if key != "secret" {
+					t.Errorf("appid = %q, want OPENWEATHER_API_KEY", key)
+				}
+			}
+		})
+	}
+}
+
+func TestCallAPIKeyBlankOverride(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	if key := callAPIKey(cm.Some("  ")); key != "secret" {
+		t.Errorf("callAPIKey(blank) = %q, want the configured key", key)
+	}
+	if key := callAPIKey(cm.Some(" tenant ")); key != "tenant" {
+		t.Errorf("callAPIKey(\" tenant \") = %q, want it trimmed", key)
+	}
+}
+
+// writeKeyFile writes contents to a key file in a fresh directory and
+// returns its path
+func writeKeyFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "openweather-key")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadAPIKeyFile(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY_FILE", " "+writeKeyFile(t, "file-key\n")+" ")
+	if key, err := readAPIKeyFile(); err != nil || key != "file-key" {
+		t.Errorf("readAPIKeyFile() = %q, %v, want the trimmed file-key", key, err)
+	}
+
+	setEnv(t)
+	if key, err := readAPIKeyFile(); err != nil || key != "" {
+		t.Errorf("readAPIKeyFile() unset = %q, %v, want nothing", key, err)
+	}
+
+	setEnv(t, "OPENWEATHER_API_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := readAPIKeyFile(); err == nil {
+		t.Error("readAPIKeyFile() read a missing file")
+	}
+}
+
+func TestOpenWeatherAPIKeyFile(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{"file wins", writeKeyFile(t, "file-key"), "file-key"},
+		{"empty file", writeKeyFile(t, " \n"), "env-key"},
+		{"unreadable file", filepath.Join(t.TempDir(), "missing"), "env-key"},
+	}
+	for _, tt := range tests {
+		setEnv(t, "OPENWEATHER_API_KEY_FILE", tt.file, "OPENWEATHER_API_KEY", "env-key")
+		if got := openWeatherAPIKey(); got != tt.want {
+			t.Errorf("%s: openWeatherAPIKey() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMissingAPIKeyFileUnreadable(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	message, err := missingAPIKey()
+	if err == nil || !strings.Contains(message, "OPENWEATHER_API_KEY_FILE") {
+		t.Errorf("missingAPIKey() = %q, %v, want the unreadable file reported", message, err)
+	}
+}
+
+func TestGetSecretEnvVar(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		want string
+	}{
+		{"plain", []string{"OPENWEATHER_API_KEY", "plain-key", "OPENWEATHER_API_KEY_B64", "ZW5jb2RlZC1rZXkK"}, "plain-key"},
+		// The trailing newline from `echo encoded-key | base64` is dropped
+		{"encoded", []string{"OPENWEATHER_API_KEY_B64", " ZW5jb2RlZC1rZXkK "}, "encoded-key"},
+		{"unset", nil, ""},
+	}
+	for _, tt := range tests {
+		setEnv(t, tt.env...)
+		if got, err := getSecretEnvVar("OPENWEATHER_API_KEY"); err != nil || got != tt.want {
+			t.Errorf("%s: getSecretEnvVar() = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	setEnv(t, "OPENWEATHER_API_KEY_B64", "not base64!")
+	_, err := getSecretEnvVar("OPENWEATHER_API_KEY")
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_API_KEY || !strings.Contains(err.Error(), "OPENWEATHER_API_KEY_B64") {
+		t.Errorf("error = %v, want %s naming the variable", err, ERR_INVALID_API_KEY)
+	}
+}
+
+func TestCheckWeatherEncodedAPIKey(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY_B64", "ZW5jb2RlZC1rZXkK")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	useTransport(t, fake)
+
+	var weather WeatherResponse
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", weathercomponent.WeatherOptions{})), &weather); err != nil {
+		t.Fatal(err)
+	}
+	if weather.Location != "London" {
+		t.Errorf("weather = %+v, want London", weather)
+	}
+	if got := sentQuery(t, fake, OPENWEATHER_PATH).Get("appid"); got != "encoded-key" {
+		t.Errorf("appid = %q, want the decoded key", got)
+	}
+}
+
+func TestMissingAPIKeyUndecodable(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY_B64", "not base64!")
+	message, err := missingAPIKey()
+	var pluginErr *PluginError
+	if !strings.Contains(message, "OPENWEATHER_API_KEY_B64") || !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_API_KEY {
+		t.Errorf("missingAPIKey() = %q, %v, want the undecodable key reported", message, err)
+	}
+}
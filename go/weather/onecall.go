@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.bytecodealliance.org/cm"
+)
+
+const ONECALL_PATH = "/data/3.0/onecall"
+
+// ONECALL_BLOCKS are the response blocks One Call's exclude parameter accepts
+var ONECALL_BLOCKS = []string{"current", "minutely", "hourly", "daily", "alerts"}
+
+// OneCallResponse is the subset of the One Call 3.0 payload the plugin reads
+type OneCallResponse struct {
+	Lat      float64        `json:"lat"`
+	Lon      float64        `json:"lon"`
+	Timezone string         `json:"timezone"`
+	Alerts   []OneCallAlert `json:"alerts"`
+	Minutely []struct {
+		Dt            int64   `json:"dt"`
+		Precipitation float64 `json:"precipitation"`
+	} `json:"minutely"`
+}
+
+// OneCallBlocksResponse is returned by check-onecall. Blocks are passed
+// through as OpenWeather sent them; excluded or unavailable ones are omitted.
+type OneCallBlocksResponse struct {
+	Lat      float64         `json:"lat"`
+	Lon      float64         `json:"lon"`
+	Timezone string          `json:"timezone"`
+	Unit     string          `json:"unit"`
+	Current  json.RawMessage `json:"current,omitempty"`
+	Minutely json.RawMessage `json:"minutely,omitempty"`
+	Hourly   json.RawMessage `json:"hourly,omitempty"`
+	Daily    json.RawMessage `json:"daily,omitempty"`
+	Alerts   json.RawMessage `json:"alerts,omitempty"`
+}
+
+type OneCallAlert struct {
+	SenderName  string   `json:"sender_name"`
+	Event       string   `json:"event"`
+	Start       int64    `json:"start"`
+	End         int64    `json:"end"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+type AlertsResponse struct {
+	Lat      float64        `json:"lat"`
+	Lon      float64        `json:"lon"`
+	Timezone string         `json:"timezone"`
+	Alerts   []WeatherAlert `json:"alerts"`
+}
+
+type WeatherAlert struct {
+	Sender      string   `json:"sender"`
+	Event       string   `json:"event"`
+	Start       int64    `json:"start"`
+	End         int64    `json:"end"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+type PrecipitationResponse struct {
+	Lat      float64               `json:"lat"`
+	Lon      float64               `json:"lon"`
+	Timezone string                `json:"timezone"`
+	Minutely []MinutePrecipitation `json:"minutely"`
+}
+
+// MinutePrecipitation is the forecast precipitation for one minute, in mm/h
+type MinutePrecipitation struct {
+	Time          int64   `json:"time"`
+	Precipitation float64 `json:"precipitation"`
+}
+
+// validateCoordinates rejects latitudes and longitudes outside the globe.
+// NaN compares false against every bound, so it is checked explicitly.
+func validateCoordinates(lat float64, lon float64) error {
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return &PluginError{
+			Code:    ERR_INVALID_COORDINATES,
+			Message: fmt.Sprintf("coordinates (%g, %g) out of range: lat must be -90..90, lon -180..180", lat, lon),
+		}
+	}
+	return nil
+}
+
+// parseExclude splits a comma-separated exclude list, checking each name
+// against ONECALL_BLOCKS. Names are case-insensitive and repeats are dropped.
+func parseExclude(exclude string) ([]string, error) {
+	var blocks []string
+	for _, name := range strings.Split(exclude, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || slices.Contains(blocks, name) {
+			continue
+		}
+		if !slices.Contains(ONECALL_BLOCKS, name) {
+			return nil, &PluginError{
+				Code:    ERR_INVALID_EXCLUDE,
+				Message: fmt.Sprintf("unknown block %q: valid blocks are %s", name, strings.Join(ONECALL_BLOCKS, ", ")),
+			}
+		}
+		blocks = append(blocks, name)
+	}
+	return blocks, nil
+}
+
+// formatCoordinate renders a coordinate in plain decimal form; %g would
+// switch to exponent notation for values near zero
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// fetchOneCallBody requests the One Call API for a point, skipping the
+// blocks named in exclude, and returns the raw body
+func fetchOneCallBody(apiKey string, lat float64, lon float64, unit string, exclude []string) ([]byte, error) {
+	var query QueryBuilder
+	query.Set("lat", formatCoordinate(lat))
+	query.Set("lon", formatCoordinate(lon))
+	query.Set("appid", apiKey)
+	query.Set("units", unit)
+	if len(exclude) > 0 {
+		query.Set("exclude", strings.Join(exclude, ","))
+	}
+	pathWithQuery := query.Path(ONECALL_PATH)
+
+	body, err := makeHTTPRequest(pathWithQuery)
+	if err != nil {
+		return nil, classifyOpenWeatherError(err)
+	}
+	return body, nil
+}
+
+// fetchOneCall is fetchOneCallBody decoded into the fields the alerts and
+// precipitation exports read
+func fetchOneCall(apiKey string, lat float64, lon float64, unit string, exclude []string) (*OneCallResponse, error) {
+	body, err := fetchOneCallBody(apiKey, lat, lon, unit, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var oneCall OneCallResponse
+	if err := json.Unmarshal(body, &oneCall); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
+	}
+	return &oneCall, nil
+}
+
+func getAlerts(apiKey string, lat float64, lon float64) (*AlertsResponse, error) {
+	// Only the alerts block is needed
+	oneCall, err := fetchOneCall(apiKey, lat, lon, "metric", []string{"current", "minutely", "hourly", "daily"})
+	if err != nil {
+		return nil, err
+	}
+
+	// One Call omits "alerts" entirely when nothing is active
+	alertsResponse := &AlertsResponse{
+		Lat:      oneCall.Lat,
+		Lon:      oneCall.Lon,
+		Timezone: oneCall.Timezone,
+		Alerts:   make([]WeatherAlert, 0, len(oneCall.Alerts)),
+	}
+	for _, alert := range oneCall.Alerts {
+		tags := alert.Tags
+		if tags == nil {
+			tags = make([]string, 0)
+		}
+		alertsResponse.Alerts = append(alertsResponse.Alerts, WeatherAlert{
+			Sender:      alert.SenderName,
+			Event:       alert.Event,
+			Start:       alert.Start,
+			End:         alert.End,
+			Description: alert.Description,
+			Tags:        tags,
+		})
+	}
+
+	return alertsResponse, nil
+}
+
+func checkAlerts(lat float64, lon float64, keyOverride cm.Option[string]) string {
+	startRequest()
+
+	if err := checkFeature(FEATURE_ALERTS); err != nil {
+		return errorJSON("Export disabled", err)
+	}
+
+	apiKey := callAPIKey(keyOverride)
+	if apiKey == "" {
+		return errorJSON(missingAPIKey())
+	}
+
+	if err := validateCoordinates(lat, lon); err != nil {
+		return errorJSON("Invalid coordinates", err)
+	}
+
+	alerts, err := getAlerts(apiKey, lat, lon)
+	if err != nil {
+		return errorJSON("Failed to fetch alerts", err)
+	}
+
+	result, err := marshalJSON(alerts)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+	return string(result)
+}
+
+func getPrecipitation(apiKey string, lat float64, lon float64) (*PrecipitationResponse, error) {
+	// Only the minutely block is needed
+	oneCall, err := fetchOneCall(apiKey, lat, lon, "metric", []string{"current", "hourly", "daily", "alerts"})
+	if err != nil {
+		return nil, err
+	}
+
+	// One Call omits "minutely" where minute forecasts aren't available
+	precipitation := &PrecipitationResponse{
+		Lat:      oneCall.Lat,
+		Lon:      oneCall.Lon,
+		Timezone: oneCall.Timezone,
+		Minutely: make([]MinutePrecipitation, 0, len(oneCall.Minutely)),
+	}
+	for _, minute := range oneCall.Minutely {
+		precipitation.Minutely = append(precipitation.Minutely, MinutePrecipitation{
+			Time:          minute.Dt,
+			Precipitation: minute.Precipitation,
+		})
+	}
+
+	return precipitation, nil
+}
+
+func checkPrecipitation(lat float64, lon float64, keyOverride cm.Option[string]) string {
+	startRequest()
+
+	if err := checkFeature(FEATURE_FORECAST); err != nil {
+		return errorJSON("Export disabled", err)
+	}
+
+	apiKey := callAPIKey(keyOverride)
+	if apiKey == "" {
+		return errorJSON(missingAPIKey())
+	}
+
+	if err := validateCoordinates(lat, lon); err != nil {
+		return errorJSON("Invalid coordinates", err)
+	}
+
+	precipitation, err := getPrecipitation(apiKey, lat, lon)
+	if err != nil {
+		return errorJSON("Failed to fetch precipitation", err)
+	}
+
+	result, err := marshalJSON(precipitation)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+	return string(result)
+}
+
+// checkOneCall returns the One Call blocks the caller didn't exclude
+func checkOneCall(lat float64, lon float64, unit string, exclude string, keyOverride cm.Option[string]) string {
+	startRequest()
+
+	if err := checkFeature(FEATURE_FORECAST); err != nil {
+		return errorJSON("Export disabled", err)
+	}
+
+	apiKey := callAPIKey(keyOverride)
+	if apiKey == "" {
+		return errorJSON(missingAPIKey())
+	}
+
+	if err := validateCoordinates(lat, lon); err != nil {
+		return errorJSON("Invalid coordinates", err)
+	}
+
+	unit, err := resolveUnit(unit)
+	if err != nil {
+		return errorJSON("Invalid configuration", err)
+	}
+
+	blocks, err := parseExclude(exclude)
+	if err != nil {
+		return errorJSON("Invalid exclude", err)
+	}
+
+	body, err := fetchOneCallBody(apiKey, lat, lon, unit, blocks)
+	if err != nil {
+		return errorJSON("Failed to fetch One Call data", err)
+	}
+
+	response := OneCallBlocksResponse{Unit: unit}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return errorJSON("Failed to fetch One Call data", fmt.Errorf("failed to parse JSON response: %v", err))
+	}
+
+	result, err := marshalJSON(response)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+	return string(result)
+}
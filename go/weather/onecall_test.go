@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"go.bytecodealliance.org/cm"
+)
+
+func TestValidateCoordinates(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		valid    bool
+	}{
+		{"london", 51.5074, -0.1278, true},
+		{"poles and antimeridian", -90, 180, true},
+		{"lat too high", 90.1, 0, false},
+		{"lon too low", 0, -180.5, false},
+		{"NaN lat", math.NaN(), 0, false},
+		{"NaN lon", 0, math.NaN(), false},
+		{"+Inf lat", math.Inf(1), 0, false},
+		{"-Inf lon", 0, math.Inf(-1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCoordinates(tt.lat, tt.lon)
+			if tt.valid {
+				if err != nil {
+					t.Errorf("validateCoordinates() error = %v", err)
+				}
+				return
+			}
+			var pluginErr *PluginError
+			if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_COORDINATES {
+				t.Errorf("validateCoordinates() error = %v, want %s", err, ERR_INVALID_COORDINATES)
+			}
+		})
+	}
+}
+
+// A One Call response trimmed to the alerts block, as requested by getAlerts
+const CAPTURED_ONECALL_ALERT = `{
+  "lat": 33.44, "lon": -94.04, "timezone": "America/Chicago", "timezone_offset": -18000,
+  "alerts": [{
+    "sender_name": "NWS Shreveport (Arkansas, Louisiana, Oklahoma and Texas)",
+    "event": "Heat Advisory",
+    "start": 1684952747,
+    "end": 1684988747,
+    "description": "...HEAT ADVISORY REMAINS IN EFFECT FROM 1 PM THIS AFTERNOON TO 8 PM CDT THIS EVENING...",
+    "tags": ["Extreme temperature value"]
+  }, {
+    "sender_name": "NWS Shreveport",
+    "event": "Air Quality Alert",
+    "start": 1684952747,
+    "end": 1685030400,
+    "description": "Ozone levels may be unhealthy for sensitive groups."
+  }]
+}`
+
+func TestGetAlerts(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond(ONECALL_PATH, fakeResponse{status: 200, body: CAPTURED_ONECALL_ALERT})
+	useTransport(t, fake)
+
+	alerts, err := getAlerts("secret", 33.44, -94.04)
+	if err != nil {
+		t.Fatalf("getAlerts() error = %v", err)
+	}
+	if alerts.Timezone != "America/Chicago" || len(alerts.Alerts) != 2 {
+		t.Fatalf("alerts = %+v, want two alerts in America/Chicago", alerts)
+	}
+	alert := alerts.Alerts[0]
+	if alert.Sender != "NWS Shreveport (Arkansas, Louisiana, Oklahoma and Texas)" || alert.Event != "Heat Advisory" ||
+		alert.Start != 1684952747 || alert.End != 1684988747 || len(alert.Tags) != 1 {
+		t.Errorf("alerts[0] = %+v", alert)
+	}
+	// Missing tags render as [] rather than null
+	if alerts.Alerts[1].Tags == nil {
+		t.Error("alerts[1].Tags = nil, want an empty list")
+	}
+
+	// Only the alerts block is requested
+	if want := "exclude=current%2Cminutely%2Chourly%2Cdaily"; !strings.Contains(fake.sent[0].PathWithQuery, want) {
+		t.Errorf("PathWithQuery = %q, want %q", fake.sent[0].PathWithQuery, want)
+	}
+}
+
+func TestGetAlertsNoneActive(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond(ONECALL_PATH, fakeResponse{status: 200, body: `{"lat":51.51,"lon":-0.13,"timezone":"Europe/London","timezone_offset":3600}`})
+	useTransport(t, fake)
+
+	alerts, err := getAlerts("secret", 51.51, -0.13)
+	if err != nil {
+		t.Fatalf("getAlerts() error = %v", err)
+	}
+	data, _ := json.Marshal(alerts)
+	if !strings.Contains(string(data), `"alerts":[]`) {
+		t.Errorf("getAlerts() = %s, want an empty alerts array", data)
+	}
+}
+
+// A One Call response trimmed to the minutely block and a few of its minutes
+const CAPTURED_ONECALL_MINUTELY = `{
+  "lat": 52.37, "lon": 4.89, "timezone": "Europe/Amsterdam", "timezone_offset": 3600,
+  "minutely": [
+    {"dt": 1700000040, "precipitation": 0},
+    {"dt": 1700000100, "precipitation": 0.21},
+    {"dt": 1700000160, "precipitation": 1.08}
+  ]
+}`
+
+func TestGetPrecipitation(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond(ONECALL_PATH, fakeResponse{status: 200, body: CAPTURED_ONECALL_MINUTELY})
+	useTransport(t, fake)
+
+	precipitation, err := getPrecipitation("secret", 52.37, 4.89)
+	if err != nil {
+		t.Fatalf("getPrecipitation() error = %v", err)
+	}
+	want := []MinutePrecipitation{{1700000040, 0}, {1700000100, 0.21}, {1700000160, 1.08}}
+	if len(precipitation.Minutely) != len(want) {
+		t.Fatalf("minutely = %+v, want %+v", precipitation.Minutely, want)
+	}
+	for i := range want {
+		if precipitation.Minutely[i] != want[i] {
+			t.Errorf("minutely[%d] = %+v, want %+v", i, precipitation.Minutely[i], want[i])
+		}
+	}
+	if precipitation.Timezone != "Europe/Amsterdam" {
+		t.Errorf("Timezone = %q", precipitation.Timezone)
+	}
+	if want := "exclude=current%2Chourly%2Cdaily%2Calerts"; !strings.Contains(fake.sent[0].PathWithQuery, want) {
+		t.Errorf("PathWithQuery = %q, want %q", fake.sent[0].PathWithQuery, want)
+	}
+}
+
+func TestGetPrecipitationUnavailable(t *testing.T) {
+	fake := &fakeTransport{}
+	fake.respond(ONECALL_PATH, fakeResponse{status: 200, body: `{"lat":-33.87,"lon":151.21,"timezone":"Australia/Sydney","timezone_offset":39600}`})
+	useTransport(t, fake)
+
+	precipitation, err := getPrecipitation("secret", -33.87, 151.21)
+	if err != nil {
+		t.Fatalf("getPrecipitation() error = %v", err)
+	}
+	data, _ := json.Marshal(precipitation)
+	if !strings.Contains(string(data), `"minutely":[]`) {
+		t.Errorf("getPrecipitation() = %s, want an empty minutely array", data)
+	}
+}
+
+func TestParseExclude(t *testing.T) {
+	tests := []struct {
+		exclude string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"minutely,hourly", "minutely,hourly", false},
+		{" Daily , ALERTS,,daily ", "daily,alerts", false},
+		{"hourly,weekly", "", true},
+	}
+	for _, tt := range tests {
+		blocks, err := parseExclude(tt.exclude)
+		if tt.wantErr {
+			var pluginErr *PluginError
+			if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_INVALID_EXCLUDE {
+				t.Errorf("parseExclude(%q) error = %v, want %s", tt.exclude, err, ERR_INVALID_EXCLUDE)
+			}
+			continue
+		}
+		if err != nil || strings.Join(blocks, ",") != tt.want {
+			t.Errorf("parseExclude(%q) = %v, %v, want %s", tt.exclude, blocks, err, tt.want)
+		}
+	}
+}
+
+func TestCheckOneCall(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true")
+	fake := &fakeTransport{}
+	fake.respond(ONECALL_PATH, fakeResponse{status: 200, body: CAPTURED_ONECALL_MINUTELY})
+	useTransport(t, fake)
+
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(checkOneCall(52.37, 4.89, "metric", "current,Hourly,daily,alerts", cm.None[string]())), &response); err != nil {
+		t.Fatal(err)
+	}
+	if string(response["unit"]) != `"metric"` || string(response["timezone"]) != `"Europe/Amsterdam"` {
+		t.Errorf("response = %v, want metric for Europe/Amsterdam", response)
+	}
+	// The minutely block is passed through untouched; excluded blocks are omitted
+	var minutely []MinutePrecipitation
+	if err := json.Unmarshal(response["minutely"], &minutely); err != nil || len(minutely) != 3 {
+		t.Errorf("minutely = %s, want the three captured minutes", response["minutely"])
+	}
+	for _, block := range []string{"current", "hourly", "daily", "alerts"} {
+		if _, ok := response[block]; ok {
+			t.Errorf("response has %s, want it omitted", block)
+		}
+	}
+	if want := "exclude=current%2Chourly%2Cdaily%2Calerts"; !strings.Contains(fake.sent[0].PathWithQuery, want) {
+		t.Errorf("PathWithQuery = %q, want %q", fake.sent[0].PathWithQuery, want)
+	}
+}
+
+func TestCheckOneCallInvalidExclude(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true")
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	var resp ErrorResponse
+	if err := json.Unmarshal([]byte(checkOneCall(52.37, 4.89, "metric", "weekly", cm.None[string]())), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != ERR_INVALID_EXCLUDE {
+		t.Errorf("code = %q, want %s", resp.Code, ERR_INVALID_EXCLUDE)
+	}
+	if len(fake.sent) != 0 {
+		t.Errorf("sent %d requests, want none for an invalid exclude", len(fake.sent))
+	}
+}
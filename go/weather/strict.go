@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// STRICT_JSON modes. Lenient, the default, ignores fields the plugin doesn't
+// know; "warn" reports the first one in warnings and "error" fails the call.
+const (
+	STRICT_JSON_WARN  = "warn"
+	STRICT_JSON_ERROR = "error"
+)
+
+// currentWeatherSchema lists every field OpenWeather documents for current
+// weather, so strict parsing flags only fields that are actually new. Values
+// are left raw: types are checked by parseWeather, not here.
+type currentWeatherSchema struct {
+	Coord struct {
+		Lon json.RawMessage `json:"lon"`
+		Lat json.RawMessage `json:"lat"`
+	} `json:"coord"`
+	Weather []struct {
+		ID          json.RawMessage `json:"id"`
+		Main        json.RawMessage `json:"main"`
+		Description json.RawMessage `json:"description"`
+		Icon        json.RawMessage `json:"icon"`
+	} `json:"weather"`
+	Base json.RawMessage `json:"base"`
+	Main struct {
+		Temp      json.RawMessage `json:"temp"`
+		FeelsLike json.RawMessage `json:"feels_like"`
+		TempMin   json.RawMessage `json:"temp_min"`
+		TempMax   json.RawMessage `json:"temp_max"`
+		Pressure  json.RawMessage `json:"pressure"`
+		Humidity  json.RawMessage `json:"humidity"`
+		SeaLevel  json.RawMessage `json:"sea_level"`
+		GrndLevel json.RawMessage `json:"grnd_level"`
+	} `json:"main"`
+	Visibility json.RawMessage `json:"visibility"`
+	Wind       struct {
+		Speed json.RawMessage `json:"speed"`
+		Deg   json.RawMessage `json:"deg"`
+		Gust  json.RawMessage `json:"gust"`
+	} `json:"wind"`
+	Clouds struct {
+		All json.RawMessage `json:"all"`
+	} `json:"clouds"`
+	Rain struct {
+		OneHour   json.RawMessage `json:"1h"`
+		ThreeHour json.RawMessage `json:"3h"`
+	} `json:"rain"`
+	Snow struct {
+		OneHour   json.RawMessage `json:"1h"`
+		ThreeHour json.RawMessage `json:"3h"`
+	} `json:"snow"`
+	Dt  json.RawMessage `json:"dt"`
+	Sys struct {
+		Type    json.RawMessage `json:"type"`
+		ID      json.RawMessage `json:"id"`
+		Message json.RawMessage `json:"message"`
+		Country json.RawMessage `json:"country"`
+		Sunrise json.RawMessage `json:"sunrise"`
+		Sunset  json.RawMessage `json:"sunset"`
+	} `json:"sys"`
+	Timezone json.RawMessage `json:"timezone"`
+	ID       json.RawMessage `json:"id"`
+	Name     json.RawMessage `json:"name"`
+	Cod      json.RawMessage `json:"cod"`
+}
+
+// strictJSONMode reads STRICT_JSON; anything but "warn" or "error" is lenient
+func strictJSONMode() string {
+	mode := strings.ToLower(strings.TrimSpace(getEnvVar("STRICT_JSON")))
+	if mode == STRICT_JSON_WARN || mode == STRICT_JSON_ERROR {
+		return mode
+	}
+	return ""
+}
+
+// unexpectedField decodes body into schema, rejecting unknown fields, and
+// returns the name of the first field schema doesn't describe. Other decode
+// errors are ignored; the lenient parse reports those.
+func unexpectedField(body []byte, schema any) string {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(schema)
+	if err == nil {
+		return ""
+	}
+	field, found := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !found {
+		return ""
+	}
+	return strings.Trim(field, `"`)
+}
+
+// checkStrict applies STRICT_JSON to an upstream body that already parsed
+// leniently, appending to warnings in warn mode or returning an
+// UNEXPECTED_FIELD error in error mode
+func checkStrict(body []byte, schema any, what string, warnings *[]string) error {
+	mode := strictJSONMode()
+	if mode == "" {
+		return nil
+	}
+	field := unexpectedField(body, schema)
+	if field == "" {
+		return nil
+	}
+	message := fmt.Sprintf("unexpected field %q in %s response", field, what)
+	if mode == STRICT_JSON_ERROR {
+		return &PluginError{Code: ERR_UNEXPECTED_FIELD, Message: message}
+	}
+	*warnings = append(*warnings, message)
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStrictJSONMode(t *testing.T) {
+	tests := map[string]string{
+		"":        "",
+		" Warn ":  STRICT_JSON_WARN,
+		"ERROR":   STRICT_JSON_ERROR,
+		"true":    "",
+		"lenient": "",
+	}
+	for value, want := range tests {
+		setEnv(t, "STRICT_JSON", value)
+		if got := strictJSONMode(); got != want {
+			t.Errorf("strictJSONMode(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestUnexpectedField(t *testing.T) {
+	if field := unexpectedField([]byte(CAPTURED_CURRENT), &currentWeatherSchema{}); field != "" {
+		t.Errorf("unexpectedField(captured) = %q, want every field known", field)
+	}
+	// Nested fields are checked as well as top-level ones
+	body := strings.Replace(CAPTURED_CURRENT, `"feels_like":11.9`, `"feels_like":11.9,"dew_point":9.4`, 1)
+	if field := unexpectedField([]byte(body), &currentWeatherSchema{}); field != "dew_point" {
+		t.Errorf("unexpectedField() = %q, want dew_point", field)
+	}
+	// Type mismatches are parseWeather's to report, not strict mode's
+	if field := unexpectedField([]byte(`{"coord":"London"}`), &currentWeatherSchema{}); field != "" {
+		t.Errorf("unexpectedField(type mismatch) = %q, want none", field)
+	}
+}
+
+func TestParseWeatherStrict(t *testing.T) {
+	body := strings.Replace(CAPTURED_CURRENT, `"cod":200`, `"cod":200,"alerts_url":"https://example.com"`, 1)
+
+	setEnv(t)
+	weather, err := parseWeather([]byte(body), "metric")
+	if err != nil || len(weather.Warnings) != 0 {
+		t.Errorf("lenient: %+v, %v, want the field ignored", weather, err)
+	}
+
+	setEnv(t, "STRICT_JSON", "warn")
+	weather, err = parseWeather([]byte(body), "metric")
+	if err != nil {
+		t.Fatalf("warn: parseWeather() error = %v", err)
+	}
+	if len(weather.Warnings) != 1 || !strings.Contains(weather.Warnings[0], `"alerts_url"`) {
+		t.Errorf("warn: warnings = %v, want alerts_url named", weather.Warnings)
+	}
+
+	setEnv(t, "STRICT_JSON", "error")
+	_, err = parseWeather([]byte(body), "metric")
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) || pluginErr.Code != ERR_UNEXPECTED_FIELD {
+		t.Errorf("error: parseWeather() error = %v, want %s", err, ERR_UNEXPECTED_FIELD)
+	}
+
+	// A response with only documented fields passes either way
+	if _, err := parseWeather([]byte(CAPTURED_CURRENT), "metric"); err != nil {
+		t.Errorf("error: parseWeather(captured) error = %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	weathercomponent "github.com/my_org/weather/gen/example/weather/weather-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// ERR_DRY_RUN marks the typed error carrying a dry-run request, since the
+// typed export can't return the request in place of a weather record
+const ERR_DRY_RUN = "DRY_RUN"
+
+type typedWeatherResult = cm.Result[weathercomponent.WeatherResultShape, weathercomponent.WeatherResult, weathercomponent.WeatherError]
+
+// toWeatherResult converts a WeatherResponse into the typed WIT record
+func toWeatherResult(weather *WeatherResponse) weathercomponent.WeatherResult {
+	result := weathercomponent.WeatherResult{
+		Location:             weather.Location,
+		Temperature:          weather.Temperature,
+		FeelsLikeTemperature: weather.FeelsLikeTemperature,
+		WindSpeed:            cm.None[float64](),
+		WindDegrees:          cm.None[uint32](),
+		Humidity:             cm.None[uint32](),
+		Unit:                 weather.Unit,
+		WeatherConditions:    cm.ToList(weather.WeatherConditions),
+	}
+	conditions := make([]weathercomponent.WeatherCondition, len(weather.Conditions))
+	for i, condition := range weather.Conditions {
+		conditions[i] = weathercomponent.WeatherCondition{
+			ID:          uint32(condition.ID),
+			Main:        condition.Main,
+			Description: condition.Description,
+			Icon:        condition.Icon,
+		}
+	}
+	result.Conditions = cm.ToList(conditions)
+	if weather.WindSpeed != nil {
+		result.WindSpeed = cm.Some(*weather.WindSpeed)
+	}
+	if weather.WindDegrees != nil {
+		result.WindDegrees = cm.Some(uint32(*weather.WindDegrees))
+	}
+	if weather.Humidity != nil {
+		result.Humidity = cm.Some(uint32(*weather.Humidity))
+	}
+	return result
+}
+
+// toWeatherError converts an error into the typed WIT error record with the
+// same message and code errorJSON would produce
+func toWeatherError(message string, err error) typedWeatherResult {
+	var dryRun *DryRunError
+	if errors.As(err, &dryRun) {
+		request, _ := json.Marshal(dryRun.Request)
+		return cm.Err[typedWeatherResult](weathercomponent.WeatherError{Message: string(request), Code: ERR_DRY_RUN, RetryAfter: cm.None[uint32]()})
+	}
+
+	resp := newErrorResponse(message, err)
+	weatherErr := weathercomponent.WeatherError{Message: resp.Error, Code: resp.Code, RetryAfter: cm.None[uint32]()}
+	if resp.RetryAfter > 0 {
+		weatherErr.RetryAfter = cm.Some(uint32(resp.RetryAfter))
+	}
+	return cm.Err[typedWeatherResult](weatherErr)
+}
+
+// checkWeatherTyped is check-weather returning a WIT record instead of JSON
+func checkWeatherTyped(location string, unit string, keyOverride cm.Option[string]) typedWeatherResult {
+	startRequest()
+
+	apiKey := callAPIKey(keyOverride)
+	if apiKey == "" {
+		return toWeatherError(missingAPIKey())
+	}
+
+	unit, err := resolveUnit(unit)
+	if err != nil {
+		return toWeatherError("Invalid configuration", err)
+	}
+
+	weather, err := getWeather(apiKey, location, unit)
+	if err != nil {
+		return toWeatherError("Failed to fetch weather", err)
+	}
+
+	return cm.OK[typedWeatherResult](toWeatherResult(weather))
+}
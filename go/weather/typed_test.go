@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	weathercomponent "github.com/my_org/weather/gen/example/weather/weather-component"
+	"go.bytecodealliance.org/cm"
+)
+
+func TestCheckWeatherTyped(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	useTransport(t, fake)
+
+	result := checkWeatherTyped("London", "metric", cm.None[string]())
+	if result.IsErr() {
+		t.Fatalf("checkWeatherTyped() error = %+v", *result.Err())
+	}
+	weather := result.OK()
+	if weather.Location != "London" || weather.Temperature != 12.5 || weather.Unit != "metric" {
+		t.Errorf("result = %+v, want London at 12.5 metric", weather)
+	}
+	if humidity := weather.Humidity.Some(); humidity == nil || *humidity != 81 {
+		t.Errorf("Humidity = %v, want 81", humidity)
+	}
+	if degrees := weather.WindDegrees.Some(); degrees == nil || *degrees != 230 {
+		t.Errorf("WindDegrees = %v, want 230", degrees)
+	}
+	if conditions := weather.WeatherConditions.Slice(); len(conditions) != 1 || conditions[0] != "light rain" {
+		t.Errorf("WeatherConditions = %v, want [light rain]", conditions)
+	}
+	want := weathercomponent.WeatherCondition{ID: 500, Main: "Rain", Description: "light rain", Icon: "10d"}
+	if conditions := weather.Conditions.Slice(); len(conditions) != 1 || conditions[0] != want {
+		t.Errorf("Conditions = %+v, want [%+v]", conditions, want)
+	}
+}
+
+func TestCheckWeatherTypedError(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	notFound := fakeResponse{status: 404, body: `{"cod":"404","message":"city not found"}`}
+	fake.respond(OPENWEATHER_PATH, notFound, notFound)
+	useTransport(t, fake)
+
+	result := checkWeatherTyped("Lodnon", "metric", cm.None[string]())
+	if !result.IsErr() {
+		t.Fatalf("checkWeatherTyped() = %+v, want an error", *result.OK())
+	}
+	// The typed error carries the same message and code as the JSON one
+	var want ErrorResponse
+	if err := json.Unmarshal([]byte(checkWeather("Lodnon", "metric", weathercomponent.WeatherOptions{})), &want); err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Err(); got.Code != ERR_LOCATION_NOT_FOUND || got.Code != want.Code || got.Message != want.Error {
+		t.Errorf("error = %+v, want %+v", *got, want)
+	}
+}
+
+func TestCheckWeatherTypedDryRun(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", "DRY_RUN", "true")
+
+	result := checkWeatherTyped("London", "metric", cm.None[string]())
+	if !result.IsErr() || result.Err().Code != ERR_DRY_RUN {
+		t.Fatalf("checkWeatherTyped() = %+v, want a %s error", result, ERR_DRY_RUN)
+	}
+	var request DryRunRequest
+	if err := json.Unmarshal([]byte(result.Err().Message), &request); err != nil {
+		t.Fatalf("dry-run message is not a request: %v", err)
+	}
+	if !request.DryRun || request.Method != "GET" {
+		t.Errorf("request = %+v, want a dry-run GET", request)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.bytecodealliance.org/cm"
+)
+
+// OneCallUVResponse is the part of a One Call payload holding UV indexes.
+// OpenWeather leaves uvi out where it has no reading, so both are pointers.
+type OneCallUVResponse struct {
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Timezone string  `json:"timezone"`
+	Current  struct {
+		UVI *float64 `json:"uvi"`
+	} `json:"current"`
+	Daily []struct {
+		Dt  int64    `json:"dt"`
+		UVI *float64 `json:"uvi"`
+	} `json:"daily"`
+}
+
+type DailyUVResponse struct {
+	Lat      float64   `json:"lat"`
+	Lon      float64   `json:"lon"`
+	Timezone string    `json:"timezone"`
+	Daily    []DailyUV `json:"daily"`
+}
+
+// DailyUV is the forecast maximum UV index for one day; UVIndex is omitted
+// when OpenWeather has no value for the day
+type DailyUV struct {
+	Time    int64    `json:"time"`
+	UVIndex *float64 `json:"uv_index,omitempty"`
+}
+
+// parseOneCallUV decodes the UV fields of a One Call body
+func parseOneCallUV(body []byte) (*OneCallUVResponse, error) {
+	var uv OneCallUVResponse
+	if err := json.Unmarshal(body, &uv); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
+	}
+	return &uv, nil
+}
+
+// getCurrentUV returns the current UV index at a point, or nil when One Call
+// doesn't report one
+func getCurrentUV(apiKey string, lat float64, lon float64) (*float64, error) {
+	// Only the current block is needed
+	body, err := fetchOneCallBody(apiKey, lat, lon, "metric", []string{"minutely", "hourly", "daily", "alerts"})
+	if err != nil {
+		return nil, err
+	}
+	uv, err := parseOneCallUV(body)
+	if err != nil {
+		return nil, err
+	}
+	return uv.Current.UVI, nil
+}
+
+// normalizeDailyUV shapes One Call's daily block into a list of UV indexes.
+// A missing daily block is an empty list.
+func normalizeDailyUV(uv *OneCallUVResponse) *DailyUVResponse {
+	response := &DailyUVResponse{
+		Lat:      uv.Lat,
+		Lon:      uv.Lon,
+		Timezone: uv.Timezone,
+		Daily:    make([]DailyUV, 0, len(uv.Daily)),
+	}
+	for _, day := range uv.Daily {
+		response.Daily = append(response.Daily, DailyUV{Time: day.Dt, UVIndex: day.UVI})
+	}
+	return response
+}
+
+func getDailyUV(apiKey string, lat float64, lon float64) (*DailyUVResponse, error) {
+	// Only the daily block is needed
+	body, err := fetchOneCallBody(apiKey, lat, lon, "metric", []string{"current", "minutely", "hourly", "alerts"})
+	if err != nil {
+		return nil, err
+	}
+	uv, err := parseOneCallUV(body)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeDailyUV(uv), nil
+}
+
+// checkDailyUV returns the daily maximum UV index forecast for a point
+func checkDailyUV(lat float64, lon float64, keyOverride cm.Option[string]) string {
+	startRequest()
+
+	if err := checkFeature(FEATURE_FORECAST); err != nil {
+		return errorJSON("Export disabled", err)
+	}
+
+	apiKey := callAPIKey(keyOverride)
+	if apiKey == "" {
+		return errorJSON(missingAPIKey())
+	}
+
+	if err := validateCoordinates(lat, lon); err != nil {
+		return errorJSON("Invalid coordinates", err)
+	}
+
+	uv, err := getDailyUV(apiKey, lat, lon)
+	if err != nil {
+		return errorJSON("Failed to fetch UV index", err)
+	}
+
+	result, err := marshalJSON(uv)
+	if err != nil {
+		return errorJSON("Failed to serialize response", err)
+	}
+	return string(result)
+}
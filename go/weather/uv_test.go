@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	weathercomponent "github.com/my_org/weather/gen/example/weather/weather-component"
+	"go.bytecodealliance.org/cm"
+)
+
+// One Call's daily block for London with the other blocks excluded; the
+// third day has no UV reading yet
+const CAPTURED_ONECALL_UV_DAILY = `{"lat":51.5085,"lon":-0.1257,"timezone":"Europe/London","timezone_offset":0,
+  "daily":[{"dt":1700049600,"uvi":1.2},{"dt":1700136000,"uvi":0.87},{"dt":1700222400}]}`
+
+// sentQuery parses the query string of the request sent to path
+func sentQuery(t *testing.T, fake *fakeTransport, path string) url.Values {
+	t.Helper()
+	for _, req := range fake.sent {
+		if before, query, _ := strings.Cut(req.PathWithQuery, "?"); before == path {
+			values, err := url.ParseQuery(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return values
+		}
+	}
+	t.Fatalf("no request sent to %s", path)
+	return nil
+}
+
+func TestNormalizeDailyUV(t *testing.T) {
+	uv, err := parseOneCallUV([]byte(CAPTURED_ONECALL_UV_DAILY))
+	if err != nil {
+		t.Fatalf("parseOneCallUV() error = %v", err)
+	}
+	daily := normalizeDailyUV(uv)
+	if daily.Lat != 51.5085 || daily.Timezone != "Europe/London" || len(daily.Daily) != 3 {
+		t.Fatalf("daily = %+v, want three days for London", daily)
+	}
+	if day := daily.Daily[1]; day.Time != 1700136000 || day.UVIndex == nil || *day.UVIndex != 0.87 {
+		t.Errorf("daily[1] = %+v, want 0.87", day)
+	}
+	// A missing reading stays missing rather than reading as zero
+	if day := daily.Daily[2]; day.UVIndex != nil {
+		t.Errorf("daily[2] uv_index = %v, want none", *day.UVIndex)
+	}
+
+	uv, _ = parseOneCallUV([]byte(`{"lat":0,"lon":0}`))
+	if daily := normalizeDailyUV(uv); daily.Daily == nil || len(daily.Daily) != 0 {
+		t.Errorf("daily = %v, want an empty, non-null list", daily.Daily)
+	}
+}
+
+func TestCheckDailyUV(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true")
+	fake := &fakeTransport{}
+	fake.respond(ONECALL_PATH, fakeResponse{status: 200, body: CAPTURED_ONECALL_UV_DAILY})
+	useTransport(t, fake)
+
+	var daily DailyUVResponse
+	if err := json.Unmarshal([]byte(checkDailyUV(51.5085, -0.1257, cm.None[string]())), &daily); err != nil {
+		t.Fatal(err)
+	}
+	if len(daily.Daily) != 3 {
+		t.Errorf("daily = %+v, want three days", daily)
+	}
+	// Only the daily block is fetched
+	if exclude := sentQuery(t, fake, ONECALL_PATH).Get("exclude"); exclude != "current,minutely,hourly,alerts" {
+		t.Errorf("exclude = %q, want everything but daily", exclude)
+	}
+}
+
+func TestCheckDailyUVDisabled(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	var resp ErrorResponse
+	if err := json.Unmarshal([]byte(checkDailyUV(51.5085, -0.1257, cm.None[string]())), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != ERR_FEATURE_DISABLED || len(fake.sent) != 0 {
+		t.Errorf("code = %q with %d requests, want %s and none sent", resp.Code, len(fake.sent), ERR_FEATURE_DISABLED)
+	}
+}
+
+func TestCheckWeatherUVIndex(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	fake.respond(ONECALL_PATH, fakeResponse{status: 200, body: `{"lat":51.5085,"lon":-0.1257,"current":{"uvi":3.7}}`})
+	useTransport(t, fake)
+
+	options := weathercomponent.WeatherOptions{UvIndex: cm.Some(true)}
+	var weather WeatherResponse
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", options)), &weather); err != nil {
+		t.Fatal(err)
+	}
+	if weather.UVIndex == nil || *weather.UVIndex != 3.7 {
+		t.Errorf("UVIndex = %v, want 3.7", weather.UVIndex)
+	}
+	// The One Call lookup is made at the matched city's coordinates
+	query := sentQuery(t, fake, ONECALL_PATH)
+	if query.Get("lat") != "51.5085" || query.Get("lon") != "-0.1257" {
+		t.Errorf("One Call sent for %s,%s, want London's coordinates", query.Get("lat"), query.Get("lon"))
+	}
+}
+
+func TestCheckWeatherUVIndexUnavailable(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret", FEATURE_FORECAST, "true", "HTTP_MAX_ATTEMPTS", "1")
+	fake := &fakeTransport{}
+	fake.respond(OPENWEATHER_PATH, fakeResponse{status: 200, body: CAPTURED_CURRENT})
+	fake.respond(ONECALL_PATH, fakeResponse{status: 503})
+	useTransport(t, fake)
+
+	options := weathercomponent.WeatherOptions{UvIndex: cm.Some(true)}
+	var weather WeatherResponse
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", options)), &weather); err != nil {
+		t.Fatal(err)
+	}
+	if weather.Location == "" || weather.UVIndex != nil {
+		t.Errorf("weather = %+v, want the weather without a UV index", weather)
+	}
+	if len(weather.Warnings) != 1 || !strings.HasPrefix(weather.Warnings[0], "uv_index unavailable") {
+		t.Errorf("warnings = %v, want the failed UV lookup reported", weather.Warnings)
+	}
+}
+
+func TestCheckWeatherUVIndexDisabled(t *testing.T) {
+	setEnv(t, "OPENWEATHER_API_KEY", "secret")
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	options := weathercomponent.WeatherOptions{UvIndex: cm.Some(true)}
+	var resp ErrorResponse
+	if err := json.Unmarshal([]byte(checkWeather("London", "metric", options)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != ERR_FEATURE_DISABLED || len(fake.sent) != 0 {
+		t.Errorf("code = %q with %d requests, want %s and none sent", resp.Code, len(fake.sent), ERR_FEATURE_DISABLED)
+	}
+}
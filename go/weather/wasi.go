@@ -0,0 +1,258 @@
+//go:build tinygo
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/my_org/weather/gen/wasi/cli/environment"
+	monotonicclock "github.com/my_org/weather/gen/wasi/clocks/monotonic-clock"
+	outgoinghandler "github.com/my_org/weather/gen/wasi/http/outgoing-handler"
+	"github.com/my_org/weather/gen/wasi/http/types"
+	"github.com/my_org/weather/gen/wasi/io/poll"
+	"github.com/my_org/weather/gen/wasi/io/streams"
+	"go.bytecodealliance.org/cm"
+)
+
+// environ returns the environment variables the host passed in
+func environ() [][2]string {
+	return environment.GetEnvironment().Slice()
+}
+
+// transport sends the plugin's HTTP requests through WASI HTTP
+var transport Transport = wasiTransport{}
+
+type wasiTransport struct{}
+
+// Send builds the WASI request, writes its body, and hands it to the
+// outgoing handler
+func (wasiTransport) Send(req OutgoingRequest) (PendingResponse, error) {
+	req.Method = strings.ToUpper(req.Method)
+
+	// Pick the method before creating any resources, so an unsupported one
+	// fails without leaving them to drop
+	var httpMethod types.Method
+	switch req.Method {
+	case "GET":
+		httpMethod = types.MethodGet()
+	case "POST":
+		httpMethod = types.MethodPost()
+	case "HEAD":
+		httpMethod = types.MethodHead()
+	default:
+		return nil, fmt.Errorf("unsupported HTTP method %q", req.Method)
+	}
+
+	// Create headers
+	headersFields := types.NewFields()
+	for key, value := range req.Headers {
+		valueBytes := cm.ToList([]uint8(value))
+		headersFields.Append(types.FieldKey(key), types.FieldValue(valueBytes))
+	}
+
+	// Create the request
+	request := types.NewOutgoingRequest(headersFields)
+
+	// Set request properties
+	request.SetMethod(httpMethod)
+	request.SetScheme(cm.Some(types.SchemeHTTPS()))
+	request.SetAuthority(cm.Some(req.Authority))
+	request.SetPathWithQuery(cm.Some(req.PathWithQuery))
+
+	// Write body for POST requests
+	if req.Method == "POST" && len(req.Body) > 0 {
+		bodyResult := request.Body()
+		if bodyResult.IsErr() {
+			return nil, fmt.Errorf("failed to get request body: %v", bodyResult.Err())
+		}
+		outgoingBody := bodyResult.OK()
+
+		streamResult := outgoingBody.Write()
+		if streamResult.IsErr() {
+			outgoingBody.ResourceDrop()
+			return nil, fmt.Errorf("failed to get body stream: %v", streamResult.Err())
+		}
+		bodyStream := streamResult.OK()
+
+		// Write the body data
+		writeResult := bodyStream.BlockingWriteAndFlush(cm.ToList(req.Body))
+		if writeResult.IsErr() {
+			bodyStream.ResourceDrop()
+			outgoingBody.ResourceDrop()
+			return nil, fmt.Errorf("failed to write body: %v", writeResult.Err())
+		}
+
+		// Drop the stream first
+		bodyStream.ResourceDrop()
+
+		// Finish the body (this consumes the outgoing body)
+		finishResult := types.OutgoingBodyFinish(*outgoingBody, cm.None[types.Trailers]())
+		if finishResult.IsErr() {
+			// Don't drop outgoingBody here since Finish consumes it
+			return nil, fmt.Errorf("failed to finish body: %v", finishResult.Err())
+		}
+		// Don't drop outgoingBody here either since Finish consumed it
+	}
+
+	// Send the request
+	futureResponseResult := outgoinghandler.Handle(request, cm.None[types.RequestOptions]())
+	if futureResponseResult.IsErr() {
+		return nil, classifyErrorCode("failed to handle request", *futureResponseResult.Err())
+	}
+	future := *futureResponseResult.OK()
+	return &wasiPendingResponse{future: future, ready: future.Subscribe()}, nil
+}
+
+// Wait polls the responses together with a timer for the deadline. The
+// timer goes last, so the positions poll reports match pending's.
+func (wasiTransport) Wait(pending []PendingResponse, deadline time.Duration) []int {
+	timer := monotonicclock.SubscribeInstant(monotonicclock.Instant(deadline))
+	defer timer.ResourceDrop()
+
+	pollables := make([]types.Pollable, 0, len(pending)+1)
+	for _, response := range pending {
+		pollables = append(pollables, response.(*wasiPendingResponse).ready)
+	}
+	pollables = append(pollables, timer)
+
+	var ready []int
+	for _, pos := range poll.Poll(cm.ToList(pollables)).Slice() {
+		if int(pos) < len(pending) {
+			ready = append(ready, int(pos))
+		}
+	}
+	return ready
+}
+
+func (wasiTransport) Now() time.Duration {
+	return time.Duration(monotonicclock.Now())
+}
+
+// Sleep blocks for d by polling a monotonic clock timer
+func (wasiTransport) Sleep(d time.Duration) {
+	timer := monotonicclock.SubscribeDuration(monotonicclock.Duration(d.Nanoseconds()))
+	defer timer.ResourceDrop()
+	poll.Poll(cm.ToList([]types.Pollable{timer}))
+}
+
+// wasiPendingResponse is a future response and the pollable that reports
+// it ready
+type wasiPendingResponse struct {
+	future   types.FutureIncomingResponse
+	ready    types.Pollable
+	response *wasiIncomingResponse
+}
+
+func (p *wasiPendingResponse) Response() (IncomingResponse, error) {
+	// Get the response
+	optionResult := p.future.Get()
+	result := optionResult.Some()
+	if result == nil {
+		// Callers only read futures their poll reported ready
+		return nil, fmt.Errorf("response was read before it was ready")
+	}
+
+	// Handle the response
+	if result.IsErr() {
+		return nil, fmt.Errorf("request failed: %v", result.Err())
+	}
+
+	responseResult := result.OK()
+	if responseResult.IsErr() {
+		return nil, classifyErrorCode("HTTP error", *responseResult.Err())
+	}
+
+	// Copy the headers out so their resource can be dropped before the
+	// body is consumed
+	response := *responseResult.OK()
+	fields := response.Headers()
+	headers := make(map[string]string)
+	for _, entry := range fields.Entries().Slice() {
+		name := strings.ToLower(string(entry.F0))
+		if _, seen := headers[name]; !seen {
+			headers[name] = string(cm.List[uint8](entry.F1).Slice())
+		}
+	}
+	fields.ResourceDrop()
+
+	p.response = &wasiIncomingResponse{response: response, headers: headers}
+	return p.response, nil
+}
+
+// Close drops the response's resources, children before parents
+func (p *wasiPendingResponse) Close() {
+	if p.response != nil {
+		p.response.close()
+	}
+	// The pollable is a child of the future and must be dropped first
+	p.ready.ResourceDrop()
+	p.future.ResourceDrop()
+}
+
+// wasiIncomingResponse reads a response body through its input stream,
+// which is opened on the first Read
+type wasiIncomingResponse struct {
+	response types.IncomingResponse
+	headers  map[string]string
+	opened   bool
+	body     types.IncomingBody
+	stream   streams.InputStream
+	readable types.Pollable
+}
+
+func (r *wasiIncomingResponse) Status() int {
+	return int(r.response.Status())
+}
+
+func (r *wasiIncomingResponse) Header(name string) string {
+	return r.headers[strings.ToLower(name)]
+}
+
+func (r *wasiIncomingResponse) Read() ([]byte, error) {
+	if !r.opened {
+		// Consume the body
+		bodyResult := r.response.Consume()
+		if bodyResult.IsErr() {
+			return nil, fmt.Errorf("failed to consume body: %v", bodyResult.Err())
+		}
+		body := *bodyResult.OK()
+
+		streamResult := body.Stream()
+		if streamResult.IsErr() {
+			body.ResourceDrop()
+			return nil, fmt.Errorf("failed to get stream: %v", streamResult.Err())
+		}
+		r.body = body
+		r.stream = *streamResult.OK()
+		r.readable = r.stream.Subscribe()
+		r.opened = true
+	}
+
+	readResult := r.stream.Read(65536)
+	if readResult.IsErr() {
+		if readResult.Err().Closed() {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read response body: %v", readResult.Err())
+	}
+	return readResult.OK().Slice(), nil
+}
+
+// WaitReadable polls the stream together with a timer for the deadline
+func (r *wasiIncomingResponse) WaitReadable(deadline time.Duration) {
+	timer := monotonicclock.SubscribeInstant(monotonicclock.Instant(deadline))
+	defer timer.ResourceDrop()
+	poll.Poll(cm.ToList([]types.Pollable{r.readable, timer}))
+}
+
+func (r *wasiIncomingResponse) close() {
+	if r.opened {
+		r.readable.ResourceDrop()
+		r.stream.ResourceDrop()
+		r.body.ResourceDrop()
+	}
+	r.response.ResourceDrop()
+}